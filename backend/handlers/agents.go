@@ -200,10 +200,9 @@ func (h *AgentHandler) PauseAgent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logActivity(id, "agent_paused", "", map[string]string{"previous_status": currentStatus})
-	go LogAudit("user", "agent_paused", "agent", id, map[string]interface{}{"previous_status": currentStatus})
-	go TriggerWebhooks("agent_paused", map[string]interface{}{
-		"event":    "agent_paused",
-		"agent_id": id,
+	go LogAudit(getAgentFromContext(r), "agent_paused", "agent", id, map[string]interface{}{"previous_status": currentStatus})
+	go TriggerWebhooks(EventAgentPaused, map[string]interface{}{
+		"agent_id": id, "previous_status": currentStatus, "actor": getAgentFromContext(r),
 	})
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Agent paused"})
 }
@@ -225,7 +224,10 @@ func (h *AgentHandler) ResumeAgent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logActivity(id, "agent_resumed", "", map[string]string{"previous_status": currentStatus})
-	go LogAudit("user", "agent_resumed", "agent", id, map[string]interface{}{"previous_status": currentStatus})
+	go LogAudit(getAgentFromContext(r), "agent_resumed", "agent", id, map[string]interface{}{"previous_status": currentStatus})
+	go TriggerWebhooks(EventAgentResumed, map[string]interface{}{
+		"agent_id": id, "previous_status": currentStatus, "actor": getAgentFromContext(r),
+	})
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Agent resumed"})
 }
 
@@ -246,10 +248,9 @@ func (h *AgentHandler) KillAgent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logActivity(id, "agent_killed", "", map[string]string{"previous_status": currentStatus})
-	go LogAudit("user", "agent_killed", "agent", id, map[string]interface{}{"previous_status": currentStatus})
-	go TriggerWebhooks("agent_killed", map[string]interface{}{
-		"event":    "agent_killed",
-		"agent_id": id,
+	go LogAudit(getAgentFromContext(r), "agent_killed", "agent", id, map[string]interface{}{"previous_status": currentStatus})
+	go TriggerWebhooks(EventAgentKilled, map[string]interface{}{
+		"agent_id": id, "previous_status": currentStatus, "actor": getAgentFromContext(r),
 	})
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Agent killed"})
 }
@@ -276,18 +277,31 @@ func (h *AgentHandler) UpdateAgentStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if _, err := db.DB.Exec(
-		`UPDATE agents SET status = $1, last_active = NOW() WHERE id = $2`,
-		data.Status, id); err != nil {
+	var previous string
+	err := db.DB.QueryRow(
+		`UPDATE agents a SET status = $1, last_active = NOW() FROM agents old
+		 WHERE a.id = $2 AND old.id = a.id
+		 RETURNING COALESCE(old.status, '')`,
+		data.Status, id).Scan(&previous)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Agent not found")
+		return
+	}
+	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	logActivity(id, "status_changed", "", map[string]string{"status": data.Status})
+	if previous != data.Status {
+		go TriggerWebhooks(EventAgentStatusChanged, map[string]interface{}{
+			"agent_id": id, "from": previous, "to": data.Status, "source": "api",
+		})
+	}
 
 	// Trigger agent_offline webhook when agent goes offline
 	if data.Status == "offline" {
-		go TriggerWebhooks("agent_offline", map[string]interface{}{
+		go TriggerWebhooks(EventAgentOffline, map[string]interface{}{
 			"agent_id": id,
 			"status":   "offline",
 		})
@@ -1,18 +1,31 @@
 package handlers
 
 import (
-	"bytes"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
+	"strings"
 	"time"
 
 	"github.com/alghanim/agentboard/backend/db"
 	"github.com/alghanim/agentboard/backend/websocket"
 )
 
+// alertConditionTypes are the rule conditions evaluateAlerts handles.
+var alertConditionTypes = map[string]bool{
+	"no_heartbeat":            true,
+	"error_rate":              true,
+	"task_stuck":              true,
+	"login_bruteforce":        true,
+	"sla_breach":              true,
+	"cost_threshold_exceeded": true,
+	"agent_idle":              true,
+	"expression":              true,
+}
+
+// costWindows are the calendar periods (UTC) cost rules sum over.
+var costWindows = map[string]bool{"hour": true, "day": true, "month": true}
+
 // StartAlertEvaluator runs alert rule evaluation every 60 seconds.
 func StartAlertEvaluator(hub *websocket.Hub) {
 	log.Println("[alerts] Alert evaluator started")
@@ -27,10 +40,12 @@ func StartAlertEvaluator(hub *websocket.Hub) {
 	}
 }
 
-// evaluateAlerts checks all enabled alert rules.
+// evaluateAlerts checks all enabled alert rules. Each evaluateX function
+// fires the alerts whose condition holds and returns false if it couldn't
+// evaluate the rule; open alerts it didn't fire again are then resolved.
 func evaluateAlerts(hub *websocket.Hub) {
 	rows, err := db.DB.Query(`
-		SELECT id, name, agent_id, condition_type, threshold, notify_webhook_id
+		SELECT id, name, agent_id, condition_type, threshold, time_window, scope, expression, notify_webhook_id
 		FROM alert_rules
 		WHERE enabled = true
 	`)
@@ -46,33 +61,67 @@ func evaluateAlerts(hub *websocket.Hub) {
 		AgentID         sql.NullString
 		ConditionType   string
 		Threshold       int
+		Window          string
+		Scope           string
+		Expression      sql.NullString
 		WebhookID       sql.NullString
 	}
 
 	var rules []ruleRow
 	for rows.Next() {
 		var r ruleRow
-		if err := rows.Scan(&r.ID, &r.Name, &r.AgentID, &r.ConditionType, &r.Threshold, &r.WebhookID); err != nil {
+		if err := rows.Scan(&r.ID, &r.Name, &r.AgentID, &r.ConditionType, &r.Threshold, &r.Window, &r.Scope, &r.Expression, &r.WebhookID); err != nil {
 			continue
 		}
 		rules = append(rules, r)
 	}
 	rows.Close()
 
+	// Efficiency scores are computed at most once per pass, and only when a rule needs them
+	env := &metricEnv{}
+
+	// Alerts of disabled rules are closed without notifying
+	db.DB.Exec(`
+		UPDATE alert_history SET state = 'resolved', resolved_at = NOW(), silenced_until = NULL
+		WHERE state <> 'resolved' AND rule_id IN (SELECT id FROM alert_rules WHERE enabled = false)
+	`)
+
 	for _, rule := range rules {
+		var passStart time.Time
+		if err := db.DB.QueryRow(`SELECT NOW()`).Scan(&passStart); err != nil {
+			log.Printf("[alerts] Error reading database time: %v", err)
+			return
+		}
+
+		ok := false
 		switch rule.ConditionType {
 		case "no_heartbeat":
-			evaluateNoHeartbeat(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.WebhookID)
+			ok = evaluateNoHeartbeat(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.WebhookID)
 		case "error_rate":
-			evaluateErrorRate(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.WebhookID)
+			ok = evaluateErrorRate(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.WebhookID)
 		case "task_stuck":
-			evaluateTaskStuck(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.WebhookID)
+			ok = evaluateTaskStuck(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.WebhookID)
+		case "login_bruteforce":
+			ok = evaluateLoginBruteforce(hub, rule.ID, rule.Name, rule.Threshold, rule.WebhookID)
+		case "sla_breach":
+			ok = evaluateSLABreach(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.WebhookID)
+		case "cost_threshold_exceeded":
+			ok = evaluateCostThreshold(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.Window, rule.Scope, rule.WebhookID)
+		case "agent_idle":
+			ok = evaluateAgentIdle(hub, rule.ID, rule.Name, rule.AgentID, rule.Threshold, rule.WebhookID)
+		case "expression":
+			ok = evaluateExpressionRule(hub, env, rule.ID, rule.Name, rule.AgentID, rule.Expression.String, rule.WebhookID)
+		}
+
+		// A failed evaluation says nothing about whether conditions cleared
+		if ok {
+			resolveClearedAlerts(hub, rule.ID, rule.Name, rule.WebhookID, passStart)
 		}
 	}
 }
 
 // evaluateNoHeartbeat checks if an agent hasn't been active in N minutes.
-func evaluateNoHeartbeat(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, thresholdMinutes int, webhookID sql.NullString) {
+func evaluateNoHeartbeat(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, thresholdMinutes int, webhookID sql.NullString) bool {
 	cutoff := time.Now().Add(-time.Duration(thresholdMinutes) * time.Minute)
 
 	var query string
@@ -99,7 +148,7 @@ func evaluateNoHeartbeat(hub *websocket.Hub, ruleID, ruleName string, agentID sq
 	rows, err := db.DB.Query(query, args...)
 	if err != nil {
 		log.Printf("[alerts] no_heartbeat query error: %v", err)
-		return
+		return false
 	}
 	defer rows.Close()
 
@@ -113,10 +162,11 @@ func evaluateNoHeartbeat(hub *websocket.Hub, ruleID, ruleName string, agentID sq
 			agID, thresholdMinutes, lastActive.Format(time.RFC3339))
 		insertAlertAndNotify(hub, ruleID, ruleName, agID, msg, webhookID)
 	}
+	return true
 }
 
 // evaluateErrorRate checks if an agent has too many errors in the last hour.
-func evaluateErrorRate(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, threshold int, webhookID sql.NullString) {
+func evaluateErrorRate(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, threshold int, webhookID sql.NullString) bool {
 	cutoff := time.Now().Add(-time.Hour)
 
 	var query string
@@ -148,7 +198,7 @@ func evaluateErrorRate(hub *websocket.Hub, ruleID, ruleName string, agentID sql.
 	rows, err := db.DB.Query(query, args...)
 	if err != nil {
 		log.Printf("[alerts] error_rate query error: %v", err)
-		return
+		return false
 	}
 	defer rows.Close()
 
@@ -169,10 +219,11 @@ func evaluateErrorRate(hub *websocket.Hub, ruleID, ruleName string, agentID sql.
 			}
 		}(agID, msg)
 	}
+	return true
 }
 
 // evaluateTaskStuck checks if tasks have been in progress for too long.
-func evaluateTaskStuck(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, thresholdMinutes int, webhookID sql.NullString) {
+func evaluateTaskStuck(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, thresholdMinutes int, webhookID sql.NullString) bool {
 	cutoff := time.Now().Add(-time.Duration(thresholdMinutes) * time.Minute)
 
 	var query string
@@ -182,7 +233,7 @@ func evaluateTaskStuck(hub *websocket.Hub, ruleID, ruleName string, agentID sql.
 		query = `
 			SELECT id, title, assignee, updated_at
 			FROM tasks
-			WHERE status = 'progress'
+			WHERE status IN ` + sqlStatusList(StatusActive) + `
 			  AND assignee = $1
 			  AND updated_at < $2
 		`
@@ -191,7 +242,7 @@ func evaluateTaskStuck(hub *websocket.Hub, ruleID, ruleName string, agentID sql.
 		query = `
 			SELECT id, title, assignee, updated_at
 			FROM tasks
-			WHERE status = 'progress'
+			WHERE status IN ` + sqlStatusList(StatusActive) + `
 			  AND updated_at < $1
 		`
 		args = []interface{}{cutoff}
@@ -200,7 +251,7 @@ func evaluateTaskStuck(hub *websocket.Hub, ruleID, ruleName string, agentID sql.
 	rows, err := db.DB.Query(query, args...)
 	if err != nil {
 		log.Printf("[alerts] task_stuck query error: %v", err)
-		return
+		return false
 	}
 	defer rows.Close()
 
@@ -218,34 +269,279 @@ func evaluateTaskStuck(hub *websocket.Hub, ruleID, ruleName string, agentID sql.
 		elapsed := int(time.Since(updatedAt).Minutes())
 		msg := fmt.Sprintf("Task '%s' (assignee: %s) has been in-progress for %d minutes (threshold: %d)",
 			title, agID, elapsed, thresholdMinutes)
+		// One alert per task, so each stuck task notifies and resolves on its own
+		fireAlert(hub, ruleID, ruleName, taskID, agID, msg, webhookID)
+	}
+	return true
+}
+
+// evaluateLoginBruteforce fires when a single IP or account has at least
+// threshold failed sign-ins or API key attempts in the lockout window.
+func evaluateLoginBruteforce(hub *websocket.Hub, ruleID, ruleName string, threshold int, webhookID sql.NullString) bool {
+	rows, err := db.DB.Query(`
+		SELECT 'ip ' || (details->>'ip'), COUNT(*)
+		FROM audit_logs
+		WHERE action IN ('login_failed', 'api_key_failed') AND timestamp >= $1 AND details->>'ip' IS NOT NULL
+		GROUP BY details->>'ip'
+		HAVING COUNT(*) >= $2
+		UNION ALL
+		SELECT 'account ' || entity_id, COUNT(*)
+		FROM audit_logs
+		WHERE action = 'login_failed' AND timestamp >= $1 AND entity_id IS NOT NULL
+		GROUP BY entity_id
+		HAVING COUNT(*) >= $2
+		ORDER BY 2 DESC
+		LIMIT 5
+	`, time.Now().Add(-authFailureWindow), threshold)
+	if err != nil {
+		log.Printf("[alerts] login_bruteforce query error: %v", err)
+		return false
+	}
+	defer rows.Close()
+
+	var sources []string
+	for rows.Next() {
+		var source string
+		var count int
+		if err := rows.Scan(&source, &count); err != nil {
+			continue
+		}
+		sources = append(sources, fmt.Sprintf("%s (%d)", source, count))
+	}
+	if len(sources) == 0 {
+		return true
+	}
+	msg := fmt.Sprintf("Possible brute-force: failed sign-in attempts in the last %d minutes from %s (threshold: %d)",
+		int(authFailureWindow.Minutes()), strings.Join(sources, ", "), threshold)
+	insertAlertAndNotify(hub, ruleID, ruleName, "", msg, webhookID)
+	return true
+}
+
+// costWindowStart returns the start of the UTC calendar period holding now.
+func costWindowStart(now time.Time, window string) time.Time {
+	now = now.UTC()
+	switch window {
+	case "hour":
+		return now.Truncate(time.Hour)
+	case "month":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// evaluateCostThreshold fires when spend in the current hour, day or month
+// exceeds threshold USD, per agent or for the fleet. Spend comes from
+// agent_costs and from session token usage; agents often report the same
+// usage both ways, so the larger of the two is taken per agent rather than
+// their sum.
+func evaluateCostThreshold(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, threshold int, window, scope string, webhookID sql.NullString) bool {
+	since := costWindowStart(time.Now(), window)
+	filter := ""
+	if agentID.Valid && agentID.String != "" {
+		filter = agentID.String
+	}
+
+	reported := map[string]float64{}
+	rows, err := db.DB.Query(`
+		SELECT agent_id, COALESCE(SUM(cost_usd), 0)
+		FROM agent_costs
+		WHERE created_at >= $1 AND ($2 = '' OR agent_id = $2)
+		GROUP BY agent_id
+	`, since, filter)
+	if err != nil {
+		log.Printf("[alerts] cost_threshold_exceeded query error: %v", err)
+		return false
+	}
+	for rows.Next() {
+		var agID string
+		var cost float64
+		if err := rows.Scan(&agID, &cost); err == nil {
+			reported[agID] = cost
+		}
+	}
+	rows.Close()
+
+	parsed, err := tokenSpendByAgent(since, filter)
+	if err != nil {
+		log.Printf("[alerts] cost_threshold_exceeded token usage error: %v", err)
+		return false
+	}
+
+	spend := map[string]float64{}
+	for agID, cost := range reported {
+		spend[agID] = cost
+	}
+	for agID, s := range parsed {
+		if s.Cost > spend[agID] {
+			spend[agID] = s.Cost
+		}
+	}
+
+	if scope == "fleet" {
+		var total float64
+		for _, cost := range spend {
+			total += cost
+		}
+		if total > float64(threshold) {
+			msg := fmt.Sprintf("Fleet spend is $%.2f this %s (threshold: $%d)", total, window, threshold)
+			insertAlertAndNotify(hub, ruleID, ruleName, filter, msg, webhookID)
+		}
+		return true
+	}
+	for agID, cost := range spend {
+		if cost > float64(threshold) {
+			msg := fmt.Sprintf("Agent '%s' has spent $%.2f this %s (threshold: $%d)", agID, cost, window, threshold)
+			insertAlertAndNotify(hub, ruleID, ruleName, agID, msg, webhookID)
+		}
+	}
+	return true
+}
+
+// evaluateAgentIdle fires for agents that have queued work (open tasks
+// assigned to them, outside backlog and blocked) but no activity, lease
+// heartbeat or check-in for thresholdMinutes. Paused and killed agents are
+// idle on purpose and skipped.
+func evaluateAgentIdle(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, thresholdMinutes int, webhookID sql.NullString) bool {
+	cutoff := time.Now().Add(-time.Duration(thresholdMinutes) * time.Minute)
+	filter := ""
+	if agentID.Valid && agentID.String != "" {
+		filter = agentID.String
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT a.id, q.queued,
+		       GREATEST(a.last_active,
+		                (SELECT MAX(l.created_at) FROM activity_log l WHERE l.agent_id = a.id),
+		                (SELECT MAX(tl.heartbeat_at) FROM task_leases tl WHERE tl.agent_id = a.id))
+		FROM agents a
+		JOIN (
+			SELECT assignee, COUNT(*) AS queued
+			FROM tasks
+			WHERE status IN `+sqlStatusList(StatusTodo, StatusActive, StatusReview)+`
+			GROUP BY assignee
+		) q ON q.assignee = a.id
+		WHERE a.status NOT IN ('paused', 'killed')
+		  AND ($1 = '' OR a.id = $1)
+	`, filter)
+	if err != nil {
+		log.Printf("[alerts] agent_idle query error: %v", err)
+		return false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var agID string
+		var queued int
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&agID, &queued, &lastSeen); err != nil {
+			continue
+		}
+		if lastSeen.Valid && lastSeen.Time.After(cutoff) {
+			continue
+		}
+		since := "never"
+		if lastSeen.Valid {
+			since = fmt.Sprintf("%d minutes ago", int(time.Since(lastSeen.Time).Minutes()))
+		}
+		msg := fmt.Sprintf("Agent '%s' has %d queued task(s) but no activity for %d minutes (last seen: %s)",
+			agID, queued, thresholdMinutes, since)
 		insertAlertAndNotify(hub, ruleID, ruleName, agID, msg, webhookID)
 	}
+	return true
 }
 
-// insertAlertAndNotify inserts into alert_history, deduplicates, and sends webhook.
+// ─── Alert state ─────────────────────────────────────────────────────────────
+//
+// An alert_history row is one alert: a rule firing for one fingerprint (an
+// agent, a task, or nothing for fleet-wide conditions) from first_seen_at
+// until the condition clears. Each evaluation pass that still sees the
+// condition bumps last_seen_at and occurrences instead of adding a row.
+//
+//	firing    notified once, then every renotify_minutes (0 = never)
+//	silenced  occurrences are counted but nothing is sent until silenced_until
+//	resolved  the condition cleared; a resolve notification went out
+//
+// A condition that returns within the rule's cooldown_minutes of resolving
+// reopens the same alert without notifying again.
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+	AlertSilenced = "silenced"
+)
+
+// insertAlertAndNotify fires the rule's alert for an agent.
 func insertAlertAndNotify(hub *websocket.Hub, ruleID, ruleName, agentID, message string, webhookID sql.NullString) {
-	// Dedup: don't create the same alert twice within 5 minutes
-	var existingCount int
-	db.DB.QueryRow(`
-		SELECT COUNT(*) FROM alert_history
-		WHERE rule_id = $1 AND agent_id = $2 AND triggered_at > NOW() - INTERVAL '5 minutes'
-	`, ruleID, agentID).Scan(&existingCount)
-
-	if existingCount > 0 {
+	fireAlert(hub, ruleID, ruleName, agentID, agentID, message, webhookID)
+}
+
+// fireAlert records one occurrence of the alert (rule, fingerprint) and
+// notifies when the alert is new or due a re-notification.
+func fireAlert(hub *websocket.Hub, ruleID, ruleName, fingerprint, agentID, message string, webhookID sql.NullString) {
+	var cooldown, renotify int
+	db.DB.QueryRow(`SELECT cooldown_minutes, renotify_minutes FROM alert_rules WHERE id = $1`, ruleID).Scan(&cooldown, &renotify)
+
+	var histID, state string
+	var lastNotified, resolvedAt, silencedUntil sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT id, state, last_notified_at, resolved_at, silenced_until
+		FROM alert_history
+		WHERE rule_id = $1 AND fingerprint = $2
+		ORDER BY triggered_at DESC
+		LIMIT 1
+	`, ruleID, fingerprint).Scan(&histID, &state, &lastNotified, &resolvedAt, &silencedUntil)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("[alerts] Failed to load alert state: %v", err)
 		return
 	}
 
-	var histID string
-	err := db.DB.QueryRow(`
-		INSERT INTO alert_history (rule_id, agent_id, message)
-		VALUES ($1, NULLIF($2,''), $3)
+	if err == nil {
+		switch {
+		case state == AlertSilenced && silencedUntil.Valid && time.Now().Before(silencedUntil.Time):
+			bumpAlert(histID, AlertSilenced, message)
+			return
+		case state == AlertFiring || state == AlertSilenced:
+			// Still firing, or a silence that has run out
+			bumpAlert(histID, AlertFiring, message)
+			due := renotify > 0 && (!lastNotified.Valid || time.Since(lastNotified.Time) >= time.Duration(renotify)*time.Minute)
+			if state == AlertSilenced || due {
+				db.DB.Exec(`UPDATE alert_history SET last_notified_at = NOW() WHERE id = $1`, histID)
+				notifyAlert(hub, histID, ruleID, ruleName, agentID, message, webhookID, "renotify")
+			}
+			return
+		case resolvedAt.Valid && time.Since(resolvedAt.Time) < time.Duration(cooldown)*time.Minute:
+			// Flapping: reopen quietly
+			db.DB.Exec(`UPDATE alert_history SET resolved_at = NULL WHERE id = $1`, histID)
+			bumpAlert(histID, AlertFiring, message)
+			return
+		}
+	}
+
+	err = db.DB.QueryRow(`
+		INSERT INTO alert_history (rule_id, agent_id, message, fingerprint, state, last_seen_at, last_notified_at)
+		VALUES ($1, NULLIF($2,''), $3, $4, 'firing', NOW(), NOW())
 		RETURNING id
-	`, ruleID, agentID, message).Scan(&histID)
+	`, ruleID, agentID, message, fingerprint).Scan(&histID)
 	if err != nil {
 		log.Printf("[alerts] Failed to insert alert history: %v", err)
 		return
 	}
+	notifyAlert(hub, histID, ruleID, ruleName, agentID, message, webhookID, "new")
+}
 
+// bumpAlert records another occurrence of an open alert.
+func bumpAlert(histID, state, message string) {
+	if _, err := db.DB.Exec(`
+		UPDATE alert_history
+		SET state = $2, message = $3, last_seen_at = NOW(), occurrences = occurrences + 1,
+		    silenced_until = CASE WHEN $2 = 'silenced' THEN silenced_until END
+		WHERE id = $1
+	`, histID, state, message); err != nil {
+		log.Printf("[alerts] Failed to update alert %s: %v", histID, err)
+	}
+}
+
+func notifyAlert(hub *websocket.Hub, histID, ruleID, ruleName, agentID, message string, webhookID sql.NullString, reason string) {
 	log.Printf("[alerts] 🔔 Alert triggered: %s — %s", ruleName, message)
 
 	// Create in-app notification for the alert
@@ -259,31 +555,73 @@ func insertAlertAndNotify(hub *websocket.Hub, ruleID, ruleName, agentID, message
 			"rule":     ruleName,
 			"agent_id": agentID,
 			"message":  message,
+			"reason":   reason,
 			"time":     time.Now(),
 		}
 		hub.Broadcast("alert_triggered", payload)
 	}
+	go TriggerWebhooks(EventAlertFired, map[string]interface{}{
+		"alert_id": histID,
+		"rule_id":  ruleID,
+		"rule":     ruleName,
+		"agent_id": agentID,
+		"message":  message,
+	})
 
 	// Call webhook if configured
 	if webhookID.Valid {
-		go callWebhook(webhookID.String, ruleName, agentID, message)
+		go callWebhook(webhookID.String, ruleName, agentID, message, AlertFiring)
 	}
 }
 
-// callWebhook makes a POST request to the configured webhook URL.
-func callWebhook(webhookURL, ruleName, agentID, message string) {
-	payload := map[string]interface{}{
-		"rule":     ruleName,
-		"agent_id": agentID,
-		"message":  message,
-		"time":     time.Now().Format(time.RFC3339),
-	}
-	body, _ := json.Marshal(payload)
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewReader(body))
+// resolveClearedAlerts resolves the rule's open alerts that the pass
+// starting at passStart didn't see again, and sends resolve notifications
+// for those that weren't silenced.
+func resolveClearedAlerts(hub *websocket.Hub, ruleID, ruleName string, webhookID sql.NullString, passStart time.Time) {
+	rows, err := db.DB.Query(`
+		UPDATE alert_history h
+		SET state = 'resolved', resolved_at = NOW(), silenced_until = NULL
+		FROM (
+			SELECT id, state FROM alert_history
+			WHERE rule_id = $1 AND state IN ('firing', 'silenced') AND last_seen_at < $2
+			FOR UPDATE
+		) prev
+		WHERE h.id = prev.id
+		RETURNING h.id, COALESCE(h.agent_id, ''), COALESCE(h.message, ''), prev.state
+	`, ruleID, passStart)
 	if err != nil {
-		log.Printf("[alerts] Webhook call failed: %v", err)
+		log.Printf("[alerts] Failed to resolve alerts for rule %s: %v", ruleID, err)
 		return
 	}
-	defer resp.Body.Close()
-	log.Printf("[alerts] Webhook called: %s → %d", webhookURL, resp.StatusCode)
+	defer rows.Close()
+
+	for rows.Next() {
+		var histID, agentID, message, prevState string
+		if err := rows.Scan(&histID, &agentID, &message, &prevState); err != nil || prevState == AlertSilenced {
+			continue
+		}
+		log.Printf("[alerts] ✅ Alert resolved: %s — %s", ruleName, message)
+		go CreateNotificationInternal(agentID, "alert_resolved", "Resolved: "+ruleName, message)
+		if hub != nil {
+			hub.Broadcast("alert_resolved", map[string]interface{}{
+				"id": histID, "rule_id": ruleID, "rule": ruleName, "agent_id": agentID, "message": message, "time": time.Now(),
+			})
+		}
+		go TriggerWebhooks(EventAlertResolved, map[string]interface{}{
+			"alert_id": histID, "rule_id": ruleID, "rule": ruleName, "agent_id": agentID, "message": message,
+		})
+		if webhookID.Valid {
+			go callWebhook(webhookID.String, ruleName, agentID, message, AlertResolved)
+		}
+	}
+}
+
+// callWebhook queues the alert for the rule's notification webhook.
+func callWebhook(webhookID, ruleName, agentID, message, state string) {
+	TriggerWebhooksToURL(webhookID, EventAlertTriggered, map[string]interface{}{
+		"rule":     ruleName,
+		"agent_id": agentID,
+		"message":  message,
+		"state":    state,
+	})
 }
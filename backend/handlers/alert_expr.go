@@ -0,0 +1,622 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/alghanim/agentboard/backend/websocket"
+	"github.com/lib/pq"
+)
+
+// ─── Expression alert rules ──────────────────────────────────────────────────
+//
+// Rules with condition_type "expression" carry a metric expression instead
+// of a fixed check:
+//
+//	<agg>(<metric>{<label><op>"<value>", ...}[<window>]) [by agent] <cmp> <number> [for <duration>]
+//
+//	p95(response_time[1h]) by agent > 30 for 10m
+//	count(traces{type="error"}[15m]) by agent > 5
+//	min(efficiency_score) by agent < 40
+//	sum(cost{model=~"opus"}[1d]) > 100
+//
+// agg is count, sum, avg, min, max, p50, p90, p95 or p99. Label matchers are
+// = and != (exact) or =~ and !~ (regular expression). Durations take s, m,
+// h, d or w. "by agent" fans the rule out to one alert per agent; "for" only
+// fires once the comparison has held on every pass for that long.
+
+// metricSample is one agent's current value of a gauge metric.
+type metricSample struct {
+	Agent string
+	Value float64
+}
+
+// metricEnv holds data shared by the rules of one evaluation pass.
+// Efficiency scores are computed at most once per pass.
+type metricEnv struct {
+	scores    []EfficiencyScore
+	scoresErr error
+	scored    bool
+}
+
+func (e *metricEnv) efficiencyScores() ([]EfficiencyScore, error) {
+	if !e.scored {
+		e.scores, e.scoresErr = computeEfficiencyScores()
+		e.scored = true
+	}
+	return e.scores, e.scoresErr
+}
+
+// alertMetric describes a metric an expression can query. Windowed
+// metrics are aggregated in SQL over source, a query selecting agent_id,
+// value and a column per label for rows since $1. Gauges are computed in Go.
+type alertMetric struct {
+	Description string
+	Labels      []string
+	Gauge       bool // a current value; takes no window
+	source      string
+	load        func(env *metricEnv) ([]metricSample, error)
+}
+
+var alertMetrics = map[string]alertMetric{
+	"activity": {
+		Description: "activity_log entries (value 1 each)",
+		Labels:      []string{"action"},
+		source:      `SELECT COALESCE(agent_id, '') AS agent_id, 1 AS value, action FROM activity_log WHERE created_at >= $1`,
+	},
+	"traces": {
+		Description: "agent_traces spans, value duration_ms",
+		Labels:      []string{"type"},
+		source:      `SELECT COALESCE(agent_id, '') AS agent_id, COALESCE(duration_ms, 0) AS value, trace_type AS type FROM agent_traces WHERE created_at >= $1`,
+	},
+	"cost": {
+		Description: "agent_costs entries, value cost_usd",
+		Labels:      []string{"model"},
+		source:      `SELECT agent_id, cost_usd AS value, COALESCE(model, '') AS model FROM agent_costs WHERE created_at >= $1`,
+	},
+	"evaluations": {
+		Description: "evaluation scores",
+		Labels:      []string{"evaluator"},
+		source:      `SELECT COALESCE(agent_id, '') AS agent_id, score AS value, evaluator FROM evaluations WHERE created_at >= $1`,
+	},
+	"tokens": {
+		Description: "assistant messages in session logs, value total tokens",
+		Labels:      []string{"model"},
+		source:      `SELECT agent_id, total_tokens AS value, model FROM token_usage WHERE ts >= $1`,
+	},
+	"token_cost": {
+		Description: "assistant messages in session logs, value cost in USD",
+		Labels:      []string{"model"},
+		source:      `SELECT agent_id, cost_usd AS value, model FROM token_usage WHERE ts >= $1`,
+	},
+	"response_time": {
+		Description: "seconds between consecutive assistant messages, gaps over 10 minutes excluded (as in /api/metrics/latency)",
+		source:      `SELECT agent_id, gap AS value FROM (` + responseGapsSQL + `) r`,
+	},
+	"efficiency_score": {
+		Description: "current efficiency score (0-100, as in /api/metrics/efficiency)",
+		Gauge:       true,
+		load: func(env *metricEnv) ([]metricSample, error) {
+			scores, err := env.efficiencyScores()
+			if err != nil {
+				return nil, err
+			}
+			out := make([]metricSample, 0, len(scores))
+			for _, s := range scores {
+				out = append(out, metricSample{Agent: s.AgentID, Value: s.Score})
+			}
+			return out, nil
+		},
+	},
+}
+
+var exprAggregations = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+	"p50": true, "p90": true, "p95": true, "p99": true,
+}
+
+// maxExprWindow bounds how far back an expression may look.
+const maxExprWindow = 30 * 24 * time.Hour
+
+// LabelMatcher filters samples on a label.
+type LabelMatcher struct {
+	Label string `json:"label"`
+	Op    string `json:"op"` // =, !=, =~, !~
+	Value string `json:"value"`
+}
+
+// matcherOps maps label matchers to their SQL operators. Regular
+// expressions are matched by Postgres.
+var matcherOps = map[string]string{"=": "=", "!=": "<>", "=~": "~", "!~": "!~"}
+
+// AlertExpr is a parsed alert expression.
+type AlertExpr struct {
+	Agg       string         `json:"agg"`
+	Metric    string         `json:"metric"`
+	Matchers  []LabelMatcher `json:"matchers,omitempty"`
+	Window    time.Duration  `json:"-"`
+	ByAgent   bool           `json:"by_agent"`
+	Op        string         `json:"op"`
+	Threshold float64        `json:"threshold"`
+	For       time.Duration  `json:"-"`
+
+	WindowText string `json:"window,omitempty"`
+	ForText    string `json:"for,omitempty"`
+}
+
+// String renders the expression in canonical form.
+func (e *AlertExpr) String() string {
+	var b strings.Builder
+	b.WriteString(e.Agg + "(" + e.Metric)
+	if len(e.Matchers) > 0 {
+		parts := make([]string, len(e.Matchers))
+		for i, m := range e.Matchers {
+			parts[i] = m.Label + m.Op + strconv.Quote(m.Value)
+		}
+		b.WriteString("{" + strings.Join(parts, ", ") + "}")
+	}
+	if e.Window > 0 {
+		b.WriteString("[" + e.WindowText + "]")
+	}
+	b.WriteString(")")
+	if e.ByAgent {
+		b.WriteString(" by agent")
+	}
+	b.WriteString(" " + e.Op + " " + strconv.FormatFloat(e.Threshold, 'f', -1, 64))
+	if e.For > 0 {
+		b.WriteString(" for " + e.ForText)
+	}
+	return b.String()
+}
+
+func (e *AlertExpr) compare(v float64) bool {
+	switch e.Op {
+	case ">":
+		return v > e.Threshold
+	case ">=":
+		return v >= e.Threshold
+	case "<":
+		return v < e.Threshold
+	case "<=":
+		return v <= e.Threshold
+	case "==":
+		return v == e.Threshold
+	case "!=":
+		return v != e.Threshold
+	}
+	return false
+}
+
+// exprLexer splits an expression into identifiers, numbers, strings and
+// punctuation.
+type exprLexer struct {
+	toks []string
+	pos  int
+}
+
+func lexExpr(src string) (*exprLexer, error) {
+	var toks []string
+	r := []rune(src)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(r) && r[j] != '"' {
+				if r[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(r) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, string(r[i:j+1]))
+			i = j + 1
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '.' || c == '-':
+			j := i
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_' || r[j] == '.' || (r[j] == '-' && j == i)) {
+				j++
+			}
+			toks = append(toks, string(r[i:j]))
+			i = j
+		case strings.ContainsRune("<>=!", c):
+			j := i + 1
+			if j < len(r) && (r[j] == '=' || r[j] == '~') {
+				j++
+			}
+			toks = append(toks, string(r[i:j]))
+			i = j
+		case strings.ContainsRune("(){}[],", c):
+			toks = append(toks, string(c))
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return &exprLexer{toks: toks}, nil
+}
+
+func (l *exprLexer) peek() string {
+	if l.pos < len(l.toks) {
+		return l.toks[l.pos]
+	}
+	return ""
+}
+
+func (l *exprLexer) next() string {
+	t := l.peek()
+	l.pos++
+	return t
+}
+
+func (l *exprLexer) expect(tok string) error {
+	if got := l.next(); got != tok {
+		if got == "" {
+			got = "end of expression"
+		}
+		return fmt.Errorf("expected %q, got %q", tok, got)
+	}
+	return nil
+}
+
+// parseExprDuration parses durations like 30s, 15m, 1h, 2d, 1w.
+func parseExprDuration(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if len(s) < 2 {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	unit, ok := units[s[len(s)-1]]
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if !ok || err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad duration %q (use e.g. 30s, 15m, 1h, 2d)", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// parseAlertExpr parses and validates an alert expression.
+func parseAlertExpr(src string) (*AlertExpr, error) {
+	l, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	e := &AlertExpr{Agg: strings.ToLower(l.next())}
+	if !exprAggregations[e.Agg] {
+		return nil, fmt.Errorf("unknown aggregation %q (count, sum, avg, min, max, p50, p90, p95, p99)", e.Agg)
+	}
+	if err := l.expect("("); err != nil {
+		return nil, err
+	}
+	e.Metric = l.next()
+	metric, ok := alertMetrics[e.Metric]
+	if !ok {
+		names := make([]string, 0, len(alertMetrics))
+		for name := range alertMetrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown metric %q (%s)", e.Metric, strings.Join(names, ", "))
+	}
+
+	if l.peek() == "{" {
+		l.next()
+		for l.peek() != "}" {
+			m := LabelMatcher{Label: l.next(), Op: l.next()}
+			if !containsString(metric.Labels, m.Label) {
+				return nil, fmt.Errorf("metric %s has no label %q", e.Metric, m.Label)
+			}
+			if _, ok := matcherOps[m.Op]; !ok {
+				return nil, fmt.Errorf("bad label matcher %q", m.Op)
+			}
+			if m.Value, err = strconv.Unquote(l.next()); err != nil {
+				return nil, fmt.Errorf("label values must be quoted strings")
+			}
+			if m.Op == "=~" || m.Op == "!~" {
+				if _, err := regexp.Compile(m.Value); err != nil {
+					return nil, fmt.Errorf("bad regular expression %q: %v", m.Value, err)
+				}
+			}
+			e.Matchers = append(e.Matchers, m)
+			if l.peek() == "," {
+				l.next()
+			} else if l.peek() != "}" {
+				return nil, fmt.Errorf("expected \",\" or \"}\" in label matchers")
+			}
+		}
+		l.next()
+	}
+
+	if l.peek() == "[" {
+		l.next()
+		e.WindowText = l.next()
+		if e.Window, err = parseExprDuration(e.WindowText); err != nil {
+			return nil, err
+		}
+		if err := l.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case metric.Gauge && e.Window > 0:
+		return nil, fmt.Errorf("%s is a current value and takes no window", e.Metric)
+	case !metric.Gauge && e.Window == 0:
+		return nil, fmt.Errorf("%s needs a window, e.g. %s[15m]", e.Metric, e.Metric)
+	case e.Window > maxExprWindow:
+		return nil, fmt.Errorf("window can be at most 30d")
+	}
+	if err := l.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if strings.ToLower(l.peek()) == "by" {
+		l.next()
+		if g := strings.ToLower(l.next()); g != "agent" {
+			return nil, fmt.Errorf("can only group by agent, not %q", g)
+		}
+		e.ByAgent = true
+	}
+
+	e.Op = l.next()
+	switch e.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return nil, fmt.Errorf("expected a comparison (>, >=, <, <=, ==, !=), got %q", e.Op)
+	}
+	if e.Threshold, err = strconv.ParseFloat(l.next(), 64); err != nil {
+		return nil, fmt.Errorf("expected a number after %s", e.Op)
+	}
+
+	if strings.ToLower(l.peek()) == "for" {
+		l.next()
+		e.ForText = l.next()
+		if e.For, err = parseExprDuration(e.ForText); err != nil {
+			return nil, err
+		}
+	}
+	if t := l.peek(); t != "" {
+		return nil, fmt.Errorf("unexpected %q at end of expression", t)
+	}
+	return e, nil
+}
+
+func aggregate(agg string, values []float64) float64 {
+	switch agg {
+	case "count":
+		return float64(len(values))
+	case "sum", "avg":
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		if agg == "avg" {
+			return sum / float64(len(values))
+		}
+		return sum
+	case "min", "max":
+		out := values[0]
+		for _, v := range values[1:] {
+			if (agg == "min" && v < out) || (agg == "max" && v > out) {
+				out = v
+			}
+		}
+		return out
+	}
+	p, _ := strconv.ParseFloat(agg[1:], 64)
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return percentile(sorted, p)
+}
+
+// ExprResult is the value of an expression for one group.
+type ExprResult struct {
+	AgentID string  `json:"agent_id,omitempty"`
+	Value   float64 `json:"value"`
+	Matches bool    `json:"matches"`
+}
+
+// aggregateSQL is the SQL aggregate of agg over a source's value column.
+func aggregateSQL(agg string) string {
+	switch agg {
+	case "count":
+		return "COUNT(value)::float8"
+	case "sum", "avg", "min", "max":
+		return strings.ToUpper(agg) + "(value::float8)"
+	}
+	p, _ := strconv.ParseFloat(agg[1:], 64)
+	return "percentile_cont(" + strconv.FormatFloat(p/100, 'f', -1, 64) + ") WITHIN GROUP (ORDER BY value::float8)"
+}
+
+// evaluate computes the expression per group (one group without "by agent").
+// A group with no samples has no value, except for count, which is 0.
+func (e *AlertExpr) evaluate(env *metricEnv, agentFilter string, now time.Time) ([]ExprResult, error) {
+	metric := alertMetrics[e.Metric]
+	var values map[string]float64
+	var err error
+	if metric.Gauge {
+		values, err = e.evaluateGauge(env, metric, agentFilter)
+	} else {
+		values, err = e.evaluateSQL(metric, agentFilter, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ExprResult{}
+	for key, v := range values {
+		v = math.Round(v*1000) / 1000
+		results = append(results, ExprResult{AgentID: key, Value: v, Matches: e.compare(v)})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].AgentID < results[j].AgentID })
+	return results, nil
+}
+
+// evaluateSQL aggregates a windowed metric in the database.
+func (e *AlertExpr) evaluateSQL(metric alertMetric, agentFilter string, now time.Time) (map[string]float64, error) {
+	args := []interface{}{now.Add(-e.Window)}
+	var where []string
+	if agentFilter != "" {
+		args = append(args, agentFilter)
+		where = append(where, fmt.Sprintf("s.agent_id = $%d", len(args)))
+	}
+	for _, m := range e.Matchers {
+		args = append(args, m.Value)
+		where = append(where, fmt.Sprintf("s.%s %s $%d", m.Label, matcherOps[m.Op], len(args)))
+	}
+
+	group := "''"
+	if e.ByAgent {
+		group = "s.agent_id"
+	}
+	query := "SELECT " + group + ", " + aggregateSQL(e.Agg) + " FROM (" + metric.source + ") s"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if e.ByAgent {
+		query += " GROUP BY s.agent_id"
+	}
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := map[string]float64{}
+	for rows.Next() {
+		var key string
+		var v sql.NullFloat64
+		if err := rows.Scan(&key, &v); err != nil {
+			return nil, err
+		}
+		// Without grouping, an empty window still yields a row: 0 for
+		// count, NULL for everything else
+		if v.Valid {
+			values[key] = v.Float64
+		}
+	}
+	return values, rows.Err()
+}
+
+// evaluateGauge aggregates a gauge metric's current values.
+func (e *AlertExpr) evaluateGauge(env *metricEnv, metric alertMetric, agentFilter string) (map[string]float64, error) {
+	samples, err := metric.load(env)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]float64{}
+	if !e.ByAgent && e.Agg == "count" {
+		groups[""] = nil
+	}
+	for _, s := range samples {
+		if agentFilter != "" && s.Agent != agentFilter {
+			continue
+		}
+		key := ""
+		if e.ByAgent {
+			key = s.Agent
+		}
+		groups[key] = append(groups[key], s.Value)
+	}
+
+	values := map[string]float64{}
+	for key, vs := range groups {
+		if len(vs) > 0 {
+			values[key] = aggregate(e.Agg, vs)
+		} else if e.Agg == "count" {
+			values[key] = 0
+		}
+	}
+	return values, nil
+}
+
+// evaluateExpressionRule fires the rule's alerts for groups whose
+// comparison has held for the expression's "for" duration. Pending groups
+// are tracked in alert_pending.
+func evaluateExpressionRule(hub *websocket.Hub, env *metricEnv, ruleID, ruleName string, agentID sql.NullString, expression string, webhookID sql.NullString) bool {
+	e, err := parseAlertExpr(expression)
+	if err != nil {
+		log.Printf("[alerts] expression rule %s is invalid: %v", ruleID, err)
+		return false
+	}
+	results, err := e.evaluate(env, agentID.String, time.Now())
+	if err != nil {
+		log.Printf("[alerts] expression query error: %v", err)
+		return false
+	}
+
+	matching := []string{}
+	for _, res := range results {
+		if !res.Matches {
+			continue
+		}
+		matching = append(matching, res.AgentID)
+
+		var since time.Time
+		if err := db.DB.QueryRow(`
+			INSERT INTO alert_pending (rule_id, fingerprint) VALUES ($1, $2)
+			ON CONFLICT (rule_id, fingerprint) DO UPDATE SET fingerprint = EXCLUDED.fingerprint
+			RETURNING since
+		`, ruleID, res.AgentID).Scan(&since); err != nil {
+			log.Printf("[alerts] expression pending state error: %v", err)
+			return false
+		}
+		if time.Since(since) < e.For {
+			continue
+		}
+
+		subject := "Fleet"
+		if res.AgentID != "" {
+			subject = fmt.Sprintf("Agent '%s'", res.AgentID)
+		}
+		msg := fmt.Sprintf("%s: %s is %s (%s %s)", subject, e.Agg+"("+e.Metric+")",
+			strconv.FormatFloat(res.Value, 'f', -1, 64), e.Op, strconv.FormatFloat(e.Threshold, 'f', -1, 64))
+		if e.For > 0 {
+			msg += " for " + e.ForText
+		}
+		fireAlert(hub, ruleID, ruleName, res.AgentID, res.AgentID, msg, webhookID)
+	}
+
+	db.DB.Exec(`DELETE FROM alert_pending WHERE rule_id = $1 AND NOT (fingerprint = ANY($2))`, ruleID, pq.Array(matching))
+	return true
+}
+
+// PreviewAlertExpression handles POST /api/alerts/rules/preview. It parses
+// an expression and returns its current value per group without firing
+// anything; "for" durations are ignored.
+func PreviewAlertExpression(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Expression string `json:"expression"`
+		AgentID    string `json:"agent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	e, err := parseAlertExpr(req.Expression)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid expression: "+err.Error())
+		return
+	}
+	results, err := e.evaluate(&metricEnv{}, req.AgentID, time.Now())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"expression": e.String(),
+		"parsed":     e,
+		"results":    results,
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLexExpr(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{`p95(response_time[1h])by agent>=30`,
+			[]string{"p95", "(", "response_time", "[", "1h", "]", ")", "by", "agent", ">=", "30"}},
+		{`count(traces{type="error", type!~"a\"b"}[15m])`,
+			[]string{"count", "(", "traces", "{", "type", "=", `"error"`, ",", "type", "!~", `"a\"b"`, "}", "[", "15m", "]", ")"}},
+		{"avg(cost[1d])\t!= -1.5", []string{"avg", "(", "cost", "[", "1d", "]", ")", "!=", "-1.5"}},
+		{"x == 0 < 1 <= 2 =~ 3", []string{"x", "==", "0", "<", "1", "<=", "2", "=~", "3"}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			l, err := lexExpr(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(l.toks, tt.want) {
+				t.Fatalf("tokens %q, want %q", l.toks, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAlertExpr(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    string // canonical form
+		window  time.Duration
+		byAgent bool
+		forDur  time.Duration
+	}{
+		{"p95(response_time[1h]) by agent > 30 for 10m",
+			"p95(response_time[1h]) by agent > 30 for 10m", time.Hour, true, 10 * time.Minute},
+		{`count(traces{type="error"}[15m]) by agent > 5`,
+			`count(traces{type="error"}[15m]) by agent > 5`, 15 * time.Minute, true, 0},
+		{"min(efficiency_score) by agent < 40",
+			"min(efficiency_score) by agent < 40", 0, true, 0},
+		{`sum(cost{model=~"opus"}[1d]) > 100`,
+			`sum(cost{model=~"opus"}[1d]) > 100`, 24 * time.Hour, false, 0},
+		{`AVG(tokens{model!="x",model!~"^claude"}[2w])>=1.5`,
+			`avg(tokens{model!="x", model!~"^claude"}[2w]) >= 1.5`, 14 * 24 * time.Hour, false, 0},
+		{"count(activity[30d]) BY Agent == 0 FOR 30s",
+			"count(activity[30d]) by agent == 0 for 30s", 30 * 24 * time.Hour, true, 30 * time.Second},
+		{"max(evaluations[1h]) <= -2.5", "max(evaluations[1h]) <= -2.5", time.Hour, false, 0},
+		{"p50(token_cost[1h]) != 0", "p50(token_cost[1h]) != 0", time.Hour, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := parseAlertExpr(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.String(); got != tt.want {
+				t.Fatalf("String() = %q, want %q", got, tt.want)
+			}
+			if e.Window != tt.window || e.ByAgent != tt.byAgent || e.For != tt.forDur {
+				t.Fatalf("window %v, by agent %v, for %v; want %v, %v, %v", e.Window, e.ByAgent, e.For, tt.window, tt.byAgent, tt.forDur)
+			}
+			// The canonical form parses back to itself
+			again, err := parseAlertExpr(e.String())
+			if err != nil || !reflect.DeepEqual(again, e) {
+				t.Fatalf("reparsed %q as %+v, %v", e.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseAlertExprInvalid(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "unknown aggregation"},
+		{"median(tokens[1h]) > 1", "unknown aggregation"},
+		{"sum tokens[1h] > 1", `expected "("`},
+		{"sum(foo[1h]) > 1", `unknown metric "foo"`},
+		{`sum(tokens{agent="x"}[1h]) > 1`, `has no label "agent"`},
+		{`sum(tokens{model=x}[1h]) > 1`, "quoted strings"},
+		{`sum(tokens{model=="x"}[1h]) > 1`, "bad label matcher"},
+		{`sum(tokens{model=~"("}[1h]) > 1`, "bad regular expression"},
+		{`sum(tokens{model="x" model="y"}[1h]) > 1`, `expected "," or "}"`},
+		{`sum(tokens{model~"x"}[1h]) > 1`, "unexpected '~'"},
+		{`sum(tokens{model="x}[1h]) > 1`, "unterminated string"},
+		{"sum(tokens) > 1", "needs a window"},
+		{"min(efficiency_score[1h]) < 1", "takes no window"},
+		{"sum(tokens[31d]) > 1", "at most 30d"},
+		{"sum(tokens[1y]) > 1", "bad duration"},
+		{"sum(tokens[0m]) > 1", "bad duration"},
+		{"sum(tokens[h]) > 1", "bad duration"},
+		{"sum(tokens[1h] > 1", `expected ")"`},
+		{"sum(tokens[1h]) by model > 1", "can only group by agent"},
+		{"sum(tokens[1h])", "expected a comparison"},
+		{"sum(tokens[1h]) => 1", "expected a comparison"},
+		{"sum(tokens[1h]) > high", "expected a number"},
+		{"sum(tokens[1h]) > 1 for ever", "bad duration"},
+		{"sum(tokens[1h]) > 1 and", `unexpected "and"`},
+		{"sum(tokens[1h]) > 1 #", "unexpected '#'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := parseAlertExpr(tt.src)
+			if err == nil {
+				t.Fatalf("parsed %q without error", tt.src)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateSQL(t *testing.T) {
+	tests := []struct {
+		agg  string
+		want string
+	}{
+		{"count", "COUNT(value)::float8"},
+		{"avg", "AVG(value::float8)"},
+		{"max", "MAX(value::float8)"},
+		{"p50", "percentile_cont(0.5) WITHIN GROUP (ORDER BY value::float8)"},
+		{"p99", "percentile_cont(0.99) WITHIN GROUP (ORDER BY value::float8)"},
+	}
+	for _, tt := range tests {
+		if got := aggregateSQL(tt.agg); got != tt.want {
+			t.Errorf("aggregateSQL(%q) = %q, want %q", tt.agg, got, tt.want)
+		}
+	}
+}
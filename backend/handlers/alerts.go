@@ -3,7 +3,11 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alghanim/agentboard/backend/db"
@@ -17,27 +21,71 @@ type AlertRule struct {
 	AgentID         *string    `json:"agent_id"`
 	ConditionType   string     `json:"condition_type"`
 	Threshold       int        `json:"threshold"`
+	Window          string     `json:"window"` // cost_threshold_exceeded: hour, day or month
+	Scope           string     `json:"scope"`  // cost_threshold_exceeded: agent or fleet
+	Expression      string     `json:"expression,omitempty"` // expression rules only
+	CooldownMinutes int        `json:"cooldown_minutes"`
+	RenotifyMinutes int        `json:"renotify_minutes"`
 	Enabled         bool       `json:"enabled"`
 	NotifyWebhookID *string    `json:"notify_webhook_id"`
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
-// AlertHistory represents a triggered alert.
+// AlertHistory represents a triggered alert and its repeated occurrences.
 type AlertHistory struct {
-	ID           string    `json:"id"`
-	RuleID       string    `json:"rule_id"`
-	RuleName     string    `json:"rule_name"`
-	AgentID      *string   `json:"agent_id"`
-	TriggeredAt  time.Time `json:"triggered_at"`
-	Message      string    `json:"message"`
-	Acknowledged bool      `json:"acknowledged"`
+	ID            string     `json:"id"`
+	RuleID        string     `json:"rule_id"`
+	RuleName      string     `json:"rule_name"`
+	AgentID       *string    `json:"agent_id"`
+	Fingerprint   string     `json:"fingerprint"`
+	State         string     `json:"state"`
+	TriggeredAt   time.Time  `json:"triggered_at"` // first seen
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	Count         int        `json:"count"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	SilencedUntil *time.Time `json:"silenced_until"`
+	Message       string     `json:"message"` // latest occurrence
+	Acknowledged  bool       `json:"acknowledged"`
+}
+
+// validateAlertRule returns an error message for a condition the evaluator
+// can't handle or a window/scope it doesn't know. Expressions are rewritten
+// in canonical form.
+func validateAlertRule(conditionType, window, scope string, expression *string) string {
+	if !alertConditionTypes[conditionType] {
+		names := make([]string, 0, len(alertConditionTypes))
+		for name := range alertConditionTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "unsupported condition_type; must be one of: " + strings.Join(names, ", ")
+	}
+	if !costWindows[window] {
+		return "window must be hour, day or month"
+	}
+	if scope != "agent" && scope != "fleet" {
+		return "scope must be agent or fleet"
+	}
+	if conditionType != "expression" {
+		*expression = ""
+		return ""
+	}
+	if strings.TrimSpace(*expression) == "" {
+		return "expression required for expression rules"
+	}
+	e, err := parseAlertExpr(*expression)
+	if err != nil {
+		return "invalid expression: " + err.Error()
+	}
+	*expression = e.String()
+	return ""
 }
 
 // GetAlertRules handles GET /api/alerts/rules
 func GetAlertRules(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.DB.Query(`
-		SELECT id, name, agent_id, condition_type, threshold, enabled, notify_webhook_id, created_at, updated_at
+		SELECT id, name, agent_id, condition_type, threshold, time_window, scope, COALESCE(expression, ''), cooldown_minutes, renotify_minutes, enabled, notify_webhook_id, created_at, updated_at
 		FROM alert_rules
 		ORDER BY created_at DESC
 	`)
@@ -53,7 +101,7 @@ func GetAlertRules(w http.ResponseWriter, r *http.Request) {
 		var agentID sql.NullString
 		var webhookID sql.NullString
 		err := rows.Scan(&rule.ID, &rule.Name, &agentID, &rule.ConditionType,
-			&rule.Threshold, &rule.Enabled, &webhookID, &rule.CreatedAt, &rule.UpdatedAt)
+			&rule.Threshold, &rule.Window, &rule.Scope, &rule.Expression, &rule.CooldownMinutes, &rule.RenotifyMinutes, &rule.Enabled, &webhookID, &rule.CreatedAt, &rule.UpdatedAt)
 		if err != nil {
 			continue
 		}
@@ -75,6 +123,11 @@ func CreateAlertRule(w http.ResponseWriter, r *http.Request) {
 		AgentID         *string `json:"agent_id"`
 		ConditionType   string  `json:"condition_type"`
 		Threshold       int     `json:"threshold"`
+		Window          string  `json:"window"`
+		Scope           string  `json:"scope"`
+		Expression      string  `json:"expression"`
+		CooldownMinutes *int    `json:"cooldown_minutes"`
+		RenotifyMinutes *int    `json:"renotify_minutes"`
 		Enabled         *bool   `json:"enabled"`
 		NotifyWebhookID *string `json:"notify_webhook_id"`
 	}
@@ -86,9 +139,30 @@ func CreateAlertRule(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "name and condition_type required")
 		return
 	}
-	if req.Threshold == 0 {
+	if req.Threshold == 0 && req.ConditionType != "expression" {
 		req.Threshold = 30
 	}
+	if req.Window == "" {
+		req.Window = "day"
+	}
+	if req.Scope == "" {
+		req.Scope = "agent"
+	}
+	cooldown, renotify := 5, 0
+	if req.CooldownMinutes != nil {
+		cooldown = *req.CooldownMinutes
+	}
+	if req.RenotifyMinutes != nil {
+		renotify = *req.RenotifyMinutes
+	}
+	if cooldown < 0 || renotify < 0 {
+		respondError(w, http.StatusBadRequest, "cooldown_minutes and renotify_minutes must not be negative")
+		return
+	}
+	if msg := validateAlertRule(req.ConditionType, req.Window, req.Scope, &req.Expression); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
 	enabled := true
 	if req.Enabled != nil {
 		enabled = *req.Enabled
@@ -105,12 +179,12 @@ func CreateAlertRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err := db.DB.QueryRow(`
-		INSERT INTO alert_rules (name, agent_id, condition_type, threshold, enabled, notify_webhook_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, name, agent_id, condition_type, threshold, enabled, notify_webhook_id, created_at, updated_at
-	`, req.Name, agentID, req.ConditionType, req.Threshold, enabled, webhookID).
+		INSERT INTO alert_rules (name, agent_id, condition_type, threshold, time_window, scope, expression, cooldown_minutes, renotify_minutes, enabled, notify_webhook_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10, $11)
+		RETURNING id, name, agent_id, condition_type, threshold, time_window, scope, COALESCE(expression, ''), cooldown_minutes, renotify_minutes, enabled, notify_webhook_id, created_at, updated_at
+	`, req.Name, agentID, req.ConditionType, req.Threshold, req.Window, req.Scope, req.Expression, cooldown, renotify, enabled, webhookID).
 		Scan(&rule.ID, &rule.Name, &agentID, &rule.ConditionType,
-			&rule.Threshold, &rule.Enabled, &webhookID, &rule.CreatedAt, &rule.UpdatedAt)
+			&rule.Threshold, &rule.Window, &rule.Scope, &rule.Expression, &rule.CooldownMinutes, &rule.RenotifyMinutes, &rule.Enabled, &webhookID, &rule.CreatedAt, &rule.UpdatedAt)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -121,7 +195,7 @@ func CreateAlertRule(w http.ResponseWriter, r *http.Request) {
 	if webhookID.Valid {
 		rule.NotifyWebhookID = &webhookID.String
 	}
-	go LogAudit("user", "alert_rule_created", "alert_rule", rule.ID, map[string]interface{}{"name": rule.Name, "condition_type": rule.ConditionType})
+	go LogAudit(getAgentFromContext(r), "alert_rule_created", "alert_rule", rule.ID, map[string]interface{}{"name": rule.Name, "condition_type": rule.ConditionType})
 	respondJSON(w, http.StatusCreated, rule)
 }
 
@@ -133,6 +207,11 @@ func UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
 		AgentID         *string `json:"agent_id"`
 		ConditionType   *string `json:"condition_type"`
 		Threshold       *int    `json:"threshold"`
+		Window          *string `json:"window"`
+		Scope           *string `json:"scope"`
+		Expression      *string `json:"expression"`
+		CooldownMinutes *int    `json:"cooldown_minutes"`
+		RenotifyMinutes *int    `json:"renotify_minutes"`
 		Enabled         *bool   `json:"enabled"`
 		NotifyWebhookID *string `json:"notify_webhook_id"`
 	}
@@ -146,10 +225,10 @@ func UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
 	var agentID sql.NullString
 	var webhookID sql.NullString
 	err := db.DB.QueryRow(`
-		SELECT id, name, agent_id, condition_type, threshold, enabled, notify_webhook_id, created_at, updated_at
+		SELECT id, name, agent_id, condition_type, threshold, time_window, scope, COALESCE(expression, ''), cooldown_minutes, renotify_minutes, enabled, notify_webhook_id, created_at, updated_at
 		FROM alert_rules WHERE id = $1
 	`, id).Scan(&rule.ID, &rule.Name, &agentID, &rule.ConditionType,
-		&rule.Threshold, &rule.Enabled, &webhookID, &rule.CreatedAt, &rule.UpdatedAt)
+		&rule.Threshold, &rule.Window, &rule.Scope, &rule.Expression, &rule.CooldownMinutes, &rule.RenotifyMinutes, &rule.Enabled, &webhookID, &rule.CreatedAt, &rule.UpdatedAt)
 	if err == sql.ErrNoRows {
 		respondError(w, http.StatusNotFound, "rule not found")
 		return
@@ -172,6 +251,29 @@ func UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
 	if req.Threshold != nil {
 		rule.Threshold = *req.Threshold
 	}
+	if req.Window != nil {
+		rule.Window = *req.Window
+	}
+	if req.Scope != nil {
+		rule.Scope = *req.Scope
+	}
+	if req.Expression != nil {
+		rule.Expression = *req.Expression
+	}
+	if req.CooldownMinutes != nil {
+		rule.CooldownMinutes = *req.CooldownMinutes
+	}
+	if req.RenotifyMinutes != nil {
+		rule.RenotifyMinutes = *req.RenotifyMinutes
+	}
+	if rule.CooldownMinutes < 0 || rule.RenotifyMinutes < 0 {
+		respondError(w, http.StatusBadRequest, "cooldown_minutes and renotify_minutes must not be negative")
+		return
+	}
+	if msg := validateAlertRule(rule.ConditionType, rule.Window, rule.Scope, &rule.Expression); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
 	if req.Enabled != nil {
 		rule.Enabled = *req.Enabled
 	}
@@ -180,9 +282,11 @@ func UpdateAlertRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	_, err = db.DB.Exec(`
-		UPDATE alert_rules SET name=$1, agent_id=$2, condition_type=$3, threshold=$4, enabled=$5, notify_webhook_id=$6
-		WHERE id=$7
-	`, rule.Name, agentID, rule.ConditionType, rule.Threshold, rule.Enabled, webhookID, id)
+		UPDATE alert_rules SET name=$1, agent_id=$2, condition_type=$3, threshold=$4, time_window=$5, scope=$6,
+		       expression=NULLIF($7, ''), cooldown_minutes=$8, renotify_minutes=$9, enabled=$10, notify_webhook_id=$11
+		WHERE id=$12
+	`, rule.Name, agentID, rule.ConditionType, rule.Threshold, rule.Window, rule.Scope, rule.Expression,
+		rule.CooldownMinutes, rule.RenotifyMinutes, rule.Enabled, webhookID, id)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -211,14 +315,19 @@ func DeleteAlertRule(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusNotFound, "rule not found")
 		return
 	}
-	go LogAudit("user", "alert_rule_deleted", "alert_rule", id, nil)
+	go LogAudit(getAgentFromContext(r), "alert_rule_deleted", "alert_rule", id, nil)
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
 // GetAlertHistory handles GET /api/alerts/history
+// Each entry is one alert with its repeated occurrences folded in: first and
+// last seen, and how many evaluation passes saw it.
+// Filters: state (firing, resolved, silenced), rule_id, agent_id, acknowledged=false, limit.
 func GetAlertHistory(w http.ResponseWriter, r *http.Request) {
 	query := `
-		SELECT ah.id, ah.rule_id, COALESCE(ar.name,''), ah.agent_id, ah.triggered_at, COALESCE(ah.message,''), ah.acknowledged
+		SELECT ah.id, ah.rule_id, COALESCE(ar.name,''), ah.agent_id, ah.fingerprint, ah.state, ah.triggered_at,
+		       COALESCE(ah.last_seen_at, ah.triggered_at), ah.occurrences, ah.resolved_at, ah.silenced_until,
+		       COALESCE(ah.message,''), ah.acknowledged
 		FROM alert_history ah
 		LEFT JOIN alert_rules ar ON ar.id = ah.rule_id
 		WHERE 1=1
@@ -226,12 +335,36 @@ func GetAlertHistory(w http.ResponseWriter, r *http.Request) {
 	args := []interface{}{}
 	argCount := 1
 
-	if ack := r.URL.Query().Get("acknowledged"); ack == "false" {
+	q := r.URL.Query()
+	if ack := q.Get("acknowledged"); ack == "false" {
 		query += " AND ah.acknowledged = false"
 	}
+	if state := q.Get("state"); state != "" {
+		if state != AlertFiring && state != AlertResolved && state != AlertSilenced {
+			respondError(w, http.StatusBadRequest, "state must be firing, resolved or silenced")
+			return
+		}
+		query += fmt.Sprintf(" AND ah.state = $%d", argCount)
+		args = append(args, state)
+		argCount++
+	}
+	if ruleID := q.Get("rule_id"); ruleID != "" {
+		query += fmt.Sprintf(" AND ah.rule_id::text = $%d", argCount)
+		args = append(args, ruleID)
+		argCount++
+	}
+	if agentID := q.Get("agent_id"); agentID != "" {
+		query += fmt.Sprintf(" AND ah.agent_id = $%d", argCount)
+		args = append(args, agentID)
+		argCount++
+	}
+	limit := 200
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 && n <= 1000 {
+		limit = n
+	}
 
-	query += " ORDER BY ah.triggered_at DESC LIMIT 200"
-	_ = argCount
+	query += fmt.Sprintf(" ORDER BY COALESCE(ah.last_seen_at, ah.triggered_at) DESC LIMIT $%d", argCount)
+	args = append(args, limit)
 
 	rows, err := db.DB.Query(query, args...)
 	if err != nil {
@@ -244,31 +377,103 @@ func GetAlertHistory(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var h AlertHistory
 		var agentID sql.NullString
-		err := rows.Scan(&h.ID, &h.RuleID, &h.RuleName, &agentID, &h.TriggeredAt, &h.Message, &h.Acknowledged)
+		var resolvedAt, silencedUntil sql.NullTime
+		err := rows.Scan(&h.ID, &h.RuleID, &h.RuleName, &agentID, &h.Fingerprint, &h.State, &h.TriggeredAt,
+			&h.LastSeenAt, &h.Count, &resolvedAt, &silencedUntil, &h.Message, &h.Acknowledged)
 		if err != nil {
 			continue
 		}
 		if agentID.Valid {
 			h.AgentID = &agentID.String
 		}
+		if resolvedAt.Valid {
+			h.ResolvedAt = &resolvedAt.Time
+		}
+		if silencedUntil.Valid {
+			h.SilencedUntil = &silencedUntil.Time
+		}
 		history = append(history, h)
 	}
 	respondJSON(w, http.StatusOK, history)
 }
 
-// AcknowledgeAlert handles POST /api/alerts/history/{id}/acknowledge
-func AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+// SilenceAlert handles POST /api/alerts/history/{id}/silence
+// Body: {"minutes": 60}. The alert keeps counting occurrences but sends
+// nothing, including its resolve notification, until the silence ends.
+func SilenceAlert(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	res, err := db.DB.Exec(`UPDATE alert_history SET acknowledged = true WHERE id = $1`, id)
+	var req struct {
+		Minutes int `json:"minutes"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+	}
+	if req.Minutes == 0 {
+		req.Minutes = 60
+	}
+	if req.Minutes < 0 || req.Minutes > 30*24*60 {
+		respondError(w, http.StatusBadRequest, "minutes must be between 1 and 43200")
+		return
+	}
+	var until time.Time
+	err := db.DB.QueryRow(`
+		UPDATE alert_history SET state = 'silenced', silenced_until = NOW() + make_interval(mins => $2)
+		WHERE id = $1 AND state <> 'resolved'
+		RETURNING silenced_until`, id, req.Minutes).Scan(&until)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "no open alert with that id")
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
+	go LogAudit(getAgentFromContext(r), "alert_silenced", "alert", id, map[string]interface{}{"minutes": req.Minutes})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"status": AlertSilenced, "silenced_until": until})
+}
+
+// UnsilenceAlert handles DELETE /api/alerts/history/{id}/silence
+func UnsilenceAlert(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	res, err := db.DB.Exec(`
+		UPDATE alert_history SET state = 'firing', silenced_until = NULL
+		WHERE id = $1 AND state = 'silenced'`, id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondError(w, http.StatusNotFound, "no silenced alert with that id")
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "alert_unsilenced", "alert", id, nil)
+	respondJSON(w, http.StatusOK, map[string]string{"status": AlertFiring})
+}
+
+// AcknowledgeAlert handles POST /api/alerts/history/{id}/acknowledge
+func AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var ruleID, ruleName, agentID, message string
+	err := db.DB.QueryRow(`
+		UPDATE alert_history h SET acknowledged = true
+		FROM alert_rules r
+		WHERE h.id = $1 AND r.id = h.rule_id
+		RETURNING h.rule_id, r.name, COALESCE(h.agent_id, ''), COALESCE(h.message, '')`, id).Scan(&ruleID, &ruleName, &agentID, &message)
+	if err == sql.ErrNoRows {
 		respondError(w, http.StatusNotFound, "alert not found")
 		return
 	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go TriggerWebhooks(EventAlertAcknowledged, map[string]interface{}{
+		"alert_id": id, "rule_id": ruleID, "rule": ruleName, "agent_id": agentID,
+		"message": message, "acknowledged_by": getAgentFromContext(r),
+	})
 	respondJSON(w, http.StatusOK, map[string]string{"status": "acknowledged"})
 }
 
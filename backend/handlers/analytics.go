@@ -20,10 +20,10 @@ func (h *AnalyticsHandler) GetOverview(w http.ResponseWriter, r *http.Request) {
 	db.DB.QueryRow(`SELECT COUNT(*) FROM tasks`).Scan(&totalTasks)
 
 	var completedThisWeek int
-	db.DB.QueryRow(`SELECT COUNT(*) FROM tasks WHERE status = 'done' AND completed_at >= date_trunc('week', NOW())`).Scan(&completedThisWeek)
+	db.DB.QueryRow(`SELECT COUNT(*) FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at >= date_trunc('week', NOW())`).Scan(&completedThisWeek)
 
 	var avgHours *float64
-	db.DB.QueryRow(`SELECT AVG(EXTRACT(EPOCH FROM (completed_at - created_at)) / 3600) FROM tasks WHERE status = 'done' AND completed_at IS NOT NULL`).Scan(&avgHours)
+	db.DB.QueryRow(`SELECT AVG(EXTRACT(EPOCH FROM (completed_at - created_at)) / 3600) FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at IS NOT NULL`).Scan(&avgHours)
 
 	var agentsActiveToday int
 	db.DB.QueryRow(`SELECT COUNT(DISTINCT agent_id) FROM activity_log WHERE created_at >= CURRENT_DATE`).Scan(&agentsActiveToday)
@@ -55,12 +55,12 @@ func (h *AnalyticsHandler) GetAgentAnalytics(w http.ResponseWriter, r *http.Requ
 		LEFT JOIN (
 			SELECT assignee, COUNT(*) AS cnt,
 				AVG(EXTRACT(EPOCH FROM (completed_at - created_at)) / 3600) AS avg_hours
-			FROM tasks WHERE status = 'done' AND completed_at IS NOT NULL
+			FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at IS NOT NULL
 			GROUP BY assignee
 		) done ON done.assignee = a.id
 		LEFT JOIN (
 			SELECT assignee, COUNT(*) AS cnt
-			FROM tasks WHERE status IN ('progress', 'todo')
+			FROM tasks WHERE status IN ` + sqlStatusList(StatusActive, StatusTodo) + `
 			GROUP BY assignee
 		) prog ON prog.assignee = a.id
 		ORDER BY completed DESC
@@ -112,7 +112,7 @@ func (h *AnalyticsHandler) GetThroughput(w http.ResponseWriter, r *http.Request)
 		FROM generate_series(NOW() - ($1 || ' days')::interval, NOW(), '1 day') d
 		LEFT JOIN (
 			SELECT completed_at::date AS day, COUNT(*) AS cnt
-			FROM tasks WHERE status = 'done' AND completed_at >= NOW() - ($1 || ' days')::interval
+			FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at >= NOW() - ($1 || ' days')::interval
 			GROUP BY day
 		) t ON t.day = d::date
 		ORDER BY date
@@ -148,8 +148,8 @@ func (h *AnalyticsHandler) GetTeamAnalytics(w http.ResponseWriter, r *http.Reque
 	rows, err := db.DB.Query(`
 		SELECT
 			COALESCE(a.team, 'unassigned') AS team,
-			COUNT(*) FILTER (WHERE t.status = 'done') AS completed,
-			COUNT(*) FILTER (WHERE t.status IN ('progress', 'todo')) AS in_progress,
+			COUNT(*) FILTER (WHERE t.status IN ` + sqlStatusList(StatusDone) + `) AS completed,
+			COUNT(*) FILTER (WHERE t.status IN ` + sqlStatusList(StatusActive, StatusTodo) + `) AS in_progress,
 			COUNT(*) AS total
 		FROM tasks t
 		LEFT JOIN agents a ON a.id = t.assignee
@@ -246,7 +246,7 @@ func (h *AnalyticsHandler) GetTrends(w http.ResponseWriter, r *http.Request) {
 			FROM generate_series(NOW() - $1::interval, NOW(), '1 day') d
 			LEFT JOIN (
 				SELECT completed_at::date AS day, COUNT(*)::float AS cnt
-				FROM tasks WHERE status = 'done' AND completed_at > NOW() - $1::interval
+				FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at > NOW() - $1::interval
 				GROUP BY day
 			) t ON t.day = d::date ORDER BY d::date`, interval)
 		if e != nil {
@@ -313,7 +313,7 @@ func (h *AnalyticsHandler) GetTrends(w http.ResponseWriter, r *http.Request) {
 			LEFT JOIN (
 				SELECT completed_at::date AS day,
 					COUNT(*)::float / GREATEST(COUNT(DISTINCT assignee), 1) AS velocity
-				FROM tasks WHERE status = 'done' AND completed_at > NOW() - $1::interval
+				FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at > NOW() - $1::interval
 				GROUP BY day
 			) v ON v.day = d::date ORDER BY d::date`, interval)
 		if e != nil {
@@ -351,6 +351,8 @@ func (h *AnalyticsHandler) GetTrends(w http.ResponseWriter, r *http.Request) {
 
 
 // GetCycleTime handles GET /api/analytics/cycle-time?range=30d
+// Cycle time runs from a task's first move into an active workflow status
+// to its completion.
 func (h *AnalyticsHandler) GetCycleTime(w http.ResponseWriter, r *http.Request) {
 	interval := costRangeToInterval(r.URL.Query().Get("range"))
 
@@ -358,14 +360,14 @@ func (h *AnalyticsHandler) GetCycleTime(w http.ResponseWriter, r *http.Request)
 	db.DB.QueryRow(`
 		SELECT COALESCE(AVG(hours),0), COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY hours),0),
 			COALESCE(PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY hours),0)
-		FROM (SELECT EXTRACT(EPOCH FROM (completed_at - created_at))/3600 AS hours
-			FROM tasks WHERE status='done' AND completed_at IS NOT NULL
+		FROM (SELECT EXTRACT(EPOCH FROM (completed_at - ` + sqlCycleStart() + `))/3600 AS hours
+			FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at IS NOT NULL
 			AND completed_at > NOW() - $1::interval) sub
 	`, interval).Scan(&avgHours, &medianHours, &p90Hours)
 
 	rows, err := db.DB.Query(`
-		SELECT COALESCE(priority,'unset'), AVG(EXTRACT(EPOCH FROM (completed_at - created_at))/3600), COUNT(*)
-		FROM tasks WHERE status='done' AND completed_at IS NOT NULL AND completed_at > NOW() - $1::interval
+		SELECT COALESCE(priority,'unset'), AVG(EXTRACT(EPOCH FROM (completed_at - ` + sqlCycleStart() + `))/3600), COUNT(*)
+		FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at IS NOT NULL AND completed_at > NOW() - $1::interval
 		GROUP BY priority ORDER BY priority
 	`, interval)
 	if err != nil {
@@ -389,8 +391,8 @@ func (h *AnalyticsHandler) GetCycleTime(w http.ResponseWriter, r *http.Request)
 		SELECT d::date, COALESCE(t.avg_h, 0)
 		FROM generate_series(NOW() - $1::interval, NOW(), '1 day') d
 		LEFT JOIN (
-			SELECT completed_at::date AS day, AVG(EXTRACT(EPOCH FROM (completed_at - created_at))/3600) AS avg_h
-			FROM tasks WHERE status='done' AND completed_at IS NOT NULL AND completed_at > NOW() - $1::interval
+			SELECT completed_at::date AS day, AVG(EXTRACT(EPOCH FROM (completed_at - ` + sqlCycleStart() + `))/3600) AS avg_h
+			FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at IS NOT NULL AND completed_at > NOW() - $1::interval
 			GROUP BY day
 		) t ON t.day = d::date ORDER BY d::date
 	`, interval)
@@ -469,13 +471,14 @@ func (h *AnalyticsHandler) GetDashboardSummary(w http.ResponseWriter, r *http.Re
 	var avgCycleHours, weeklyCost float64
 
 	db.DB.QueryRow(`SELECT COUNT(*) FROM tasks`).Scan(&totalTasks)
-	db.DB.QueryRow(`SELECT COUNT(*) FROM tasks WHERE status='done' AND completed_at >= date_trunc('week', NOW())`).Scan(&completedThisWeek)
+	db.DB.QueryRow(`SELECT COUNT(*) FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at >= date_trunc('week', NOW())`).Scan(&completedThisWeek)
 	db.DB.QueryRow(`SELECT COUNT(DISTINCT agent_id) FROM activity_log WHERE created_at >= CURRENT_DATE`).Scan(&activeAgentsToday)
-	db.DB.QueryRow(`SELECT COALESCE(AVG(EXTRACT(EPOCH FROM (completed_at - created_at))/3600),0) FROM tasks WHERE status='done' AND completed_at IS NOT NULL`).Scan(&avgCycleHours)
+	// Same cycle time as GetCycleTime: from the first active status to done
+	db.DB.QueryRow(`SELECT COALESCE(AVG(EXTRACT(EPOCH FROM (completed_at - ` + sqlCycleStart() + `))/3600),0) FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at IS NOT NULL`).Scan(&avgCycleHours)
 
 	var weeklyVelocity float64
 	db.DB.QueryRow(`SELECT COALESCE(COUNT(*)::float / GREATEST(EXTRACT(EPOCH FROM (NOW() - MIN(completed_at)))/604800, 1), 0)
-		FROM tasks WHERE status='done' AND completed_at >= NOW() - interval '28 days'`).Scan(&weeklyVelocity)
+		FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at >= NOW() - interval '28 days'`).Scan(&weeklyVelocity)
 
 	db.DB.QueryRow(`SELECT COALESCE(SUM(cost_usd),0) FROM agent_costs WHERE created_at >= date_trunc('month', NOW())`).Scan(&weeklyCost)
 
@@ -535,7 +538,7 @@ func (h *AnalyticsHandler) GetAgentRanking(w http.ResponseWriter, r *http.Reques
 		LEFT JOIN (
 			SELECT assignee, COUNT(*) AS cnt,
 				AVG(EXTRACT(EPOCH FROM (completed_at - created_at))/3600) AS avg_hours
-			FROM tasks WHERE status = 'done' AND completed_at > NOW() - $1::interval
+			FROM tasks WHERE status IN ` + sqlStatusList(StatusDone) + ` AND completed_at > NOW() - $1::interval
 			GROUP BY assignee
 		) done ON done.assignee = a.id
 		LEFT JOIN (
@@ -52,6 +52,9 @@ func (h *AnnotationHandler) CreateAnnotation(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	ann.AgentID = agentID
+	if agent := GetBoundAgent(r); agent != "" {
+		ann.Author = agent
+	}
 	if ann.Author == "" {
 		ann.Author = "ali"
 	}
@@ -2,23 +2,34 @@ package handlers
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/alghanim/agentboard/backend/db"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type APIKeyHandler struct{}
 
+// Keys look like nc_live_<12 hex key id>_<64 hex secret>. The part before the
+// second underscore is stored in key_prefix so validation touches one row.
+const apiKeyPrefix = "nc_live_"
+
 type APIKey struct {
 	ID        string     `json:"id"`
 	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix,omitempty"`
 	Role      string     `json:"role"`
+	Scopes    []string   `json:"scopes"`
+	AgentID   string     `json:"agent_id,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
 	LastUsed  *time.Time `json:"last_used"`
 	ExpiresAt *time.Time `json:"expires_at"`
@@ -26,7 +37,7 @@ type APIKey struct {
 
 // ListKeys handles GET /api/keys
 func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.DB.Query(`SELECT id, name, role, created_at, last_used, expires_at FROM api_keys ORDER BY created_at DESC`)
+	rows, err := db.DB.Query(`SELECT id, name, COALESCE(key_prefix,''), role, scopes, COALESCE(agent_id,''), created_at, last_used, expires_at FROM api_keys ORDER BY created_at DESC`)
 	if err != nil {
 		respondError(w, 500, err.Error())
 		return
@@ -37,7 +48,7 @@ func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var k APIKey
 		var lastUsed, expiresAt sql.NullTime
-		if err := rows.Scan(&k.ID, &k.Name, &k.Role, &k.CreatedAt, &lastUsed, &expiresAt); err != nil {
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.Role, pq.Array(&k.Scopes), &k.AgentID, &k.CreatedAt, &lastUsed, &expiresAt); err != nil {
 			respondError(w, 500, err.Error())
 			return
 		}
@@ -55,9 +66,11 @@ func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
 // CreateKey handles POST /api/keys
 func (h *APIKeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name          string `json:"name"`
-		Role          string `json:"role"`
-		ExpiresInDays *int   `json:"expires_in_days"`
+		Name          string   `json:"name"`
+		Role          string   `json:"role"`
+		ExpiresInDays *int     `json:"expires_in_days"`
+		Scopes        []string `json:"scopes"`
+		AgentID       string   `json:"agent_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, 400, "invalid JSON")
@@ -74,13 +87,40 @@ func (h *APIKeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
 		respondError(w, 400, "role must be admin, member, or viewer")
 		return
 	}
+	if s := unknownScope(req.Scopes); s != "" {
+		respondError(w, 400, "unknown scope: "+s)
+		return
+	}
+	if req.Scopes == nil {
+		req.Scopes = []string{}
+	}
+	var boundAgent *string
+	if req.AgentID != "" {
+		if len(req.Scopes) == 0 {
+			respondError(w, 400, "agent-bound keys need scopes (see GET /api/keys/scopes)")
+			return
+		}
+		var exists bool
+		db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM agents WHERE id = $1)`, req.AgentID).Scan(&exists)
+		if !exists {
+			respondError(w, 400, "agent not found: "+req.AgentID)
+			return
+		}
+		boundAgent = &req.AgentID
+	}
 
+	rawID := make([]byte, 6)
 	rawKey := make([]byte, 32)
+	if _, err := rand.Read(rawID); err != nil {
+		respondError(w, 500, "failed to generate key")
+		return
+	}
 	if _, err := rand.Read(rawKey); err != nil {
 		respondError(w, 500, "failed to generate key")
 		return
 	}
-	plaintext := "nb_" + hex.EncodeToString(rawKey)
+	prefix := apiKeyPrefix + hex.EncodeToString(rawID)
+	plaintext := prefix + "_" + hex.EncodeToString(rawKey)
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), bcrypt.DefaultCost)
 	if err != nil {
@@ -97,8 +137,8 @@ func (h *APIKeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
 	var id string
 	var createdAt time.Time
 	err = db.DB.QueryRow(
-		`INSERT INTO api_keys (key_hash, name, role, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
-		string(hash), req.Name, req.Role, expiresAt,
+		`INSERT INTO api_keys (key_hash, key_prefix, name, role, scopes, agent_id, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`,
+		string(hash), prefix, req.Name, req.Role, pq.Array(req.Scopes), boundAgent, expiresAt,
 	).Scan(&id, &createdAt)
 	if err != nil {
 		respondError(w, 500, err.Error())
@@ -108,8 +148,11 @@ func (h *APIKeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, 201, map[string]interface{}{
 		"id":         id,
 		"key":        plaintext,
+		"prefix":     prefix,
 		"name":       req.Name,
 		"role":       req.Role,
+		"scopes":     req.Scopes,
+		"agent_id":   req.AgentID,
 		"created_at": createdAt,
 		"expires_at": expiresAt,
 	})
@@ -127,5 +170,77 @@ func (h *APIKeyHandler) DeleteKey(w http.ResponseWriter, r *http.Request) {
 		respondError(w, 404, "API key not found")
 		return
 	}
+	apiKeyCache.invalidate(id)
 	respondJSON(w, 200, map[string]string{"message": "API key revoked"})
 }
+
+// ─── Verified key cache ──────────────────────────────────────────────────────
+
+// apiKeyCacheTTL bounds how long a verified key skips bcrypt. Deleting a key
+// invalidates it immediately; other changes (expiry) are picked up within the TTL.
+const apiKeyCacheTTL = 60 * time.Second
+
+type cachedAPIKey struct {
+	key      *APIKeyIdentity
+	expires  time.Time // cache entry expiry
+	keyUntil *time.Time
+}
+
+type verifiedKeyCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedAPIKey // sha256(key) -> verified key
+}
+
+var apiKeyCache = &verifiedKeyCache{entries: map[string]cachedAPIKey{}}
+
+func apiKeyDigest(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *verifiedKeyCache) get(apiKey string) (cachedAPIKey, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	digest := apiKeyDigest(apiKey)
+	e, ok := c.entries[digest]
+	if !ok {
+		return e, false
+	}
+	now := time.Now()
+	if now.After(e.expires) || (e.keyUntil != nil && now.After(*e.keyUntil)) {
+		delete(c.entries, digest)
+		return e, false
+	}
+	return e, true
+}
+
+func (c *verifiedKeyCache) put(apiKey string, e cachedAPIKey) {
+	e.expires = time.Now().Add(apiKeyCacheTTL)
+	c.mu.Lock()
+	c.entries[apiKeyDigest(apiKey)] = e
+	c.mu.Unlock()
+}
+
+// invalidate drops every cached entry for the given api_keys row.
+func (c *verifiedKeyCache) invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for digest, e := range c.entries {
+		if e.key.ID == id {
+			delete(c.entries, digest)
+		}
+	}
+}
+
+// splitAPIKeyPrefix returns the nc_live_<id> prefix of a key, or "" for legacy keys.
+func splitAPIKeyPrefix(apiKey string) string {
+	if !strings.HasPrefix(apiKey, apiKeyPrefix) {
+		return ""
+	}
+	rest := apiKey[len(apiKeyPrefix):]
+	idx := strings.IndexByte(rest, '_')
+	if idx <= 0 {
+		return ""
+	}
+	return apiKeyPrefix + rest[:idx]
+}
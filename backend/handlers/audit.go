@@ -15,6 +15,7 @@ type AuditLog struct {
 	ID         string      `json:"id"`
 	Timestamp  string      `json:"timestamp"`
 	User       string      `json:"user"`
+	UserName   string      `json:"user_name,omitempty"` // resolved when "user" is a dashboard account ID
 	Action     string      `json:"action"`
 	EntityType string      `json:"entity_type"`
 	EntityID   string      `json:"entity_id"`
@@ -54,24 +55,26 @@ func GetAuditLog(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	query := `SELECT id, timestamp, COALESCE("user",'user'), action,
-	                 COALESCE(entity_type,''), COALESCE(entity_id,''), details
-	          FROM audit_logs WHERE 1=1`
+	query := `SELECT a.id, a.timestamp, COALESCE(a."user",'user'), COALESCE(u.username,''), a.action,
+	                 COALESCE(a.entity_type,''), COALESCE(a.entity_id,''), a.details
+	          FROM audit_logs a
+	          LEFT JOIN users u ON u.id::text = a."user"
+	          WHERE 1=1`
 	args := []interface{}{}
 	argCount := 1
 
 	if entityType != "" {
-		query += fmt.Sprintf(" AND entity_type = $%d", argCount)
+		query += fmt.Sprintf(" AND a.entity_type = $%d", argCount)
 		args = append(args, entityType)
 		argCount++
 	}
 	if actionFilter != "" {
-		query += fmt.Sprintf(" AND action = $%d", argCount)
+		query += fmt.Sprintf(" AND a.action = $%d", argCount)
 		args = append(args, actionFilter)
 		argCount++
 	}
 
-	query += fmt.Sprintf(" ORDER BY timestamp DESC LIMIT $%d", argCount)
+	query += fmt.Sprintf(" ORDER BY a.timestamp DESC LIMIT $%d", argCount)
 	args = append(args, limit)
 
 	rows, err := db.DB.Query(query, args...)
@@ -85,7 +88,7 @@ func GetAuditLog(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var entry AuditLog
 		var detailsRaw []byte
-		if err := rows.Scan(&entry.ID, &entry.Timestamp, &entry.User, &entry.Action,
+		if err := rows.Scan(&entry.ID, &entry.Timestamp, &entry.User, &entry.UserName, &entry.Action,
 			&entry.EntityType, &entry.EntityID, &detailsRaw); err != nil {
 			continue
 		}
@@ -2,9 +2,7 @@ package handlers
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,6 +14,7 @@ import (
 
 	"github.com/alghanim/agentboard/backend/db"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -23,7 +22,10 @@ import (
 
 type contextKey string
 
-const roleContextKey contextKey = "user_role"
+const (
+	roleContextKey contextKey = "user_role"
+	userContextKey contextKey = "user"
+)
 
 // GetRoleFromContext extracts the role stored by auth middleware.
 func GetRoleFromContext(r *http.Request) string {
@@ -33,27 +35,13 @@ func GetRoleFromContext(r *http.Request) string {
 	return ""
 }
 
-// ─── JWT secret (generated once on startup) ───────────────────────────────────
-
-var (
-	jwtSecret     []byte
-	jwtSecretOnce sync.Once
-)
-
-func getJWTSecret() []byte {
-	jwtSecretOnce.Do(func() {
-		if s := os.Getenv("JWT_SECRET"); s != "" {
-			jwtSecret = []byte(s)
-			return
-		}
-		b := make([]byte, 32)
-		if _, err := rand.Read(b); err != nil {
-			log.Fatalf("auth: failed to generate JWT secret: %v", err)
-		}
-		jwtSecret = []byte(hex.EncodeToString(b))
-		log.Printf("⚠️  JWT_SECRET not set — generated ephemeral secret (tokens will invalidate on restart)")
-	})
-	return jwtSecret
+// GetUserFromContext returns the logged-in user attached by auth middleware, or nil
+// for API-key and anonymous requests.
+func GetUserFromContext(r *http.Request) *AuthUser {
+	if u, ok := r.Context().Value(userContextKey).(*AuthUser); ok {
+		return u
+	}
+	return nil
 }
 
 // ─── Password hash ────────────────────────────────────────────────────────────
@@ -88,42 +76,86 @@ func getPasswordHash() string {
 type AuthHandler struct{}
 
 func init() {
-	go func() {
-		getJWTSecret()
-		getPasswordHash()
-	}()
+	go getPasswordHash()
 }
 
 // POST /api/auth/login
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var body struct {
+		Username string `json:"username"`
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
 		return
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(getPasswordHash()), []byte(body.Password)); err != nil {
-		http.Error(w, `{"error":"invalid password"}`, http.StatusUnauthorized)
+	// Older clients only send a password — treat that as the bootstrap admin.
+	if body.Username == "" {
+		body.Username = "admin"
+		if u := os.Getenv("AGENTBOARD_ADMIN_USER"); u != "" {
+			body.Username = u
+		}
+	}
+
+	ip := clientIP(r)
+	if wait := loginLimiter.retryAfter(loginIPKey(ip), loginAccountKey(body.Username)); wait > 0 {
+		respondThrottled(w, wait)
+		return
+	}
+
+	var user AuthUser
+	var hash sql.NullString
+	err := db.DB.QueryRow(
+		`SELECT id, username, role, password_hash FROM users WHERE username = $1 AND disabled = false`,
+		body.Username,
+	).Scan(&user.ID, &user.Username, &user.Role, &hash)
+	if err != nil || !hash.Valid {
+		// Burn a comparison anyway so unknown usernames aren't distinguishable by timing.
+		bcrypt.CompareHashAndPassword([]byte(getPasswordHash()), []byte(body.Password))
+		recordLoginFailure(ip, body.Username, "unknown_user")
+		http.Error(w, `{"error":"invalid username or password"}`, http.StatusUnauthorized)
 		return
 	}
-	claims := jwt.MapClaims{
-		"sub": "admin",
-		"iat": time.Now().Unix(),
-		"exp": time.Now().Add(24 * time.Hour).Unix(),
+	if err := bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(body.Password)); err != nil {
+		recordLoginFailure(ip, body.Username, "bad_password")
+		http.Error(w, `{"error":"invalid username or password"}`, http.StatusUnauthorized)
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(getJWTSecret())
+	loginLimiter.reset(loginAccountKey(body.Username))
+
+	pair, err := startSession(r, &user, "password")
 	if err != nil {
 		http.Error(w, `{"error":"token generation failed"}`, http.StatusInternalServerError)
 		return
 	}
+	db.DB.Exec(`UPDATE users SET last_login = NOW() WHERE id = $1`, user.ID)
+	go LogAudit(user.ID, "user_login", "user", user.ID, nil)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": signed})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token": pair.Token, "refresh_token": pair.RefreshToken, "expires_in": pair.ExpiresIn, "user": user,
+	})
 }
 
-// POST /api/auth/logout
+// POST /api/auth/logout — revokes the session of the bearer token (or of the
+// refresh token in the body), so neither can be used again.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	sid := ""
+	if token, ok := validateToken(r); ok {
+		sid, _ = token.Claims.(jwt.MapClaims)["sid"].(string)
+	}
+	if sid == "" && body.RefreshToken != "" {
+		db.DB.QueryRow(`SELECT id FROM user_sessions WHERE refresh_token_hash = $1`,
+			hashInviteToken(body.RefreshToken)).Scan(&sid)
+	}
+	if sid != "" {
+		revokeSession(sid, "logout")
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
 }
@@ -131,8 +163,26 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 // GET /api/auth/me
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	_, ok := validateToken(r)
-	json.NewEncoder(w).Encode(map[string]bool{"authenticated": ok})
+	user, ok := userFromToken(r)
+	resp := map[string]interface{}{"authenticated": ok, "auth_mode": GetAuthMode(), "sso": OIDCEnabled()}
+	if ok {
+		resp["user"] = user
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// issueToken signs a short-lived access token whose subject is the user's ID
+// and whose sid ties it to a session that can be revoked.
+func issueToken(user *AuthUser, sid string) (string, error) {
+	return signJWT(jwt.MapClaims{
+		"typ":      "access",
+		"sub":      user.ID,
+		"sid":      sid,
+		"username": user.Username,
+		"role":     user.Role,
+		"iat":      time.Now().Unix(),
+		"exp":      time.Now().Add(accessTokenTTL).Unix(),
+	})
 }
 
 // ─── Token validation helper ─────────────────────────────────────────────────
@@ -142,34 +192,63 @@ func validateToken(r *http.Request) (*jwt.Token, bool) {
 	if !strings.HasPrefix(auth, "Bearer ") {
 		return nil, false
 	}
-	tokenStr := strings.TrimPrefix(auth, "Bearer ")
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return getJWTSecret(), nil
-	})
-	if err != nil || !token.Valid {
+	claims := jwt.MapClaims{}
+	token, err := parseJWT(strings.TrimPrefix(auth, "Bearer "), claims)
+	if err != nil || !token.Valid || claims["typ"] != "access" {
+		return nil, false
+	}
+	// Logged-out and killed sessions are on the revocation list.
+	sid, _ := claims["sid"].(string)
+	if sid == "" || revocations.isRevoked(sid) {
 		return nil, false
 	}
 	return token, true
 }
 
+// userFromToken validates the bearer token and resolves its subject to an
+// active user. Role changes and disables take effect on the next request.
+func userFromToken(r *http.Request) (*AuthUser, bool) {
+	token, ok := validateToken(r)
+	if !ok {
+		return nil, false
+	}
+	sub, err := token.Claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, false
+	}
+	return loadAuthUser(sub)
+}
+
 // ─── API Key validation ──────────────────────────────────────────────────────
 
-// validateAPIKey checks the X-API-Key header against stored keys.
-// Returns the role if valid, empty string if not.
-func validateAPIKey(apiKey string) (string, bool) {
-	rows, err := db.DB.Query(`SELECT id, key_hash, role, expires_at FROM api_keys`)
+// validateAPIKey checks the X-API-Key header against stored keys and returns
+// the key's identity (role, scopes, bound agent) if valid.
+// Prefixed keys are looked up by key_prefix and verified with a single bcrypt
+// comparison; recently verified keys are served from apiKeyCache.
+func validateAPIKey(apiKey string) (*APIKeyIdentity, bool) {
+	if cached, ok := apiKeyCache.get(apiKey); ok {
+		return cached.key, true
+	}
+
+	const cols = `SELECT id, key_hash, role, scopes, COALESCE(agent_id,''), expires_at FROM api_keys`
+	var rows *sql.Rows
+	var err error
+	if prefix := splitAPIKeyPrefix(apiKey); prefix != "" {
+		rows, err = db.DB.Query(cols+` WHERE key_prefix = $1`, prefix)
+	} else {
+		// Legacy nb_ keys predate prefixes; only they need the slow scan.
+		rows, err = db.DB.Query(cols + ` WHERE key_prefix IS NULL`)
+	}
 	if err != nil {
-		return "", false
+		return nil, false
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var id, keyHash, role string
+		var keyHash string
+		var key APIKeyIdentity
 		var expiresAt sql.NullTime
-		if err := rows.Scan(&id, &keyHash, &role, &expiresAt); err != nil {
+		if err := rows.Scan(&key.ID, &keyHash, &key.Role, pq.Array(&key.Scopes), &key.AgentID, &expiresAt); err != nil {
 			continue
 		}
 		// Check expiry
@@ -177,12 +256,17 @@ func validateAPIKey(apiKey string) (string, bool) {
 			continue
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(keyHash), []byte(apiKey)); err == nil {
-			// Update last_used
-			go db.DB.Exec(`UPDATE api_keys SET last_used = NOW() WHERE id = $1`, id)
-			return role, true
+			entry := cachedAPIKey{key: &key}
+			if expiresAt.Valid {
+				entry.keyUntil = &expiresAt.Time
+			}
+			apiKeyCache.put(apiKey, entry)
+			// Update last_used (at most once per cache TTL)
+			go db.DB.Exec(`UPDATE api_keys SET last_used = NOW() WHERE id = $1`, key.ID)
+			return &key, true
 		}
 	}
-	return "", false
+	return nil, false
 }
 
 // ─── Role hierarchy ──────────────────────────────────────────────────────────
@@ -211,48 +295,152 @@ func RequireRole(minRole string) func(http.Handler) http.Handler {
 	}
 }
 
+// ─── Auth mode ───────────────────────────────────────────────────────────────
+
+// Server-wide auth modes, selected with AGENTBOARD_AUTH_MODE.
+const (
+	AuthModeOpen       = "open"        // no login required; anonymous callers act as admin
+	AuthModePublicRead = "public-read" // anonymous callers may read as viewer; writes need a login
+	AuthModePrivate    = "private"     // every request needs a login or API key
+)
+
+var (
+	authMode     string
+	authModeOnce sync.Once
+)
+
+// GetAuthMode returns the configured auth mode (default: public-read).
+func GetAuthMode() string {
+	authModeOnce.Do(func() {
+		authMode = strings.ToLower(os.Getenv("AGENTBOARD_AUTH_MODE"))
+		switch authMode {
+		case AuthModeOpen:
+			log.Printf("⚠️  AGENTBOARD_AUTH_MODE=open — the API is reachable without login")
+		case AuthModePrivate:
+		case "":
+			authMode = AuthModePublicRead
+		default:
+			log.Printf("⚠️  Unknown AGENTBOARD_AUTH_MODE %q — falling back to %s", authMode, AuthModePublicRead)
+			authMode = AuthModePublicRead
+		}
+	})
+	return authMode
+}
+
+// anonymousRole is the role granted to unauthenticated requests, or "" if they
+// must be rejected.
+func anonymousRole(method string) string {
+	switch GetAuthMode() {
+	case AuthModeOpen:
+		return "admin"
+	case AuthModePublicRead:
+		if method == http.MethodGet || method == http.MethodOptions {
+			return "viewer"
+		}
+	}
+	return ""
+}
+
 // ─── Auth middleware ──────────────────────────────────────────────────────────
 
-// RequireAuth wraps write endpoints (POST/PUT/DELETE).
-// GET requests are always passed through.
+// RequireAuth authenticates every API request by X-API-Key or bearer token and
+// stores the caller's role in the context. Unauthenticated requests get the
+// anonymous role of the current auth mode, or 401. Viewers are read-only.
 // Auth endpoints themselves (/api/auth/*) are always allowed.
+// JWT holders get the role of their user account. Scoped and agent-bound API
+// keys are further restricted by authorizeAPIKey.
 func RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Always allow auth endpoints
-		if strings.HasPrefix(r.URL.Path, "/api/auth/") {
+		// Always allow auth endpoints and CORS preflights
+		if strings.HasPrefix(r.URL.Path, "/api/auth/") || r.Method == http.MethodOptions {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Check for API key first
+		ctx := r.Context()
+		var role string
+
 		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
-			if role, ok := validateAPIKey(apiKey); ok {
-				ctx := context.WithValue(r.Context(), roleContextKey, role)
-				next.ServeHTTP(w, r.WithContext(ctx))
+			ip := clientIP(r)
+			if wait := loginLimiter.retryAfter(apiKeyIPKey(ip)); wait > 0 {
+				respondThrottled(w, wait)
+				return
+			}
+			key, ok := validateAPIKey(apiKey)
+			if !ok {
+				recordAPIKeyFailure(ip, apiKey)
+				// API key provided but invalid
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid API key"})
+				return
+			}
+			if status, msg := authorizeAPIKey(r, key); status != 0 {
+				respondError(w, status, msg)
 				return
 			}
-			// API key provided but invalid
+			role = key.Role
+			ctx = context.WithValue(ctx, roleContextKey, role)
+			ctx = context.WithValue(ctx, apiKeyContextKey, key)
+		} else if user, ok := userFromToken(r); ok {
+			role = user.Role
+			ctx = withUser(ctx, user)
+		} else if role = anonymousRole(r.Method); role != "" {
+			ctx = context.WithValue(ctx, roleContextKey, role)
+		} else {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "invalid API key"})
+			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
 			return
 		}
 
-		// Let GETs and OPTIONS through; only protect writes with JWT
-		if r.Method == http.MethodGet || r.Method == http.MethodOptions {
-			next.ServeHTTP(w, r)
+		if r.Method != http.MethodGet && roleLevel[role] < roleLevel["member"] {
+			respondError(w, http.StatusForbidden, "viewers have read-only access")
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		_, ok := validateToken(r)
+// RoleHandler wraps a single route with RequireRole, for routes that can't be
+// grouped under their own subrouter.
+func RoleHandler(minRole string, h http.HandlerFunc) http.Handler {
+	return RequireRole(minRole)(h)
+}
+
+// AuthorizeWebSocket reports whether a /ws/stream upgrade may proceed. Browsers
+// can't set headers on WebSocket connections, so the bearer token may also be
+// passed as ?token= and the API key as ?api_key=.
+func AuthorizeWebSocket(r *http.Request) bool {
+	if anonymousRole(http.MethodGet) != "" {
+		return true
+	}
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		apiKey = r.URL.Query().Get("api_key")
+	}
+	if apiKey != "" {
+		ip := clientIP(r)
+		if loginLimiter.retryAfter(apiKeyIPKey(ip)) > 0 {
+			return false
+		}
+		_, ok := validateAPIKey(apiKey)
 		if !ok {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
-			return
+			recordAPIKeyFailure(ip, apiKey)
 		}
-		// JWT users get admin role
-		ctx := context.WithValue(r.Context(), roleContextKey, "admin")
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+		return ok
+	}
+	if r.Header.Get("Authorization") == "" {
+		if t := r.URL.Query().Get("token"); t != "" {
+			r.Header.Set("Authorization", "Bearer "+t)
+		}
+	}
+	_, ok := userFromToken(r)
+	return ok
+}
+
+// withUser attaches a logged-in user and their role to the context.
+func withUser(ctx context.Context, user *AuthUser) context.Context {
+	ctx = context.WithValue(ctx, userContextKey, user)
+	return context.WithValue(ctx, roleContextKey, user.Role)
 }
@@ -51,6 +51,12 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	comment.TaskID = taskID
+	// Logged-in users and agent-bound keys always comment as themselves
+	if user := GetUserFromContext(r); user != nil {
+		comment.Author = user.ID
+	} else if agent := GetBoundAgent(r); agent != "" {
+		comment.Author = agent
+	}
 
 	err := db.DB.QueryRow(
 		`INSERT INTO comments (task_id, author, content) VALUES ($1, $2, $3)
@@ -65,6 +71,9 @@ func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 
 	logActivity(comment.Author, "comment_added", taskID, map[string]string{"comment_id": comment.ID})
 	h.Hub.Broadcast("comment_added", comment)
+	go TriggerWebhooks(EventTaskCommented, map[string]interface{}{
+		"task_id": taskID, "comment_id": comment.ID, "author": comment.Author, "content": comment.Content,
+	})
 
 	respondJSON(w, http.StatusCreated, comment)
 }
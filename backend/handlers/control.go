@@ -19,8 +19,11 @@ func (h *AgentControlHandler) Kill(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	updateAgentDBStatus(id, "killed")
+	previous := updateAgentDBStatus(id, "killed")
 	logActivity(id, "killed", "", nil)
+	go TriggerWebhooks(EventAgentKilled, map[string]interface{}{
+		"agent_id": id, "previous_status": previous, "actor": getAgentFromContext(r),
+	})
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Kill signal sent", "status": "killed"})
 }
 
@@ -31,8 +34,11 @@ func (h *AgentControlHandler) Pause(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	updateAgentDBStatus(id, "paused")
+	previous := updateAgentDBStatus(id, "paused")
 	logActivity(id, "paused", "", nil)
+	go TriggerWebhooks(EventAgentPaused, map[string]interface{}{
+		"agent_id": id, "previous_status": previous, "actor": getAgentFromContext(r),
+	})
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Pause signal sent", "status": "paused"})
 }
 
@@ -42,8 +48,11 @@ func (h *AgentControlHandler) Resume(w http.ResponseWriter, r *http.Request) {
 	// Remove both signal files
 	removeSignalFile(id, "PAUSE")
 	removeSignalFile(id, "KILL")
-	updateAgentDBStatus(id, "idle")
+	previous := updateAgentDBStatus(id, "idle")
 	logActivity(id, "resumed", "", nil)
+	go TriggerWebhooks(EventAgentResumed, map[string]interface{}{
+		"agent_id": id, "previous_status": previous, "actor": getAgentFromContext(r),
+	})
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Agent resumed", "status": "idle"})
 }
 
@@ -61,6 +70,12 @@ func removeSignalFile(agentID, signal string) {
 	os.Remove(filepath.Join(wsDir, signal))
 }
 
-func updateAgentDBStatus(agentID, status string) {
-	db.DB.Exec(`UPDATE agents SET status = $1, last_active = NOW() WHERE id = $2`, status, agentID)
+// updateAgentDBStatus sets the agent's status and returns the previous one.
+func updateAgentDBStatus(agentID, status string) string {
+	var previous string
+	db.DB.QueryRow(
+		`UPDATE agents a SET status = $1, last_active = NOW() FROM agents old
+		 WHERE a.id = $2 AND old.id = a.id
+		 RETURNING COALESCE(old.status, '')`, status, agentID).Scan(&previous)
+	return previous
 }
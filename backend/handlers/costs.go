@@ -27,6 +27,9 @@ func (h *CostsHandler) IngestCost(w http.ResponseWriter, r *http.Request) {
 		respondError(w, 400, "invalid JSON")
 		return
 	}
+	if agent := GetBoundAgent(r); agent != "" {
+		req.AgentID = agent
+	}
 	if req.AgentID == "" {
 		respondError(w, 400, "agent_id is required")
 		return
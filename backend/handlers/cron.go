@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ─── Cron expressions ────────────────────────────────────────────────────────
+//
+// Standard five-field cron: minute hour day-of-month month day-of-week.
+// Fields take *, values, ranges (a-b), lists (a,b) and steps (*/n, a-b/n).
+// Months and weekdays accept names (JAN, MON); Sunday is 0 or 7. When both
+// day fields are restricted a day matching either one fires, as in Vixie cron.
+// @yearly, @monthly, @weekly, @daily and @hourly are accepted as shorthands.
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronDayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// parseCron parses a cron expression.
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+
+	s := &cronSchedule{}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			ends := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = cronValue(ends[0], names); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(ends[1], names); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := cronValue(rng, names)
+			if err != nil {
+				return 0, err
+			}
+			// "a/n" runs from a to the end of the range
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dowOK
+	case s.dowStar:
+		return domOK
+	}
+	return domOK || dowOK
+}
+
+// next returns the first time after t, in loc, the schedule fires, or the
+// zero time if it never does within five years (e.g. "0 0 30 2 *").
+// Schedules follow the wall clock: a time repeated when clocks go back fires
+// once, and one skipped when they go forward fires that much later (02:30
+// becomes 03:30).
+func (s *cronSchedule) next(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	// Search wall-clock times in UTC, where every day has 24 hours
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	limit := wall.AddDate(5, 0, 0)
+	for {
+		if wall = s.nextWall(wall, limit); wall.IsZero() {
+			return time.Time{}
+		}
+		at := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+		if at.Hour() != wall.Hour() || at.Minute() != wall.Minute() {
+			// In a gap, time.Date reads wall with the offset after it,
+			// landing before the gap; read it with the one before instead
+			_, offset := at.Zone()
+			at = time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, time.FixedZone("", offset)).In(loc)
+		}
+		// In a repeated hour, time.Date picks the first occurrence, which
+		// t may already be past
+		if at.After(t) {
+			return at
+		}
+	}
+}
+
+// nextWall returns the first wall-clock time after wall (in UTC) the
+// schedule matches, or the zero time if there is none before limit.
+func (s *cronSchedule) nextWall(wall, limit time.Time) time.Time {
+	t := wall.Add(time.Minute)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
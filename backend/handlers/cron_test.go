@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// cronBits sets the bit of each value, as parseCronField does.
+func cronBits(values ...int) uint64 {
+	var b uint64
+	for _, v := range values {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+func TestParseCron(t *testing.T) {
+	all := func(lo, hi int) uint64 {
+		var b uint64
+		for v := lo; v <= hi; v++ {
+			b |= 1 << uint(v)
+		}
+		return b
+	}
+	tests := []struct {
+		expr                          string
+		minute, hour, dom, month, dow uint64
+	}{
+		{"* * * * *", all(0, 59), all(0, 23), all(1, 31), all(1, 12), all(0, 7)},
+		{"*/15 * * * *", cronBits(0, 15, 30, 45), all(0, 23), all(1, 31), all(1, 12), all(0, 7)},
+		{"5/20 9-17/4 * * *", cronBits(5, 25, 45), cronBits(9, 13, 17), all(1, 31), all(1, 12), all(0, 7)},
+		{"0 0 1,15 JAN,jul *", cronBits(0), cronBits(0), cronBits(1, 15), cronBits(1, 7), all(0, 7)},
+		{"0 0 * * MON-FRI", cronBits(0), cronBits(0), all(1, 31), all(1, 12), all(1, 5)},
+		{"0 0 * * 7", cronBits(0), cronBits(0), all(1, 31), all(1, 12), cronBits(0, 7)},
+		{"0 0 * * 5-7", cronBits(0), cronBits(0), all(1, 31), all(1, 12), cronBits(0, 5, 6, 7)},
+		{"@weekly", cronBits(0), cronBits(0), all(1, 31), all(1, 12), cronBits(0)},
+		{" @Hourly ", cronBits(0), all(0, 23), all(1, 31), all(1, 12), all(0, 7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []uint64{s.minute, s.hour, s.dom, s.month, s.dow}
+			want := []uint64{tt.minute, tt.hour, tt.dom, tt.month, tt.dow}
+			for i, field := range []string{"minute", "hour", "day of month", "month", "day of week"} {
+				if got[i] != want[i] {
+					t.Errorf("%s = %b, want %b", field, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "needs 5 fields"},
+		{"* * * *", "needs 5 fields"},
+		{"* * * * * *", "needs 5 fields"},
+		{"60 * * * *", "minute"},
+		{"* 24 * * *", "hour"},
+		{"* * 0 * *", "day of month"},
+		{"* * * 13 *", "month"},
+		{"* * * * 8", "day of week"},
+		{"*/0 * * * *", "bad step"},
+		{"*/x * * * *", "bad step"},
+		{"5-1 * * * *", "outside"},
+		{"x * * * *", "bad value"},
+		{"* * * FOO *", "bad value"},
+		{"* * * * MON-", "bad value"},
+		{"1,,2 * * * *", "bad value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseCron(tt.expr)
+			if err == nil {
+				t.Fatalf("parsed %q without error", tt.expr)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		zone string
+		from string
+		want []string // successive runs; "" for never
+	}{
+		{"steps and ranges", "*/20 9-10 * * *", "UTC", "2026-01-05T10:30:00Z",
+			[]string{"2026-01-05T10:40:00Z", "2026-01-06T09:00:00Z", "2026-01-06T09:20:00Z"}},
+		{"not at the current minute", "30 10 * * *", "UTC", "2026-01-05T10:30:00Z",
+			[]string{"2026-01-06T10:30:00Z"}},
+		{"7 is Sunday", "0 12 * * 7", "UTC", "2026-03-02T00:00:00Z",
+			[]string{"2026-03-08T12:00:00Z", "2026-03-15T12:00:00Z"}},
+		{"either day field", "0 0 13 * 5", "UTC", "2026-02-01T00:00:00Z",
+			[]string{"2026-02-06T00:00:00Z", "2026-02-13T00:00:00Z", "2026-02-20T00:00:00Z", "2026-02-27T00:00:00Z", "2026-03-06T00:00:00Z"}},
+		{"leap day", "0 0 29 2 *", "UTC", "2026-01-01T00:00:00Z",
+			[]string{"2028-02-29T00:00:00Z", "2032-02-29T00:00:00Z"}},
+		{"never fires", "0 0 30 2 *", "UTC", "2026-01-01T00:00:00Z",
+			[]string{""}},
+		{"in a named zone", "0 9 * * MON-FRI", "Asia/Kolkata", "2026-01-02T04:00:00Z",
+			[]string{"2026-01-05T09:00:00+05:30"}},
+		// America/New_York springs forward at 02:00 on 2026-03-08 and
+		// falls back at 02:00 on 2026-11-01
+		{"skipped by spring forward", "30 2 * * *", "America/New_York", "2026-03-07T12:00:00-05:00",
+			[]string{"2026-03-08T03:30:00-04:00", "2026-03-09T02:30:00-04:00"}},
+		{"hourly over spring forward", "0 * * * *", "America/New_York", "2026-03-08T00:30:00-05:00",
+			[]string{"2026-03-08T01:00:00-05:00", "2026-03-08T03:00:00-04:00", "2026-03-08T04:00:00-04:00"}},
+		{"repeated by fall back", "30 1 * * *", "America/New_York", "2026-10-31T12:00:00-04:00",
+			[]string{"2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"}},
+		{"from inside the repeated hour", "30 1 * * *", "America/New_York", "2026-11-01T01:10:00-05:00",
+			[]string{"2026-11-02T01:30:00-05:00"}},
+		{"hourly over fall back", "0 * * * *", "America/New_York", "2026-11-01T00:30:00-04:00",
+			[]string{"2026-11-01T01:00:00-04:00", "2026-11-01T02:00:00-05:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at, err := time.Parse(time.RFC3339, tt.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.want {
+				at = s.next(at, loc)
+				got := ""
+				if !at.IsZero() {
+					got = at.Format(time.RFC3339)
+				}
+				if got != want {
+					t.Fatalf("run %d = %q, want %q", i+1, got, want)
+				}
+			}
+		})
+	}
+}
@@ -31,25 +31,75 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Method:      "POST",
 			Path:        "/api/auth/login",
 			Category:    "Auth",
-			Description: "Authenticate with a password and receive a bearer token.",
+			Description: "Authenticate with a username and password and receive a bearer token.",
 			Params: []APIParam{
-				{Name: "password", In: "body", Type: "string", Required: true, Description: "Dashboard password"},
+				{Name: "username", In: "body", Type: "string", Required: false, Description: "Account username (default: the bootstrap admin)"},
+				{Name: "password", In: "body", Type: "string", Required: true, Description: "Account password"},
 			},
-			ExampleResponse: map[string]interface{}{"token": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."},
+			ExampleResponse: map[string]interface{}{"token": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...", "refresh_token": "9f3c...", "expires_in": 900, "user": map[string]interface{}{"id": "b2f1...", "username": "admin", "role": "admin"}},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/auth/refresh",
+			Category:    "Auth",
+			Description: "Exchange a refresh token for a new access token. The refresh token is rotated; reusing an old one revokes the session.",
+			Params: []APIParam{
+				{Name: "refresh_token", In: "body", Type: "string", Required: true, Description: "Refresh token from login or the previous refresh"},
+			},
+			ExampleResponse: map[string]interface{}{"token": "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9...", "refresh_token": "4a7e...", "expires_in": 900},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/auth/oidc/login",
+			Category:    "Auth",
+			Description: "Start single sign-on: redirects the browser to the configured OpenID Connect provider.",
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/auth/oidc/callback",
+			Category:    "Auth",
+			Description: "OpenID Connect redirect target. Verifies the ID token, maps IdP groups to a role and redirects to /#sso_token=<token>.",
 		},
 		{
 			Method:          "POST",
 			Path:            "/api/auth/logout",
 			Category:        "Auth",
-			Description:     "Invalidate the current bearer token.",
-			ExampleResponse: map[string]interface{}{"message": "Logged out"},
+			Description:     "Revoke the session of the current bearer token (or of refresh_token in the body).",
+			ExampleResponse: map[string]interface{}{"ok": true},
 		},
 		{
 			Method:          "GET",
 			Path:            "/api/auth/me",
 			Category:        "Auth",
 			Description:     "Return the currently authenticated user info.",
-			ExampleResponse: map[string]interface{}{"authenticated": true},
+			ExampleResponse: map[string]interface{}{"authenticated": true, "user": map[string]interface{}{"id": "b2f1...", "username": "admin", "role": "admin"}},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/auth/accept-invite",
+			Category:    "Auth",
+			Description: "Redeem an invite or reset token and set the account password.",
+			Params: []APIParam{
+				{Name: "token", In: "body", Type: "string", Required: true, Description: "Token from POST /api/users or /api/users/{id}/reset"},
+				{Name: "password", In: "body", Type: "string", Required: true, Description: "New password (min 8 characters)"},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/users",
+			Category:    "Auth",
+			Description: "Invite a user (admin only). Returns a one-time invite token.",
+			Params: []APIParam{
+				{Name: "username", In: "body", Type: "string", Required: true, Description: "Login name"},
+				{Name: "role", In: "body", Type: "string", Required: false, Description: "viewer, member (default) or admin"},
+			},
+			ExampleResponse: map[string]interface{}{"user": map[string]interface{}{"username": "sara", "role": "member", "pending": true}, "invite_token": "9f2c..."},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/users/{id}/disable",
+			Category:    "Auth",
+			Description: "Disable a user (admin only). Also available: /enable and /reset.",
 		},
 
 		// ── Agents ────────────────────────────────────────────────────────────
@@ -294,7 +344,7 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Method:      "PUT",
 			Path:        "/api/tasks/{id}",
 			Category:    "Tasks",
-			Description: "Update a task's fields.",
+			Description: "Update a task's fields. A status change is made as by POST /api/tasks/{id}/transition, with the same transition rules and guards, after the other fields are saved.",
 			Params: []APIParam{
 				{Name: "id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
 				{Name: "title", In: "body", Type: "string", Required: false, Description: "New title"},
@@ -316,12 +366,352 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Method:      "POST",
 			Path:        "/api/tasks/{id}/transition",
 			Category:    "Tasks",
-			Description: "Transition a task to a new status.",
+			Description: "Transition a task to a new status. The move must be allowed by the task's workflow and pass its guards (403 for a role guard, 422 for required fields or evaluation score).",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
+				{Name: "status", In: "body", Type: "string", Required: true, Description: "Target status; must be a status of the task's workflow"},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/tasks/{id}/workflow",
+			Category:    "Tasks",
+			Description: "Get the workflow governing a task (template's, else team's, else default) and the statuses it can move to next.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
+			},
+			ExampleResponse: map[string]interface{}{"status": "progress", "category": "active", "next": []string{"review", "blocked", "todo"}},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/workflows",
+			Category:    "Workflows",
+			Description: "List task workflows with their statuses, transitions, guards and assigned teams.",
+			ExampleResponse: []map[string]interface{}{{
+				"id": "uuid", "name": "qa", "initial_status": "todo", "is_default": false, "teams": []string{"qa"},
+				"statuses": []map[string]interface{}{
+					{"name": "todo", "category": "todo"}, {"name": "progress", "category": "active", "stuck_after_minutes": 240},
+					{"name": "qa", "category": "review"}, {"name": "awaiting-human", "category": "blocked"}, {"name": "done", "category": "done"},
+				},
+				"transitions": []map[string]interface{}{
+					{"from": "progress", "to": "qa"},
+					{"from": "qa", "to": "done", "guards": map[string]interface{}{"min_role": "member", "min_eval_score": 80, "required_fields": []string{"assignee"}}},
+					{"from": "done", "to": "progress"},
+				},
+			}},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/workflows",
+			Category:    "Workflows",
+			Description: "Create a workflow (admin only). Status categories are backlog, todo, active, review, blocked and done; a transition from \"*\" applies to every status.",
+			Params: []APIParam{
+				{Name: "name", In: "body", Type: "string", Required: true, Description: "Unique name"},
+				{Name: "statuses", In: "body", Type: "array", Required: true, Description: "[{name, label, category, stuck_after_minutes}]"},
+				{Name: "transitions", In: "body", Type: "array", Required: false, Description: "[{from, to, guards: {required_fields, min_role, min_eval_score}}]"},
+				{Name: "initial_status", In: "body", Type: "string", Required: false, Description: "Status for new tasks; defaults to the first status"},
+			},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/api/workflows/{id}",
+			Category:    "Workflows",
+			Description: "Replace a workflow definition (admin only). Returns 409 if tasks still sit in a status being removed.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Workflow UUID"},
+			},
+		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/workflows/{id}",
+			Category:    "Workflows",
+			Description: "Delete a non-default workflow (admin only); its teams and templates fall back to the default.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Workflow UUID"},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/workflows/{id}/default",
+			Category:    "Workflows",
+			Description: "Make a workflow the default for tasks without a team or template workflow (admin only).",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Workflow UUID"},
+			},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/api/workflows/teams/{team}",
+			Category:    "Workflows",
+			Description: "Pick the workflow for a team's tasks (admin only). An empty workflow_id reverts to the default.",
+			Params: []APIParam{
+				{Name: "team", In: "path", Type: "string", Required: true, Description: "Team name"},
+				{Name: "workflow_id", In: "body", Type: "string", Required: true, Description: "Workflow UUID or empty"},
+			},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/api/tasks/{id}/dependencies",
+			Category:    "Tasks",
+			Description: "Replace the tasks this task depends on. Self-references and unknown tasks return 400; a change that would close a cycle returns 409 with the cycle's path.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
+				{Name: "depends_on", In: "body", Type: "array", Required: true, Description: "Task UUIDs"},
+			},
+			ExampleResponse: map[string]interface{}{
+				"error": "dependency cycle: \"Ship\" (uuid-a) → \"Test\" (uuid-b) → \"Ship\" (uuid-a)",
+				"cycle": []string{"uuid-a", "uuid-b", "uuid-a"},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/tasks/graph/validate",
+			Category:    "Tasks",
+			Description: "Check stored dependencies for cycles, self-references, references to deleted tasks and duplicates.",
+			ExampleResponse: map[string]interface{}{
+				"valid": false, "tasks": 120, "edges": 87,
+				"cycles":             []map[string]interface{}{{"path": []string{"uuid-a", "uuid-b", "uuid-a"}, "description": "\"Ship\" (uuid-a) → \"Test\" (uuid-b) → \"Ship\" (uuid-a)"}},
+				"self_references":    []map[string]interface{}{},
+				"missing_references": []map[string]interface{}{{"task_id": "uuid", "title": "Deploy", "ref_id": "uuid-gone"}},
+				"duplicates":         []map[string]interface{}{},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/tasks/{id}/readiness",
+			Category:    "Tasks",
+			Description: "Whether a task may start: its open dependencies and its workflow's ready status. Moving a task into an active status returns 409 while dependencies are open; finished dependencies release it to the ready status automatically.",
 			Params: []APIParam{
 				{Name: "id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
-				{Name: "status", In: "body", Type: "string", Required: true, Description: "Target status: todo | in-progress | done | blocked"},
+			},
+			ExampleResponse: map[string]interface{}{
+				"task_id": "uuid", "status": "todo", "ready": false, "ready_status": "next",
+				"open_dependencies": []map[string]interface{}{{"id": "uuid", "title": "Design API", "status": "review"}},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/queue/claim",
+			Category:    "Queue",
+			Description: "Atomically lease the most urgent ready task for an agent and assign it to them. Matches the agent's team, \"role:<name>\" labels (tasks without one fit any role) and, if given, any of labels. Returns 204 when the queue is empty.",
+			Params: []APIParam{
+				{Name: "agent_id", In: "body", Type: "string", Required: false, Description: "Claiming agent; implied by an agent-bound API key"},
+				{Name: "team", In: "body", Type: "string", Required: false, Description: "Override the agent's team (empty matches any team)"},
+				{Name: "role", In: "body", Type: "string", Required: false, Description: "Override the agent's role"},
+				{Name: "labels", In: "body", Type: "array", Required: false, Description: "Only tasks with at least one of these labels"},
+				{Name: "lease_seconds", In: "body", Type: "integer", Required: false, Description: "Lease length (default 300, max 3600)"},
+			},
+			ExampleResponse: map[string]interface{}{
+				"task":  map[string]interface{}{"id": "uuid", "title": "Write release notes", "status": "next", "priority": "high", "assignee": "writer"},
+				"lease": map[string]interface{}{"task_id": "uuid", "agent_id": "writer", "token": "uuid", "expires_at": "2026-01-01T10:05:00Z"},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/queue/leases/{task_id}/heartbeat",
+			Category:    "Queue",
+			Description: "Extend a live lease. Returns 409 once it has expired or been reclaimed.",
+			Params: []APIParam{
+				{Name: "task_id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
+				{Name: "token", In: "body", Type: "string", Required: true, Description: "Lease token from the claim"},
+				{Name: "agent_id", In: "body", Type: "string", Required: false, Description: "Lease holder; implied by an agent-bound API key"},
+				{Name: "lease_seconds", In: "body", Type: "integer", Required: false, Description: "New lease length from now"},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/queue/leases/{task_id}/release",
+			Category:    "Queue",
+			Description: "Give a leased task back to the queue: unassigned and in its ready status. Expired leases are released the same way automatically. Both are recorded in task history.",
+			Params: []APIParam{
+				{Name: "task_id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
+				{Name: "token", In: "body", Type: "string", Required: true, Description: "Lease token from the claim"},
+				{Name: "reason", In: "body", Type: "string", Required: false, Description: "Noted in task history"},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/queue/leases",
+			Category:    "Queue",
+			Description: "List live leases. Tokens are only shown to the agent holding them.",
+			Params: []APIParam{
+				{Name: "agent_id", In: "query", Type: "string", Required: false, Description: "Filter by agent"},
+			},
+		},
+		{
+			Method:          "GET",
+			Path:            "/api/scheduler/teams",
+			Category:        "Tasks",
+			Description:     "List per-team auto-assignment policies.",
+			ExampleResponse: []map[string]interface{}{{"team": "backend", "auto_assign": true, "roles": []string{"engineer"}, "max_active_per_agent": 1}},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/api/scheduler/teams/{team}",
+			Category:    "Tasks",
+			Description: "Set a team's auto-assignment policy (admin only). Ready, unassigned tasks of the team go to its idle agents with the fewest open tasks.",
+			Params: []APIParam{
+				{Name: "team", In: "path", Type: "string", Required: true, Description: "Team name"},
+				{Name: "auto_assign", In: "body", Type: "boolean", Required: true, Description: "Enable auto-assignment"},
+				{Name: "roles", In: "body", Type: "array", Required: false, Description: "Eligible agent roles (case-insensitive); empty means any"},
+				{Name: "max_active_per_agent", In: "body", Type: "integer", Required: false, Description: "Open tasks an agent may hold and still be picked (default 1)"},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/workflow-rules",
+			Category:    "Workflows",
+			Description: "List workflow rules in run order, including rules mirrored from templates (source \"template\").",
+			ExampleResponse: []map[string]interface{}{{
+				"id": "uuid", "name": "Escalate urgent blocks", "enabled": true, "scope_type": "team", "scope_value": "backend",
+				"from_status": "*", "to_status": "blocked", "stop_on_error": false, "position": 0, "source": "api",
+				"conditions": []map[string]interface{}{{"field": "priority", "op": "in", "value": []string{"urgent", "critical"}}},
+				"actions": []map[string]interface{}{
+					{"type": "add_label", "value": "escalated"},
+					{"type": "message_agent", "agent_id": "assignee", "text": "{{task.title}} is blocked, please post an update"},
+					{"type": "create_incident", "text": "Blocked: {{task.title}}", "severity": "high"},
+				},
+			}},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/workflow-rules",
+			Category:    "Workflows",
+			Description: "Create a workflow rule (admin only). Conditions use fields priority, labels, assignee, team, age_minutes, time_in_status_minutes; gt/gte/lt/lte apply to the minute fields and to priority (low < medium < high < urgent < critical). Actions: set_field, add_label, comment, webhook, message_agent, transition_dependents, create_incident, assign, notify, create_subtask. Text accepts {{task.id}}, {{task.title}}, {{task.assignee}}, {{task.priority}}, {{task.team}}, {{from}}, {{to}}, {{rule}}.",
+			Params: []APIParam{
+				{Name: "name", In: "body", Type: "string", Required: true, Description: "Rule name"},
+				{Name: "scope_type", In: "body", Type: "string", Required: false, Description: "global (default), template, team or label"},
+				{Name: "scope_value", In: "body", Type: "string", Required: false, Description: "Template UUID, team or label, per scope_type"},
+				{Name: "from_status", In: "body", Type: "string", Required: false, Description: "Status left; empty or * for any"},
+				{Name: "to_status", In: "body", Type: "string", Required: false, Description: "Status entered; empty or * for any"},
+				{Name: "conditions", In: "body", Type: "array", Required: false, Description: "[{field, op, value}], all must hold"},
+				{Name: "actions", In: "body", Type: "array", Required: true, Description: "[{type, field, value, text, agent_id, webhook_id, status, severity}] run in order"},
+				{Name: "stop_on_error", In: "body", Type: "boolean", Required: false, Description: "Skip remaining actions after a failure"},
+				{Name: "position", In: "body", Type: "integer", Required: false, Description: "Run order, lowest first"},
+			},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/api/workflow-rules/{id}",
+			Category:    "Workflows",
+			Description: "Replace a workflow rule (admin only). Template rules return 409; edit the template instead.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Rule UUID"},
+			},
+		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/workflow-rules/{id}",
+			Category:    "Workflows",
+			Description: "Delete a workflow rule (admin only).",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Rule UUID"},
 			},
 		},
+		{
+			Method:      "POST",
+			Path:        "/api/workflow-rules/dry-run",
+			Category:    "Workflows",
+			Description: "Show which rules a transition would fire and their rendered actions, without running them. Describe the task by task_id, by overrides in task, or both.",
+			Params: []APIParam{
+				{Name: "to_status", In: "body", Type: "string", Required: true, Description: "Hypothetical target status"},
+				{Name: "from_status", In: "body", Type: "string", Required: false, Description: "Defaults to the task's current status"},
+				{Name: "task_id", In: "body", Type: "string", Required: false, Description: "Existing task to evaluate"},
+				{Name: "task", In: "body", Type: "object", Required: false, Description: "Overrides: title, priority, assignee, team, labels, template_id, age_minutes, time_in_status_minutes"},
+				{Name: "rule_id", In: "body", Type: "string", Required: false, Description: "Only evaluate this rule"},
+			},
+			ExampleResponse: map[string]interface{}{
+				"from_status": "progress", "to_status": "blocked", "would_fire": 1,
+				"rules": []map[string]interface{}{{
+					"rule_id": "uuid", "name": "Escalate urgent blocks", "enabled": true, "in_scope": true, "transition_match": true, "would_fire": true,
+					"conditions": []map[string]interface{}{{"field": "priority", "op": "in", "value": []string{"urgent"}, "actual": "urgent", "passed": true}},
+					"actions":    []map[string]interface{}{{"type": "add_label", "value": "escalated"}},
+				}},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/workflow-rules/runs",
+			Category:    "Workflows",
+			Description: "Execution log of workflow rules, newest first, with each action's outcome.",
+			Params: []APIParam{
+				{Name: "rule_id", In: "query", Type: "string", Required: false, Description: "Filter by rule"},
+				{Name: "task_id", In: "query", Type: "string", Required: false, Description: "Filter by task"},
+				{Name: "status", In: "query", Type: "string", Required: false, Description: "success, partial or failed"},
+				{Name: "limit", In: "query", Type: "integer", Required: false, Description: "Max rows (default 50, max 500)"},
+			},
+			ExampleResponse: []map[string]interface{}{{
+				"id": "uuid", "rule_id": "uuid", "rule_name": "Escalate urgent blocks", "task_id": "uuid",
+				"from_status": "progress", "to_status": "blocked", "status": "partial", "duration_ms": 412,
+				"results": []map[string]interface{}{
+					{"type": "add_label", "ok": true, "detail": "label escalated"},
+					{"type": "message_agent", "ok": false, "error": "agent unreachable and no webhook configured"},
+				},
+			}},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/templates/{id}/schedules",
+			Category:    "Tasks",
+			Description: "List a template's recurring schedules with their next five run times.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Template UUID"},
+			},
+			ExampleResponse: []map[string]interface{}{{
+				"id": "uuid", "template_id": "uuid", "cron": "0 9 * * MON", "timezone": "Europe/Berlin",
+				"title_pattern": "Weekly report {{iso_week}}", "enabled": true, "catch_up": "latest", "max_catch_up": 10,
+				"next_run_at": "2026-10-19T07:00:00Z", "last_run_at": nil, "next_runs": []string{"2026-10-19T09:00:00+02:00"},
+			}},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/templates/{id}/schedules",
+			Category:    "Tasks",
+			Description: "Create tasks from a template on a cron schedule. Titles (and the template description) accept {{template}}, {{date}}, {{time}}, {{year}}, {{month}}, {{month_name}}, {{day}}, {{weekday}}, {{week}}, {{iso_week}}, {{quarter}}, rendered in the schedule's timezone.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Template UUID"},
+				{Name: "cron", In: "body", Type: "string", Required: true, Description: "Five-field cron expression or @daily, @weekly, @monthly, @yearly, @hourly"},
+				{Name: "timezone", In: "body", Type: "string", Required: false, Description: "IANA timezone (default UTC)"},
+				{Name: "title_pattern", In: "body", Type: "string", Required: false, Description: "Task title (default \"{{template}} {{date}}\")"},
+				{Name: "enabled", In: "body", Type: "boolean", Required: false, Description: "Default true"},
+				{Name: "catch_up", In: "body", Type: "string", Required: false, Description: "Missed runs: skip, latest (default) or all"},
+				{Name: "max_catch_up", In: "body", Type: "integer", Required: false, Description: "Most missed runs created with catch_up=all (default 10)"},
+			},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/api/templates/{id}/schedules/{schedule_id}",
+			Category:    "Tasks",
+			Description: "Replace a schedule. The next run is recomputed from now; runs missed while disabled are not caught up.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Template UUID"},
+				{Name: "schedule_id", In: "path", Type: "string", Required: true, Description: "Schedule UUID"},
+			},
+		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/templates/{id}/schedules/{schedule_id}",
+			Category:    "Tasks",
+			Description: "Delete a schedule. Its run history is kept.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Template UUID"},
+				{Name: "schedule_id", In: "path", Type: "string", Required: true, Description: "Schedule UUID"},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/templates/{id}/schedules/history",
+			Category:    "Tasks",
+			Description: "Schedule runs of a template, newest first: created, skipped (missed runs dropped by the catch-up policy) or failed.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Template UUID"},
+				{Name: "limit", In: "query", Type: "integer", Required: false, Description: "Max runs (default 50, max 500)"},
+			},
+			ExampleResponse: []map[string]interface{}{{
+				"id": "uuid", "schedule_id": "uuid", "scheduled_for": "2026-10-12T07:00:00Z", "ran_at": "2026-10-12T07:00:12Z",
+				"status": "created", "catch_up": false, "task_id": "uuid", "task_title": "Weekly report 2026-W42", "task_status": "todo",
+			}},
+		},
 		{
 			Method:      "POST",
 			Path:        "/api/tasks/{id}/assign",
@@ -389,6 +779,68 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			},
 		},
 
+		// ── Traces ────────────────────────────────────────────────────────────
+		{
+			Method:          "POST",
+			Path:            "/api/otlp/v1/traces",
+			Category:        "Traces",
+			Description:     "OTLP/HTTP trace receiver. Accepts an OpenTelemetry ExportTraceServiceRequest as application/x-protobuf or application/json, optionally with Content-Encoding: gzip; point OTEL_EXPORTER_OTLP_TRACES_ENDPOINT here and pass X-API-Key via OTEL_EXPORTER_OTLP_HEADERS. Each span is stored with its trace, span and parent span IDs, attributes, status and start/end times. The agent comes from the key's bound agent, the agentboard.agent_id attribute or service.name; the task from an agentboard.task_id attribute on any span of the trace. trace_type is taken from agentboard.trace_type, error status or GenAI attributes (tool_call, llm_invoke, sub_agent_spawn, file_change), else span. Re-sent spans are ignored; spans without valid IDs are reported in partialSuccess.",
+			ExampleResponse: map[string]interface{}{},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/traces/batch",
+			Category:    "Traces",
+			Description: "Ingest up to 10000 traces in one transaction. The body is a JSON array, or NDJSON (one trace per line) with Content-Type application/x-ndjson; either may be sent with Content-Encoding: gzip. Items take the fields of POST /api/traces. Every item gets a result: inserted, duplicate (a span_id already stored for its trace; id is the stored one) or rejected with the reason. Responds 400 when every item is rejected. Error traces are notified once per agent, coalesced over 30 seconds.",
+			ExampleResponse: map[string]interface{}{
+				"inserted": 2, "duplicates": 0, "rejected": 1, "rejected_indices": []int{1}, "ids": []string{"uuid", "uuid"},
+				"results": []map[string]interface{}{
+					{"index": 0, "line": 1, "status": "inserted", "id": "uuid"},
+					{"index": 1, "line": 2, "status": "rejected", "error": "invalid trace_type"},
+					{"index": 2, "line": 3, "status": "inserted", "id": "uuid"},
+				},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/tasks/{id}/traces",
+			Category:    "Traces",
+			Description: "List a task's traces by start time. With view=tree, OTLP spans are nested under their parents in children; traces without span IDs and spans whose parent wasn't received are roots.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
+				{Name: "view", In: "query", Type: "string", Required: false, Description: "tree for a span tree"},
+				{Name: "type", In: "query", Type: "string", Required: false, Description: "Filter by trace_type"},
+				{Name: "limit", In: "query", Type: "integer", Required: false, Description: "Max spans (default 100, max 1000; tree default and max 10000)"},
+			},
+			ExampleResponse: []map[string]interface{}{{
+				"id": "uuid", "task_id": "uuid", "agent_id": "titan", "trace_type": "llm_invoke", "duration_ms": 5400,
+				"trace_id": "5b8efff798038103d269b633813fc60c", "span_id": "eee19b7ec3c1b174", "name": "invoke_agent titan",
+				"status_code": "ok", "start_time": "2026-10-17T09:00:00Z", "end_time": "2026-10-17T09:00:05.4Z",
+				"children": []map[string]interface{}{{"id": "uuid", "trace_type": "tool_call", "span_id": "aaa19b7ec3c1b175", "parent_span_id": "eee19b7ec3c1b174", "name": "execute_tool read_file", "duration_ms": 120}},
+			}},
+		},
+
+		{
+			Method:      "GET",
+			Path:        "/api/tasks/{id}/traces/tree",
+			Category:    "Traces",
+			Description: "Waterfall of a task's spans, nested by parent_span_id. Each span has offset_ms from the task's first span, duration_ms, self_ms (not covered by children) and child_ms, plus critical_ms, its time on the critical path: the chain of spans that decided when the task finished. by_type rolls spans up per trace_type; idle_ms is time on the critical path with no span running. Traces posted to /api/traces nest too when they carry span_id and parent_span_id (trace_id defaults to the task).",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
+			},
+			ExampleResponse: map[string]interface{}{
+				"task_id": "uuid", "span_count": 3, "start": "2026-10-17T09:00:00Z", "end": "2026-10-17T09:00:10Z",
+				"total_ms": 10000, "busy_ms": 9500, "idle_ms": 500, "errors": 0,
+				"critical_path": []map[string]interface{}{{"id": "uuid", "name": "execute_tool run_tests", "trace_type": "tool_call", "agent_id": "titan", "critical_ms": 7000}},
+				"by_type":       []map[string]interface{}{{"trace_type": "tool_call", "count": 1, "errors": 0, "total_ms": 7000, "self_ms": 7000, "critical_ms": 7000, "self_pct": 73.7}},
+				"roots": []map[string]interface{}{{
+					"id": "uuid", "span_id": "eee19b7ec3c1b174", "name": "invoke_agent titan", "trace_type": "sub_agent_spawn", "status": "ok",
+					"depth": 0, "offset_ms": 0, "duration_ms": 9500, "self_ms": 2500, "child_ms": 7000, "critical_ms": 2500, "on_critical_path": true,
+					"children": []map[string]interface{}{},
+				}},
+			},
+		},
+
 		// ── Alerts ────────────────────────────────────────────────────────────
 		{
 			Method:      "GET",
@@ -396,18 +848,45 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Category:    "Alerts",
 			Description: "List all alert rules.",
 			ExampleResponse: []map[string]interface{}{
-				{"id": "uuid", "name": "High cost alert", "condition": "cost > 5", "enabled": true},
+				{"id": "uuid", "name": "High cost alert", "agent_id": nil, "condition_type": "cost_threshold_exceeded",
+					"threshold": 50, "window": "day", "scope": "fleet", "enabled": true, "notify_webhook_id": nil},
 			},
 		},
 		{
 			Method:      "POST",
 			Path:        "/api/alerts/rules",
 			Category:    "Alerts",
-			Description: "Create a new alert rule.",
+			Description: "Create a new alert rule. Unsupported condition types are rejected with 400.",
 			Params: []APIParam{
 				{Name: "name", In: "body", Type: "string", Required: true, Description: "Rule name"},
-				{Name: "condition", In: "body", Type: "string", Required: true, Description: "Rule condition expression"},
-				{Name: "severity", In: "body", Type: "string", Required: false, Description: "info | warning | critical"},
+				{Name: "condition_type", In: "body", Type: "string", Required: true, Description: "no_heartbeat, error_rate, task_stuck, login_bruteforce, sla_breach, cost_threshold_exceeded, agent_idle or expression"},
+				{Name: "threshold", In: "body", Type: "integer", Required: false, Description: "Minutes, count or USD depending on condition_type (default 30; unused by expression rules)"},
+				{Name: "expression", In: "body", Type: "string", Required: false, Description: "expression rules: agg(metric{label=\"value\"}[window]) [by agent] op number [for duration], e.g. p95(response_time[1h]) by agent > 30 for 10m. agg is count, sum, avg, min, max, p50, p90, p95 or p99; metrics are activity, traces, cost, evaluations, tokens, token_cost, response_time and efficiency_score (no window)"},
+				{Name: "agent_id", In: "body", Type: "string", Required: false, Description: "Limit to one agent; omit for all agents"},
+				{Name: "window", In: "body", Type: "string", Required: false, Description: "cost_threshold_exceeded: current hour, day (default) or month, UTC"},
+				{Name: "scope", In: "body", Type: "string", Required: false, Description: "cost_threshold_exceeded: agent (each agent, default) or fleet (total)"},
+				{Name: "cooldown_minutes", In: "body", Type: "integer", Required: false, Description: "A condition that returns within this long of resolving reopens the alert without notifying (default 5)"},
+				{Name: "renotify_minutes", In: "body", Type: "integer", Required: false, Description: "Notify again while still firing every this many minutes (default 0 = never)"},
+				{Name: "enabled", In: "body", Type: "boolean", Required: false, Description: "Default true"},
+				{Name: "notify_webhook_id", In: "body", Type: "string", Required: false, Description: "Webhook to notify directly"},
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/alerts/rules/preview",
+			Category:    "Alerts",
+			Description: "Parse an alert expression and return its current value per group, without firing anything. The for duration is not applied.",
+			Params: []APIParam{
+				{Name: "expression", In: "body", Type: "string", Required: true, Description: "Alert expression"},
+				{Name: "agent_id", In: "body", Type: "string", Required: false, Description: "Only consider this agent's samples"},
+			},
+			ExampleResponse: map[string]interface{}{
+				"expression": "count(traces{type=\"error\"}[15m]) by agent > 5",
+				"parsed": map[string]interface{}{
+					"agg": "count", "metric": "traces", "matchers": []map[string]interface{}{{"label": "type", "op": "=", "value": "error"}},
+					"window": "15m", "by_agent": true, "op": ">", "threshold": 5,
+				},
+				"results": []map[string]interface{}{{"agent_id": "titan", "value": 7, "matches": true}, {"agent_id": "forge", "value": 1, "matches": false}},
 			},
 		},
 		{
@@ -432,11 +911,19 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Method:      "GET",
 			Path:        "/api/alerts/history",
 			Category:    "Alerts",
-			Description: "Get alert trigger history.",
+			Description: "Get alerts, most recently seen first. Repeated occurrences of an alert are folded into one entry with first seen (triggered_at), last_seen_at and count. state is firing, silenced or resolved; alerts resolve on their own when the condition clears.",
 			Params: []APIParam{
-				{Name: "limit", In: "query", Type: "integer", Required: false, Description: "Max results"},
+				{Name: "limit", In: "query", Type: "integer", Required: false, Description: "Max results (default 200, max 1000)"},
 				{Name: "acknowledged", In: "query", Type: "boolean", Required: false, Description: "Filter by acknowledged status"},
+				{Name: "state", In: "query", Type: "string", Required: false, Description: "firing, silenced or resolved"},
+				{Name: "rule_id", In: "query", Type: "string", Required: false, Description: "Filter by rule UUID"},
+				{Name: "agent_id", In: "query", Type: "string", Required: false, Description: "Filter by agent"},
 			},
+			ExampleResponse: []map[string]interface{}{{
+				"id": "uuid", "rule_id": "uuid", "rule_name": "Titan no heartbeat", "agent_id": "titan", "fingerprint": "titan",
+				"state": "firing", "triggered_at": "2026-10-16T09:00:00Z", "last_seen_at": "2026-10-17T09:00:00Z", "count": 1441,
+				"resolved_at": nil, "silenced_until": nil, "message": "Agent 'titan' has not sent a heartbeat in 10 minutes", "acknowledged": false,
+			}},
 		},
 		{
 			Method:      "POST",
@@ -447,6 +934,26 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 				{Name: "id", In: "path", Type: "string", Required: true, Description: "Alert history entry UUID"},
 			},
 		},
+		{
+			Method:      "POST",
+			Path:        "/api/alerts/history/{id}/silence",
+			Category:    "Alerts",
+			Description: "Silence an open alert. Occurrences are still counted but no notifications, re-notifications or resolve notifications go out until the silence ends.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Alert history entry UUID"},
+				{Name: "minutes", In: "body", Type: "integer", Required: false, Description: "Silence length (default 60, max 43200)"},
+			},
+			ExampleResponse: map[string]interface{}{"status": "silenced", "silenced_until": "2026-10-17T10:00:00Z"},
+		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/alerts/history/{id}/silence",
+			Category:    "Alerts",
+			Description: "End a silence early; the alert is firing again.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Alert history entry UUID"},
+			},
+		},
 		{
 			Method:          "GET",
 			Path:            "/api/alerts/unacknowledged-count",
@@ -454,6 +961,68 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Description:     "Get count of unacknowledged alerts (used for badge).",
 			ExampleResponse: map[string]interface{}{"count": 3},
 		},
+		{
+			Method:      "GET",
+			Path:        "/api/sla/policies",
+			Category:    "Alerts",
+			Description: "List SLA policies. sla_breach alert rules escalate open breaches one step per rule threshold (minutes): assignee, team lead, then webhooks (sla_breached event and the rule's notify webhook).",
+			ExampleResponse: []map[string]interface{}{{
+				"id": "uuid", "name": "Urgent", "priority": "urgent", "team": nil,
+				"response_minutes": 15, "resolution_minutes": 240, "enabled": true,
+			}},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/sla/policies",
+			Category:    "Alerts",
+			Description: "Create an SLA policy. The most specific enabled policy applies to a task: priority and team, then priority, then team, then neither.",
+			Params: []APIParam{
+				{Name: "name", In: "body", Type: "string", Required: true, Description: "Policy name"},
+				{Name: "priority", In: "body", Type: "string", Required: false, Description: "Task priority matched; omit for any"},
+				{Name: "team", In: "body", Type: "string", Required: false, Description: "Task team matched; omit for any"},
+				{Name: "response_minutes", In: "body", Type: "integer", Required: false, Description: "Minutes from creation to leaving backlog/todo"},
+				{Name: "resolution_minutes", In: "body", Type: "integer", Required: false, Description: "Minutes from creation to done"},
+				{Name: "enabled", In: "body", Type: "boolean", Required: false, Description: "Default true"},
+			},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/api/sla/policies/{id}",
+			Category:    "Alerts",
+			Description: "Replace an SLA policy.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Policy UUID"},
+			},
+		},
+		{
+			Method:      "DELETE",
+			Path:        "/api/sla/policies/{id}",
+			Category:    "Alerts",
+			Description: "Delete an SLA policy.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Policy UUID"},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/tasks/{id}/sla",
+			Category:    "Alerts",
+			Description: "A task's SLA status under its matching policy, computed from task history. policy is null when none applies.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Task UUID"},
+			},
+			ExampleResponse: map[string]interface{}{
+				"task_id": "uuid", "breached": true,
+				"policy": map[string]interface{}{"id": "uuid", "name": "Urgent", "priority": "urgent", "response_minutes": 15, "resolution_minutes": 240},
+				"response": map[string]interface{}{
+					"target_minutes": 15, "due_at": "2026-10-17T09:15:00Z", "met_at": "2026-10-17T09:05:00Z", "breached": false, "escalation_level": 0,
+				},
+				"resolution": map[string]interface{}{
+					"target_minutes": 240, "due_at": "2026-10-17T13:00:00Z", "met_at": nil, "breached": true,
+					"remaining_minutes": -42, "escalation_level": 2,
+				},
+			},
+		},
 
 		// ── Webhooks ──────────────────────────────────────────────────────────
 		{
@@ -462,7 +1031,16 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Category:    "Webhooks",
 			Description: "List all configured webhooks.",
 			ExampleResponse: []map[string]interface{}{
-				{"id": "uuid", "url": "https://hooks.slack.com/...", "events": []string{"task.done", "agent.error"}, "enabled": true},
+				{"id": "uuid", "url": "https://hooks.slack.com/...", "events": []string{"task_done", "agent_error"}, "enabled": true},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/webhooks/events",
+			Category:    "Webhooks",
+			Description: "List the webhook event catalogue: every subscribable event with its schema version and the JSON Schema of its delivery body. Every body carries event, schema_version and timestamp.",
+			ExampleResponse: []map[string]interface{}{
+				{"name": "task_assigned", "version": 1, "category": "tasks", "description": "A task was assigned to an agent.", "schema": map[string]interface{}{"type": "object", "required": []string{"event", "schema_version", "timestamp", "task_id", "assignee"}}},
 			},
 		},
 		{
@@ -472,7 +1050,7 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Description: "Register a new webhook.",
 			Params: []APIParam{
 				{Name: "url", In: "body", Type: "string", Required: true, Description: "Webhook destination URL"},
-				{Name: "events", In: "body", Type: "array", Required: true, Description: "Event types to subscribe to"},
+				{Name: "events", In: "body", Type: "array", Required: true, Description: "Event types to subscribe to (see GET /api/webhooks/events)"},
 				{Name: "secret", In: "body", Type: "string", Required: false, Description: "HMAC signing secret"},
 			},
 		},
@@ -498,11 +1076,44 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 			Method:      "POST",
 			Path:        "/api/webhooks/{id}/test",
 			Category:    "Webhooks",
-			Description: "Send a test payload to a webhook.",
+			Description: "Queue a test payload for a webhook.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Webhook UUID"},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/webhooks/{id}/deliveries",
+			Category:    "Webhooks",
+			Description: "Delivery log for a webhook: status, attempts, last status code, latency and response snippet. Failed deliveries are retried with exponential backoff.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Webhook UUID"},
+				{Name: "status", In: "query", Type: "string", Required: false, Description: "pending, retrying, delivered or failed"},
+				{Name: "limit", In: "query", Type: "integer", Required: false, Description: "Max results (default 50, max 500)"},
+			},
+			ExampleResponse: []interface{}{map[string]interface{}{"id": "d41c...", "event": "task_done", "status": "retrying", "attempts": 2, "last_status_code": 502, "last_latency_ms": 143, "response_snippet": "Bad Gateway"}},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/webhooks/{id}/deliveries/{delivery_id}/redeliver",
+			Category:    "Webhooks",
+			Description: "Re-send a past delivery with its original payload and timestamp, signed as before and marked with X-AgentBoard-Redelivery: true.",
 			Params: []APIParam{
 				{Name: "id", In: "path", Type: "string", Required: true, Description: "Webhook UUID"},
+				{Name: "delivery_id", In: "path", Type: "string", Required: true, Description: "Delivery UUID"},
 			},
 		},
+		{
+			Method:      "POST",
+			Path:        "/api/webhooks/{id}/deliveries/replay",
+			Category:    "Webhooks",
+			Description: "Re-send every failed delivery created since a point in time that has not already been redelivered.",
+			Params: []APIParam{
+				{Name: "id", In: "path", Type: "string", Required: true, Description: "Webhook UUID"},
+				{Name: "since", In: "body", Type: "string", Required: true, Description: "RFC 3339 timestamp"},
+			},
+			ExampleResponse: map[string]interface{}{"queued": 12, "delivery_ids": []string{"8e2a..."}},
+		},
 
 		// ── Logs ──────────────────────────────────────────────────────────────
 		{
@@ -686,6 +1297,73 @@ func GetAPIDocs(w http.ResponseWriter, r *http.Request) {
 				{Name: "agent", In: "query", Type: "string", Required: false, Description: "Filter by agent"},
 			},
 		},
+		{
+			Method:      "GET",
+			Path:        "/api/admin/retention",
+			Category:    "Dashboard",
+			Description: "Retention policies with each table's size, oldest row, rollup count and last prune, plus the next scheduled prune (admin).",
+			ExampleResponse: map[string]interface{}{
+				"tables":        []map[string]interface{}{{"table": "agent_traces", "raw_days": 14, "summary_days": 365, "enabled": true, "rows_estimate": 182000, "size": "96 MB", "summary_rows": 412}},
+				"next_prune_at": "2026-10-17T13:00:00Z", "interval_minutes": 60,
+			},
+		},
+		{
+			Method:      "PUT",
+			Path:        "/api/admin/retention/{table}",
+			Category:    "Dashboard",
+			Description: "Update a table's retention policy (admin). Policies start disabled. Tables: agent_traces, activity_log, audit_logs, alert_history (resolved alerts only), notifications.",
+			Params: []APIParam{
+				{Name: "table", In: "path", Type: "string", Required: true, Description: "Table name"},
+				{Name: "raw_days", In: "body", Type: "integer", Required: false, Description: "Days to keep raw rows before rolling them into daily aggregates (0 = forever)"},
+				{Name: "summary_days", In: "body", Type: "integer", Required: false, Description: "Days to keep daily aggregates (0 = forever)"},
+				{Name: "enabled", In: "body", Type: "boolean", Required: false, Description: "Whether the pruner handles this table"},
+			},
+		},
+		{
+			Method:          "POST",
+			Path:            "/api/admin/retention/run",
+			Category:        "Dashboard",
+			Description:     "Prune all enabled tables now (admin). 409 if a prune is already running.",
+			ExampleResponse: map[string]interface{}{"pruned": map[string]int{"agent_traces": 5200, "notifications": 0}},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/admin/retention/rollups",
+			Category:    "Dashboard",
+			Description: "Per-day aggregates of rows the pruner removed from a table: count, errors, total/max/average duration per agent and kind (admin).",
+			Params: []APIParam{
+				{Name: "table", In: "query", Type: "string", Required: true, Description: "agent_traces, activity_log, audit_logs, alert_history or notifications"},
+				{Name: "from", In: "query", Type: "string", Required: false, Description: "First day, YYYY-MM-DD (default: 29 days ago)"},
+				{Name: "to", In: "query", Type: "string", Required: false, Description: "Last day, YYYY-MM-DD (default: today)"},
+				{Name: "agent", In: "query", Type: "string", Required: false, Description: "Filter by agent"},
+				{Name: "kind", In: "query", Type: "string", Required: false, Description: "Filter by kind (trace type, action, notification type or alert rule ID)"},
+				{Name: "by", In: "query", Type: "string", Required: false, Description: "day to sum each day across agents and kinds"},
+			},
+			ExampleResponse: map[string]interface{}{
+				"table": "agent_traces", "from": "2026-09-01", "to": "2026-09-30",
+				"rollups": []map[string]interface{}{{"day": "2026-09-01", "agent_id": "coder", "kind": "tool_call", "count": 412, "error_count": 3, "total_ms": 98211, "max_ms": 5120, "avg_ms": 238.4}},
+			},
+		},
+		{
+			Method:      "GET",
+			Path:        "/api/admin/token-index",
+			Category:    "Analytics",
+			Description: "Status of the token usage index that backs the token and cost analytics: files tracked, files with unread bytes, messages indexed and the last indexing pass (admin).",
+			ExampleResponse: map[string]interface{}{
+				"files": 412, "files_behind": 1, "pending_bytes": 2048, "messages": 183204,
+				"last_run": "2026-10-17T12:00:15Z", "last_run_ms": 42, "last_run_messages": 3, "interval_seconds": 15,
+			},
+		},
+		{
+			Method:      "POST",
+			Path:        "/api/admin/token-index/rebuild",
+			Category:    "Analytics",
+			Description: "Reprice indexed messages that carry no cost of their own after a pricing change, or with full=true re-read every session file from scratch (admin). Same as `agentboard reindex-tokens [--full]`.",
+			Params: []APIParam{
+				{Name: "full", In: "query", Type: "boolean", Required: false, Description: "Drop the index and re-read all session files"},
+			},
+			ExampleResponse: map[string]interface{}{"full": false, "repriced": 1820, "indexed": 0},
+		},
 		{
 			Method:      "GET",
 			Path:        "/api/errors",
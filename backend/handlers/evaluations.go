@@ -35,6 +35,9 @@ func CreateEvaluation(w http.ResponseWriter, r *http.Request) {
 		respondError(w, 400, "score must be 0-100")
 		return
 	}
+	if agent := GetBoundAgent(r); agent != "" {
+		req.AgentID = &agent
+	}
 	if req.Evaluator == "" {
 		req.Evaluator = "manual"
 	}
@@ -50,9 +53,24 @@ func CreateEvaluation(w http.ResponseWriter, r *http.Request) {
 		respondError(w, 500, err.Error())
 		return
 	}
+	go TriggerWebhooks(EventEvaluationRecorded, evaluationEventPayload(id, req.TaskID, req.AgentID, req.Score, req.Criteria, req.Evaluator))
 	respondJSON(w, 201, map[string]string{"id": id})
 }
 
+// evaluationEventPayload builds the evaluation_recorded webhook payload.
+func evaluationEventPayload(id string, taskID, agentID *string, score float64, criteria json.RawMessage, evaluator string) map[string]interface{} {
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return map[string]interface{}{
+		"evaluation_id": id, "task_id": deref(taskID), "agent_id": deref(agentID),
+		"score": score, "criteria": criteria, "evaluator": evaluator,
+	}
+}
+
 // BulkCreateEvaluations handles POST /api/evaluations/bulk
 func BulkCreateEvaluations(w http.ResponseWriter, r *http.Request) {
 	var reqs []struct {
@@ -78,8 +96,13 @@ func BulkCreateEvaluations(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	bound := GetBoundAgent(r)
 	ids := []string{}
+	events := []map[string]interface{}{}
 	for i, req := range reqs {
+		if bound != "" {
+			req.AgentID = &bound
+		}
 		if req.Score < 0 || req.Score > 100 {
 			respondError(w, 400, "score must be 0-100 (index "+fmt.Sprintf("%d", i)+")")
 			return
@@ -100,12 +123,18 @@ func BulkCreateEvaluations(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		ids = append(ids, id)
+		events = append(events, evaluationEventPayload(id, req.TaskID, req.AgentID, req.Score, req.Criteria, req.Evaluator))
 	}
 
 	if err := tx.Commit(); err != nil {
 		respondError(w, 500, err.Error())
 		return
 	}
+	go func() {
+		for _, e := range events {
+			TriggerWebhooks(EventEvaluationRecorded, e)
+		}
+	}()
 	respondJSON(w, 201, map[string]interface{}{"ids": ids, "count": len(ids)})
 }
 
@@ -99,6 +99,11 @@ func (h *HealthHandler) ForceHealthCheck(w http.ResponseWriter, r *http.Request)
 	newStatus := determineStatusFromHealth(health)
 	if newStatus != "" {
 		db.DB.Exec(`UPDATE agents SET status = $1 WHERE id = $2`, newStatus, id)
+		if newStatus != health.Status {
+			go TriggerWebhooks(EventAgentStatusChanged, map[string]interface{}{
+				"agent_id": id, "from": health.Status, "to": newStatus, "source": "health_check",
+			})
+		}
 		health.Status = newStatus
 	}
 
@@ -356,6 +361,9 @@ func runAllHealthChecks() {
 				"reason": "health_check",
 			})
 			log.Printf("health: %s: %s → %s", a.id, a.status, newStatus)
+			TriggerWebhooks(EventAgentStatusChanged, map[string]interface{}{
+				"agent_id": a.id, "from": a.status, "to": newStatus, "source": "health_check",
+			})
 		}
 
 		// Auto-restart on health failure
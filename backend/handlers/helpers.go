@@ -24,7 +24,16 @@ func respondError(w http.ResponseWriter, code int, message string) {
 	respondJSON(w, code, map[string]string{"error": message})
 }
 
+// getAgentFromContext returns who is acting on a request: the logged-in user's ID,
+// else the agent an API key is bound to, else the agent named in X-Agent-ID,
+// else "system".
 func getAgentFromContext(r *http.Request) string {
+	if user := GetUserFromContext(r); user != nil {
+		return user.ID
+	}
+	if agent := GetBoundAgent(r); agent != "" {
+		return agent
+	}
 	if agent := r.Header.Get("X-Agent-ID"); agent != "" {
 		return agent
 	}
@@ -52,7 +61,7 @@ func logActivity(agentID, action, taskID string, details map[string]string) {
 		for k, v := range details {
 			payload[k] = v
 		}
-		go TriggerWebhooks("agent_error", payload)
+		go TriggerWebhooks(EventAgentError, payload)
 	}
 }
 
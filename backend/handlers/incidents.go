@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -96,6 +97,10 @@ func CreateIncident(w http.ResponseWriter, r *http.Request) {
 		respondError(w, 500, err.Error())
 		return
 	}
+	go TriggerWebhooks(EventIncidentOpened, map[string]interface{}{
+		"incident_id": id, "title": req.Title, "severity": req.Severity, "status": "open",
+		"task_ids": req.TaskIDs, "agent_ids": req.AgentIDs, "automatic": false,
+	})
 	respondJSON(w, 201, map[string]string{"id": id})
 }
 
@@ -116,10 +121,12 @@ func UpdateIncident(w http.ResponseWriter, r *http.Request) {
 	}
 	sets := []string{}
 	args := []interface{}{}
+	changed := []string{}
 	n := 1
 	addField := func(col string, val interface{}) {
 		sets = append(sets, fmt.Sprintf("%s = $%d", col, n))
 		args = append(args, val)
+		changed = append(changed, col)
 		n++
 	}
 	if req.Title != nil { addField("title", *req.Title) }
@@ -140,12 +147,29 @@ func UpdateIncident(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	args = append(args, id)
-	query := fmt.Sprintf("UPDATE incidents SET %s WHERE id = $%d", strings.Join(sets, ", "), n)
-	_, err := db.DB.Exec(query, args...)
+	query := fmt.Sprintf(`UPDATE incidents SET %s WHERE id = $%d
+		RETURNING title, severity, status, resolved_at`, strings.Join(sets, ", "), n)
+	var title, severity, status string
+	var resolvedAt sql.NullTime
+	err := db.DB.QueryRow(query, args...).Scan(&title, &severity, &status, &resolvedAt)
+	if err == sql.ErrNoRows {
+		respondError(w, 404, "incident not found")
+		return
+	}
 	if err != nil {
 		respondError(w, 500, err.Error())
 		return
 	}
+	payload := map[string]interface{}{
+		"incident_id": id, "title": title, "severity": severity, "status": status, "changed": changed,
+	}
+	go TriggerWebhooks(EventIncidentUpdated, payload)
+	if req.Status != nil && (status == "resolved" || status == "closed") {
+		go TriggerWebhooks(EventIncidentResolved, map[string]interface{}{
+			"incident_id": id, "title": title, "severity": severity, "status": status,
+			"resolved_at": resolvedAt.Time.UTC().Format(time.RFC3339),
+		})
+	}
 	respondJSON(w, 200, map[string]string{"status": "updated"})
 }
 
@@ -199,7 +223,15 @@ func autoCreateOrAppendIncident(taskID, agentID, errorSummary string) (string, e
 			"task_id": taskID,
 		})
 		newTimeline, _ := json.Marshal(entries)
-		db.DB.Exec(`UPDATE incidents SET timeline = $1 WHERE id = $2`, newTimeline, existingID)
+		var title, severity, status string
+		if err := db.DB.QueryRow(
+			`UPDATE incidents SET timeline = $1 WHERE id = $2 RETURNING title, severity, status`,
+			newTimeline, existingID).Scan(&title, &severity, &status); err == nil {
+			go TriggerWebhooks(EventIncidentUpdated, map[string]interface{}{
+				"incident_id": existingID, "title": title, "severity": severity, "status": status,
+				"changed": []string{"timeline"},
+			})
+		}
 		return existingID, nil
 	}
 
@@ -223,5 +255,11 @@ func autoCreateOrAppendIncident(taskID, agentID, errorSummary string) (string, e
 		`INSERT INTO incidents (title, severity, task_ids, agent_ids, timeline) VALUES ($1, 'high', $2, $3, $4) RETURNING id`,
 		title, taskIDs, agentIDs, initialTimeline,
 	).Scan(&id)
+	if err == nil {
+		go TriggerWebhooks(EventIncidentOpened, map[string]interface{}{
+			"incident_id": id, "title": title, "severity": "high", "status": "open",
+			"task_ids": taskIDs, "agent_ids": agentIDs, "automatic": true,
+		})
+	}
 	return id, err
 }
@@ -4,6 +4,7 @@ import (
 	"math"
 	"net/http"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/alghanim/agentboard/backend/db"
@@ -26,6 +27,7 @@ type LatencyMetrics struct {
 }
 
 // GetLatencyMetrics handles GET /api/metrics/latency
+// Query: days (default 30) bounds the message response times.
 func (h *MetricsHandler) GetLatencyMetrics(w http.ResponseWriter, r *http.Request) {
 	// Get per-agent task completion latency from DB
 	rows, err := db.DB.Query(`
@@ -52,41 +54,42 @@ func (h *MetricsHandler) GetLatencyMetrics(w http.ResponseWriter, r *http.Reques
 	}
 	defer rows.Close()
 
-	// Also get token-level response time from JSONL (message-to-message latency)
-	allMsgs := parseAllTokenData()
-	agentResponseTimes := make(map[string][]float64)
-	// Group messages by agent, sort by time, measure gaps
-	agentMsgs := make(map[string][]time.Time)
-	for _, m := range allMsgs {
-		if !m.Timestamp.IsZero() {
-			agentMsgs[m.AgentID] = append(agentMsgs[m.AgentID], m.Timestamp)
-		}
+	// Also get message-to-message response time from session token usage
+	days := 30
+	if v, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && v > 0 && v <= 365 {
+		days = v
 	}
-	for agentID, times := range agentMsgs {
-		sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
-		for i := 1; i < len(times); i++ {
-			gap := times[i].Sub(times[i-1]).Seconds()
-			// Only count gaps < 10 minutes as response times (longer = idle)
-			if gap > 0 && gap < 600 {
-				agentResponseTimes[agentID] = append(agentResponseTimes[agentID], gap)
-			}
+	type responseStats struct{ avg, p50, p95 float64 }
+	responseTimes := map[string]responseStats{}
+	rtRows, err := db.DB.Query(`
+		SELECT agent_id, AVG(gap),
+		       percentile_cont(0.5) WITHIN GROUP (ORDER BY gap),
+		       percentile_cont(0.95) WITHIN GROUP (ORDER BY gap)
+		FROM (`+responseGapsSQL+`) r
+		GROUP BY agent_id
+	`, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for rtRows.Next() {
+		var agentID string
+		var st responseStats
+		if err := rtRows.Scan(&agentID, &st.avg, &st.p50, &st.p95); err == nil {
+			responseTimes[agentID] = st
 		}
 	}
+	rtRows.Close()
 
 	var results []LatencyMetrics
 	for rows.Next() {
 		var m LatencyMetrics
 		rows.Scan(&m.AgentID, &m.Name, &m.TasksCompleted, &m.AvgTaskHours, &m.FastestTaskHrs, &m.SlowestTaskHrs)
 
-		if rts, ok := agentResponseTimes[m.AgentID]; ok && len(rts) > 0 {
-			sort.Float64s(rts)
-			sum := 0.0
-			for _, v := range rts {
-				sum += v
-			}
-			m.AvgResponseSec = math.Round(sum/float64(len(rts))*10) / 10
-			m.P50ResponseSec = math.Round(percentile(rts, 50)*10) / 10
-			m.P95ResponseSec = math.Round(percentile(rts, 95)*10) / 10
+		if st, ok := responseTimes[m.AgentID]; ok {
+			m.AvgResponseSec = math.Round(st.avg*10) / 10
+			m.P50ResponseSec = math.Round(st.p50*10) / 10
+			m.P95ResponseSec = math.Round(st.p95*10) / 10
 		}
 		results = append(results, m)
 	}
@@ -137,26 +140,38 @@ type AgentForecast struct {
 
 // GetCostForecast handles GET /api/metrics/cost-forecast
 func (h *MetricsHandler) GetCostForecast(w http.ResponseWriter, r *http.Request) {
-	allMsgs := parseAllTokenData()
-	now := time.Now()
+	now := time.Now().UTC()
 
 	// Build daily cost map for last 30 days
 	dailyCosts := make(map[string]float64)
 	dailyTokens := make(map[string]int64)
 	agentDailyCosts := make(map[string]map[string]float64)
 
-	for _, msg := range allMsgs {
-		if msg.Timestamp.Before(now.AddDate(0, 0, -30)) {
+	rows, err := db.DB.Query(`
+		SELECT agent_id, `+tokenDay+`, SUM(cost_usd), SUM(total_tokens)
+		FROM token_usage
+		WHERE ts >= $1
+		GROUP BY 1, 2
+	`, now.AddDate(0, 0, -30))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var agentID, dateStr string
+		var cost float64
+		var tokens int64
+		if err := rows.Scan(&agentID, &dateStr, &cost, &tokens); err != nil {
 			continue
 		}
-		dateStr := msg.Timestamp.Format("2006-01-02")
-		dailyCosts[dateStr] += msg.CostTotal
-		dailyTokens[dateStr] += msg.TotalTokens
+		dailyCosts[dateStr] += cost
+		dailyTokens[dateStr] += tokens
 
-		if agentDailyCosts[msg.AgentID] == nil {
-			agentDailyCosts[msg.AgentID] = make(map[string]float64)
+		if agentDailyCosts[agentID] == nil {
+			agentDailyCosts[agentID] = make(map[string]float64)
 		}
-		agentDailyCosts[msg.AgentID][dateStr] += msg.CostTotal
+		agentDailyCosts[agentID][dateStr] += cost
 	}
 
 	// Build daily history
@@ -275,6 +290,16 @@ type EffBreakdown struct {
 
 // GetEfficiencyScores handles GET /api/metrics/efficiency
 func (h *MetricsHandler) GetEfficiencyScores(w http.ResponseWriter, r *http.Request) {
+	results, err := computeEfficiencyScores()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, results)
+}
+
+// computeEfficiencyScores scores every agent with tasks, best first.
+func computeEfficiencyScores() ([]EfficiencyScore, error) {
 	// Get task data from DB
 	type agentTaskData struct {
 		id, name     string
@@ -299,8 +324,7 @@ func (h *MetricsHandler) GetEfficiencyScores(w http.ResponseWriter, r *http.Requ
 		HAVING COUNT(t.id) > 0
 	`)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -311,13 +335,16 @@ func (h *MetricsHandler) GetEfficiencyScores(w http.ResponseWriter, r *http.Requ
 		agents[a.id] = a
 	}
 
-	// Get token usage from JSONL
-	allMsgs := parseAllTokenData()
+	// Get token usage from the session index
+	spend, err := tokenSpendByAgent(time.Time{}, "")
+	if err != nil {
+		return nil, err
+	}
 	agentTokens := make(map[string]int64)
 	agentCost := make(map[string]float64)
-	for _, msg := range allMsgs {
-		agentTokens[msg.AgentID] += msg.TotalTokens
-		agentCost[msg.AgentID] += msg.CostTotal
+	for agentID, s := range spend {
+		agentTokens[agentID] = s.Tokens
+		agentCost[agentID] = s.Cost
 	}
 
 	// Find max values for normalization
@@ -396,5 +423,5 @@ func (h *MetricsHandler) GetEfficiencyScores(w http.ResponseWriter, r *http.Requ
 		return results[i].Score > results[j].Score
 	})
 
-	respondJSON(w, http.StatusOK, results)
+	return results, nil
 }
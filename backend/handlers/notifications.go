@@ -110,7 +110,7 @@ func (h *NotificationHandler) CreateNotification(w http.ResponseWriter, r *http.
 	}
 
 	// Fire webhook
-	go TriggerWebhooks("notification.created", map[string]interface{}{
+	go TriggerWebhooks(EventNotificationCreated, map[string]interface{}{
 		"id": id, "agent_id": req.AgentID, "type": req.Type, "title": req.Title,
 	})
 
@@ -185,7 +185,7 @@ func CreateNotificationInternal(agentID, notifType, title, message string) {
 		log.Printf("[notifications] Failed to create notification: %v", err)
 		return
 	}
-	go TriggerWebhooks("notification.created", map[string]interface{}{
+	go TriggerWebhooks(EventNotificationCreated, map[string]interface{}{
 		"id": id, "agent_id": agentID, "type": notifType, "title": title,
 	})
 }
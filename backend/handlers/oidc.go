@@ -0,0 +1,644 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ─── OpenID Connect (SSO) login ──────────────────────────────────────────────
+//
+// Authorization-code flow with PKCE. The browser is sent to the IdP from
+// /api/auth/oidc/login and comes back to /api/auth/oidc/callback, where the
+// ID token is verified against the IdP's JWKS, the user is created or updated,
+// and the same JWT as a password login is issued. State, nonce and the PKCE
+// verifier travel in a short-lived signed cookie, so no server-side session
+// is needed.
+//
+// Configured with environment variables:
+//
+//	OIDC_ISSUER          issuer URL (enables SSO when set together with OIDC_CLIENT_ID)
+//	OIDC_CLIENT_ID       client ID registered with the IdP
+//	OIDC_CLIENT_SECRET   client secret (optional for public clients)
+//	OIDC_REDIRECT_URL    callback URL, default <request origin>/api/auth/oidc/callback
+//	OIDC_SCOPES          default "openid profile email groups"
+//	OIDC_GROUPS_CLAIM    claim holding the user's groups, default "groups"
+//	OIDC_ADMIN_GROUPS    comma-separated groups mapped to admin
+//	OIDC_MEMBER_GROUPS   comma-separated groups mapped to member
+//	OIDC_VIEWER_GROUPS   comma-separated groups mapped to viewer
+//	OIDC_DEFAULT_ROLE    role for users in none of the groups: viewer (default), member, admin or none
+//
+// Any OIDC-compliant provider works, including local mock providers such as
+// navikt/mock-oauth2-server; plain http issuers are accepted for that purpose.
+
+const (
+	oidcStateCookie = "agentboard_oidc"
+	oidcStateTTL    = 10 * time.Minute
+	oidcHTTPTimeout = 10 * time.Second
+)
+
+type oidcConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string
+	AdminGroups  []string
+	MemberGroups []string
+	ViewerGroups []string
+	DefaultRole  string // "" means users outside the mapped groups are refused
+}
+
+var (
+	oidcCfg     *oidcConfig
+	oidcCfgOnce sync.Once
+)
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// getOIDCConfig returns the SSO configuration, or nil when SSO is not configured.
+func getOIDCConfig() *oidcConfig {
+	oidcCfgOnce.Do(func() {
+		issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+		clientID := os.Getenv("OIDC_CLIENT_ID")
+		if issuer == "" || clientID == "" {
+			return
+		}
+		cfg := &oidcConfig{
+			Issuer:       issuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:       splitList(os.Getenv("OIDC_SCOPES")),
+			GroupsClaim:  os.Getenv("OIDC_GROUPS_CLAIM"),
+			AdminGroups:  splitList(os.Getenv("OIDC_ADMIN_GROUPS")),
+			MemberGroups: splitList(os.Getenv("OIDC_MEMBER_GROUPS")),
+			ViewerGroups: splitList(os.Getenv("OIDC_VIEWER_GROUPS")),
+			DefaultRole:  strings.ToLower(os.Getenv("OIDC_DEFAULT_ROLE")),
+		}
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{"openid", "profile", "email", "groups"}
+		}
+		if cfg.GroupsClaim == "" {
+			cfg.GroupsClaim = "groups"
+		}
+		switch cfg.DefaultRole {
+		case "":
+			cfg.DefaultRole = "viewer"
+		case "none":
+			cfg.DefaultRole = ""
+		default:
+			if !validRole(cfg.DefaultRole) {
+				log.Printf("⚠️  Unknown OIDC_DEFAULT_ROLE %q — falling back to viewer", cfg.DefaultRole)
+				cfg.DefaultRole = "viewer"
+			}
+		}
+		oidcCfg = cfg
+		log.Printf("🔐 OIDC login enabled (issuer %s)", issuer)
+	})
+	return oidcCfg
+}
+
+// OIDCEnabled reports whether SSO login is configured.
+func OIDCEnabled() bool {
+	return getOIDCConfig() != nil
+}
+
+// mapRole picks the highest role whose group list intersects groups.
+func (c *oidcConfig) mapRole(groups []string) string {
+	has := func(list []string) bool {
+		for _, g := range groups {
+			for _, want := range list {
+				if g == want {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch {
+	case has(c.AdminGroups):
+		return "admin"
+	case has(c.MemberGroups):
+		return "member"
+	case has(c.ViewerGroups):
+		return "viewer"
+	}
+	return c.DefaultRole
+}
+
+func (c *oidcConfig) redirectURL(r *http.Request) string {
+	if c.RedirectURL != "" {
+		return c.RedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/api/auth/oidc/callback"
+}
+
+// ─── Provider discovery & keys ───────────────────────────────────────────────
+
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcState struct {
+	mu        sync.Mutex
+	provider  *oidcProvider
+	keys      map[string]interface{} // kid -> *rsa.PublicKey / *ecdsa.PublicKey
+	keysFetch time.Time
+}
+
+var (
+	oidc       = &oidcState{}
+	oidcClient = &http.Client{Timeout: oidcHTTPTimeout}
+)
+
+func oidcGetJSON(u string, out interface{}) error {
+	resp, err := oidcClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// discover fetches and caches the issuer's openid-configuration.
+func (s *oidcState) discover(cfg *oidcConfig) (*oidcProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider != nil {
+		return s.provider, nil
+	}
+	var p oidcProvider
+	if err := oidcGetJSON(cfg.Issuer+"/.well-known/openid-configuration", &p); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(p.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q", p.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	s.provider = &p
+	return s.provider, nil
+}
+
+// key returns the signing key for kid, refetching the JWKS when kid is unknown
+// (at most once a minute, so bogus kids can't hammer the IdP).
+func (s *oidcState) key(p *oidcProvider, kid string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+	if k, ok := singleKey(s.keys, kid); ok {
+		return k, nil
+	}
+	if time.Since(s.keysFetch) < time.Minute && s.keys != nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	s.keysFetch = time.Now()
+	if err := oidcGetJSON(p.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	s.keys = keys
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	if k, ok := singleKey(keys, kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// singleKey covers single-key providers that omit kid from the token header.
+func singleKey(keys map[string]interface{}, kid string) (interface{}, bool) {
+	if kid != "" || len(keys) != 1 {
+		return nil, false
+	}
+	for _, k := range keys {
+		return k, true
+	}
+	return nil, false
+}
+
+// ─── Handlers ────────────────────────────────────────────────────────────────
+
+func randomURLToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// GET /api/auth/oidc/login — redirects the browser to the IdP.
+func (h *AuthHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	cfg := getOIDCConfig()
+	if cfg == nil {
+		respondError(w, http.StatusNotFound, "SSO is not configured")
+		return
+	}
+	p, err := oidc.discover(cfg)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		respondError(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	state, nonce, verifier := randomURLToken(), randomURLToken(), randomURLToken()
+	cookie, err := signJWT(jwt.MapClaims{
+		"typ":      "oidc_state",
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    cookie,
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {cfg.redirectURL(r)},
+		"scope":                 {strings.Join(cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, p.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// GET /api/auth/oidc/callback — completes the login and hands the tokens to the
+// frontend in the URL fragment (#sso_token=...&sso_refresh=...), which never
+// reaches server logs.
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	fail := func(msg string) {
+		http.Redirect(w, r, "/#sso_error="+url.QueryEscape(msg), http.StatusFound)
+	}
+	cfg := getOIDCConfig()
+	if cfg == nil {
+		respondError(w, http.StatusNotFound, "SSO is not configured")
+		return
+	}
+	// Clear the state cookie whatever happens.
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		fail("identity provider returned " + e)
+		return
+	}
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		fail("login session expired, please try again")
+		return
+	}
+	session := jwt.MapClaims{}
+	if _, err := parseJWT(c.Value, session); err != nil || session["typ"] != "oidc_state" {
+		fail("login session expired, please try again")
+		return
+	}
+	if q.Get("state") == "" || q.Get("state") != session["state"] {
+		fail("invalid login state")
+		return
+	}
+	nonce, _ := session["nonce"].(string)
+	verifier, _ := session["verifier"].(string)
+
+	p, err := oidc.discover(cfg)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		fail("identity provider unavailable")
+		return
+	}
+	idToken, accessToken, err := oidcExchange(cfg, p, q.Get("code"), verifier, cfg.redirectURL(r))
+	if err != nil {
+		log.Printf("oidc: token exchange: %v", err)
+		fail("could not complete sign-in")
+		return
+	}
+	claims, err := oidcVerify(cfg, p, idToken, nonce)
+	if err != nil {
+		log.Printf("oidc: id_token: %v", err)
+		fail("could not verify identity")
+		return
+	}
+	// Some IdPs only put groups in the userinfo response.
+	if _, ok := claims[cfg.GroupsClaim]; !ok && p.UserinfoEndpoint != "" && accessToken != "" {
+		if info, err := oidcUserinfo(p, accessToken); err == nil && info["sub"] == claims["sub"] {
+			for k, v := range info {
+				if _, exists := claims[k]; !exists {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	role := cfg.mapRole(claimStrings(claims[cfg.GroupsClaim]))
+	if role == "" {
+		fail("your account is not in a group allowed to use AgentBoard")
+		return
+	}
+	user, err := upsertOIDCUser(cfg, claims, role)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		if err == errDisabledAccount || err == errNoFreeUsername {
+			fail(err.Error())
+		} else {
+			fail("could not complete sign-in")
+		}
+		return
+	}
+	pair, err := startSession(r, user, "oidc")
+	if err != nil {
+		fail("token generation failed")
+		return
+	}
+	go LogAudit(user.ID, "user_login", "user", user.ID, map[string]interface{}{"method": "oidc", "role": role})
+	http.Redirect(w, r, "/#sso_token="+url.QueryEscape(pair.Token)+"&sso_refresh="+url.QueryEscape(pair.RefreshToken), http.StatusFound)
+}
+
+// oidcExchange redeems an authorization code for tokens.
+func oidcExchange(cfg *oidcConfig, p *oidcProvider, code, verifier, redirectURI string) (string, string, error) {
+	if code == "" {
+		return "", "", errors.New("missing code")
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", "", fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", "", fmt.Errorf("%s: %s %s", resp.Status, body.Error, body.Description)
+	}
+	if body.IDToken == "" {
+		return "", "", errors.New("no id_token in response")
+	}
+	return body.IDToken, body.AccessToken, nil
+}
+
+// oidcVerify checks the ID token signature, issuer, audience, expiry and nonce.
+func oidcVerify(cfg *oidcConfig, p *oidcProvider, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return oidc.key(p, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("missing sub")
+	}
+	return claims, nil
+}
+
+func oidcUserinfo(p *oidcProvider, accessToken string) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, p.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo: %s", resp.Status)
+	}
+	info := map[string]interface{}{}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&info)
+	return info, err
+}
+
+// claimStrings accepts a claim that is either a string or a list of strings.
+func claimStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return splitList(t)
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// upsertOIDCUser finds the user linked to the token's issuer+subject, creating
+// it on first login. The role is re-synced from the IdP on every login; a
+// disabled account is refused and left untouched.
+func upsertOIDCUser(cfg *oidcConfig, claims jwt.MapClaims, role string) (*AuthUser, error) {
+	sub, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	preferred, _ := claims["preferred_username"].(string)
+
+	var user AuthUser
+	var disabled bool
+	err := db.DB.QueryRow(
+		`SELECT disabled FROM users WHERE oidc_issuer = $1 AND oidc_subject = $2`,
+		cfg.Issuer, sub,
+	).Scan(&disabled)
+	if err == nil {
+		if disabled {
+			return nil, errDisabledAccount
+		}
+		err = db.DB.QueryRow(
+			`UPDATE users SET role = $3, last_login = NOW(),
+			        email = CASE WHEN $4 = '' THEN email ELSE $4 END,
+			        display_name = CASE WHEN $5 = '' THEN display_name ELSE $5 END
+			 WHERE oidc_issuer = $1 AND oidc_subject = $2 AND NOT disabled
+			 RETURNING id, username, role`,
+			cfg.Issuer, sub, role, email, name,
+		).Scan(&user.ID, &user.Username, &user.Role)
+		if err == sql.ErrNoRows {
+			// Disabled between the two statements
+			return nil, errDisabledAccount
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// First login: pick the first free username among the IdP's suggestions.
+	candidates := []string{preferred, email, sub}
+	sum := sha256.Sum256([]byte(sub))
+	candidates = append(candidates, firstNonEmpty(preferred, email, "sso")+"-"+hex.EncodeToString(sum[:4]))
+	if name == "" {
+		name = firstNonEmpty(preferred, email, sub)
+	}
+	for _, username := range candidates {
+		if username == "" || len(username) > 100 {
+			continue
+		}
+		err = db.DB.QueryRow(
+			`INSERT INTO users (username, display_name, email, role, oidc_issuer, oidc_subject, last_login)
+			 VALUES ($1, $2, $3, $4, $5, $6, NOW())
+			 ON CONFLICT (username) DO NOTHING
+			 RETURNING id, username, role`,
+			username, name, email, role, cfg.Issuer, sub,
+		).Scan(&user.ID, &user.Username, &user.Role)
+		if err == nil {
+			go LogAudit(user.ID, "user_created", "user", user.ID, map[string]interface{}{"username": username, "role": role, "method": "oidc"})
+			return &user, nil
+		}
+	}
+	return nil, errNoFreeUsername
+}
+
+var (
+	errDisabledAccount = errors.New("your account is disabled")
+	errNoFreeUsername  = errors.New("could not create an account for this identity")
+)
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/lib/pq"
+)
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS, token and userinfo
+// endpoints. The browser's visit to /authorize is skipped: startLogin hands
+// the challenge and nonce of the login redirect straight to the mock, and the
+// token endpoint checks the PKCE verifier against that challenge.
+type mockIdP struct {
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	// idToken adjusts the claims of the next ID token; sign overrides the key.
+	idToken  func(claims jwt.MapClaims)
+	sign     *rsa.PrivateKey
+	userinfo map[string]interface{}
+}
+
+const (
+	mockClientID = "agentboard-test"
+	mockCode     = "auth-code"
+	mockRedirect = "http://agentboard.test/api/auth/oidc/callback"
+)
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"userinfo_endpoint":      m.srv.URL + "/userinfo",
+			"jwks_uri":               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1", "kty": "RSA", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != mockCode ||
+			r.PostForm.Get("client_id") != mockClientID || r.PostForm.Get("redirect_uri") != mockRedirect ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":    m.srv.URL,
+			"aud":    mockClientID,
+			"sub":    "user-123",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"iat":    time.Now().Unix(),
+			"nonce":  m.nonce,
+			"email":  "ada@example.com",
+			"name":   "Ada",
+			"groups": []string{"engineers"},
+		}
+		if m.idToken != nil {
+			m.idToken(claims)
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "k1"
+		signWith := m.key
+		if m.sign != nil {
+			signWith = m.sign
+		}
+		raw, err := tok.SignedString(signWith)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": raw, "access_token": "access", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" || m.userinfo == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(m.userinfo)
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// useOIDC points the package at the mock provider with fresh caches, and
+// signs state cookies with a fixed secret so no database is needed for them.
+func useOIDC(t *testing.T, m *mockIdP, defaultRole string) {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "oidc-test-secret")
+	oidcCfgOnce.Do(func() {})
+	oidcCfg = &oidcConfig{
+		Issuer:       m.srv.URL,
+		ClientID:     mockClientID,
+		RedirectURL:  mockRedirect,
+		Scopes:       []string{"openid", "profile", "email", "groups"},
+		GroupsClaim:  "groups",
+		AdminGroups:  []string{"admins"},
+		MemberGroups: []string{"engineers"},
+		DefaultRole:  defaultRole,
+	}
+	oidc = &oidcState{}
+	keyRing = &signingKeyRing{}
+	t.Cleanup(func() { oidcCfg = nil })
+}
+
+// startLogin runs OIDCLogin and returns the authorize redirect's query and
+// the state cookie.
+func startLogin(t *testing.T, m *mockIdP) (url.Values, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	(&AuthHandler{}).OIDCLogin(rec, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body.String())
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loc.Scheme + "://" + loc.Host + loc.Path; got != m.srv.URL+"/authorize" {
+		t.Fatalf("login redirects to %s", got)
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("login: no HttpOnly state cookie in %v", rec.Result().Cookies())
+	}
+	q := loc.Query()
+	m.challenge, m.nonce = q.Get("code_challenge"), q.Get("nonce")
+	return q, cookie
+}
+
+// callback completes the login as the browser would after the IdP redirect.
+func callback(t *testing.T, query url.Values, cookie *http.Cookie) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/auth/oidc/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	(&AuthHandler{}).OIDCCallback(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: status %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Header().Get("Location")
+}
+
+func TestOIDCLoginRedirect(t *testing.T) {
+	m := newMockIdP(t)
+	useOIDC(t, m, "viewer")
+	q, _ := startLogin(t, m)
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             mockClientID,
+		"redirect_uri":          mockRedirect,
+		"scope":                 "openid profile email groups",
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	for _, k := range []string{"state", "nonce", "code_challenge"} {
+		if q.Get(k) == "" {
+			t.Errorf("missing %s", k)
+		}
+	}
+}
+
+func TestOIDCLoginNotConfigured(t *testing.T) {
+	oidcCfgOnce.Do(func() {})
+	oidcCfg = nil
+	rec := httptest.NewRecorder()
+	(&AuthHandler{}).OIDCLogin(rec, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", rec.Code)
+	}
+}
+
+// TestOIDCCallbackRejects covers the callback's failure paths, none of which
+// may reach the users table.
+func TestOIDCCallbackRejects(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		query    func(q url.Values) url.Values
+		noCookie bool
+		nonce    string
+		idToken  func(claims jwt.MapClaims)
+		sign     *rsa.PrivateKey
+		want     string
+	}{
+		{name: "idp error", query: func(q url.Values) url.Values { return url.Values{"error": {"access_denied"}} }, want: "identity provider returned access_denied"},
+		{name: "no state cookie", noCookie: true, want: "login session expired"},
+		{name: "state mismatch", query: func(q url.Values) url.Values { q.Set("state", "forged"); return q }, want: "invalid login state"},
+		{name: "wrong code", query: func(q url.Values) url.Values { q.Set("code", "stolen"); return q }, want: "could not complete sign-in"},
+		{name: "nonce mismatch", nonce: "replayed", want: "could not verify identity"},
+		{name: "wrong audience", idToken: func(c jwt.MapClaims) { c["aud"] = "someone-else" }, want: "could not verify identity"},
+		{name: "wrong issuer", idToken: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, want: "could not verify identity"},
+		{name: "expired", idToken: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, want: "could not verify identity"},
+		{name: "unknown signing key", sign: otherKey, want: "could not verify identity"},
+		{name: "no mapped group", idToken: func(c jwt.MapClaims) { c["groups"] = []string{"contractors"} }, want: "not in a group allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIdP(t)
+			useOIDC(t, m, "")
+			m.idToken, m.sign = tt.idToken, tt.sign
+			authz, cookie := startLogin(t, m)
+			q := url.Values{"code": {mockCode}, "state": {authz.Get("state")}}
+			if tt.query != nil {
+				q = tt.query(q)
+			}
+			if tt.noCookie {
+				cookie = nil
+			}
+			if tt.nonce != "" {
+				m.nonce = tt.nonce
+			}
+			loc := callback(t, q, cookie)
+			if !strings.HasPrefix(loc, "/#sso_error=") {
+				t.Fatalf("redirect %q, want an sso_error", loc)
+			}
+			msg, _ := url.QueryUnescape(strings.TrimPrefix(loc, "/#sso_error="))
+			if !strings.Contains(msg, tt.want) {
+				t.Fatalf("error %q, want %q", msg, tt.want)
+			}
+		})
+	}
+}
+
+// TestOIDCCallbackDatabase signs in against a real database: the first login
+// creates the user, and a disabled user is refused without its role or
+// last_login changing. Set TEST_DATABASE_URL to run it.
+func TestOIDCCallbackDatabase(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := os.ReadFile("../schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(string(schema)); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	prev := db.DB
+	db.DB = conn
+	t.Cleanup(func() { db.DB = prev; conn.Close() })
+
+	m := newMockIdP(t)
+	useOIDC(t, m, "viewer")
+	conn.Exec(`DELETE FROM users WHERE oidc_issuer = $1`, m.srv.URL)
+	t.Cleanup(func() { conn.Exec(`DELETE FROM users WHERE oidc_issuer = $1`, m.srv.URL) })
+
+	login := func() string {
+		authz, cookie := startLogin(t, m)
+		q := url.Values{"code": {mockCode}, "state": {authz.Get("state")}}
+		return callback(t, q, cookie)
+	}
+
+	// Groups only in userinfo are merged in before the role is mapped.
+	m.idToken = func(c jwt.MapClaims) { delete(c, "groups") }
+	m.userinfo = map[string]interface{}{"sub": "user-123", "groups": []string{"engineers"}}
+	if loc := login(); !strings.HasPrefix(loc, "/#sso_token=") || !strings.Contains(loc, "&sso_refresh=") {
+		t.Fatalf("first login redirect %q", loc)
+	}
+	var role string
+	var lastLogin time.Time
+	if err := conn.QueryRow(`SELECT role, last_login FROM users WHERE oidc_issuer = $1 AND oidc_subject = 'user-123'`,
+		m.srv.URL).Scan(&role, &lastLogin); err != nil {
+		t.Fatal(err)
+	}
+	if role != "member" {
+		t.Fatalf("role %q, want member", role)
+	}
+
+	conn.Exec(`UPDATE users SET disabled = true WHERE oidc_issuer = $1`, m.srv.URL)
+	m.idToken = func(c jwt.MapClaims) { c["groups"] = []string{"admins"} }
+	loc := login()
+	if msg, _ := url.QueryUnescape(strings.TrimPrefix(loc, "/#sso_error=")); msg != errDisabledAccount.Error() {
+		t.Fatalf("disabled login redirect %q", loc)
+	}
+	var role2 string
+	var lastLogin2 time.Time
+	conn.QueryRow(`SELECT role, last_login FROM users WHERE oidc_issuer = $1 AND oidc_subject = 'user-123'`,
+		m.srv.URL).Scan(&role2, &lastLogin2)
+	if role2 != "member" || !lastLogin2.Equal(lastLogin) {
+		t.Fatalf("disabled login changed the user: role %q, last_login %v -> %v", role2, lastLogin, lastLogin2)
+	}
+}
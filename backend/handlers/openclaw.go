@@ -59,6 +59,11 @@ func StartAgentStatusPoller(hub interface{ Broadcast(string, interface{}) }) {
 			if prev, ok := prevStatuses[ca.Name]; !ok || prev != s.Status {
 				changed = true
 				prevStatuses[ca.Name] = s.Status
+				if ok {
+					go TriggerWebhooks(EventAgentStatusChanged, map[string]interface{}{
+						"agent_id": ca.ID, "from": prev, "to": s.Status, "source": "poller",
+					})
+				}
 			}
 		}
 		if changed {
@@ -406,6 +411,11 @@ func (h *OpenClawHandler) UpdateAgentSoul(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	go LogAudit(getAgentFromContext(r), "soul_updated", "agent", ca.ID, map[string]interface{}{"file": filename})
+	go TriggerWebhooks(EventSoulUpdated, map[string]interface{}{
+		"agent_id": ca.ID, "file": req.File, "filename": filename,
+		"bytes": len(req.Content), "actor": getAgentFromContext(r),
+	})
 	writeJSON(w, map[string]string{"message": "File saved successfully", "file": filename})
 }
 
@@ -0,0 +1,848 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ─── OTLP/HTTP trace receiver ────────────────────────────────────────────────
+//
+// POST /api/otlp/v1/traces accepts an OpenTelemetry ExportTraceServiceRequest
+// as protobuf (application/x-protobuf) or JSON (application/json), optionally
+// gzip-compressed. Point an exporter at it with
+//
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT=https://<host>/api/otlp/v1/traces
+//	OTEL_EXPORTER_OTLP_HEADERS=X-API-Key=<key>
+//
+// Each span becomes one agent_traces row keeping its trace, span and parent
+// span IDs, attributes, status and start/end times. The agent is the API
+// key's bound agent, else the agentboard.agent_id attribute (span, then
+// resource), else the resource's service.name. The task comes from an
+// agentboard.task_id attribute on any span of the trace, so child spans
+// exported before their root still land on the task.
+
+const (
+	otlpMaxBody    = 8 << 20  // compressed request size
+	otlpMaxDecoded = 32 << 20 // after gzip
+)
+
+var (
+	otlpSpanKinds   = []string{"unspecified", "internal", "server", "client", "producer", "consumer"}
+	otlpStatusCodes = []string{"unset", "ok", "error"}
+)
+
+// otlpSpan is a span decoded from either encoding.
+type otlpSpan struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Kind          string
+	Start, End    time.Time
+	Attributes    map[string]interface{}
+	Events        []otlpEvent
+	StatusCode    string
+	StatusMessage string
+
+	Resource     map[string]interface{}
+	ScopeName    string
+	ScopeVersion string
+}
+
+type otlpEvent struct {
+	Name       string                 `json:"name"`
+	Time       time.Time              `json:"time"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+func unixNano(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns)).UTC()
+}
+
+func enumName(names []string, n uint64) string {
+	if n < uint64(len(names)) {
+		return names[n]
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// ─── Protobuf decoding ───────────────────────────────────────────────────────
+//
+// Just enough of the protobuf wire format to read
+// opentelemetry.proto.collector.trace.v1.ExportTraceServiceRequest.
+
+var errPBTruncated = errors.New("truncated protobuf message")
+
+type pbReader struct {
+	b []byte
+}
+
+func (r *pbReader) done() bool { return len(r.b) == 0 }
+
+func (r *pbReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errPBTruncated
+	}
+	r.b = r.b[n:]
+	return v, nil
+}
+
+func (r *pbReader) key() (int, int, error) {
+	k, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(k >> 3), int(k & 7), nil
+}
+
+func (r *pbReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.b)) {
+		return nil, errPBTruncated
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v, nil
+}
+
+func (r *pbReader) fixed64() (uint64, error) {
+	if len(r.b) < 8 {
+		return 0, errPBTruncated
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v, nil
+}
+
+func (r *pbReader) skip(wireType int) error {
+	var err error
+	switch wireType {
+	case 0:
+		_, err = r.varint()
+	case 1:
+		_, err = r.fixed64()
+	case 2:
+		_, err = r.bytes()
+	case 5:
+		if len(r.b) < 4 {
+			return errPBTruncated
+		}
+		r.b = r.b[4:]
+	default:
+		return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+	}
+	return err
+}
+
+// pbFields calls fn for each field of msg. fn returns false for fields it
+// doesn't read, which are skipped.
+func pbFields(msg []byte, fn func(r *pbReader, field, wireType int) (bool, error)) error {
+	r := &pbReader{b: msg}
+	for !r.done() {
+		field, wireType, err := r.key()
+		if err != nil {
+			return err
+		}
+		handled, err := fn(r, field, wireType)
+		if err != nil {
+			return err
+		}
+		if !handled {
+			if err := r.skip(wireType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func decodeOTLPProto(body []byte) ([]otlpSpan, error) {
+	var spans []otlpSpan
+	err := pbFields(body, func(r *pbReader, field, wt int) (bool, error) {
+		if field != 1 || wt != 2 {
+			return false, nil
+		}
+		b, err := r.bytes()
+		if err != nil {
+			return true, err
+		}
+		rs, err := decodePBResourceSpans(b)
+		spans = append(spans, rs...)
+		return true, err
+	})
+	return spans, err
+}
+
+func decodePBResourceSpans(msg []byte) ([]otlpSpan, error) {
+	resource := map[string]interface{}{}
+	var scopes [][]byte
+	err := pbFields(msg, func(r *pbReader, field, wt int) (bool, error) {
+		if wt != 2 {
+			return false, nil
+		}
+		switch field {
+		case 1: // Resource
+			b, err := r.bytes()
+			if err != nil {
+				return true, err
+			}
+			return true, pbFields(b, func(r *pbReader, field, wt int) (bool, error) {
+				if field != 1 || wt != 2 {
+					return false, nil
+				}
+				return true, decodePBKeyValueInto(r, resource)
+			})
+		case 2, 1000: // ScopeSpans; 1000 is the pre-1.0 instrumentation_library_spans
+			b, err := r.bytes()
+			scopes = append(scopes, b)
+			return true, err
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var spans []otlpSpan
+	for _, msg := range scopes {
+		var scopeName, scopeVersion string
+		var raw [][]byte
+		err := pbFields(msg, func(r *pbReader, field, wt int) (bool, error) {
+			if wt != 2 {
+				return false, nil
+			}
+			switch field {
+			case 1:
+				b, err := r.bytes()
+				if err != nil {
+					return true, err
+				}
+				return true, pbFields(b, func(r *pbReader, field, wt int) (bool, error) {
+					if wt != 2 || (field != 1 && field != 2) {
+						return false, nil
+					}
+					s, err := r.bytes()
+					if field == 1 {
+						scopeName = string(s)
+					} else {
+						scopeVersion = string(s)
+					}
+					return true, err
+				})
+			case 2:
+				b, err := r.bytes()
+				raw = append(raw, b)
+				return true, err
+			}
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range raw {
+			s, err := decodePBSpan(b)
+			if err != nil {
+				return nil, err
+			}
+			s.Resource, s.ScopeName, s.ScopeVersion = resource, scopeName, scopeVersion
+			spans = append(spans, s)
+		}
+	}
+	return spans, nil
+}
+
+func decodePBSpan(msg []byte) (otlpSpan, error) {
+	s := otlpSpan{Attributes: map[string]interface{}{}, Kind: otlpSpanKinds[0], StatusCode: otlpStatusCodes[0]}
+	err := pbFields(msg, func(r *pbReader, field, wt int) (bool, error) {
+		switch {
+		case wt == 2 && (field == 1 || field == 2 || field == 4 || field == 5):
+			b, err := r.bytes()
+			switch field {
+			case 1:
+				s.TraceID = hex.EncodeToString(b)
+			case 2:
+				s.SpanID = hex.EncodeToString(b)
+			case 4:
+				s.ParentSpanID = hex.EncodeToString(b)
+			case 5:
+				s.Name = string(b)
+			}
+			return true, err
+		case wt == 0 && field == 6:
+			v, err := r.varint()
+			s.Kind = enumName(otlpSpanKinds, v)
+			return true, err
+		case wt == 1 && (field == 7 || field == 8):
+			v, err := r.fixed64()
+			if field == 7 {
+				s.Start = unixNano(v)
+			} else {
+				s.End = unixNano(v)
+			}
+			return true, err
+		case wt == 2 && field == 9:
+			return true, decodePBKeyValueInto(r, s.Attributes)
+		case wt == 2 && field == 11:
+			b, err := r.bytes()
+			if err != nil {
+				return true, err
+			}
+			ev := otlpEvent{Attributes: map[string]interface{}{}}
+			err = pbFields(b, func(r *pbReader, field, wt int) (bool, error) {
+				switch {
+				case wt == 1 && field == 1:
+					v, err := r.fixed64()
+					ev.Time = unixNano(v)
+					return true, err
+				case wt == 2 && field == 2:
+					v, err := r.bytes()
+					ev.Name = string(v)
+					return true, err
+				case wt == 2 && field == 3:
+					return true, decodePBKeyValueInto(r, ev.Attributes)
+				}
+				return false, nil
+			})
+			s.Events = append(s.Events, ev)
+			return true, err
+		case wt == 2 && field == 15:
+			b, err := r.bytes()
+			if err != nil {
+				return true, err
+			}
+			return true, pbFields(b, func(r *pbReader, field, wt int) (bool, error) {
+				switch {
+				case wt == 2 && field == 2:
+					v, err := r.bytes()
+					s.StatusMessage = string(v)
+					return true, err
+				case wt == 0 && field == 3:
+					v, err := r.varint()
+					s.StatusCode = enumName(otlpStatusCodes, v)
+					return true, err
+				}
+				return false, nil
+			})
+		}
+		return false, nil
+	})
+	return s, err
+}
+
+// decodePBKeyValueInto reads a length-delimited KeyValue into m.
+func decodePBKeyValueInto(r *pbReader, m map[string]interface{}) error {
+	b, err := r.bytes()
+	if err != nil {
+		return err
+	}
+	var key string
+	var value interface{}
+	err = pbFields(b, func(r *pbReader, field, wt int) (bool, error) {
+		if wt != 2 || (field != 1 && field != 2) {
+			return false, nil
+		}
+		v, err := r.bytes()
+		if err != nil {
+			return true, err
+		}
+		if field == 1 {
+			key = string(v)
+			return true, nil
+		}
+		value, err = decodePBAnyValue(v)
+		return true, err
+	})
+	if err == nil && key != "" {
+		m[key] = value
+	}
+	return err
+}
+
+func decodePBAnyValue(msg []byte) (interface{}, error) {
+	var value interface{}
+	err := pbFields(msg, func(r *pbReader, field, wt int) (bool, error) {
+		switch {
+		case field == 1 && wt == 2:
+			v, err := r.bytes()
+			value = string(v)
+			return true, err
+		case field == 2 && wt == 0:
+			v, err := r.varint()
+			value = v != 0
+			return true, err
+		case field == 3 && wt == 0:
+			v, err := r.varint()
+			value = int64(v)
+			return true, err
+		case field == 4 && wt == 1:
+			v, err := r.fixed64()
+			value = math.Float64frombits(v)
+			return true, err
+		case field == 5 && wt == 2: // ArrayValue
+			b, err := r.bytes()
+			if err != nil {
+				return true, err
+			}
+			list := []interface{}{}
+			err = pbFields(b, func(r *pbReader, field, wt int) (bool, error) {
+				if field != 1 || wt != 2 {
+					return false, nil
+				}
+				v, err := r.bytes()
+				if err != nil {
+					return true, err
+				}
+				item, err := decodePBAnyValue(v)
+				list = append(list, item)
+				return true, err
+			})
+			value = list
+			return true, err
+		case field == 6 && wt == 2: // KeyValueList
+			b, err := r.bytes()
+			if err != nil {
+				return true, err
+			}
+			kv := map[string]interface{}{}
+			err = pbFields(b, func(r *pbReader, field, wt int) (bool, error) {
+				if field != 1 || wt != 2 {
+					return false, nil
+				}
+				return true, decodePBKeyValueInto(r, kv)
+			})
+			value = kv
+			return true, err
+		case field == 7 && wt == 2:
+			v, err := r.bytes()
+			value = base64.StdEncoding.EncodeToString(v)
+			return true, err
+		}
+		return false, nil
+	})
+	return value, err
+}
+
+// ─── JSON decoding ───────────────────────────────────────────────────────────
+//
+// OTLP/JSON uses lowerCamelCase field names, hex trace and span IDs, 64-bit
+// integers as strings or numbers, and enums as integers (names are accepted
+// too).
+
+// otlpNumber is an integer sent as either a JSON number or a string.
+type otlpNumber string
+
+func (n *otlpNumber) UnmarshalJSON(b []byte) error {
+	*n = otlpNumber(strings.Trim(string(b), `"`))
+	return nil
+}
+
+func (n otlpNumber) int64() int64 {
+	v, _ := strconv.ParseInt(string(n), 10, 64)
+	return v
+}
+
+func (n otlpNumber) enum(names []string, prefix string) string {
+	if v, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return enumName(names, v)
+	}
+	if s := strings.TrimPrefix(strings.ToLower(string(n)), prefix); s != "" {
+		return s
+	}
+	return names[0]
+}
+
+type otlpJSONKeyValue struct {
+	Key   string           `json:"key"`
+	Value otlpJSONAnyValue `json:"value"`
+}
+
+type otlpJSONAnyValue struct {
+	StringValue *string     `json:"stringValue"`
+	BoolValue   *bool       `json:"boolValue"`
+	IntValue    *otlpNumber `json:"intValue"`
+	DoubleValue *float64    `json:"doubleValue"`
+	ArrayValue  *struct {
+		Values []otlpJSONAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []otlpJSONKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+	BytesValue *string `json:"bytesValue"`
+}
+
+func (v otlpJSONAnyValue) value() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return v.IntValue.int64()
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		list := make([]interface{}, len(v.ArrayValue.Values))
+		for i, item := range v.ArrayValue.Values {
+			list[i] = item.value()
+		}
+		return list
+	case v.KvlistValue != nil:
+		return otlpJSONAttributes(v.KvlistValue.Values)
+	case v.BytesValue != nil:
+		return *v.BytesValue
+	}
+	return nil
+}
+
+func otlpJSONAttributes(kvs []otlpJSONKeyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		if kv.Key != "" {
+			m[kv.Key] = kv.Value.value()
+		}
+	}
+	return m
+}
+
+type otlpJSONScopeSpans struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scope"`
+	Spans []struct {
+		TraceID           string             `json:"traceId"`
+		SpanID            string             `json:"spanId"`
+		ParentSpanID      string             `json:"parentSpanId"`
+		Name              string             `json:"name"`
+		Kind              otlpNumber         `json:"kind"`
+		StartTimeUnixNano otlpNumber         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   otlpNumber         `json:"endTimeUnixNano"`
+		Attributes        []otlpJSONKeyValue `json:"attributes"`
+		Events            []struct {
+			TimeUnixNano otlpNumber         `json:"timeUnixNano"`
+			Name         string             `json:"name"`
+			Attributes   []otlpJSONKeyValue `json:"attributes"`
+		} `json:"events"`
+		Status struct {
+			Code    otlpNumber `json:"code"`
+			Message string     `json:"message"`
+		} `json:"status"`
+	} `json:"spans"`
+}
+
+// otlpJSONID normalizes a trace or span ID of size bytes to lowercase hex.
+// The spec says hex, but some exporters send protobuf-JSON's base64.
+func otlpJSONID(s string, size int) string {
+	if b, err := hex.DecodeString(s); err == nil && len(b) == size {
+		return strings.ToLower(s)
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == size {
+		return hex.EncodeToString(b)
+	}
+	return s
+}
+
+func decodeOTLPJSON(body []byte) ([]otlpSpan, error) {
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpJSONKeyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []otlpJSONScopeSpans `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	var spans []otlpSpan
+	for _, rs := range req.ResourceSpans {
+		resource := otlpJSONAttributes(rs.Resource.Attributes)
+		for _, ss := range rs.ScopeSpans {
+			for _, js := range ss.Spans {
+				s := otlpSpan{
+					TraceID:       otlpJSONID(js.TraceID, 16),
+					SpanID:        otlpJSONID(js.SpanID, 8),
+					ParentSpanID:  otlpJSONID(js.ParentSpanID, 8),
+					Name:          js.Name,
+					Kind:          js.Kind.enum(otlpSpanKinds, "span_kind_"),
+					Start:         unixNano(uint64(js.StartTimeUnixNano.int64())),
+					End:           unixNano(uint64(js.EndTimeUnixNano.int64())),
+					Attributes:    otlpJSONAttributes(js.Attributes),
+					StatusCode:    js.Status.Code.enum(otlpStatusCodes, "status_code_"),
+					StatusMessage: js.Status.Message,
+					Resource:      resource,
+					ScopeName:     ss.Scope.Name,
+					ScopeVersion:  ss.Scope.Version,
+				}
+				for _, ev := range js.Events {
+					s.Events = append(s.Events, otlpEvent{
+						Name:       ev.Name,
+						Time:       unixNano(uint64(ev.TimeUnixNano.int64())),
+						Attributes: otlpJSONAttributes(ev.Attributes),
+					})
+				}
+				spans = append(spans, s)
+			}
+		}
+	}
+	return spans, nil
+}
+
+// ─── Mapping onto agent_traces ───────────────────────────────────────────────
+
+// attr returns the first of keys set to a non-empty value on the span, then
+// on its resource.
+func (s *otlpSpan) attr(keys ...string) string {
+	for _, m := range []map[string]interface{}{s.Attributes, s.Resource} {
+		for _, k := range keys {
+			if v, ok := m[k]; ok && v != nil {
+				if str := strings.TrimSpace(fmt.Sprint(v)); str != "" {
+					return str
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// traceType maps a span onto an agent_traces trace_type. An explicit
+// agentboard.trace_type attribute wins; otherwise failed spans are errors
+// and GenAI semantic-convention attributes pick the kind of work.
+func (s *otlpSpan) traceType() string {
+	if t := s.attr("agentboard.trace_type"); validTraceTypes[t] {
+		return t
+	}
+	if s.StatusCode == "error" {
+		return "error"
+	}
+	op := s.attr("gen_ai.operation.name")
+	switch {
+	case op == "execute_tool" || s.attr("gen_ai.tool.name") != "":
+		return "tool_call"
+	case op == "invoke_agent" || op == "create_agent":
+		return "sub_agent_spawn"
+	case op != "" || s.attr("gen_ai.system", "gen_ai.request.model") != "":
+		return "llm_invoke"
+	case s.attr("file.path") != "":
+		return "file_change"
+	}
+	return "span"
+}
+
+func (s *otlpSpan) content() json.RawMessage {
+	c := map[string]interface{}{
+		"name": s.Name,
+		"kind": s.Kind,
+	}
+	if len(s.Resource) > 0 {
+		c["resource"] = s.Resource
+	}
+	if s.ScopeName != "" {
+		c["scope"] = map[string]string{"name": s.ScopeName, "version": s.ScopeVersion}
+	}
+	if len(s.Events) > 0 {
+		c["events"] = s.Events
+	}
+	b, _ := json.Marshal(c)
+	return b
+}
+
+// IngestOTLPTraces handles POST /api/otlp/v1/traces
+func (h *TraceHandler) IngestOTLPTraces(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isProto := mediaType == "application/x-protobuf" || mediaType == "application/protobuf"
+	if !isProto && mediaType != "application/json" {
+		respondError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/x-protobuf or application/json")
+		return
+	}
+
+	body, err := readCompressedBody(w, r, otlpMaxBody, otlpMaxDecoded)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var spans []otlpSpan
+	if isProto {
+		spans, err = decodeOTLPProto(body)
+	} else {
+		spans, err = decodeOTLPJSON(body)
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid OTLP payload: "+err.Error())
+		return
+	}
+
+	rejected, errMsg, err := storeOTLPSpans(spans, GetBoundAgent(r))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// ExportTraceServiceResponse, with partial_success only when spans were dropped
+	if isProto {
+		var resp []byte
+		if rejected > 0 {
+			var partial []byte
+			partial = binary.AppendUvarint(append(partial, 1<<3|0), uint64(rejected))
+			partial = binary.AppendUvarint(append(partial, 2<<3|2), uint64(len(errMsg)))
+			partial = append(partial, errMsg...)
+			resp = binary.AppendUvarint(append(resp, 1<<3|2), uint64(len(partial)))
+			resp = append(resp, partial...)
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resp)
+		return
+	}
+	resp := map[string]interface{}{}
+	if rejected > 0 {
+		resp["partialSuccess"] = map[string]interface{}{"rejectedSpans": strconv.Itoa(rejected), "errorMessage": errMsg}
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// storeOTLPSpans writes spans to agent_traces in one transaction. Spans
+// without valid IDs are rejected; re-sent spans are ignored.
+func storeOTLPSpans(spans []otlpSpan, boundAgent string) (int, string, error) {
+	rejected, errMsg := 0, ""
+	valid := spans[:0]
+	for _, s := range spans {
+		if len(s.TraceID) != 32 || len(s.SpanID) != 16 || strings.Trim(s.TraceID, "0") == "" || strings.Trim(s.SpanID, "0") == "" {
+			rejected++
+			errMsg = "spans need a 16-byte trace_id and an 8-byte span_id"
+			continue
+		}
+		if len(s.ParentSpanID) != 16 || strings.Trim(s.ParentSpanID, "0") == "" {
+			s.ParentSpanID = ""
+		}
+		valid = append(valid, s)
+	}
+	if len(valid) == 0 {
+		return rejected, errMsg, nil
+	}
+
+	// Task IDs named by any span of a trace apply to the whole trace
+	traceTask := map[string]string{}
+	spanTask := make([]string, len(valid)) // canonical form of each span's task ID
+	var candidates []string
+	for i := range valid {
+		if id, err := uuid.Parse(valid[i].attr("agentboard.task_id", "task.id")); err == nil {
+			spanTask[i] = id.String()
+			candidates = append(candidates, spanTask[i])
+		}
+	}
+	known := map[string]bool{}
+	if len(candidates) > 0 {
+		var err error
+		if known, err = existingTasks(candidates); err != nil {
+			return 0, "", err
+		}
+	}
+	var traceIDs []string
+	for i := range valid {
+		if known[spanTask[i]] {
+			traceTask[valid[i].TraceID] = spanTask[i]
+		}
+		traceIDs = append(traceIDs, valid[i].TraceID)
+	}
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT ON (trace_id) trace_id, task_id::text FROM agent_traces
+		WHERE trace_id = ANY($1) AND task_id IS NOT NULL
+	`, pq.Array(traceIDs))
+	if err != nil {
+		return 0, "", err
+	}
+	for rows.Next() {
+		var traceID, taskID string
+		if rows.Scan(&traceID, &taskID) == nil {
+			if _, ok := traceTask[traceID]; !ok {
+				traceTask[traceID] = taskID
+			}
+		}
+	}
+	rows.Close()
+
+	items := make([]*traceInput, len(valid))
+	for i := range valid {
+		s := &valid[i]
+		t := &traceInput{
+			TaskID:        traceTask[s.TraceID],
+			AgentID:       boundAgent,
+			TraceType:     s.traceType(),
+			Content:       s.content(),
+			TraceID:       s.TraceID,
+			SpanID:        s.SpanID,
+			ParentSpanID:  s.ParentSpanID,
+			Name:          s.Name,
+			Status:        s.StatusCode,
+			StatusMessage: s.StatusMessage,
+		}
+		if t.AgentID == "" {
+			t.AgentID = s.attr("agentboard.agent_id", "service.name")
+		}
+		start, end := s.Start, s.End
+		if start.IsZero() {
+			start = time.Now().UTC()
+		}
+		if end.Before(start) {
+			end = start
+		}
+		t.StartTime, t.EndTime = &start, &end
+		t.DurationMs = int(end.Sub(start).Milliseconds())
+		t.Attributes, _ = json.Marshal(s.Attributes)
+		items[i] = t
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+	_, isNew, err := insertTraces(tx, items)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Spans stored before their trace's task was known
+	for traceID, taskID := range traceTask {
+		if _, err := tx.Exec(`UPDATE agent_traces SET task_id = $1 WHERE trace_id = $2 AND task_id IS NULL`, taskID, traceID); err != nil {
+			return 0, "", err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+
+	for i, t := range items {
+		if isNew[i] && t.TraceType == "error" && t.AgentID != "" {
+			traceErrorNotices.add(t.AgentID, t.TaskID)
+		}
+	}
+	if rejected > 0 {
+		log.Printf("[otlp] rejected %d span(s): %s", rejected, errMsg)
+	}
+	return rejected, errMsg, nil
+}
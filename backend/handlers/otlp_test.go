@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pb builds protobuf wire-format messages by hand. Field numbers below are
+// those of opentelemetry/proto/{collector/trace,trace,common,resource}/v1.
+type pb []byte
+
+func (m pb) varint(field int, v uint64) pb {
+	m = binary.AppendUvarint(m, uint64(field)<<3)
+	return binary.AppendUvarint(m, v)
+}
+
+func (m pb) fixed64(field int, v uint64) pb {
+	m = binary.AppendUvarint(m, uint64(field)<<3|1)
+	return binary.LittleEndian.AppendUint64(m, v)
+}
+
+func (m pb) fixed32(field int, v uint32) pb {
+	m = binary.AppendUvarint(m, uint64(field)<<3|5)
+	return binary.LittleEndian.AppendUint32(m, v)
+}
+
+func (m pb) bytes(field int, b []byte) pb {
+	m = binary.AppendUvarint(m, uint64(field)<<3|2)
+	m = binary.AppendUvarint(m, uint64(len(b)))
+	return append(m, b...)
+}
+
+func (m pb) str(field int, s string) pb { return m.bytes(field, []byte(s)) }
+
+func (m pb) msg(field int, sub pb) pb { return m.bytes(field, sub) }
+
+// kv encodes a KeyValue whose AnyValue is any.
+func kv(key string, any pb) pb { return pb{}.str(1, key).msg(2, any) }
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestDecodeOTLPProtoRoundTrip(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(1500 * time.Millisecond)
+
+	resource := pb{}.
+		msg(1, kv("service.name", pb{}.str(1, "planner"))).
+		msg(1, kv("agentboard.agent_id", pb{}.str(1, "agent-7"))).
+		varint(2, 0) // dropped_attributes_count
+	scope := pb{}.str(1, "agentboard.sdk").str(2, "1.2.0")
+	event := pb{}.
+		fixed64(1, uint64(start.Add(time.Second).UnixNano())).
+		str(2, "retry").
+		msg(3, kv("attempt", pb{}.varint(3, 2)))
+	status := pb{}.str(2, "upstream timeout").varint(3, 2)
+	span := pb{}.
+		bytes(1, mustHex("5b8efff798038103d269b633813fc60c")).
+		bytes(2, mustHex("eee19b7ec3c1b174")).
+		str(3, "w3c-tracestate=1"). // trace_state: not read
+		bytes(4, mustHex("eee19b7ec3c1b173")).
+		str(5, "llm.call").
+		varint(6, 3). // SPAN_KIND_CLIENT
+		fixed64(7, uint64(start.UnixNano())).
+		fixed64(8, uint64(end.UnixNano())).
+		msg(9, kv("gen_ai.request.model", pb{}.str(1, "opus"))).
+		msg(9, kv("gen_ai.usage.input_tokens", pb{}.varint(3, 1200))).
+		msg(9, kv("cache.hit", pb{}.varint(2, 1))).
+		msg(9, kv("temperature", pb{}.fixed64(4, math.Float64bits(0.25)))).
+		msg(9, kv("tools", pb{}.msg(5, pb{}.msg(1, pb{}.str(1, "search")).msg(1, pb{}.varint(3, 3))))).
+		msg(9, kv("limits", pb{}.msg(6, pb{}.msg(1, kv("max", pb{}.varint(3, 10)))))).
+		msg(9, kv("blob", pb{}.bytes(7, []byte{0xde, 0xad}))).
+		varint(10, 0). // dropped_attributes_count
+		msg(11, event).
+		msg(15, status).
+		fixed32(16, 0x100). // flags
+		varint(99, 7)       // a field from a newer schema
+	request := pb{}.msg(1, pb{}.
+		msg(1, resource).
+		msg(2, pb{}.msg(1, scope).msg(2, span).str(3, "https://opentelemetry.io/schemas/1.26.0")).
+		str(3, "https://opentelemetry.io/schemas/1.26.0"))
+
+	spans, err := decodeOTLPProto(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	got := spans[0]
+	want := otlpSpan{
+		TraceID:      "5b8efff798038103d269b633813fc60c",
+		SpanID:       "eee19b7ec3c1b174",
+		ParentSpanID: "eee19b7ec3c1b173",
+		Name:         "llm.call",
+		Kind:         "client",
+		Start:        start,
+		End:          end,
+		Attributes: map[string]interface{}{
+			"gen_ai.request.model":      "opus",
+			"gen_ai.usage.input_tokens": int64(1200),
+			"cache.hit":                 true,
+			"temperature":               0.25,
+			"tools":                     []interface{}{"search", int64(3)},
+			"limits":                    map[string]interface{}{"max": int64(10)},
+			"blob":                      "3q0=",
+		},
+		Events: []otlpEvent{{
+			Name:       "retry",
+			Time:       start.Add(time.Second),
+			Attributes: map[string]interface{}{"attempt": int64(2)},
+		}},
+		StatusCode:    "error",
+		StatusMessage: "upstream timeout",
+		Resource:      map[string]interface{}{"service.name": "planner", "agentboard.agent_id": "agent-7"},
+		ScopeName:     "agentboard.sdk",
+		ScopeVersion:  "1.2.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded span\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestDecodeOTLPProtoLegacyScopeField(t *testing.T) {
+	// Exporters before OTLP 1.0 sent instrumentation_library_spans as field 1000.
+	span := pb{}.bytes(1, mustHex("5b8efff798038103d269b633813fc60c")).bytes(2, mustHex("eee19b7ec3c1b174")).str(5, "old")
+	request := pb{}.msg(1, pb{}.msg(1000, pb{}.msg(2, span)))
+	spans, err := decodeOTLPProto(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 1 || spans[0].Name != "old" || spans[0].Kind != "unspecified" || spans[0].StatusCode != "unset" {
+		t.Fatalf("got %+v", spans)
+	}
+}
+
+func TestDecodeOTLPProtoMalformed(t *testing.T) {
+	validSpan := pb{}.bytes(1, mustHex("5b8efff798038103d269b633813fc60c")).str(5, "ok")
+	// wrap puts span bytes, plus any trailing raw bytes, into a request.
+	wrap := func(span pb, raw ...byte) pb {
+		span = append(append(pb{}, span...), raw...)
+		return pb{}.msg(1, pb{}.msg(2, pb{}.msg(2, span)))
+	}
+	tests := []struct {
+		name string
+		body []byte
+		want string
+	}{
+		{"truncated varint key", []byte{0x80}, "truncated"},
+		{"truncated varint value", []byte{0x08, 0x80}, "truncated"},
+		{"unterminated varint", []byte{0x0a, 0xff, 0xff, 0xff}, "truncated"},
+		{"varint overflows 64 bits", []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, "truncated"},
+		{"truncated varint in nested span", wrap(pb{}.str(5, "x"), 0x30, 0x80), "truncated"},
+		{"length prefix past the end", []byte{0x0a, 0x05, 0x01, 0x02}, "truncated"},
+		{"huge length prefix", append([]byte{0x0a}, binary.AppendUvarint(nil, math.MaxUint64)...), "truncated"},
+		{"length prefix past the end of parent", wrap(pb{}.str(5, "x"), 0x2a, 0x7f), "truncated"},
+		{"truncated fixed64", wrap(nil, 7<<3|1, 1, 2, 3), "truncated"},
+		{"truncated fixed32", append(binary.AppendUvarint(nil, 9<<3|5), 1, 2), "truncated"},
+		{"start group wire type", wrap(validSpan, 0x1b), "wire type 3"},
+		{"end group wire type", wrap(validSpan, 0x0c), "wire type 4"},
+		{"wire type 6", wrap(validSpan, 0x0e), "wire type 6"},
+		{"wire type 7", pb{}.msg(1, pb{}.msg(1, append(pb{}, 0x0f))), "wire type 7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeOTLPProto(tt.body)
+			if err == nil {
+				t.Fatalf("decoded %x without error", tt.body)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %q, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeOTLPProtoSkipsUnknownFields(t *testing.T) {
+	// Every supported wire type, on fields the decoder doesn't read.
+	unknown := pb{}.varint(90, 300).fixed64(91, 1).str(92, "x").fixed32(93, 1)
+	span := append(pb{}.bytes(1, mustHex("5b8efff798038103d269b633813fc60c")).str(5, "kept"), unknown...)
+	request := append(pb{}.msg(1, pb{}.msg(2, append(pb{}.msg(2, span), unknown...))), unknown...)
+	spans, err := decodeOTLPProto(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 1 || spans[0].Name != "kept" {
+		t.Fatalf("got %+v", spans)
+	}
+}
+
+func TestDecodeOTLPProtoEmpty(t *testing.T) {
+	spans, err := decodeOTLPProto(nil)
+	if err != nil || len(spans) != 0 {
+		t.Fatalf("got %v, %v", spans, err)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -27,35 +28,10 @@ func SendAgentMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Try OpenClaw API first
-	openclawBase := os.Getenv("OPENCLAW_API_URL")
-	if openclawBase == "" {
-		openclawBase = "http://localhost:4444"
-	}
-
-	// Send via OpenClaw session API
-	payload := map[string]interface{}{
-		"message":  req.Message,
-		"agent_id": agentID,
-	}
-	body, _ := json.Marshal(payload)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Post(openclawBase+"/api/sessions/"+agentID+"/message", "application/json", bytes.NewReader(body))
+	resp, err := sendAgentMessage(agentID, req.Message)
 	if err != nil {
-		// Fallback: check if agent has a webhook configured
-		var webhookURL string
-		db.DB.QueryRow(`SELECT url FROM webhooks WHERE name = $1 AND active = true LIMIT 1`, agentID).Scan(&webhookURL)
-		if webhookURL != "" {
-			resp, err = client.Post(webhookURL, "application/json", bytes.NewReader(body))
-			if err != nil {
-				respondError(w, 502, "failed to reach agent: "+err.Error())
-				return
-			}
-		} else {
-			respondError(w, 502, "agent unreachable and no webhook configured")
-			return
-		}
+		respondError(w, 502, err.Error())
+		return
 	}
 	defer resp.Body.Close()
 
@@ -70,3 +46,35 @@ func SendAgentMessage(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(resp.StatusCode)
 	w.Write(respBody)
 }
+
+// sendAgentMessage posts msg to the agent's OpenClaw session, falling back to
+// an active webhook named after the agent. The caller closes the response.
+func sendAgentMessage(agentID, msg string) (*http.Response, error) {
+	openclawBase := os.Getenv("OPENCLAW_API_URL")
+	if openclawBase == "" {
+		openclawBase = "http://localhost:4444"
+	}
+
+	payload := map[string]interface{}{
+		"message":  msg,
+		"agent_id": agentID,
+	}
+	body, _ := json.Marshal(payload)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(openclawBase+"/api/sessions/"+agentID+"/message", "application/json", bytes.NewReader(body))
+	if err == nil {
+		return resp, nil
+	}
+	// Fallback: check if agent has a webhook configured
+	var webhookURL string
+	db.DB.QueryRow(`SELECT url FROM webhooks WHERE name = $1 AND active = true LIMIT 1`, agentID).Scan(&webhookURL)
+	if webhookURL == "" {
+		return nil, fmt.Errorf("agent unreachable and no webhook configured")
+	}
+	resp, err = client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach agent: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/alghanim/agentboard/backend/models"
+	"github.com/alghanim/agentboard/backend/websocket"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// ─── Work queue ──────────────────────────────────────────────────────────────
+//
+// Agents pull work instead of polling and racing on AssignTask. A claim
+// leases the most urgent ready task that fits the agent and assigns it to
+// them; the lease must be renewed by heartbeat. Released or expired leases put
+// the task back in the queue: unassigned, in its workflow's ready status.
+// Lease events are written to task_history with a note.
+
+const (
+	defaultLeaseDuration = 5 * time.Minute
+	maxLeaseDuration     = time.Hour
+	leaseReapInterval    = 15 * time.Second
+)
+
+// TaskLease is an agent's time-limited hold on a task.
+type TaskLease struct {
+	TaskID      string    `json:"task_id"`
+	AgentID     string    `json:"agent_id"`
+	Token       string    `json:"token,omitempty"` // only shown to the holder
+	ClaimedAt   time.Time `json:"claimed_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+const leaseCols = `task_id, agent_id, token, claimed_at, heartbeat_at, expires_at`
+
+func scanLease(scanner interface{ Scan(...interface{}) error }) (*TaskLease, error) {
+	var l TaskLease
+	if err := scanner.Scan(&l.TaskID, &l.AgentID, &l.Token, &l.ClaimedAt, &l.HeartbeatAt, &l.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// leaseDuration reads a requested lease length in seconds, clamped to
+// (0, maxLeaseDuration].
+func leaseDuration(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultLeaseDuration
+	}
+	d := time.Duration(seconds) * time.Second
+	if d > maxLeaseDuration {
+		return maxLeaseDuration
+	}
+	return d
+}
+
+// recordLeaseEvent notes a lease event in task_history without changing status.
+func recordLeaseEvent(q interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+}, taskID, status, by, note string) {
+	if _, err := q.Exec(`
+		INSERT INTO task_history (task_id, from_status, to_status, changed_by, changed_at, note)
+		VALUES ($1, $2, $2, $3, NOW(), $4)`, taskID, status, by, note); err != nil {
+		log.Printf("[queue] Error recording lease event for %s: %v", taskID, err)
+	}
+}
+
+// requeueTask moves a task whose lease ended back to its ready status if it
+// had moved on (e.g. into progress), when the workflow allows it.
+func requeueTask(hub *websocket.Hub, taskID string) {
+	current, wf, err := taskWorkflow(taskID)
+	if err != nil || wf.category(current) == StatusTodo || wf.category(current) == StatusDone {
+		return
+	}
+	targets := []string{readyStatusOf(wf)}
+	for _, s := range wf.Statuses {
+		if s.Category == StatusTodo && s.Name != targets[0] {
+			targets = append(targets, s.Name)
+		}
+	}
+	for _, to := range targets {
+		if to != "" && wf.transition(current, to) != nil {
+			if _, err := moveTask(hub, nil, taskID, to, "queue", 0); err != nil {
+				log.Printf("[queue] Could not requeue task %s: %v", taskID, err)
+			}
+			return
+		}
+	}
+}
+
+// endLease drops a lease and unassigns the task if its holder still has it,
+// unless the task is already done. It returns false if no such lease existed.
+func endLease(hub *websocket.Hub, taskID, agentID, token, by, note string) (bool, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	q := `DELETE FROM task_leases WHERE task_id = $1 AND agent_id = $2`
+	args := []interface{}{taskID, agentID}
+	if token != "" {
+		q += ` AND token = $3`
+		args = append(args, token)
+	}
+	res, err := tx.Exec(q, args...)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM tasks WHERE id = $1 FOR UPDATE`, taskID).Scan(&status); err != nil {
+		return false, err
+	}
+	_, wf, err := taskWorkflow(taskID)
+	if err != nil {
+		return false, err
+	}
+	done := wf.category(status) == StatusDone
+	if !done {
+		if _, err := tx.Exec(`
+			UPDATE tasks SET assignee = CASE WHEN assignee = $2 THEN NULL ELSE assignee END, updated_at = NOW()
+			WHERE id = $1`, taskID, agentID); err != nil {
+			return false, err
+		}
+		tx.Exec(`UPDATE agents SET current_task_id = NULL WHERE id = $1 AND current_task_id = $2::uuid`, agentID, taskID)
+	}
+	recordLeaseEvent(tx, taskID, status, by, note)
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	if !done {
+		requeueTask(hub, taskID)
+	}
+	if hub != nil {
+		hub.Broadcast("task_released", map[string]string{"task_id": taskID, "agent_id": agentID})
+	}
+	return true, nil
+}
+
+// StartLeaseReaper releases expired leases. Run in a goroutine.
+func StartLeaseReaper(hub *websocket.Hub) {
+	log.Println("[queue] Lease reaper started")
+	ticker := time.NewTicker(leaseReapInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reapExpiredLeases(hub)
+	}
+}
+
+func reapExpiredLeases(hub *websocket.Hub) {
+	rows, err := db.DB.Query(`SELECT task_id, agent_id, token FROM task_leases WHERE expires_at < NOW()`)
+	if err != nil {
+		log.Printf("[queue] Error loading expired leases: %v", err)
+		return
+	}
+	type expired struct{ taskID, agentID, token string }
+	var leases []expired
+	for rows.Next() {
+		var e expired
+		if rows.Scan(&e.taskID, &e.agentID, &e.token) == nil {
+			leases = append(leases, e)
+		}
+	}
+	rows.Close()
+
+	for _, e := range leases {
+		// The token pins the expired lease, so a heartbeat racing us wins
+		ok, err := endLease(hub, e.taskID, e.agentID, e.token, "queue", "lease expired (held by "+e.agentID+")")
+		if err != nil {
+			log.Printf("[queue] Error expiring lease on %s: %v", e.taskID, err)
+			continue
+		}
+		if ok {
+			log.Printf("[queue] Lease on task %s held by %s expired", e.taskID, e.agentID)
+			logActivity(e.agentID, "lease_expired", e.taskID, nil)
+			go CreateNotificationInternal(e.agentID, "lease_expired", "Task lease expired",
+				fmt.Sprintf("Your lease on task %s expired and it went back to the queue", e.taskID))
+		}
+	}
+}
+
+// ─── HTTP handlers ───────────────────────────────────────────────────────────
+
+type QueueHandler struct {
+	Hub *websocket.Hub
+}
+
+// queueAgent resolves which agent a queue request acts for: an API key's
+// bound agent, else agent_id. It writes an error and returns "" on failure.
+func queueAgent(w http.ResponseWriter, r *http.Request, agentID string) string {
+	if bound := GetBoundAgent(r); bound != "" {
+		if agentID != "" && agentID != bound {
+			respondError(w, http.StatusForbidden, "API key is bound to agent "+bound)
+			return ""
+		}
+		return bound
+	}
+	if agentID == "" {
+		respondError(w, http.StatusBadRequest, "agent_id is required")
+		return ""
+	}
+	return agentID
+}
+
+// ClaimTask handles POST /api/queue/claim
+// Leases the most urgent ready task for the agent. Tasks match on team (the
+// agent's, unless given), on role via "role:<name>" labels (unlabelled tasks
+// fit any role) and, if labels are given, on having at least one of them.
+// Returns 204 when nothing is available and 404 for an unknown agent.
+func (h *QueueHandler) ClaimTask(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		AgentID      string   `json:"agent_id"`
+		Team         *string  `json:"team"`
+		Role         *string  `json:"role"`
+		Labels       []string `json:"labels"`
+		LeaseSeconds int      `json:"lease_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	agentID := queueAgent(w, r, req.AgentID)
+	if agentID == "" {
+		return
+	}
+
+	var team, role, status string
+	err := db.DB.QueryRow(`SELECT COALESCE(team, ''), COALESCE(role, ''), COALESCE(status, '') FROM agents WHERE id = $1`, agentID).
+		Scan(&team, &role, &status)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "agent not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if status == "paused" || status == "killed" {
+		respondError(w, http.StatusConflict, "agent is "+status)
+		return
+	}
+	if req.Team != nil {
+		team = *req.Team
+	}
+	if req.Role != nil {
+		role = *req.Role
+	}
+	if req.Labels == nil {
+		req.Labels = []string{}
+	}
+	lease := leaseDuration(req.LeaseSeconds)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	var t models.Task
+	err = tx.QueryRow(`
+		SELECT t.id, t.title, t.description, t.status, t.priority, t.assignee, t.team,
+		       t.due_date, t.created_at, t.updated_at, t.completed_at, t.parent_task_id, t.labels
+		FROM tasks t
+		WHERE t.status IN `+sqlStatusList(StatusTodo)+`
+		  AND (COALESCE(t.assignee, '') = '' OR t.assignee = $1)
+		  AND ($2 = '' OR t.team = $2)
+		  AND (NOT EXISTS (SELECT 1 FROM unnest(COALESCE(t.labels, '{}')) l WHERE l LIKE 'role:%')
+		       OR ('role:' || LOWER($3)) = ANY(t.labels))
+		  AND (cardinality($4::text[]) = 0 OR t.labels && $4::text[])
+		  AND NOT EXISTS (SELECT 1 FROM task_leases l WHERE l.task_id = t.id AND l.expires_at > NOW())
+		  AND NOT EXISTS (
+		      SELECT 1 FROM tasks dep
+		      WHERE dep.id = ANY(COALESCE(t.depends_on, '{}')) AND dep.status NOT IN `+sqlStatusList(StatusDone)+`)
+		ORDER BY CASE t.priority WHEN 'critical' THEN 0 WHEN 'urgent' THEN 1 WHEN 'high' THEN 2
+		                         WHEN 'medium' THEN 3 WHEN 'low' THEN 4 ELSE 5 END,
+		         t.due_date NULLS LAST, t.created_at
+		LIMIT 1
+		FOR UPDATE OF t SKIP LOCKED`,
+		agentID, team, role, pq.Array(req.Labels),
+	).Scan(&t.ID, &t.Title, &t.Description, &t.Status, &t.Priority, &t.Assignee, &t.Team,
+		&t.DueDate, &t.CreatedAt, &t.UpdatedAt, &t.CompletedAt, &t.ParentTaskID, pq.Array(&t.Labels))
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	l, err := scanLease(tx.QueryRow(`
+		INSERT INTO task_leases (task_id, agent_id, token, claimed_at, heartbeat_at, expires_at)
+		VALUES ($1, $2, uuid_generate_v4(), NOW(), NOW(), NOW() + $3 * INTERVAL '1 second')
+		ON CONFLICT (task_id) DO UPDATE SET agent_id = EXCLUDED.agent_id, token = EXCLUDED.token,
+		       claimed_at = EXCLUDED.claimed_at, heartbeat_at = EXCLUDED.heartbeat_at, expires_at = EXCLUDED.expires_at
+		RETURNING `+leaseCols,
+		t.ID, agentID, int(lease.Seconds())))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var previous string
+	if t.Assignee != nil {
+		previous = *t.Assignee
+	}
+	if _, err := tx.Exec(`UPDATE tasks SET assignee = $1, updated_at = NOW() WHERE id = $2`, agentID, t.ID); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	tx.Exec(`UPDATE agents SET current_task_id = $1::uuid WHERE id = $2`, t.ID, agentID)
+	recordLeaseEvent(tx, t.ID, t.Status, agentID, fmt.Sprintf("lease claimed by %s for %s", agentID, lease))
+	if err := tx.Commit(); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	t.Assignee = &agentID
+
+	logActivity(agentID, "task_claimed", t.ID, map[string]string{"expires_at": l.ExpiresAt.Format(time.RFC3339)})
+	h.Hub.Broadcast("task_claimed", map[string]string{"task_id": t.ID, "agent_id": agentID})
+	if previous != agentID {
+		go TriggerWebhooks(EventTaskAssigned, map[string]interface{}{
+			"task_id": t.ID, "assignee": agentID, "previous_assignee": previous, "actor": agentID,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"task": t, "lease": l})
+}
+
+// leaseRequest is the body of heartbeat and release calls.
+type leaseRequest struct {
+	AgentID      string `json:"agent_id"`
+	Token        string `json:"token"`
+	LeaseSeconds int    `json:"lease_seconds"`
+	Reason       string `json:"reason"`
+}
+
+func decodeLeaseRequest(w http.ResponseWriter, r *http.Request) (*leaseRequest, string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req leaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return nil, "", false
+	}
+	if req.Token == "" {
+		respondError(w, http.StatusBadRequest, "token is required")
+		return nil, "", false
+	}
+	agentID := queueAgent(w, r, req.AgentID)
+	return &req, agentID, agentID != ""
+}
+
+// HeartbeatLease handles POST /api/queue/leases/{task_id}/heartbeat
+// Extends a live lease. Returns 409 once the lease has expired or moved on.
+func (h *QueueHandler) HeartbeatLease(w http.ResponseWriter, r *http.Request) {
+	taskID := mux.Vars(r)["task_id"]
+	req, agentID, ok := decodeLeaseRequest(w, r)
+	if !ok {
+		return
+	}
+	l, err := scanLease(db.DB.QueryRow(`
+		UPDATE task_leases SET heartbeat_at = NOW(), expires_at = NOW() + $4 * INTERVAL '1 second'
+		WHERE task_id = $1 AND agent_id = $2 AND token = $3 AND expires_at > NOW()
+		RETURNING `+leaseCols,
+		taskID, agentID, req.Token, int(leaseDuration(req.LeaseSeconds).Seconds())))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusConflict, "lease not held: it expired or belongs to another claim")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, l)
+}
+
+// ReleaseLease handles POST /api/queue/leases/{task_id}/release
+// Gives the task back to the queue.
+func (h *QueueHandler) ReleaseLease(w http.ResponseWriter, r *http.Request) {
+	taskID := mux.Vars(r)["task_id"]
+	req, agentID, ok := decodeLeaseRequest(w, r)
+	if !ok {
+		return
+	}
+	note := "lease released by " + agentID
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		note += ": " + reason
+	}
+	released, err := endLease(h.Hub, taskID, agentID, req.Token, agentID, note)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !released {
+		respondError(w, http.StatusConflict, "lease not held: it expired or belongs to another claim")
+		return
+	}
+	logActivity(agentID, "task_released", taskID, map[string]string{"reason": req.Reason})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Task released to the queue"})
+}
+
+// ListLeases handles GET /api/queue/leases?agent_id=
+func (h *QueueHandler) ListLeases(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT ` + leaseCols + ` FROM task_leases WHERE expires_at > NOW()`
+	args := []interface{}{}
+	if agent := r.URL.Query().Get("agent_id"); agent != "" {
+		args = append(args, agent)
+		query += ` AND agent_id = $1`
+	}
+	rows, err := db.DB.Query(query+` ORDER BY expires_at`, args...)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	leases := []TaskLease{}
+	for rows.Next() {
+		l, err := scanLease(rows)
+		if err != nil {
+			continue
+		}
+		// Tokens are only shown to their holder
+		if GetBoundAgent(r) != l.AgentID {
+			l.Token = ""
+		}
+		leases = append(leases, *l)
+	}
+	respondJSON(w, http.StatusOK, leases)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ─── Brute-force protection ──────────────────────────────────────────────────
+//
+// Failed sign-ins are counted per client IP and per account; failed API keys
+// per client IP. The first few failures in a window are free. After that each
+// further failure doubles the wait before the next attempt is accepted, and
+// once the lockout threshold is reached the source is locked out entirely.
+// A successful login clears the account's counter (not the IP's, so one valid
+// account can't be used to reset a spraying attacker).
+
+const (
+	authFailureWindow  = 15 * time.Minute
+	authFreeAttempts   = 5
+	authBackoffBase    = time.Second
+	authBackoffMax     = 5 * time.Minute
+	authLockoutAccount = 10
+	authLockoutIP      = 30
+	authLockoutPeriod  = 15 * time.Minute
+)
+
+type authFailures struct {
+	count       int
+	first       time.Time
+	blockedTill time.Time
+}
+
+type authLimiter struct {
+	mu      sync.Mutex
+	entries map[string]*authFailures
+}
+
+var loginLimiter = &authLimiter{entries: map[string]*authFailures{}}
+
+func init() {
+	go func() {
+		for range time.Tick(time.Minute) {
+			loginLimiter.prune()
+		}
+	}()
+}
+
+// retryAfter returns how long the caller must wait before any of keys may
+// attempt again, or 0.
+func (l *authLimiter) retryAfter(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var wait time.Duration
+	now := time.Now()
+	for _, k := range keys {
+		if e := l.entries[k]; e != nil && e.blockedTill.After(now) {
+			if d := e.blockedTill.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// fail records a failure for key and reports whether it just got locked out.
+func (l *authLimiter) fail(key string, lockoutAt int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	e := l.entries[key]
+	if e == nil || now.Sub(e.first) > authFailureWindow && e.blockedTill.Before(now) {
+		e = &authFailures{first: now}
+		l.entries[key] = e
+	}
+	e.count++
+	switch {
+	case e.count >= lockoutAt:
+		wasLocked := e.count > lockoutAt
+		e.blockedTill = now.Add(authLockoutPeriod)
+		return !wasLocked
+	case e.count > authFreeAttempts:
+		backoff := authBackoffBase << uint(e.count-authFreeAttempts-1)
+		if backoff > authBackoffMax {
+			backoff = authBackoffMax
+		}
+		e.blockedTill = now.Add(backoff)
+	}
+	return false
+}
+
+func (l *authLimiter) reset(key string) {
+	l.mu.Lock()
+	delete(l.entries, key)
+	l.mu.Unlock()
+}
+
+func (l *authLimiter) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for k, e := range l.entries {
+		if now.Sub(e.first) > authFailureWindow && e.blockedTill.Before(now) {
+			delete(l.entries, k)
+		}
+	}
+}
+
+func loginIPKey(ip string) string        { return "login-ip:" + ip }
+func loginAccountKey(user string) string { return "login-user:" + user }
+func apiKeyIPKey(ip string) string       { return "apikey-ip:" + ip }
+
+// respondThrottled writes a 429 with Retry-After.
+func respondThrottled(w http.ResponseWriter, wait time.Duration) {
+	secs := int(wait.Seconds() + 0.999)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	respondError(w, http.StatusTooManyRequests, fmt.Sprintf("too many failed attempts, retry in %ds", secs))
+}
+
+// recordLoginFailure counts a failed password login and writes it to the audit log.
+func recordLoginFailure(ip, username, reason string) {
+	lockedIP := loginLimiter.fail(loginIPKey(ip), authLockoutIP)
+	lockedUser := loginLimiter.fail(loginAccountKey(username), authLockoutAccount)
+	go LogAudit("anonymous", "login_failed", "user", username, map[string]interface{}{"ip": ip, "reason": reason})
+	if lockedIP || lockedUser {
+		log.Printf("⚠️  auth: locking out login attempts (ip %s, account %q)", ip, username)
+		go LogAudit("system", "login_locked", "user", username, map[string]interface{}{
+			"ip": ip, "ip_locked": lockedIP, "account_locked": lockedUser, "duration": authLockoutPeriod.String(),
+		})
+	}
+}
+
+// recordAPIKeyFailure counts a rejected X-API-Key and writes it to the audit log.
+// Only the non-secret prefix of the key is recorded.
+func recordAPIKeyFailure(ip, apiKey string) {
+	locked := loginLimiter.fail(apiKeyIPKey(ip), authLockoutIP)
+	go LogAudit("anonymous", "api_key_failed", "api_key", splitAPIKeyPrefix(apiKey), map[string]interface{}{"ip": ip})
+	if locked {
+		log.Printf("⚠️  auth: locking out API key attempts from %s", ip)
+		go LogAudit("system", "api_key_locked", "api_key", "", map[string]interface{}{"ip": ip, "duration": authLockoutPeriod.String()})
+	}
+}
@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/alghanim/agentboard/backend/websocket"
+	"github.com/gorilla/mux"
+)
+
+// ─── Recurring tasks ─────────────────────────────────────────────────────────
+//
+// A template can carry schedules: a cron expression in a timezone plus a
+// title pattern. StartRecurringTasks instantiates the template whenever a
+// schedule comes due. Runs missed while the server was down are handled by
+// the schedule's catch-up policy:
+//
+//	skip    only the run that is due now is created
+//	latest  one task for the most recent missed run (the default)
+//	all     one task per missed run, up to max_catch_up
+//
+// Every run, created or skipped, is kept in template_schedule_runs.
+
+const (
+	recurringInterval = 30 * time.Second
+	// recurringGrace is how late a run may start and still count as on time.
+	recurringGrace = 5 * time.Minute
+	// maxMissedScan bounds how many missed occurrences are enumerated.
+	maxMissedScan = 10000
+)
+
+var catchUpPolicies = map[string]bool{"skip": true, "latest": true, "all": true}
+
+// TemplateSchedule creates tasks from a template on a cron schedule.
+type TemplateSchedule struct {
+	ID           string      `json:"id"`
+	TemplateID   string      `json:"template_id"`
+	Cron         string      `json:"cron"`
+	Timezone     string      `json:"timezone"`
+	TitlePattern string      `json:"title_pattern"`
+	Enabled      bool        `json:"enabled"`
+	CatchUp      string      `json:"catch_up"`
+	MaxCatchUp   int         `json:"max_catch_up"`
+	NextRunAt    *time.Time  `json:"next_run_at"`
+	LastRunAt    *time.Time  `json:"last_run_at"`
+	NextRuns     []time.Time `json:"next_runs,omitempty"` // upcoming runs, for display
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+const scheduleCols = `id, template_id, cron, timezone, title_pattern, enabled, catch_up, max_catch_up,
+	next_run_at, last_run_at, created_at, updated_at`
+
+func scanSchedule(scanner interface{ Scan(...interface{}) error }) (*TemplateSchedule, error) {
+	var s TemplateSchedule
+	var next, last sql.NullTime
+	if err := scanner.Scan(&s.ID, &s.TemplateID, &s.Cron, &s.Timezone, &s.TitlePattern, &s.Enabled, &s.CatchUp,
+		&s.MaxCatchUp, &next, &last, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if next.Valid {
+		s.NextRunAt = &next.Time
+	}
+	if last.Valid {
+		s.LastRunAt = &last.Time
+	}
+	return &s, nil
+}
+
+// parse returns the schedule's cron and location.
+func (s *TemplateSchedule) parse() (*cronSchedule, *time.Location, error) {
+	c, err := parseCron(s.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	return c, loc, nil
+}
+
+// upcoming fills NextRuns with the next n run times after NextRunAt.
+func (s *TemplateSchedule) upcoming(n int) {
+	c, loc, err := s.parse()
+	if err != nil || s.NextRunAt == nil || !s.Enabled {
+		return
+	}
+	t := *s.NextRunAt
+	for i := 0; i < n && !t.IsZero(); i++ {
+		s.NextRuns = append(s.NextRuns, t.In(loc))
+		t = c.next(t, loc)
+	}
+}
+
+// renderTitle fills a title pattern for a run at t (already in the
+// schedule's timezone). Week numbers are ISO 8601.
+func renderTitle(pattern, templateName string, t time.Time) string {
+	isoYear, isoWeek := t.ISOWeek()
+	return strings.NewReplacer(
+		"{{template}}", templateName,
+		"{{date}}", t.Format("2006-01-02"),
+		"{{time}}", t.Format("15:04"),
+		"{{year}}", strconv.Itoa(t.Year()),
+		"{{month}}", t.Format("01"),
+		"{{month_name}}", t.Month().String(),
+		"{{day}}", t.Format("02"),
+		"{{weekday}}", t.Weekday().String(),
+		"{{week}}", fmt.Sprintf("%02d", isoWeek),
+		"{{iso_week}}", fmt.Sprintf("%d-W%02d", isoYear, isoWeek),
+		"{{quarter}}", fmt.Sprintf("Q%d", (int(t.Month())-1)/3+1),
+	).Replace(pattern)
+}
+
+// plannedRuns splits the occurrences due by now into the ones to create and
+// the number skipped, per the schedule's catch-up policy.
+func plannedRuns(s *TemplateSchedule, due []time.Time, now time.Time) (create []time.Time, skipped int) {
+	if len(due) == 0 {
+		return nil, 0
+	}
+	switch s.CatchUp {
+	case "all":
+		if len(due) > s.MaxCatchUp {
+			return due[len(due)-s.MaxCatchUp:], len(due) - s.MaxCatchUp
+		}
+		return due, 0
+	case "skip":
+		for _, t := range due {
+			if now.Sub(t) <= recurringGrace {
+				create = append(create, t)
+			}
+		}
+		return create, len(due) - len(create)
+	}
+	return due[len(due)-1:], len(due) - 1
+}
+
+// StartRecurringTasks creates tasks for due template schedules. Run in a
+// goroutine.
+func StartRecurringTasks(hub *websocket.Hub) {
+	log.Println("[recurring] Recurring task scheduler started")
+	ticker := time.NewTicker(recurringInterval)
+	defer ticker.Stop()
+
+	for {
+		runDueSchedules(hub)
+		<-ticker.C
+	}
+}
+
+// runDueSchedules runs every due schedule, each in its own transaction:
+// the schedule row lock, its run records, its tasks and its next run time
+// are committed together, so a failure leaves the schedule due and nothing
+// half-created.
+func runDueSchedules(hub *websocket.Hub) {
+	rows, err := db.DB.Query(`SELECT id FROM template_schedules WHERE enabled AND next_run_at <= NOW()`)
+	if err != nil {
+		log.Printf("[recurring] Error loading due schedules: %v", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		created, err := runDueSchedule(id)
+		if err != nil {
+			log.Printf("[recurring] Schedule %s: %v", id, err)
+			continue
+		}
+		for _, ev := range created {
+			logActivity(ev.actor, "task_created", ev.task["id"].(string), map[string]string{
+				"template_id": ev.task["template_id"].(string), "scheduled_for": ev.at.Format(time.RFC3339),
+			})
+			if hub != nil {
+				hub.Broadcast("task_created", ev.task)
+			}
+			go TriggerWebhooks(EventTaskCreated, map[string]interface{}{"task": ev.task, "actor": ev.actor})
+		}
+	}
+}
+
+// scheduledTask is a task created by a schedule, announced after commit.
+type scheduledTask struct {
+	task  map[string]interface{}
+	actor string
+	at    time.Time
+}
+
+func runDueSchedule(id string) ([]scheduledTask, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The row lock keeps two instances from running the same schedule
+	row := tx.QueryRow(`SELECT `+scheduleCols+` FROM template_schedules
+		WHERE id = $1 AND enabled AND next_run_at <= NOW() FOR UPDATE SKIP LOCKED`, id)
+	s, err := scanSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil // run elsewhere meanwhile, or no longer due
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next, created, err := runSchedule(tx, s, now)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE template_schedules SET next_run_at = $1, last_run_at = $2 WHERE id = $3`,
+		next, now, s.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// runSchedule creates the schedule's due tasks in tx and returns its next
+// run time (nil if it has none) and the tasks created.
+func runSchedule(tx *sql.Tx, s *TemplateSchedule, now time.Time) (*time.Time, []scheduledTask, error) {
+	c, loc, err := s.parse()
+	if err != nil {
+		log.Printf("[recurring] Schedule %s is invalid, disabling: %v", s.ID, err)
+		_, err := tx.Exec(`UPDATE template_schedules SET enabled = false WHERE id = $1`, s.ID)
+		return nil, nil, err
+	}
+
+	var occurrences []time.Time
+	for t := *s.NextRunAt; !t.IsZero() && !t.After(now) && len(occurrences) < maxMissedScan; t = c.next(t, loc) {
+		occurrences = append(occurrences, t)
+	}
+	create, skipped := plannedRuns(s, occurrences, now)
+
+	if skipped > 0 {
+		note := fmt.Sprintf("%d missed run(s) skipped (catch_up=%s)", skipped, s.CatchUp)
+		if _, err := tx.Exec(`
+			INSERT INTO template_schedule_runs (schedule_id, template_id, scheduled_for, status, catch_up, note)
+			VALUES ($1, $2, $3, 'skipped', true, $4)
+			ON CONFLICT (schedule_id, scheduled_for) DO NOTHING`,
+			s.ID, s.TemplateID, occurrences[0], note); err != nil {
+			return nil, nil, err
+		}
+		log.Printf("[recurring] Schedule %s: %s", s.ID, note)
+	}
+
+	var created []scheduledTask
+	if len(create) > 0 {
+		row := tx.QueryRow(`SELECT `+templateCols+` FROM task_templates WHERE id = $1`, s.TemplateID)
+		tmpl, err := scanTemplate(row)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading template: %w", err)
+		}
+		for _, at := range create {
+			task, err := createScheduledTask(tx, s, &tmpl, at.In(loc), now.Sub(at) > recurringGrace)
+			if err != nil {
+				return nil, nil, err
+			}
+			if task != nil {
+				created = append(created, *task)
+			}
+		}
+	}
+	return nextRun(c, loc, now), created, nil
+}
+
+func nextRun(c *cronSchedule, loc *time.Location, after time.Time) *time.Time {
+	t := c.next(after, loc)
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// createScheduledTask records the run and creates its task in tx. It returns
+// nil if the run already exists or the task was rejected; a rejected task is
+// recorded as a failed run.
+func createScheduledTask(tx *sql.Tx, s *TemplateSchedule, tmpl *TaskTemplate, at time.Time, catchUp bool) (*scheduledTask, error) {
+	// The run row is claimed first so an occurrence is never created twice
+	var runID string
+	err := tx.QueryRow(`
+		INSERT INTO template_schedule_runs (schedule_id, template_id, scheduled_for, status, catch_up)
+		VALUES ($1, $2, $3, 'created', $4)
+		ON CONFLICT (schedule_id, scheduled_for) DO NOTHING
+		RETURNING id`, s.ID, s.TemplateID, at, catchUp).Scan(&runID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("recording run: %w", err)
+	}
+
+	title := renderTitle(s.TitlePattern, tmpl.Name, at)
+	var description *string
+	if tmpl.Description != nil {
+		d := renderTitle(*tmpl.Description, tmpl.Name, at)
+		description = &d
+	}
+	// A rejected insert aborts only the savepoint, so the failure can
+	// still be recorded
+	if _, err := tx.Exec(`SAVEPOINT scheduled_task`); err != nil {
+		return nil, err
+	}
+	taskID, taskErr := instantiateTemplate(tx, tmpl, title, description, tmpl.DefaultAssignee, tmpl.DefaultPriority)
+	if taskErr != nil {
+		log.Printf("[recurring] Schedule %s: creating task: %v", s.ID, taskErr)
+		if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT scheduled_task`); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE template_schedule_runs SET status = 'failed', note = $2 WHERE id = $1`, runID, taskErr.Error()); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if _, err := tx.Exec(`UPDATE template_schedule_runs SET task_id = $2 WHERE id = $1`, runID, taskID); err != nil {
+		return nil, err
+	}
+
+	return &scheduledTask{
+		task: map[string]interface{}{
+			"id": taskID, "title": title, "priority": tmpl.DefaultPriority, "assignee": tmpl.DefaultAssignee, "template_id": tmpl.ID,
+		},
+		actor: "schedule:" + s.ID,
+		at:    at,
+	}, nil
+}
+
+// ─── HTTP handlers ───────────────────────────────────────────────────────────
+
+func decodeSchedule(w http.ResponseWriter, r *http.Request) (*TemplateSchedule, *cronSchedule, *time.Location, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	s := TemplateSchedule{Enabled: true, Timezone: "UTC", CatchUp: "latest", MaxCatchUp: 10, TitlePattern: "{{template}} {{date}}"}
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return nil, nil, nil, false
+	}
+	c, loc, err := s.parse()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return nil, nil, nil, false
+	}
+	if !catchUpPolicies[s.CatchUp] {
+		respondError(w, http.StatusBadRequest, "catch_up must be skip, latest or all")
+		return nil, nil, nil, false
+	}
+	if s.MaxCatchUp < 1 || s.MaxCatchUp > 1000 {
+		respondError(w, http.StatusBadRequest, "max_catch_up must be between 1 and 1000")
+		return nil, nil, nil, false
+	}
+	if strings.TrimSpace(s.TitlePattern) == "" {
+		respondError(w, http.StatusBadRequest, "title_pattern must not be empty")
+		return nil, nil, nil, false
+	}
+	return &s, c, loc, true
+}
+
+// ListTemplateSchedules handles GET /api/templates/{id}/schedules
+func (h *TemplateHandler) ListTemplateSchedules(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.Query(`SELECT `+scheduleCols+` FROM template_schedules WHERE template_id = $1 ORDER BY created_at`,
+		mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	list := []*TemplateSchedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			continue
+		}
+		s.upcoming(5)
+		list = append(list, s)
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// CreateTemplateSchedule handles POST /api/templates/{id}/schedules
+func (h *TemplateHandler) CreateTemplateSchedule(w http.ResponseWriter, r *http.Request) {
+	templateID := mux.Vars(r)["id"]
+	s, c, loc, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	var exists bool
+	db.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM task_templates WHERE id = $1)`, templateID).Scan(&exists)
+	if !exists {
+		respondError(w, http.StatusNotFound, "template not found")
+		return
+	}
+
+	created, err := scanSchedule(db.DB.QueryRow(`
+		INSERT INTO template_schedules (template_id, cron, timezone, title_pattern, enabled, catch_up, max_catch_up, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+scheduleCols,
+		templateID, s.Cron, s.Timezone, s.TitlePattern, s.Enabled, s.CatchUp, s.MaxCatchUp, nextRun(c, loc, time.Now())))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "template_schedule_created", "template", templateID, map[string]interface{}{
+		"schedule_id": created.ID, "cron": created.Cron, "timezone": created.Timezone,
+	})
+	created.upcoming(5)
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// UpdateTemplateSchedule handles PUT /api/templates/{id}/schedules/{schedule_id}
+// The next run is recomputed from now, so runs missed while a schedule was
+// disabled are not caught up.
+func (h *TemplateHandler) UpdateTemplateSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s, c, loc, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	updated, err := scanSchedule(db.DB.QueryRow(`
+		UPDATE template_schedules SET cron = $1, timezone = $2, title_pattern = $3, enabled = $4, catch_up = $5,
+		       max_catch_up = $6, next_run_at = $7, updated_at = NOW()
+		WHERE id = $8 AND template_id = $9
+		RETURNING `+scheduleCols,
+		s.Cron, s.Timezone, s.TitlePattern, s.Enabled, s.CatchUp, s.MaxCatchUp, nextRun(c, loc, time.Now()),
+		vars["schedule_id"], vars["id"]))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "schedule not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "template_schedule_updated", "template", vars["id"], map[string]interface{}{
+		"schedule_id": updated.ID, "cron": updated.Cron, "enabled": updated.Enabled,
+	})
+	updated.upcoming(5)
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// DeleteTemplateSchedule handles DELETE /api/templates/{id}/schedules/{schedule_id}
+// The schedule's run history is kept.
+func (h *TemplateHandler) DeleteTemplateSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	res, err := db.DB.Exec(`DELETE FROM template_schedules WHERE id = $1 AND template_id = $2`, vars["schedule_id"], vars["id"])
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondError(w, http.StatusNotFound, "schedule not found")
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "template_schedule_deleted", "template", vars["id"], map[string]interface{}{
+		"schedule_id": vars["schedule_id"],
+	})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "schedule deleted"})
+}
+
+// GetTemplateScheduleHistory handles GET /api/templates/{id}/schedules/history?limit=
+func (h *TemplateHandler) GetTemplateScheduleHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+	rows, err := db.DB.Query(`
+		SELECT r.id, r.schedule_id, r.scheduled_for, r.ran_at, r.status, r.catch_up, COALESCE(r.note, ''),
+		       r.task_id, t.title, t.status
+		FROM template_schedule_runs r
+		LEFT JOIN tasks t ON t.id = r.task_id
+		WHERE r.template_id = $1
+		ORDER BY r.scheduled_for DESC
+		LIMIT $2`, mux.Vars(r)["id"], limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type scheduleRun struct {
+		ID           string    `json:"id"`
+		ScheduleID   *string   `json:"schedule_id"`
+		ScheduledFor time.Time `json:"scheduled_for"`
+		RanAt        time.Time `json:"ran_at"`
+		Status       string    `json:"status"`
+		CatchUp      bool      `json:"catch_up"`
+		Note         string    `json:"note,omitempty"`
+		TaskID       *string   `json:"task_id"`
+		TaskTitle    *string   `json:"task_title"`
+		TaskStatus   *string   `json:"task_status"`
+	}
+	runs := []scheduleRun{}
+	for rows.Next() {
+		var run scheduleRun
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &run.ScheduledFor, &run.RanAt, &run.Status, &run.CatchUp, &run.Note,
+			&run.TaskID, &run.TaskTitle, &run.TaskStatus); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	respondJSON(w, http.StatusOK, runs)
+}
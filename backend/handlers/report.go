@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
-	"sort"
 	"strings"
 	"time"
 
@@ -78,36 +77,30 @@ func (h *ReportHandler) buildReport(period string) (*ReportData, error) {
 		r.CompletionRate = float64(r.CompletedTasks) / float64(r.TotalTasks) * 100.0
 	}
 
-	// Cost data from JSONL session files
-	allMsgs := parseAllTokenData()
+	// Cost data from indexed session token usage
 	now := time.Now()
 	weekStart := now.AddDate(0, 0, -int(now.Weekday()))
 	weekStart = time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day(), 0, 0, 0, 0, now.Location())
-	for _, msg := range allMsgs {
-		r.CostAllTime += msg.CostTotal
-		r.TokensAllTime += msg.TotalTokens
-		if !msg.Timestamp.Before(weekStart) {
-			r.CostThisWeek += msg.CostTotal
-		}
-	}
-
-	// Top cost agents from JSONL
-	agentCostMap := make(map[string]*CostRow)
-	for _, msg := range allMsgs {
-		c, ok := agentCostMap[msg.AgentID]
-		if !ok {
-			c = &CostRow{AgentID: msg.AgentID}
-			agentCostMap[msg.AgentID] = c
+	db.DB.QueryRow(`
+		SELECT COALESCE(SUM(cost_usd), 0), COALESCE(SUM(total_tokens), 0),
+		       COALESCE(SUM(cost_usd) FILTER (WHERE ts >= $1), 0)
+		FROM token_usage
+	`, weekStart).Scan(&r.CostAllTime, &r.TokensAllTime, &r.CostThisWeek)
+
+	// Top cost agents
+	costRows, err := db.DB.Query(`
+		SELECT agent_id, SUM(cost_usd), SUM(total_tokens)
+		FROM token_usage
+		GROUP BY agent_id
+		ORDER BY SUM(cost_usd) DESC
+		LIMIT 10`)
+	if err == nil {
+		defer costRows.Close()
+		for costRows.Next() {
+			var c CostRow
+			costRows.Scan(&c.AgentID, &c.TotalCost, &c.Tokens)
+			r.TopCosts = append(r.TopCosts, c)
 		}
-		c.TotalCost += msg.CostTotal
-		c.Tokens += msg.TotalTokens
-	}
-	for _, c := range agentCostMap {
-		r.TopCosts = append(r.TopCosts, *c)
-	}
-	sort.Slice(r.TopCosts, func(i, j int) bool { return r.TopCosts[i].TotalCost > r.TopCosts[j].TotalCost })
-	if len(r.TopCosts) > 10 {
-		r.TopCosts = r.TopCosts[:10]
 	}
 
 	// Per-agent stats
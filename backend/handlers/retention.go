@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/gorilla/mux"
+)
+
+// ─── Retention ───────────────────────────────────────────────────────────────
+//
+// Each retention_policies row keeps a table's raw rows for raw_days. The
+// pruner rolls older rows into per-day aggregates in daily_rollups (count,
+// errors, total and max duration per agent and kind) as it deletes them, and
+// drops aggregates older than summary_days. 0 days means keep forever.
+// Policies start disabled; nothing is pruned until an admin enables one.
+// GET /api/admin/retention/rollups serves the aggregates.
+
+const (
+	retentionInterval   = time.Hour
+	retentionFirstRun   = 2 * time.Minute
+	retentionBatchSize  = 5000
+	retentionMaxBatches = 200 // per table per run; the rest waits for the next run
+)
+
+// retentionTable describes how to prune and summarize a table. Every field
+// is a SQL expression over the table's columns.
+type retentionTable struct {
+	ts      string // row age
+	where   string // extra condition rows must meet to be pruned
+	agent   string // rollup dimensions
+	kind    string
+	isError string
+	ms      string // duration in milliseconds
+}
+
+var retentionTables = map[string]retentionTable{
+	"agent_traces": {
+		ts: "created_at", agent: "agent_id", kind: "trace_type",
+		isError: "trace_type = 'error' OR status_code = 'error'", ms: "duration_ms",
+	},
+	"activity_log": {
+		ts: "created_at", agent: "agent_id", kind: "action",
+		isError: "action ILIKE '%error%' OR action ILIKE '%fail%'", ms: "0",
+	},
+	"audit_logs": {
+		ts: "timestamp", agent: `"user"`, kind: "action",
+		isError: "false", ms: "0",
+	},
+	"alert_history": { // open alerts are never pruned
+		ts: "COALESCE(resolved_at, last_seen_at, triggered_at)", where: "state = 'resolved'",
+		agent: "agent_id", kind: "rule_id::text", isError: "false", ms: "0",
+	},
+	"notifications": {
+		ts: "created_at", agent: "agent_id", kind: "type",
+		isError: "type IN ('alert', 'trace_error')", ms: "0",
+	},
+}
+
+// RetentionPolicy is a table's retention setting and last prune.
+type RetentionPolicy struct {
+	Table          string     `json:"table"`
+	RawDays        int        `json:"raw_days"`
+	SummaryDays    int        `json:"summary_days"`
+	Enabled        bool       `json:"enabled"`
+	LastPrunedAt   *time.Time `json:"last_pruned_at"`
+	LastPrunedRows int64      `json:"last_pruned_rows"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+var retentionState struct {
+	sync.Mutex
+	nextRun time.Time
+	running bool
+}
+
+// StartRetentionPruner prunes tables on retentionInterval.
+func StartRetentionPruner() {
+	log.Println("[retention] Pruner started")
+	retentionState.Lock()
+	retentionState.nextRun = time.Now().Add(retentionFirstRun)
+	retentionState.Unlock()
+	time.Sleep(retentionFirstRun)
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		retentionState.Lock()
+		retentionState.nextRun = time.Now().Add(retentionInterval)
+		retentionState.Unlock()
+		runRetention()
+		<-ticker.C
+	}
+}
+
+func loadRetentionPolicies() ([]RetentionPolicy, error) {
+	rows, err := db.DB.Query(`
+		SELECT table_name, raw_days, summary_days, enabled, last_pruned_at, last_pruned_rows, updated_at
+		FROM retention_policies ORDER BY table_name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policies := []RetentionPolicy{}
+	for rows.Next() {
+		var p RetentionPolicy
+		if err := rows.Scan(&p.Table, &p.RawDays, &p.SummaryDays, &p.Enabled, &p.LastPrunedAt, &p.LastPrunedRows, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if _, ok := retentionTables[p.Table]; ok {
+			policies = append(policies, p)
+		}
+	}
+	return policies, rows.Err()
+}
+
+// runRetention prunes every enabled table and returns rows pruned per table.
+// It reports false without pruning if a run is already in progress.
+func runRetention() (map[string]int64, bool) {
+	retentionState.Lock()
+	if retentionState.running {
+		retentionState.Unlock()
+		return nil, false
+	}
+	retentionState.running = true
+	retentionState.Unlock()
+	defer func() {
+		retentionState.Lock()
+		retentionState.running = false
+		retentionState.Unlock()
+	}()
+
+	pruned := map[string]int64{}
+	policies, err := loadRetentionPolicies()
+	if err != nil {
+		log.Printf("[retention] Error loading policies: %v", err)
+		return pruned, true
+	}
+	for _, p := range policies {
+		if !p.Enabled {
+			continue
+		}
+		n, err := pruneTable(p)
+		if err != nil {
+			log.Printf("[retention] Error pruning %s: %v", p.Table, err)
+		}
+		pruned[p.Table] = n
+		db.DB.Exec(`UPDATE retention_policies SET last_pruned_at = NOW(), last_pruned_rows = $2 WHERE table_name = $1`, p.Table, n)
+		if n > 0 {
+			log.Printf("[retention] Pruned %d row(s) from %s", n, p.Table)
+		}
+	}
+	return pruned, true
+}
+
+// pruneTable deletes p.Table's rows older than p.RawDays in batches, adding
+// each batch to daily_rollups in the same statement, then drops expired
+// aggregates.
+func pruneTable(p RetentionPolicy) (int64, error) {
+	t := retentionTables[p.Table]
+	var total int64
+	if p.RawDays > 0 {
+		where := t.ts + " < NOW() - make_interval(days => $1)"
+		if t.where != "" {
+			where += " AND " + t.where
+		}
+		query := fmt.Sprintf(`
+			WITH gone AS (
+				DELETE FROM %[1]s WHERE id IN (SELECT id FROM %[1]s WHERE %[2]s LIMIT %[3]d)
+				RETURNING %[4]s AS ts, %[5]s AS agent, %[6]s AS kind, (%[7]s) AS is_error, %[8]s AS ms
+			), rolled AS (
+				INSERT INTO daily_rollups (table_name, day, agent_id, kind, count, error_count, total_ms, max_ms)
+				SELECT $2, ts::date, COALESCE(agent, ''), COALESCE(kind, ''), COUNT(*),
+				       COUNT(*) FILTER (WHERE is_error), COALESCE(SUM(ms), 0), COALESCE(MAX(ms), 0)
+				FROM gone GROUP BY 2, 3, 4
+				ON CONFLICT (table_name, day, agent_id, kind) DO UPDATE SET
+					count = daily_rollups.count + EXCLUDED.count,
+					error_count = daily_rollups.error_count + EXCLUDED.error_count,
+					total_ms = daily_rollups.total_ms + EXCLUDED.total_ms,
+					max_ms = GREATEST(daily_rollups.max_ms, EXCLUDED.max_ms)
+				RETURNING 1
+			)
+			SELECT COUNT(*) FROM gone
+		`, p.Table, where, retentionBatchSize, t.ts, t.agent, t.kind, t.isError, t.ms)
+
+		for i := 0; i < retentionMaxBatches; i++ {
+			var n int64
+			if err := db.DB.QueryRow(query, p.RawDays, p.Table).Scan(&n); err != nil {
+				return total, err
+			}
+			total += n
+			if n < retentionBatchSize {
+				break
+			}
+		}
+	}
+	if p.SummaryDays > 0 {
+		if _, err := db.DB.Exec(`DELETE FROM daily_rollups WHERE table_name = $1 AND day < CURRENT_DATE - $2::int`, p.Table, p.SummaryDays); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// RetentionTableStatus is a policy with its table's current size.
+type RetentionTableStatus struct {
+	RetentionPolicy
+	RowsEstimate  int64      `json:"rows_estimate"`
+	SizeBytes     int64      `json:"size_bytes"`
+	Size          string     `json:"size"`
+	OldestRow     *time.Time `json:"oldest_row"`
+	SummaryRows   int64      `json:"summary_rows"`
+	OldestSummary *string    `json:"oldest_summary_day"`
+}
+
+// GetRetention handles GET /api/admin/retention
+func GetRetention(w http.ResponseWriter, r *http.Request) {
+	policies, err := loadRetentionPolicies()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tables := []RetentionTableStatus{}
+	for _, p := range policies {
+		t := retentionTables[p.Table]
+		st := RetentionTableStatus{RetentionPolicy: p}
+		// reltuples is the planner's estimate; an exact count would scan the table
+		db.DB.QueryRow(`
+			SELECT GREATEST(c.reltuples, 0)::bigint, pg_total_relation_size(c.oid), pg_size_pretty(pg_total_relation_size(c.oid))
+			FROM pg_class c WHERE c.oid = $1::regclass
+		`, p.Table).Scan(&st.RowsEstimate, &st.SizeBytes, &st.Size)
+		var oldest sql.NullTime
+		db.DB.QueryRow(`SELECT MIN(` + t.ts + `) FROM ` + p.Table).Scan(&oldest)
+		if oldest.Valid {
+			st.OldestRow = &oldest.Time
+		}
+		db.DB.QueryRow(`SELECT COUNT(*), MIN(day)::text FROM daily_rollups WHERE table_name = $1`, p.Table).Scan(&st.SummaryRows, &st.OldestSummary)
+		tables = append(tables, st)
+	}
+
+	var rollupBytes int64
+	var rollupSize string
+	db.DB.QueryRow(`SELECT pg_total_relation_size('daily_rollups'), pg_size_pretty(pg_total_relation_size('daily_rollups'))`).Scan(&rollupBytes, &rollupSize)
+
+	retentionState.Lock()
+	next, running := retentionState.nextRun, retentionState.running
+	retentionState.Unlock()
+	var nextRun *time.Time
+	if !next.IsZero() {
+		nextRun = &next
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tables":           tables,
+		"summary_table":    map[string]interface{}{"table": "daily_rollups", "size_bytes": rollupBytes, "size": rollupSize},
+		"next_prune_at":    nextRun,
+		"running":          running,
+		"interval_minutes": int(retentionInterval / time.Minute),
+		"batch_size":       retentionBatchSize,
+		"max_rows_per_run": retentionBatchSize * retentionMaxBatches,
+	})
+}
+
+// UpdateRetention handles PUT /api/admin/retention/{table}
+func UpdateRetention(w http.ResponseWriter, r *http.Request) {
+	table := mux.Vars(r)["table"]
+	if _, ok := retentionTables[table]; !ok {
+		names := make([]string, 0, len(retentionTables))
+		for name := range retentionTables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		respondError(w, http.StatusNotFound, fmt.Sprintf("no retention policy for %q; tables: %v", table, names))
+		return
+	}
+	var req struct {
+		RawDays     *int  `json:"raw_days"`
+		SummaryDays *int  `json:"summary_days"`
+		Enabled     *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if (req.RawDays != nil && *req.RawDays < 0) || (req.SummaryDays != nil && *req.SummaryDays < 0) {
+		respondError(w, http.StatusBadRequest, "raw_days and summary_days must not be negative (0 keeps forever)")
+		return
+	}
+
+	var p RetentionPolicy
+	err := db.DB.QueryRow(`
+		UPDATE retention_policies SET
+			raw_days = COALESCE($2, raw_days),
+			summary_days = COALESCE($3, summary_days),
+			enabled = COALESCE($4, enabled),
+			updated_at = NOW()
+		WHERE table_name = $1
+		RETURNING table_name, raw_days, summary_days, enabled, last_pruned_at, last_pruned_rows, updated_at
+	`, table, req.RawDays, req.SummaryDays, req.Enabled).
+		Scan(&p.Table, &p.RawDays, &p.SummaryDays, &p.Enabled, &p.LastPrunedAt, &p.LastPrunedRows, &p.UpdatedAt)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "retention_updated", "retention_policy", table, map[string]interface{}{
+		"raw_days": p.RawDays, "summary_days": p.SummaryDays, "enabled": p.Enabled,
+	})
+	respondJSON(w, http.StatusOK, p)
+}
+
+// DailyRollup is one day's aggregate of rows pruned from a table.
+type DailyRollup struct {
+	Day        string  `json:"day"`
+	AgentID    *string `json:"agent_id,omitempty"`
+	Kind       *string `json:"kind,omitempty"`
+	Count      int64   `json:"count"`
+	ErrorCount int64   `json:"error_count"`
+	TotalMs    int64   `json:"total_ms"`
+	MaxMs      int64   `json:"max_ms"`
+	AvgMs      float64 `json:"avg_ms"`
+}
+
+// GetRetentionRollups handles GET /api/admin/retention/rollups
+// Query: table (required), from/to (YYYY-MM-DD, default the last 30 days),
+// agent, kind, and by=day to sum each day across agents and kinds.
+func GetRetentionRollups(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	table := q.Get("table")
+	if _, ok := retentionTables[table]; !ok {
+		respondError(w, http.StatusBadRequest, "table must be one of agent_traces, activity_log, audit_logs, alert_history, notifications")
+		return
+	}
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -29)
+	for param, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := q.Get(param); v != "" {
+			t, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, param+" must be a date (YYYY-MM-DD)")
+				return
+			}
+			*dst = t
+		}
+	}
+
+	cols, group := `agent_id, kind`, `day, agent_id, kind`
+	if q.Get("by") == "day" {
+		cols, group = `NULL::text, NULL::text`, `day`
+	}
+	rows, err := db.DB.Query(`
+		SELECT day::text, `+cols+`, SUM(count), SUM(error_count), SUM(total_ms), MAX(max_ms)
+		FROM daily_rollups
+		WHERE table_name = $1 AND day BETWEEN $2::date AND $3::date
+		  AND ($4 = '' OR agent_id = $4) AND ($5 = '' OR kind = $5)
+		GROUP BY `+group+`
+		ORDER BY `+group+`
+		LIMIT 10000
+	`, table, from.Format("2006-01-02"), to.Format("2006-01-02"), q.Get("agent"), q.Get("kind"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	list := []DailyRollup{}
+	for rows.Next() {
+		var d DailyRollup
+		if err := rows.Scan(&d.Day, &d.AgentID, &d.Kind, &d.Count, &d.ErrorCount, &d.TotalMs, &d.MaxMs); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if d.Count > 0 {
+			d.AvgMs = float64(d.TotalMs) / float64(d.Count)
+		}
+		list = append(list, d)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"table": table, "from": from.Format("2006-01-02"), "to": to.Format("2006-01-02"), "rollups": list,
+	})
+}
+
+// RunRetention handles POST /api/admin/retention/run
+func RunRetention(w http.ResponseWriter, r *http.Request) {
+	pruned, ok := runRetention()
+	if !ok {
+		respondError(w, http.StatusConflict, "a prune is already running")
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "retention_run", "retention_policy", "", map[string]interface{}{"pruned": pruned})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"pruned": pruned})
+}
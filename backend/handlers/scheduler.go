@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/alghanim/agentboard/backend/websocket"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// ─── Task scheduler ──────────────────────────────────────────────────────────
+//
+// The scheduler acts on tasks.depends_on. When a task is finished, dependents
+// whose dependencies are now all done leave todo/blocked for their workflow's
+// ready status ("next" on the default board). Tasks with open dependencies
+// can't start. Teams can opt in to auto-assignment, which hands ready,
+// unassigned tasks to idle agents of the team, optionally limited by role.
+// A task is only released when its last open dependency finishes or is
+// removed from it; one blocked or sent back to todo by hand stays put.
+
+const schedulerInterval = 60 * time.Second
+
+// TeamScheduling is a team's auto-assignment policy.
+type TeamScheduling struct {
+	Team              string    `json:"team"`
+	AutoAssign        bool      `json:"auto_assign"`
+	Roles             []string  `json:"roles"`                // agent roles eligible; empty means any
+	MaxActivePerAgent int       `json:"max_active_per_agent"` // open tasks an agent may hold before it is skipped
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// openDependency is an unfinished task another task depends on.
+type openDependency struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+}
+
+// openDependencies lists taskID's dependencies that aren't done yet.
+// Dependencies that no longer exist don't block.
+func openDependencies(taskID string) ([]openDependency, error) {
+	rows, err := db.DB.Query(`
+		SELECT dep.id, dep.title, dep.status
+		FROM tasks t JOIN tasks dep ON dep.id = ANY(t.depends_on)
+		WHERE t.id = $1 AND dep.status NOT IN `+sqlStatusList(StatusDone)+`
+		ORDER BY dep.created_at`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deps := []openDependency{}
+	for rows.Next() {
+		var d openDependency
+		if err := rows.Scan(&d.ID, &d.Title, &d.Status); err != nil {
+			return nil, err
+		}
+		deps = append(deps, d)
+	}
+	return deps, rows.Err()
+}
+
+// checkDependenciesForStart returns an error when a task entering an active
+// status still has open dependencies.
+func checkDependenciesForStart(taskID string) (int, error) {
+	deps, err := openDependencies(taskID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if len(deps) == 0 {
+		return 0, nil
+	}
+	names := make([]string, len(deps))
+	for i, d := range deps {
+		names[i] = fmt.Sprintf("%q (%s)", d.Title, d.Status)
+	}
+	return http.StatusConflict, fmt.Errorf("Task has %d open dependencies: %s", len(deps), strings.Join(names, ", "))
+}
+
+// readyStatusOf is the status a workflow queues startable work in: "next"
+// if it has a todo-category status by that name, else its first todo status.
+func readyStatusOf(wf *Workflow) string {
+	if s := wf.status("next"); s != nil && s.Category == StatusTodo {
+		return s.Name
+	}
+	for _, s := range wf.Statuses {
+		if s.Category == StatusTodo {
+			return s.Name
+		}
+	}
+	return ""
+}
+
+// readyStatus is where an unblocked task in current should move, or "" if it
+// is already there or the workflow has no transition to it.
+func readyStatus(wf *Workflow, current string) string {
+	to := readyStatusOf(wf)
+	if to == "" || to == current || wf.transition(current, to) == nil {
+		return ""
+	}
+	return to
+}
+
+// releaseDependents moves tasks that depend on taskID to their ready status
+// once all their dependencies are done, then offers them for assignment.
+func releaseDependents(hub *websocket.Hub, taskID string, depth int) {
+	rows, err := db.DB.Query(`
+		SELECT d.id FROM tasks d
+		WHERE $1 = ANY(d.depends_on)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM tasks dep
+		      WHERE dep.id = ANY(d.depends_on) AND dep.status NOT IN `+sqlStatusList(StatusDone)+`)`,
+		taskID)
+	if err != nil {
+		log.Printf("[scheduler] Error finding dependents of %s: %v", taskID, err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		releaseTask(hub, id, depth)
+	}
+	if len(ids) > 0 {
+		assignReadyTasks(hub)
+	}
+}
+
+// releaseTask moves one fully unblocked task from todo/blocked to its ready
+// status, if its workflow allows that move.
+func releaseTask(hub *websocket.Hub, taskID string, depth int) bool {
+	current, wf, err := taskWorkflow(taskID)
+	if err != nil {
+		return false
+	}
+	switch wf.category(current) {
+	case StatusTodo, StatusBlocked:
+	default:
+		return false
+	}
+	to := readyStatus(wf, current)
+	if to == "" {
+		return false
+	}
+	if _, err := moveTask(hub, nil, taskID, to, "scheduler", depth); err != nil {
+		log.Printf("[scheduler] Could not release task %s to %s: %v", taskID, to, err)
+		return false
+	}
+	log.Printf("[scheduler] Released task %s: %s → %s", taskID, current, to)
+	return true
+}
+
+// StartTaskScheduler periodically assigns ready tasks. Run in a goroutine.
+func StartTaskScheduler(hub *websocket.Hub) {
+	log.Println("[scheduler] Task scheduler started")
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		assignReadyTasks(hub)
+		<-ticker.C
+	}
+}
+
+// readyCandidate is an unassigned task that is free to start.
+type readyCandidate struct {
+	id, title, status, team string
+}
+
+// assignReadyTasks gives ready, unassigned tasks of auto-assign teams to idle
+// agents, most urgent and oldest first.
+func assignReadyTasks(hub *websocket.Hub) {
+	policies, err := loadTeamScheduling()
+	if err != nil {
+		log.Printf("[scheduler] Error loading team policies: %v", err)
+		return
+	}
+	teams := []string{}
+	for team, p := range policies {
+		if p.AutoAssign {
+			teams = append(teams, team)
+		}
+	}
+	if len(teams) == 0 {
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT t.id, t.title, t.status, t.team FROM tasks t
+		WHERE COALESCE(t.assignee, '') = '' AND t.team = ANY($1)
+		  AND t.status IN `+sqlStatusList(StatusTodo)+`
+		  AND NOT EXISTS (
+		      SELECT 1 FROM tasks dep
+		      WHERE dep.id = ANY(COALESCE(t.depends_on, '{}')) AND dep.status NOT IN `+sqlStatusList(StatusDone)+`)
+		ORDER BY CASE t.priority WHEN 'critical' THEN 0 WHEN 'urgent' THEN 1 WHEN 'high' THEN 2
+		                         WHEN 'medium' THEN 3 WHEN 'low' THEN 4 ELSE 5 END,
+		         t.created_at
+		LIMIT 200`, pq.Array(teams))
+	if err != nil {
+		log.Printf("[scheduler] Error loading ready tasks: %v", err)
+		return
+	}
+	var ready []readyCandidate
+	for rows.Next() {
+		var c readyCandidate
+		if rows.Scan(&c.id, &c.title, &c.status, &c.team) == nil {
+			ready = append(ready, c)
+		}
+	}
+	rows.Close()
+
+	for _, c := range ready {
+		// Only tasks sitting in their workflow's ready status are dispatched
+		_, wf, err := taskWorkflow(c.id)
+		if err != nil || readyStatusOf(wf) != c.status {
+			continue
+		}
+		agent, err := pickIdleAgent(policies[c.team])
+		if err != nil {
+			log.Printf("[scheduler] Error picking agent for team %s: %v", c.team, err)
+			return
+		}
+		if agent == "" {
+			continue
+		}
+		assignScheduledTask(hub, c, agent)
+	}
+}
+
+// pickIdleAgent returns the idle agent of the policy's team holding the
+// fewest open tasks, or "" if none is free.
+func pickIdleAgent(p TeamScheduling) (string, error) {
+	roles := make([]string, len(p.Roles))
+	for i, r := range p.Roles {
+		roles[i] = strings.ToLower(r)
+	}
+	var agent string
+	err := db.DB.QueryRow(`
+		SELECT a.id FROM agents a
+		LEFT JOIN tasks t ON t.assignee = a.id AND t.status NOT IN `+sqlStatusList(StatusDone)+`
+		WHERE a.team = $1 AND a.status IN ('idle', 'online')
+		  AND (cardinality($2::text[]) = 0 OR LOWER(COALESCE(a.role, '')) = ANY($2))
+		GROUP BY a.id, a.last_active
+		HAVING COUNT(t.id) < $3
+		ORDER BY COUNT(t.id), a.last_active NULLS FIRST
+		LIMIT 1`, p.Team, pq.Array(roles), p.MaxActivePerAgent).Scan(&agent)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return agent, err
+}
+
+func assignScheduledTask(hub *websocket.Hub, c readyCandidate, agent string) {
+	res, err := db.DB.Exec(
+		`UPDATE tasks SET assignee = $1, updated_at = NOW() WHERE id = $2 AND COALESCE(assignee, '') = ''`,
+		agent, c.id)
+	if err != nil {
+		log.Printf("[scheduler] Error assigning task %s: %v", c.id, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return // someone got there first
+	}
+	db.DB.Exec(`UPDATE agents SET current_task_id = $1::uuid WHERE id = $2`, c.id, agent)
+
+	log.Printf("[scheduler] Assigned task %s to %s", c.id, agent)
+	logActivity("scheduler", "task_assigned", c.id, map[string]string{"assignee": agent})
+	go LogAudit("scheduler", "task_assigned", "task", c.id, map[string]interface{}{"assignee": agent, "team": c.team})
+	if hub != nil {
+		hub.Broadcast("task_assigned", map[string]string{"task_id": c.id, "assignee": agent})
+	}
+	go CreateNotificationInternal(agent, "task_assigned", "Task assigned", fmt.Sprintf("You were assigned %q by the scheduler", c.title))
+	go TriggerWebhooks(EventTaskAssigned, map[string]interface{}{
+		"task_id": c.id, "assignee": agent, "previous_assignee": "", "actor": "scheduler",
+	})
+}
+
+func loadTeamScheduling() (map[string]TeamScheduling, error) {
+	rows, err := db.DB.Query(`SELECT team, auto_assign, COALESCE(roles, '{}'), max_active_per_agent, updated_at FROM team_scheduling`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policies := map[string]TeamScheduling{}
+	for rows.Next() {
+		var p TeamScheduling
+		if err := rows.Scan(&p.Team, &p.AutoAssign, pq.Array(&p.Roles), &p.MaxActivePerAgent, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policies[p.Team] = p
+	}
+	return policies, rows.Err()
+}
+
+// ─── HTTP handlers ───────────────────────────────────────────────────────────
+
+type SchedulerHandler struct {
+	Hub *websocket.Hub
+}
+
+// ListTeamScheduling handles GET /api/scheduler/teams
+func (h *SchedulerHandler) ListTeamScheduling(w http.ResponseWriter, r *http.Request) {
+	policies, err := loadTeamScheduling()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	list := make([]TeamScheduling, 0, len(policies))
+	for _, p := range policies {
+		list = append(list, p)
+	}
+	respondJSON(w, http.StatusOK, list)
+}
+
+// SetTeamScheduling handles PUT /api/scheduler/teams/{team}
+func (h *SchedulerHandler) SetTeamScheduling(w http.ResponseWriter, r *http.Request) {
+	team := mux.Vars(r)["team"]
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	p := TeamScheduling{MaxActivePerAgent: 1}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if p.MaxActivePerAgent < 1 {
+		respondError(w, http.StatusBadRequest, "max_active_per_agent must be at least 1")
+		return
+	}
+	if p.Roles == nil {
+		p.Roles = []string{}
+	}
+	p.Team = team
+	err := db.DB.QueryRow(`
+		INSERT INTO team_scheduling (team, auto_assign, roles, max_active_per_agent, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (team) DO UPDATE SET auto_assign = $2, roles = $3, max_active_per_agent = $4, updated_at = NOW()
+		RETURNING updated_at`,
+		team, p.AutoAssign, pq.Array(p.Roles), p.MaxActivePerAgent).Scan(&p.UpdatedAt)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "team_scheduling_updated", "team", team, map[string]interface{}{
+		"auto_assign": p.AutoAssign, "roles": p.Roles, "max_active_per_agent": p.MaxActivePerAgent,
+	})
+	if p.AutoAssign {
+		go assignReadyTasks(h.Hub)
+	}
+	respondJSON(w, http.StatusOK, p)
+}
+
+// GetTaskReadiness handles GET /api/tasks/{id}/readiness
+// Reports whether a task may start and what it is waiting on.
+func (h *SchedulerHandler) GetTaskReadiness(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	status, wf, err := taskWorkflow(id)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	deps, err := openDependencies(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"task_id":           id,
+		"status":            status,
+		"ready":             len(deps) == 0,
+		"open_dependencies": deps,
+		"ready_status":      readyStatusOf(wf),
+	})
+}
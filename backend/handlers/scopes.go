@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/gorilla/mux"
+)
+
+// ─── API key scopes ──────────────────────────────────────────────────────────
+//
+// A key with no scopes behaves as before: its role decides what it may do.
+// A key with scopes may still read anything its role allows, but may only call
+// write routes listed in routeScopes under a scope it holds. Agent-bound keys
+// always have scopes; bound keys created before that was required get
+// boundKeyDefaultScopes.
+
+var apiKeyScopes = map[string]string{
+	"tasks:write":         "Create, update, assign, transition and comment on tasks",
+	"traces:ingest":       "Ingest agent traces",
+	"costs:ingest":        "Ingest cost records",
+	"agents:control":      "Pause, resume, kill agents and change their status or health settings",
+	"agents:message":      "Send messages to agents",
+	"souls:write":         "Update agent soul files and snapshots",
+	"annotations:write":   "Add and remove agent annotations",
+	"evaluations:write":   "Record task evaluations",
+	"incidents:write":     "Open and update incidents",
+	"notifications:write": "Create and update notifications",
+}
+
+// boundKeyDefaultScopes are what an agent needs to work its own tasks and
+// report on them.
+var boundKeyDefaultScopes = []string{"tasks:write", "traces:ingest", "costs:ingest"}
+
+// routeScopes maps "METHOD /path/template" of write routes to the scope required.
+var routeScopes = map[string]string{
+	"POST /api/tasks":                                       "tasks:write",
+	"PUT /api/tasks/{id}":                                   "tasks:write",
+	"DELETE /api/tasks/{id}":                                "tasks:write",
+	"POST /api/tasks/{id}/assign":                           "tasks:write",
+	"POST /api/tasks/{id}/transition":                       "tasks:write",
+	"PUT /api/tasks/{id}/dependencies":                      "tasks:write",
+	"POST /api/queue/claim":                                 "tasks:write",
+	"POST /api/queue/leases/{task_id}/heartbeat":            "tasks:write",
+	"POST /api/queue/leases/{task_id}/release":              "tasks:write",
+	"POST /api/tasks/{task_id}/comments":                    "tasks:write",
+	"DELETE /api/comments/{id}":                             "tasks:write",
+	"POST /api/templates/{id}/instantiate":                  "tasks:write",
+	"POST /api/traces":                                      "traces:ingest",
+	"POST /api/traces/batch":                                "traces:ingest",
+	"POST /api/otlp/v1/traces":                              "traces:ingest",
+	"POST /api/costs":                                       "costs:ingest",
+	"POST /api/agents/{id}/pause":                           "agents:control",
+	"POST /api/agents/{id}/resume":                          "agents:control",
+	"POST /api/agents/{id}/kill":                            "agents:control",
+	"PUT /api/agents/{id}/status":                           "agents:control",
+	"POST /api/agents/{id}/health/check":                    "agents:control",
+	"POST /api/agents/{id}/health/auto-restart":             "agents:control",
+	"POST /api/agents/{id}/message":                         "agents:message",
+	"PUT /api/agents/{id}/soul":                             "souls:write",
+	"POST /api/agents/{id}/snapshots":                       "souls:write",
+	"POST /api/agents/{id}/snapshots/{snapshot_id}/restore": "souls:write",
+	"POST /api/agents/{id}/annotations":                     "annotations:write",
+	"DELETE /api/agents/{id}/annotations/{ann_id}":          "annotations:write",
+	"POST /api/evaluations":                                 "evaluations:write",
+	"POST /api/evaluations/bulk":                            "evaluations:write",
+	"POST /api/incidents":                                   "incidents:write",
+	"PUT /api/incidents/{id}":                               "incidents:write",
+	"POST /api/incidents/auto-create":                       "incidents:write",
+	"POST /api/notifications":                               "notifications:write",
+	"POST /api/notifications/read-all":                      "notifications:write",
+	"PUT /api/notifications/{id}/read":                      "notifications:write",
+	"DELETE /api/notifications/{id}":                        "notifications:write",
+}
+
+// APIKeyIdentity is what RequireAuth knows about a request made with an API key.
+type APIKeyIdentity struct {
+	ID      string
+	Role    string
+	Scopes  []string
+	AgentID string // non-empty for keys bound to a single agent
+}
+
+const apiKeyContextKey contextKey = "api_key"
+
+// GetAPIKeyFromContext returns the API key identity of the request, or nil.
+func GetAPIKeyFromContext(r *http.Request) *APIKeyIdentity {
+	if k, ok := r.Context().Value(apiKeyContextKey).(*APIKeyIdentity); ok {
+		return k
+	}
+	return nil
+}
+
+// GetBoundAgent returns the agent an API key is bound to, or "".
+// Handlers use it to force agent_id / changed_by on writes.
+func GetBoundAgent(r *http.Request) string {
+	if k := GetAPIKeyFromContext(r); k != nil {
+		return k.AgentID
+	}
+	return ""
+}
+
+// authorizeAPIKey checks scopes and agent binding for a write made with an API key.
+// It returns an HTTP status and message when the request must be rejected.
+func authorizeAPIKey(r *http.Request, key *APIKeyIdentity) (int, string) {
+	if r.Method == http.MethodGet || (len(key.Scopes) == 0 && key.AgentID == "") {
+		return 0, ""
+	}
+
+	template := ""
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ = route.GetPathTemplate()
+	}
+
+	scopes := key.Scopes
+	if len(scopes) == 0 && key.AgentID != "" {
+		scopes = boundKeyDefaultScopes
+	}
+	if len(scopes) > 0 {
+		need, ok := routeScopes[r.Method+" "+template]
+		if !ok {
+			return http.StatusForbidden, "API key scopes do not allow this endpoint"
+		}
+		if !containsString(scopes, need) {
+			return http.StatusForbidden, "API key is missing scope " + need
+		}
+	}
+
+	if key.AgentID == "" {
+		return 0, ""
+	}
+	vars := mux.Vars(r)
+	switch {
+	case strings.HasPrefix(template, "/api/agents/{id}"):
+		if vars["id"] != key.AgentID {
+			return http.StatusForbidden, "API key is bound to agent " + key.AgentID
+		}
+	case strings.HasPrefix(template, "/api/tasks/{id}"), strings.HasPrefix(template, "/api/tasks/{task_id}"):
+		taskID := vars["id"]
+		if taskID == "" {
+			taskID = vars["task_id"]
+		}
+		var assignee sql.NullString
+		if err := db.DB.QueryRow(`SELECT assignee FROM tasks WHERE id = $1`, taskID).Scan(&assignee); err != nil {
+			return 0, "" // let the handler report not found
+		}
+		if assignee.String != "" && assignee.String != key.AgentID {
+			return http.StatusForbidden, "task is assigned to another agent"
+		}
+	case template == "/api/comments/{id}":
+		var author string
+		if err := db.DB.QueryRow(`SELECT author FROM comments WHERE id = $1`, vars["id"]).Scan(&author); err != nil {
+			return 0, ""
+		}
+		if author != key.AgentID {
+			return http.StatusForbidden, "comment was written by someone else"
+		}
+	case template == "/api/traces/{id}":
+		var agent sql.NullString
+		if err := db.DB.QueryRow(`SELECT agent_id FROM agent_traces WHERE id = $1`, vars["id"]).Scan(&agent); err != nil {
+			return 0, ""
+		}
+		if agent.String != key.AgentID {
+			return http.StatusForbidden, "trace belongs to another agent"
+		}
+	}
+	return 0, ""
+}
+
+// unknownScope returns the first unknown scope in scopes, or "".
+func unknownScope(scopes []string) string {
+	for _, s := range scopes {
+		if _, ok := apiKeyScopes[s]; !ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// ListAPIKeyScopes handles GET /api/keys/scopes
+func (h *APIKeyHandler) ListAPIKeyScopes(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, apiKeyScopes)
+}
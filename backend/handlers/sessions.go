@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// ─── Sessions ────────────────────────────────────────────────────────────────
+//
+// A login creates a row in user_sessions. The client gets a short-lived access
+// token (JWT carrying the session ID as "sid") and an opaque refresh token whose
+// sha256 is stored on the session. Each refresh rotates the refresh token;
+// presenting an already-rotated token revokes the whole session, since it means
+// the token was copied. Logging out or killing a session puts its ID on the
+// revocation list that validateToken consults.
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type SessionHandler struct{}
+
+// Session is an active login as shown to admins.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	Method     string    `json:"method"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// TokenPair is returned by login and refresh.
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+}
+
+func newRefreshToken() (string, string, error) {
+	// Same shape as invite tokens: 256 random bits, sha256 stored.
+	return newInviteToken()
+}
+
+var (
+	trustProxyOnce sync.Once
+	trustProxyVal  bool
+)
+
+func trustProxy() bool {
+	trustProxyOnce.Do(func() {
+		trustProxyVal = os.Getenv("AGENTBOARD_TRUST_PROXY") == "true"
+	})
+	return trustProxyVal
+}
+
+// clientIP returns the caller's address. X-Forwarded-For is only honoured when
+// AGENTBOARD_TRUST_PROXY=true, since clients can otherwise forge it to dodge
+// per-IP rate limits.
+func clientIP(r *http.Request) string {
+	if trustProxy() {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession records a new login for user and returns its first token pair.
+func startSession(r *http.Request, user *AuthUser, method string) (*TokenPair, error) {
+	refresh, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	ua := r.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	var sid string
+	err = db.DB.QueryRow(
+		`INSERT INTO user_sessions (user_id, refresh_token_hash, method, user_agent, ip, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		user.ID, refreshHash, method, ua, clientIP(r), time.Now().Add(refreshTokenTTL),
+	).Scan(&sid)
+	if err != nil {
+		return nil, err
+	}
+	token, err := issueToken(user, sid)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{Token: token, RefreshToken: refresh, ExpiresIn: int(accessTokenTTL.Seconds())}, nil
+}
+
+var errSessionInvalid = errors.New("invalid or expired refresh token")
+
+// rotateSession exchanges a refresh token for a new token pair.
+func rotateSession(refresh string) (*TokenPair, *AuthUser, error) {
+	hash := hashInviteToken(refresh)
+	newRefresh, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sid, userID string
+	err = db.DB.QueryRow(
+		`UPDATE user_sessions
+		 SET previous_token_hash = refresh_token_hash, refresh_token_hash = $2, last_used_at = NOW()
+		 WHERE refresh_token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 RETURNING id, user_id`,
+		hash, newHash,
+	).Scan(&sid, &userID)
+	if err == sql.ErrNoRows {
+		// A rotated-out token being replayed: someone else holds this session.
+		var reused string
+		if db.DB.QueryRow(
+			`SELECT id FROM user_sessions WHERE previous_token_hash = $1 AND revoked_at IS NULL`, hash,
+		).Scan(&reused) == nil {
+			log.Printf("⚠️  sessions: refresh token reuse on session %s — revoking", reused)
+			revokeSession(reused, "token_reuse")
+		}
+		return nil, nil, errSessionInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, ok := loadAuthUser(userID)
+	if !ok {
+		revokeSession(sid, "user_disabled")
+		return nil, nil, errSessionInvalid
+	}
+	token, err := issueToken(user, sid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &TokenPair{Token: token, RefreshToken: newRefresh, ExpiresIn: int(accessTokenTTL.Seconds())}, user, nil
+}
+
+// revokeSession ends a session and adds it to the revocation list.
+func revokeSession(sid, reason string) bool {
+	res, err := db.DB.Exec(
+		`UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $2 WHERE id = $1 AND revoked_at IS NULL`,
+		sid, reason,
+	)
+	if err != nil {
+		return false
+	}
+	revocations.add(sid, time.Now())
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+// revokeUserSessions ends every active session of a user.
+func revokeUserSessions(userID, reason string) {
+	rows, err := db.DB.Query(
+		`UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $2
+		 WHERE user_id = $1 AND revoked_at IS NULL RETURNING id`, userID, reason,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sid string
+		if rows.Scan(&sid) == nil {
+			revocations.add(sid, time.Now())
+		}
+	}
+}
+
+// ─── Revocation list ─────────────────────────────────────────────────────────
+
+// revocationList holds sessions revoked within the last access-token lifetime;
+// older revocations need no entry because their access tokens have expired.
+// It is re-read from the database periodically so revocations made by other
+// instances are honoured too.
+type revocationList struct {
+	mu       sync.Mutex
+	revoked  map[string]time.Time // sid -> revoked at
+	loadedAt time.Time
+}
+
+const revocationSyncInterval = 15 * time.Second
+
+var revocations = &revocationList{revoked: map[string]time.Time{}}
+
+func (l *revocationList) add(sid string, at time.Time) {
+	l.mu.Lock()
+	l.revoked[sid] = at
+	l.mu.Unlock()
+}
+
+func (l *revocationList) isRevoked(sid string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.loadedAt) > revocationSyncInterval {
+		l.sync()
+	}
+	_, ok := l.revoked[sid]
+	return ok
+}
+
+// sync reloads recent revocations and drops entries whose tokens have expired.
+// Called with l.mu held.
+func (l *revocationList) sync() {
+	cutoff := time.Now().Add(-accessTokenTTL)
+	rows, err := db.DB.Query(`SELECT id, revoked_at FROM user_sessions WHERE revoked_at > $1`, cutoff)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sid string
+		var at time.Time
+		if rows.Scan(&sid, &at) == nil {
+			l.revoked[sid] = at
+		}
+	}
+	for sid, at := range l.revoked {
+		if at.Before(cutoff) {
+			delete(l.revoked, sid)
+		}
+	}
+	l.loadedAt = time.Now()
+}
+
+// ─── Signing keys ────────────────────────────────────────────────────────────
+//
+// Tokens are signed with the newest key in jwt_signing_keys and carry its ID in
+// the "kid" header. Rotating adds a new key; retired keys keep verifying until
+// every token they signed has expired, then they are deleted. Setting
+// JWT_SECRET pins a single key instead (kid "env") and disables rotation.
+
+type signingKey struct {
+	id        string
+	secret    []byte
+	retiredAt *time.Time
+}
+
+type signingKeyRing struct {
+	mu       sync.Mutex
+	pinned   bool
+	current  *signingKey
+	keys     map[string]*signingKey
+	loadedAt time.Time
+}
+
+var keyRing = &signingKeyRing{}
+
+func newSigningKeyID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// load reads the key ring from the database, creating the first key if needed.
+// Called with k.mu held.
+func (k *signingKeyRing) load() error {
+	if s := os.Getenv("JWT_SECRET"); s != "" {
+		key := &signingKey{id: "env", secret: []byte(s)}
+		k.pinned, k.current, k.keys = true, key, map[string]*signingKey{"env": key}
+		k.loadedAt = time.Now()
+		return nil
+	}
+	// Drop keys whose tokens can no longer be valid.
+	db.DB.Exec(`DELETE FROM jwt_signing_keys WHERE retired_at < $1`, time.Now().Add(-accessTokenTTL))
+
+	rows, err := db.DB.Query(`SELECT id, secret, retired_at FROM jwt_signing_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	keys := map[string]*signingKey{}
+	var current *signingKey
+	for rows.Next() {
+		var key signingKey
+		var secret string
+		var retired sql.NullTime
+		if err := rows.Scan(&key.id, &secret, &retired); err != nil {
+			return err
+		}
+		key.secret = []byte(secret)
+		if retired.Valid {
+			key.retiredAt = &retired.Time
+		} else if current == nil {
+			current = &key
+		}
+		keys[key.id] = &key
+	}
+	if current == nil {
+		created, err := insertSigningKey()
+		if err != nil {
+			return err
+		}
+		current = created
+		keys[created.id] = created
+		log.Printf("🔑 Created JWT signing key %s", created.id)
+	}
+	k.current, k.keys, k.loadedAt = current, keys, time.Now()
+	return nil
+}
+
+func insertSigningKey() (*signingKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	key := &signingKey{id: newSigningKeyID(), secret: []byte(hex.EncodeToString(raw))}
+	_, err := db.DB.Exec(`INSERT INTO jwt_signing_keys (id, secret) VALUES ($1, $2)`, key.id, string(key.secret))
+	return key, err
+}
+
+// signing returns the key new tokens are signed with.
+func (k *signingKeyRing) signing() (*signingKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.current == nil {
+		if err := k.load(); err != nil {
+			return nil, err
+		}
+	}
+	return k.current, nil
+}
+
+// verifying returns the key with the given ID, reloading the ring (at most
+// every few seconds) when another instance may have rotated.
+func (k *signingKeyRing) verifying(kid string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.current == nil || (k.keys[kid] == nil && time.Since(k.loadedAt) > 5*time.Second) {
+		if err := k.load(); err != nil {
+			return nil, err
+		}
+	}
+	key := k.keys[kid]
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.retiredAt != nil && time.Since(*key.retiredAt) > accessTokenTTL {
+		return nil, fmt.Errorf("signing key %q has expired", kid)
+	}
+	return key.secret, nil
+}
+
+// rotate retires the current key and makes a new one current.
+func (k *signingKeyRing) rotate() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if os.Getenv("JWT_SECRET") != "" {
+		return "", errors.New("signing key is pinned by JWT_SECRET")
+	}
+	if _, err := db.DB.Exec(`UPDATE jwt_signing_keys SET retired_at = NOW() WHERE retired_at IS NULL`); err != nil {
+		return "", err
+	}
+	created, err := insertSigningKey()
+	if err != nil {
+		return "", err
+	}
+	if err := k.load(); err != nil {
+		return "", err
+	}
+	return created.id, nil
+}
+
+// signJWT signs claims with the current signing key.
+func signJWT(claims jwt.MapClaims) (string, error) {
+	key, err := keyRing.signing()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.secret)
+}
+
+// parseJWT verifies a token signed by signJWT and fills claims.
+func parseJWT(raw string, claims jwt.MapClaims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return keyRing.verifying(kid)
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+}
+
+// ─── Handlers ────────────────────────────────────────────────────────────────
+
+// POST /api/auth/refresh
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		respondError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+	pair, user, err := rotateSession(body.RefreshToken)
+	if err == errSessionInvalid {
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to refresh session")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"token": pair.Token, "refresh_token": pair.RefreshToken, "expires_in": pair.ExpiresIn, "user": user,
+	})
+}
+
+// ListSessions handles GET /api/sessions[?user_id=X]
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT s.id, s.user_id, u.username, s.method, s.user_agent, s.ip, s.created_at, s.last_used_at, s.expires_at
+		FROM user_sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.revoked_at IS NULL AND s.expires_at > NOW()`
+	args := []interface{}{}
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		query += ` AND s.user_id = $1`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY s.last_used_at DESC`
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Username, &s.Method, &s.UserAgent, &s.IP,
+			&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		sessions = append(sessions, s)
+	}
+	respondJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession handles DELETE /api/sessions/{id}
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !revokeSession(id, "admin") {
+		respondError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "session_revoked", "session", id, nil)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// RevokeUserSessions handles DELETE /api/users/{id}/sessions
+func (h *SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	revokeUserSessions(id, "admin")
+	go LogAudit(getAgentFromContext(r), "user_sessions_revoked", "user", id, nil)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Sessions revoked"})
+}
+
+// RotateSigningKey handles POST /api/sessions/signing-key/rotate
+func (h *SessionHandler) RotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	kid, err := keyRing.rotate()
+	if err != nil {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "signing_key_rotated", "signing_key", kid, nil)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"kid":          kid,
+		"grace_period": accessTokenTTL.String(),
+		"message":      "New tokens use the new key; tokens signed with the old key stay valid until they expire",
+	})
+}
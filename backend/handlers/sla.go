@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/config"
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/alghanim/agentboard/backend/websocket"
+	"github.com/gorilla/mux"
+)
+
+// ─── Task SLAs ───────────────────────────────────────────────────────────────
+//
+// An SLA policy sets targets for tasks of a priority and/or team: a response
+// target (time from creation until the task first leaves the backlog/todo
+// categories) and a resolution target (time until it first reaches done).
+// Both are computed from task_history. The most specific enabled policy
+// applies: priority and team, then priority, then team, then neither.
+//
+// sla_breach alert rules escalate open breaches one step per rule threshold
+// (minutes): the assignee, then the team lead, then webhooks.
+
+const (
+	SLATargetResponse   = "response"
+	SLATargetResolution = "resolution"
+
+	slaLevelAssignee = 1
+	slaLevelLead     = 2
+	slaLevelWebhook  = 3
+)
+
+// SLAPolicy sets response and resolution targets for matching tasks.
+type SLAPolicy struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Priority          *string   `json:"priority"` // nil matches any
+	Team              *string   `json:"team"`     // nil matches any
+	ResponseMinutes   *int      `json:"response_minutes"`
+	ResolutionMinutes *int      `json:"resolution_minutes"`
+	Enabled           bool      `json:"enabled"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// SLATarget is the state of one SLA target for a task.
+type SLATarget struct {
+	TargetMinutes    int        `json:"target_minutes"`
+	DueAt            time.Time  `json:"due_at"`
+	MetAt            *time.Time `json:"met_at"`
+	Breached         bool       `json:"breached"`
+	RemainingMinutes *int       `json:"remaining_minutes,omitempty"` // until due, negative once overdue; open targets only
+	EscalationLevel  int        `json:"escalation_level"`
+}
+
+// open reports whether the target is still running.
+func (t *SLATarget) open() bool { return t != nil && t.MetAt == nil }
+
+// SLAStatus is a task's SLA state under its policy.
+type SLAStatus struct {
+	TaskID     string     `json:"task_id"`
+	Policy     *SLAPolicy `json:"policy"`
+	Response   *SLATarget `json:"response"`
+	Resolution *SLATarget `json:"resolution"`
+	Breached   bool       `json:"breached"`
+}
+
+const slaPolicyCols = `id, name, priority, team, response_minutes, resolution_minutes, enabled, created_at, updated_at`
+
+func scanSLAPolicy(scanner interface{ Scan(...interface{}) error }) (*SLAPolicy, error) {
+	var p SLAPolicy
+	var priority, team sql.NullString
+	var response, resolution sql.NullInt64
+	if err := scanner.Scan(&p.ID, &p.Name, &priority, &team, &response, &resolution, &p.Enabled,
+		&p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if priority.Valid {
+		p.Priority = &priority.String
+	}
+	if team.Valid {
+		p.Team = &team.String
+	}
+	if response.Valid {
+		n := int(response.Int64)
+		p.ResponseMinutes = &n
+	}
+	if resolution.Valid {
+		n := int(resolution.Int64)
+		p.ResolutionMinutes = &n
+	}
+	return &p, nil
+}
+
+func loadSLAPolicies(enabledOnly bool) ([]*SLAPolicy, error) {
+	query := `SELECT ` + slaPolicyCols + ` FROM sla_policies`
+	if enabledOnly {
+		query += ` WHERE enabled`
+	}
+	rows, err := db.DB.Query(query + ` ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	policies := []*SLAPolicy{}
+	for rows.Next() {
+		p, err := scanSLAPolicy(rows)
+		if err != nil {
+			continue
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// matchSLAPolicy picks the most specific policy for a task; ties go to the
+// oldest policy.
+func matchSLAPolicy(policies []*SLAPolicy, priority, team string) *SLAPolicy {
+	var best *SLAPolicy
+	bestScore := -1
+	for _, p := range policies {
+		score := 0
+		if p.Priority != nil {
+			if *p.Priority != priority {
+				continue
+			}
+			score += 2
+		}
+		if p.Team != nil {
+			if *p.Team != team {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best
+}
+
+// slaTask holds the timestamps SLA targets are measured from.
+type slaTask struct {
+	ID, Title, Priority, Team, Assignee string
+	CreatedAt                           time.Time
+	RespondedAt, ResolvedAt             *time.Time
+}
+
+// slaTaskQuery selects slaTask rows. A task created past todo, or closed
+// without history, counts from its own timestamps.
+func slaTaskQuery() string {
+	waiting := sqlStatusList(StatusBacklog, StatusTodo)
+	done := sqlStatusList(StatusDone)
+	return `
+		SELECT t.id, t.title, COALESCE(t.priority, ''), COALESCE(t.team, ''), COALESCE(t.assignee, ''), t.created_at,
+		       COALESCE((SELECT MIN(h.changed_at) FROM task_history h
+		                 WHERE h.task_id = t.id AND h.from_status IS DISTINCT FROM h.to_status AND h.to_status NOT IN ` + waiting + `),
+		                CASE WHEN t.status NOT IN ` + waiting + ` THEN t.created_at END),
+		       COALESCE((SELECT MIN(h.changed_at) FROM task_history h
+		                 WHERE h.task_id = t.id AND h.to_status IN ` + done + `),
+		                CASE WHEN t.status IN ` + done + ` THEN t.updated_at END)
+		FROM tasks t`
+}
+
+func scanSLATask(scanner interface{ Scan(...interface{}) error }) (*slaTask, error) {
+	var t slaTask
+	var responded, resolved sql.NullTime
+	if err := scanner.Scan(&t.ID, &t.Title, &t.Priority, &t.Team, &t.Assignee, &t.CreatedAt, &responded, &resolved); err != nil {
+		return nil, err
+	}
+	if responded.Valid {
+		t.RespondedAt = &responded.Time
+	}
+	if resolved.Valid {
+		t.ResolvedAt = &resolved.Time
+	}
+	return &t, nil
+}
+
+func slaTarget(minutes *int, start time.Time, metAt *time.Time, now time.Time) *SLATarget {
+	if minutes == nil {
+		return nil
+	}
+	t := &SLATarget{TargetMinutes: *minutes, DueAt: start.Add(time.Duration(*minutes) * time.Minute), MetAt: metAt}
+	if metAt != nil {
+		t.Breached = metAt.After(t.DueAt)
+	} else {
+		t.Breached = now.After(t.DueAt)
+		remaining := int(t.DueAt.Sub(now).Minutes())
+		t.RemainingMinutes = &remaining
+	}
+	return t
+}
+
+// computeSLA evaluates a task against a policy at now.
+func computeSLA(t *slaTask, p *SLAPolicy, now time.Time) *SLAStatus {
+	s := &SLAStatus{TaskID: t.ID, Policy: p}
+	if p == nil {
+		return s
+	}
+	s.Response = slaTarget(p.ResponseMinutes, t.CreatedAt, t.RespondedAt, now)
+	s.Resolution = slaTarget(p.ResolutionMinutes, t.CreatedAt, t.ResolvedAt, now)
+	s.Breached = (s.Response != nil && s.Response.Breached) || (s.Resolution != nil && s.Resolution.Breached)
+	return s
+}
+
+// teamLead returns the lead of a team from the agents config, falling back
+// to the agents table.
+func teamLead(team string) string {
+	if team == "" {
+		return ""
+	}
+	for _, a := range config.GetAgents() {
+		if a.IsLead && a.Team == team {
+			return a.ID
+		}
+	}
+	var id string
+	db.DB.QueryRow(`SELECT id FROM agents WHERE team = $1 AND is_lead ORDER BY id LIMIT 1`, team).Scan(&id)
+	return id
+}
+
+// evaluateSLABreach escalates open SLA breaches one step at a time, at most
+// once per intervalMinutes per task and target.
+func evaluateSLABreach(hub *websocket.Hub, ruleID, ruleName string, agentID sql.NullString, intervalMinutes int, webhookID sql.NullString) bool {
+	policies, err := loadSLAPolicies(true)
+	if err != nil {
+		log.Printf("[alerts] sla_breach policy error: %v", err)
+		return false
+	}
+	if len(policies) == 0 {
+		return true
+	}
+
+	query := slaTaskQuery() + ` WHERE t.status NOT IN ` + sqlStatusList(StatusDone)
+	var args []interface{}
+	if agentID.Valid && agentID.String != "" {
+		query += ` AND t.assignee = $1`
+		args = append(args, agentID.String)
+	}
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("[alerts] sla_breach query error: %v", err)
+		return false
+	}
+	var tasks []*slaTask
+	for rows.Next() {
+		if t, err := scanSLATask(rows); err == nil {
+			tasks = append(tasks, t)
+		}
+	}
+	rows.Close()
+
+	now := time.Now()
+	interval := time.Duration(intervalMinutes) * time.Minute
+	for _, t := range tasks {
+		p := matchSLAPolicy(policies, t.Priority, t.Team)
+		if p == nil {
+			continue
+		}
+		s := computeSLA(t, p, now)
+		for target, st := range map[string]*SLATarget{SLATargetResponse: s.Response, SLATargetResolution: s.Resolution} {
+			if st.open() && st.Breached {
+				// The alert itself notifies the assignee, the first escalation step;
+				// the rule's webhook is the last step, so it's held back here
+				fireAlert(hub, ruleID, ruleName, t.ID+":"+target, t.Assignee, slaBreachMessage(t, p, target, st), sql.NullString{})
+				escalateSLA(hub, ruleName, webhookID, t, p, target, st, interval)
+			}
+		}
+	}
+	return true
+}
+
+func slaBreachMessage(t *slaTask, p *SLAPolicy, target string, st *SLATarget) string {
+	return fmt.Sprintf("Task '%s' breached its %s SLA (%s: %d min target, %d min overdue)",
+		t.Title, target, p.Name, st.TargetMinutes, int(time.Since(st.DueAt).Minutes()))
+}
+
+// escalateSLA moves a breach to its next escalation level if the previous
+// level is at least interval old.
+func escalateSLA(hub *websocket.Hub, ruleName string, webhookID sql.NullString, t *slaTask, p *SLAPolicy, target string, st *SLATarget, interval time.Duration) {
+	var level int
+	var last time.Time
+	err := db.DB.QueryRow(`SELECT level, last_escalated_at FROM sla_escalations WHERE task_id = $1 AND target = $2`,
+		t.ID, target).Scan(&level, &last)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("[alerts] sla_breach escalation lookup: %v", err)
+		return
+	}
+	if level >= slaLevelWebhook || (level > 0 && time.Since(last) < interval) {
+		return
+	}
+	level++
+
+	msg := slaBreachMessage(t, p, target, st)
+
+	// Escalation is recorded first so a failing notifier can't repeat a step
+	if _, err := db.DB.Exec(`
+		INSERT INTO sla_escalations (task_id, target, policy_id, level, breached_at, last_escalated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (task_id, target) DO UPDATE SET level = EXCLUDED.level, last_escalated_at = NOW()`,
+		t.ID, target, p.ID, level, st.DueAt); err != nil {
+		log.Printf("[alerts] sla_breach escalation update: %v", err)
+		return
+	}
+
+	notified := ""
+	switch level {
+	case slaLevelAssignee:
+		notified = t.Assignee
+	case slaLevelLead:
+		notified = teamLead(t.Team)
+		if notified == "" {
+			log.Printf("[alerts] sla_breach: no lead for team %q, task %s", t.Team, t.ID)
+		} else {
+			go CreateNotificationInternal(notified, "sla_breach", "SLA escalation: "+t.Title, msg)
+		}
+	case slaLevelWebhook:
+		payload := map[string]interface{}{
+			"task_id": t.ID, "title": t.Title, "priority": t.Priority, "team": t.Team, "assignee": t.Assignee,
+			"policy_id": p.ID, "policy": p.Name, "target": target, "due_at": st.DueAt, "level": level, "message": msg,
+		}
+		go TriggerWebhooks(EventSLABreached, payload)
+		if webhookID.Valid {
+			go callWebhook(webhookID.String, ruleName, t.Assignee, msg, AlertFiring)
+		}
+	}
+
+	logActivity("system", "sla_escalated", t.ID, map[string]string{
+		"target": target, "level": fmt.Sprint(level), "notified": notified, "policy": p.Name,
+	})
+	if hub != nil {
+		hub.Broadcast("sla_escalated", map[string]interface{}{
+			"task_id": t.ID, "target": target, "level": level, "notified": notified, "message": msg,
+		})
+	}
+}
+
+// ─── HTTP handlers ───────────────────────────────────────────────────────────
+
+func decodeSLAPolicy(w http.ResponseWriter, r *http.Request) (*SLAPolicy, bool) {
+	p := SLAPolicy{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON")
+		return nil, false
+	}
+	if p.Name == "" {
+		respondError(w, http.StatusBadRequest, "name required")
+		return nil, false
+	}
+	if p.ResponseMinutes == nil && p.ResolutionMinutes == nil {
+		respondError(w, http.StatusBadRequest, "response_minutes or resolution_minutes required")
+		return nil, false
+	}
+	if (p.ResponseMinutes != nil && *p.ResponseMinutes <= 0) || (p.ResolutionMinutes != nil && *p.ResolutionMinutes <= 0) {
+		respondError(w, http.StatusBadRequest, "SLA targets must be positive minutes")
+		return nil, false
+	}
+	if p.Priority != nil && *p.Priority == "" {
+		p.Priority = nil
+	}
+	if p.Team != nil && *p.Team == "" {
+		p.Team = nil
+	}
+	return &p, true
+}
+
+// ListSLAPolicies handles GET /api/sla/policies
+func ListSLAPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := loadSLAPolicies(false)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, policies)
+}
+
+// CreateSLAPolicy handles POST /api/sla/policies
+func CreateSLAPolicy(w http.ResponseWriter, r *http.Request) {
+	p, ok := decodeSLAPolicy(w, r)
+	if !ok {
+		return
+	}
+	created, err := scanSLAPolicy(db.DB.QueryRow(`
+		INSERT INTO sla_policies (name, priority, team, response_minutes, resolution_minutes, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+slaPolicyCols,
+		p.Name, p.Priority, p.Team, p.ResponseMinutes, p.ResolutionMinutes, p.Enabled))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "sla_policy_created", "sla_policy", created.ID, map[string]interface{}{"name": created.Name})
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// UpdateSLAPolicy handles PUT /api/sla/policies/{id}
+func UpdateSLAPolicy(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	p, ok := decodeSLAPolicy(w, r)
+	if !ok {
+		return
+	}
+	updated, err := scanSLAPolicy(db.DB.QueryRow(`
+		UPDATE sla_policies SET name = $1, priority = $2, team = $3, response_minutes = $4, resolution_minutes = $5,
+		       enabled = $6, updated_at = NOW()
+		WHERE id = $7
+		RETURNING `+slaPolicyCols,
+		p.Name, p.Priority, p.Team, p.ResponseMinutes, p.ResolutionMinutes, p.Enabled, id))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "policy not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "sla_policy_updated", "sla_policy", id, map[string]interface{}{"name": updated.Name})
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// DeleteSLAPolicy handles DELETE /api/sla/policies/{id}
+func DeleteSLAPolicy(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	res, err := db.DB.Exec(`DELETE FROM sla_policies WHERE id = $1`, id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondError(w, http.StatusNotFound, "policy not found")
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "sla_policy_deleted", "sla_policy", id, nil)
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// GetTaskSLA handles GET /api/tasks/{id}/sla
+func GetTaskSLA(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	t, err := scanSLATask(db.DB.QueryRow(slaTaskQuery()+` WHERE t.id = $1`, id))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "task not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	policies, err := loadSLAPolicies(true)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s := computeSLA(t, matchSLAPolicy(policies, t.Priority, t.Team), time.Now())
+
+	rows, err := db.DB.Query(`SELECT target, level FROM sla_escalations WHERE task_id = $1`, id)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var target string
+			var level int
+			if rows.Scan(&target, &level) != nil {
+				continue
+			}
+			if target == SLATargetResponse && s.Response != nil {
+				s.Response.EscalationLevel = level
+			} else if target == SLATargetResolution && s.Resolution != nil {
+				s.Resolution.EscalationLevel = level
+			}
+		}
+	}
+	respondJSON(w, http.StatusOK, s)
+}
@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/alghanim/agentboard/backend/db"
 	"github.com/gorilla/mux"
@@ -26,9 +31,12 @@ func GetTaskDependencies(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, 200, map[string]interface{}{"task_id": taskID, "depends_on": deps})
 }
 
-// UpdateTaskDependencies sets the depends_on array for a task
-func UpdateTaskDependencies(w http.ResponseWriter, r *http.Request) {
-	taskID := mux.Vars(r)["id"]
+// UpdateTaskDependencies sets the depends_on array for a task. The new
+// edges are checked against the whole graph: self-references, unknown tasks
+// and cycles are rejected, and a cycle error names the path. A task whose
+// last open dependency the edit removes is released to its ready status.
+func (h *TaskHandler) UpdateTaskDependencies(w http.ResponseWriter, r *http.Request) {
+	taskID := strings.ToLower(mux.Vars(r)["id"])
 	var req struct {
 		DependsOn []string `json:"depends_on"`
 	}
@@ -36,12 +44,300 @@ func UpdateTaskDependencies(w http.ResponseWriter, r *http.Request) {
 		respondError(w, 400, "invalid JSON")
 		return
 	}
-	_, err := db.DB.Exec(`UPDATE tasks SET depends_on = $1 WHERE id = $2`, pq.Array(req.DependsOn), taskID)
+
+	// Drop duplicates, keep order
+	deps := []string{}
+	seen := map[string]bool{}
+	for _, d := range req.DependsOn {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" || seen[d] {
+			continue
+		}
+		if !uuidPattern.MatchString(d) {
+			respondError(w, 400, fmt.Sprintf("%q is not a task ID", d))
+			return
+		}
+		if d == taskID {
+			respondError(w, 400, "a task cannot depend on itself")
+			return
+		}
+		seen[d] = true
+		deps = append(deps, d)
+	}
+
+	tx, err := db.DB.Begin()
 	if err != nil {
 		respondError(w, 500, err.Error())
 		return
 	}
-	respondJSON(w, 200, map[string]interface{}{"task_id": taskID, "depends_on": req.DependsOn})
+	defer tx.Rollback()
+
+	// Serialise dependency writes so two concurrent edits can't form a cycle
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, dependencyLockKey); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	g, err := loadDependencyGraph(tx)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	if _, ok := g.titles[taskID]; !ok {
+		respondError(w, 404, "task not found")
+		return
+	}
+	missing := []string{}
+	for _, d := range deps {
+		if _, ok := g.titles[d]; !ok {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) > 0 {
+		respondError(w, 400, "unknown tasks: "+strings.Join(missing, ", "))
+		return
+	}
+
+	previous := g.deps[taskID]
+	g.deps[taskID] = deps
+	if cycle := g.cycleThrough(taskID); cycle != nil {
+		respondJSON(w, 409, map[string]interface{}{
+			"error": "dependency cycle: " + g.describePath(cycle),
+			"cycle": cycle,
+		})
+		return
+	}
+
+	// Whether the task waited on open work before the edit, and after it
+	var wasWaiting, waiting bool
+	done := sqlStatusList(StatusDone)
+	if err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM tasks WHERE id = ANY($1::uuid[]) AND status NOT IN `+done+`),
+		       EXISTS (SELECT 1 FROM tasks WHERE id = ANY($2::uuid[]) AND status NOT IN `+done+`)`,
+		pq.Array(previous), pq.Array(deps)).Scan(&wasWaiting, &waiting); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	if _, err := tx.Exec(`UPDATE tasks SET depends_on = $1, updated_at = NOW() WHERE id = $2`, pq.Array(deps), taskID); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+	if wasWaiting && !waiting {
+		go releaseTask(h.Hub, taskID, 0)
+	}
+	go LogAudit(getAgentFromContext(r), "task_dependencies_updated", "task", taskID, map[string]interface{}{"depends_on": deps})
+	respondJSON(w, 200, map[string]interface{}{"task_id": taskID, "depends_on": deps})
+}
+
+// dependencyLockKey is the advisory lock held while depends_on is rewritten.
+const dependencyLockKey = 0x6465707321 // "deps!"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// dependencyGraph is every task's depends_on, as stored.
+type dependencyGraph struct {
+	deps   map[string][]string
+	titles map[string]string
+}
+
+func loadDependencyGraph(q interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}) (*dependencyGraph, error) {
+	rows, err := q.Query(`SELECT id, title, COALESCE(depends_on, '{}') FROM tasks`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	g := &dependencyGraph{deps: map[string][]string{}, titles: map[string]string{}}
+	for rows.Next() {
+		var id, title string
+		var deps []string
+		if err := rows.Scan(&id, &title, pq.Array(&deps)); err != nil {
+			return nil, err
+		}
+		g.titles[id] = title
+		if len(deps) > 0 {
+			g.deps[id] = deps
+		}
+	}
+	return g, rows.Err()
+}
+
+// cycleThrough returns a dependency path from start back to itself
+// (start, ..., start), or nil if start isn't on a cycle.
+func (g *dependencyGraph) cycleThrough(start string) []string {
+	visited := map[string]bool{}
+	var path []string
+	var walk func(id string) bool
+	walk = func(id string) bool {
+		for _, dep := range g.deps[id] {
+			if dep == start {
+				path = append(path, dep)
+				return true
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			path = append(path, dep)
+			if walk(dep) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return false
+	}
+	path = []string{start}
+	if walk(start) {
+		return path
+	}
+	return nil
+}
+
+// cycles returns every elementary cycle found by a depth-first search, each
+// rotated to start at its smallest ID and closed (a, ..., a).
+func (g *dependencyGraph) cycles() [][]string {
+	ids := make([]string, 0, len(g.deps))
+	for id := range g.deps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	const (
+		white = iota
+		grey
+		black
+	)
+	color := map[string]int{}
+	stack := []string{}
+	found := map[string][]string{}
+
+	var visit func(id string)
+	visit = func(id string) {
+		color[id] = grey
+		stack = append(stack, id)
+		for _, dep := range g.deps[id] {
+			switch color[dep] {
+			case white:
+				visit(dep)
+			case grey:
+				// Back edge: the cycle is the stack from dep to id
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dep {
+						cycle := canonicalCycle(stack[i:])
+						found[strings.Join(cycle, ",")] = cycle
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		color[id] = black
+	}
+	for _, id := range ids {
+		if color[id] == white {
+			visit(id)
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for k := range found {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([][]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, found[k])
+	}
+	return out
+}
+
+func canonicalCycle(nodes []string) []string {
+	min := 0
+	for i := range nodes {
+		if nodes[i] < nodes[min] {
+			min = i
+		}
+	}
+	cycle := append(append([]string{}, nodes[min:]...), nodes[:min]...)
+	return append(cycle, cycle[0])
+}
+
+// describePath renders a path of task IDs as "title (id) → ...".
+func (g *dependencyGraph) describePath(path []string) string {
+	parts := make([]string, len(path))
+	for i, id := range path {
+		parts[i] = fmt.Sprintf("%q (%s)", g.titles[id], id)
+	}
+	return strings.Join(parts, " → ")
+}
+
+// ValidateTaskGraph handles GET /api/tasks/graph/validate
+// Reports problems already in the stored dependency data.
+func ValidateTaskGraph(w http.ResponseWriter, r *http.Request) {
+	g, err := loadDependencyGraph(db.DB)
+	if err != nil {
+		respondError(w, 500, err.Error())
+		return
+	}
+
+	type taskRef struct {
+		TaskID string `json:"task_id"`
+		Title  string `json:"title"`
+		RefID  string `json:"ref_id,omitempty"`
+	}
+	type cycleReport struct {
+		Path        []string `json:"path"`
+		Description string   `json:"description"`
+	}
+	selfRefs := []taskRef{}
+	missing := []taskRef{}
+	duplicates := []taskRef{}
+	edges := 0
+
+	ids := make([]string, 0, len(g.deps))
+	for id := range g.deps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		seen := map[string]bool{}
+		for _, dep := range g.deps[id] {
+			edges++
+			switch {
+			case dep == id:
+				selfRefs = append(selfRefs, taskRef{TaskID: id, Title: g.titles[id]})
+			case seen[dep]:
+				duplicates = append(duplicates, taskRef{TaskID: id, Title: g.titles[id], RefID: dep})
+			default:
+				if _, ok := g.titles[dep]; !ok {
+					missing = append(missing, taskRef{TaskID: id, Title: g.titles[id], RefID: dep})
+				}
+			}
+			seen[dep] = true
+		}
+	}
+
+	cycles := []cycleReport{}
+	for _, c := range g.cycles() {
+		if len(c) == 2 { // a self-reference, reported above
+			continue
+		}
+		cycles = append(cycles, cycleReport{Path: c, Description: g.describePath(c)})
+	}
+
+	respondJSON(w, 200, map[string]interface{}{
+		"valid":              len(selfRefs)+len(missing)+len(duplicates)+len(cycles) == 0,
+		"tasks":              len(g.titles),
+		"edges":              edges,
+		"cycles":             cycles,
+		"self_references":    selfRefs,
+		"missing_references": missing,
+		"duplicates":         duplicates,
+	})
 }
 
 // TaskDAGNode represents a node in the task DAG
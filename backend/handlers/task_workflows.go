@@ -0,0 +1,812 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// ─── Task workflows ──────────────────────────────────────────────────────────
+//
+// A workflow is a named set of task statuses plus the transitions allowed
+// between them, each optionally guarded. A task uses its template's workflow,
+// else its team's, else the default one. Every status belongs to a category
+// so the rest of the code (stuck detection, completion, analytics) can ask
+// "is this done?" without knowing status names.
+
+// Status categories.
+const (
+	StatusBacklog = "backlog"
+	StatusTodo    = "todo"
+	StatusActive  = "active"
+	StatusReview  = "review"
+	StatusBlocked = "blocked"
+	StatusDone    = "done"
+)
+
+var statusCategories = map[string]bool{
+	StatusBacklog: true, StatusTodo: true, StatusActive: true,
+	StatusReview: true, StatusBlocked: true, StatusDone: true,
+}
+
+// defaultStuckAfter applies to active statuses without their own threshold.
+const defaultStuckAfter = 2 * time.Hour
+
+// workflowCacheTTL bounds how stale another instance's edits can be.
+const workflowCacheTTL = 30 * time.Second
+
+var statusNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,49}$`)
+
+type WorkflowStatus struct {
+	Name              string `json:"name"`
+	Label             string `json:"label,omitempty"`
+	Category          string `json:"category"`
+	StuckAfterMinutes int    `json:"stuck_after_minutes,omitempty"` // active statuses only; default 120
+}
+
+// TransitionGuards are checked before a transition is allowed. All set
+// guards must pass.
+type TransitionGuards struct {
+	RequiredFields []string `json:"required_fields,omitempty"` // task fields that must be non-empty
+	MinRole        string   `json:"min_role,omitempty"`        // viewer, member or admin
+	MinEvalScore   *float64 `json:"min_eval_score,omitempty"`  // latest evaluation of the task
+}
+
+type WorkflowTransition struct {
+	From   string            `json:"from"` // "*" matches any status
+	To     string            `json:"to"`
+	Guards *TransitionGuards `json:"guards,omitempty"`
+}
+
+type Workflow struct {
+	ID            string               `json:"id"`
+	Name          string               `json:"name"`
+	Description   string               `json:"description,omitempty"`
+	InitialStatus string               `json:"initial_status"`
+	Statuses      []WorkflowStatus     `json:"statuses"`
+	Transitions   []WorkflowTransition `json:"transitions"`
+	IsDefault     bool                 `json:"is_default"`
+	Teams         []string             `json:"teams"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+}
+
+// builtinWorkflow is the original hardcoded board. It seeds the default
+// workflow and is used if the workflows table can't be read.
+var builtinWorkflow = Workflow{
+	Name:          "default",
+	Description:   "Standard board: backlog → todo → next → progress → review → done",
+	InitialStatus: "todo",
+	Statuses: []WorkflowStatus{
+		{Name: "backlog", Label: "Backlog", Category: StatusBacklog},
+		{Name: "todo", Label: "To Do", Category: StatusTodo},
+		{Name: "next", Label: "Next", Category: StatusTodo},
+		{Name: "progress", Label: "In Progress", Category: StatusActive},
+		{Name: "review", Label: "Review", Category: StatusReview},
+		{Name: "blocked", Label: "Blocked", Category: StatusBlocked},
+		{Name: "done", Label: "Done", Category: StatusDone},
+	},
+	Transitions: []WorkflowTransition{
+		{From: "todo", To: "progress"}, {From: "todo", To: "backlog"}, {From: "todo", To: "next"},
+		{From: "backlog", To: "todo"}, {From: "backlog", To: "next"},
+		{From: "next", To: "progress"},
+		{From: "progress", To: "review"}, {From: "progress", To: "blocked"}, {From: "progress", To: "todo"},
+		{From: "review", To: "done"}, {From: "review", To: "progress"},
+		{From: "blocked", To: "todo"}, {From: "blocked", To: "progress"}, {From: "blocked", To: "next"},
+	},
+	IsDefault: true,
+}
+
+func (wf *Workflow) status(name string) *WorkflowStatus {
+	for i := range wf.Statuses {
+		if wf.Statuses[i].Name == name {
+			return &wf.Statuses[i]
+		}
+	}
+	return nil
+}
+
+// category returns the category of status, or "" if the workflow lacks it.
+func (wf *Workflow) category(name string) string {
+	if s := wf.status(name); s != nil {
+		return s.Category
+	}
+	return ""
+}
+
+// transition returns the rule permitting from → to, or nil.
+func (wf *Workflow) transition(from, to string) *WorkflowTransition {
+	var wildcard *WorkflowTransition
+	for i := range wf.Transitions {
+		t := &wf.Transitions[i]
+		if t.To != to {
+			continue
+		}
+		if t.From == from {
+			return t
+		}
+		if t.From == "*" && wildcard == nil {
+			wildcard = t
+		}
+	}
+	return wildcard
+}
+
+// next lists the statuses reachable from status.
+func (wf *Workflow) next(status string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range wf.Transitions {
+		if (t.From == status || t.From == "*") && t.To != status && !seen[t.To] {
+			seen[t.To] = true
+			out = append(out, t.To)
+		}
+	}
+	return out
+}
+
+// validate checks a workflow definition before it is stored.
+func (wf *Workflow) validate() error {
+	if strings.TrimSpace(wf.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(wf.Statuses) == 0 {
+		return fmt.Errorf("at least one status is required")
+	}
+	names := map[string]bool{}
+	for _, s := range wf.Statuses {
+		if !statusNamePattern.MatchString(s.Name) {
+			return fmt.Errorf("invalid status name %q: use lowercase letters, digits, - and _", s.Name)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("duplicate status %q", s.Name)
+		}
+		if !statusCategories[s.Category] {
+			return fmt.Errorf("status %q: category must be one of backlog, todo, active, review, blocked, done", s.Name)
+		}
+		if s.StuckAfterMinutes < 0 {
+			return fmt.Errorf("status %q: stuck_after_minutes must not be negative", s.Name)
+		}
+		names[s.Name] = true
+	}
+	if wf.InitialStatus == "" {
+		wf.InitialStatus = wf.Statuses[0].Name
+	}
+	if !names[wf.InitialStatus] {
+		return fmt.Errorf("initial_status %q is not one of the statuses", wf.InitialStatus)
+	}
+	for _, t := range wf.Transitions {
+		if t.From != "*" && !names[t.From] {
+			return fmt.Errorf("transition from unknown status %q", t.From)
+		}
+		if !names[t.To] {
+			return fmt.Errorf("transition to unknown status %q", t.To)
+		}
+		if g := t.Guards; g != nil {
+			for _, f := range g.RequiredFields {
+				if _, ok := guardFields[f]; !ok {
+					return fmt.Errorf("transition %s → %s: unknown required field %q", t.From, t.To, f)
+				}
+			}
+			if _, ok := roleLevel[g.MinRole]; g.MinRole != "" && !ok {
+				return fmt.Errorf("transition %s → %s: min_role must be viewer, member or admin", t.From, t.To)
+			}
+			if g.MinEvalScore != nil && (*g.MinEvalScore < 0 || *g.MinEvalScore > 100) {
+				return fmt.Errorf("transition %s → %s: min_eval_score must be 0-100", t.From, t.To)
+			}
+		}
+	}
+	return nil
+}
+
+// guardFields maps the field names usable in required_fields to SQL that is
+// true when the field is filled in.
+var guardFields = map[string]string{
+	"assignee":    `COALESCE(assignee, '') <> ''`,
+	"description": `COALESCE(description, '') <> ''`,
+	"team":        `COALESCE(team, '') <> ''`,
+	"due_date":    `due_date IS NOT NULL`,
+	"labels":      `COALESCE(array_length(labels, 1), 0) > 0`,
+	"priority":    `COALESCE(priority, '') <> ''`,
+}
+
+// ─── Cache ───────────────────────────────────────────────────────────────────
+
+type workflowSet struct {
+	byID      map[string]*Workflow
+	teams     map[string]string // team → workflow ID
+	defaultWF *Workflow
+	loaded    time.Time
+}
+
+var (
+	workflowMu    sync.Mutex
+	workflowCache *workflowSet
+)
+
+// loadWorkflows returns the cached workflow set, reloading it when stale.
+func loadWorkflows() *workflowSet {
+	workflowMu.Lock()
+	defer workflowMu.Unlock()
+	if workflowCache != nil && time.Since(workflowCache.loaded) < workflowCacheTTL {
+		return workflowCache
+	}
+	set, err := readWorkflows()
+	if err != nil {
+		log.Printf("[workflows] load failed, using built-in workflow: %v", err)
+		wf := builtinWorkflow
+		set = &workflowSet{byID: map[string]*Workflow{}, teams: map[string]string{}, defaultWF: &wf}
+		if workflowCache != nil {
+			set = workflowCache // keep serving the last good copy
+		}
+	}
+	set.loaded = time.Now()
+	workflowCache = set
+	return set
+}
+
+// invalidateWorkflows forces the next lookup to re-read the database.
+func invalidateWorkflows() {
+	workflowMu.Lock()
+	workflowCache = nil
+	workflowMu.Unlock()
+}
+
+func readWorkflows() (*workflowSet, error) {
+	rows, err := db.DB.Query(`SELECT ` + workflowCols + ` FROM workflows`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	set := &workflowSet{byID: map[string]*Workflow{}, teams: map[string]string{}}
+	for rows.Next() {
+		wf, err := scanWorkflow(rows)
+		if err != nil {
+			return nil, err
+		}
+		set.byID[wf.ID] = wf
+		if wf.IsDefault {
+			set.defaultWF = wf
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	trows, err := db.DB.Query(`SELECT team, workflow_id FROM team_workflows`)
+	if err != nil {
+		return nil, err
+	}
+	defer trows.Close()
+	for trows.Next() {
+		var team, id string
+		if trows.Scan(&team, &id) == nil {
+			set.teams[team] = id
+			if wf := set.byID[id]; wf != nil {
+				wf.Teams = append(wf.Teams, team)
+			}
+		}
+	}
+	if set.defaultWF == nil {
+		wf := builtinWorkflow
+		set.defaultWF = &wf
+	}
+	return set, nil
+}
+
+// builtinUpgrades are transitions added to builtinWorkflow after it was
+// first seeded. A default workflow seeded by an older release gets those of
+// upgrades past its seed_version once, where it has both statuses.
+var builtinUpgrades = [][]WorkflowTransition{
+	1: {{From: "todo", To: "next"}, {From: "blocked", To: "next"}},
+}
+
+// EnsureDefaultWorkflow seeds the built-in workflow on a fresh install and
+// applies pending builtinUpgrades to one seeded earlier. Called once at
+// startup.
+func EnsureDefaultWorkflow() error {
+	version := len(builtinUpgrades) - 1
+	statuses, _ := json.Marshal(builtinWorkflow.Statuses)
+	transitions, _ := json.Marshal(builtinWorkflow.Transitions)
+	_, err := db.DB.Exec(`
+		INSERT INTO workflows (name, description, initial_status, statuses, transitions, is_default, seed_version)
+		SELECT $1, $2, $3, $4, $5, true, $6
+		WHERE NOT EXISTS (SELECT 1 FROM workflows WHERE is_default)
+		ON CONFLICT (name) DO NOTHING`,
+		builtinWorkflow.Name, builtinWorkflow.Description, builtinWorkflow.InitialStatus, statuses, transitions, version)
+	if err != nil {
+		return err
+	}
+	for v := 1; v <= version; v++ {
+		added, _ := json.Marshal(builtinUpgrades[v])
+		_, err := db.DB.Exec(`
+			UPDATE workflows w SET
+			  transitions = w.transitions || (
+			      SELECT COALESCE(jsonb_agg(t), '[]'::jsonb) FROM jsonb_array_elements($1::jsonb) t
+			      WHERE NOT w.transitions @> jsonb_build_array(t)
+			        AND w.statuses @> jsonb_build_array(jsonb_build_object('name', t->>'from'))
+			        AND w.statuses @> jsonb_build_array(jsonb_build_object('name', t->>'to'))),
+			  seed_version = $3,
+			  updated_at = NOW()
+			WHERE w.name = $2 AND w.seed_version < $3`,
+			added, builtinWorkflow.Name, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workflowFor resolves the workflow for a template and/or team.
+func (s *workflowSet) workflowFor(templateWorkflowID, team string) *Workflow {
+	if wf := s.byID[templateWorkflowID]; wf != nil {
+		return wf
+	}
+	if wf := s.byID[s.teams[team]]; wf != nil {
+		return wf
+	}
+	return s.defaultWF
+}
+
+// all returns every workflow, including the fallback default.
+func (s *workflowSet) all() []*Workflow {
+	out := make([]*Workflow, 0, len(s.byID)+1)
+	for _, wf := range s.byID {
+		out = append(out, wf)
+	}
+	if len(s.byID) == 0 {
+		out = append(out, s.defaultWF)
+	}
+	return out
+}
+
+// taskWorkflow loads a task's current status and the workflow governing it.
+func taskWorkflow(taskID string) (string, *Workflow, error) {
+	var status, templateWF, team string
+	err := db.DB.QueryRow(`
+		SELECT t.status, COALESCE(tt.workflow_id::text, ''), COALESCE(t.team, '')
+		FROM tasks t LEFT JOIN task_templates tt ON tt.id = t.template_id
+		WHERE t.id = $1`, taskID).Scan(&status, &templateWF, &team)
+	if err != nil {
+		return "", nil, err
+	}
+	return status, loadWorkflows().workflowFor(templateWF, team), nil
+}
+
+// ─── Category helpers used by queries ────────────────────────────────────────
+
+// statusesIn returns every status name, across all workflows, in any of
+// the given categories.
+func statusesIn(categories ...string) []string {
+	want := map[string]bool{}
+	for _, c := range categories {
+		want[c] = true
+	}
+	seen := map[string]bool{}
+	out := []string{}
+	for _, wf := range loadWorkflows().all() {
+		for _, s := range wf.Statuses {
+			if want[s.Category] && !seen[s.Name] {
+				seen[s.Name] = true
+				out = append(out, s.Name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// sqlStatusList renders statusesIn(categories...) as a quoted SQL list for
+// use after IN, e.g. ('done','shipped').
+func sqlStatusList(categories ...string) string {
+	names := statusesIn(categories...)
+	if len(names) == 0 {
+		return "(NULL)"
+	}
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = pq.QuoteLiteral(n)
+	}
+	return "(" + strings.Join(quoted, ",") + ")"
+}
+
+// sqlCycleStart is the SQL for when work on a tasks row started: its first
+// move into an active status, or its creation if it never had one.
+func sqlCycleStart() string {
+	return `COALESCE((SELECT MIN(h.changed_at) FROM task_history h
+		WHERE h.task_id = tasks.id AND h.to_status IN ` + sqlStatusList(StatusActive) + `), created_at)`
+}
+
+// stuckThresholds maps each active status to how long a task may sit in it
+// untouched. When workflows disagree the shortest threshold wins.
+func stuckThresholds() map[string]time.Duration {
+	out := map[string]time.Duration{}
+	for _, wf := range loadWorkflows().all() {
+		for _, s := range wf.Statuses {
+			if s.Category != StatusActive {
+				continue
+			}
+			d := defaultStuckAfter
+			if s.StuckAfterMinutes > 0 {
+				d = time.Duration(s.StuckAfterMinutes) * time.Minute
+			}
+			if cur, ok := out[s.Name]; !ok || d < cur {
+				out[s.Name] = d
+			}
+		}
+	}
+	return out
+}
+
+// sqlStuckCondition renders the stuck test for a tasks row as SQL.
+func sqlStuckCondition() string {
+	thresholds := stuckThresholds()
+	if len(thresholds) == 0 {
+		return "false"
+	}
+	names := make([]string, 0, len(thresholds))
+	for n := range thresholds {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = fmt.Sprintf("(status = %s AND updated_at < NOW() - INTERVAL '%d minutes')",
+			pq.QuoteLiteral(n), int(thresholds[n].Minutes()))
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+// ─── Guards ──────────────────────────────────────────────────────────────────
+
+// checkGuards returns an HTTP status and message when a guard blocks the
+// transition, or 0 when it may proceed. Role guards only apply to requests
+// (r != nil); system moves are trusted.
+func checkGuards(r *http.Request, taskID string, g *TransitionGuards) (int, string) {
+	if g == nil {
+		return 0, ""
+	}
+	if g.MinRole != "" && r != nil {
+		role := GetRoleFromContext(r)
+		if _, ok := roleLevel[role]; !ok || roleLevel[role] < roleLevel[g.MinRole] {
+			return http.StatusForbidden, fmt.Sprintf("transition requires %s role or higher", g.MinRole)
+		}
+	}
+	var missing []string
+	for _, f := range g.RequiredFields {
+		var ok bool
+		if err := db.DB.QueryRow(`SELECT `+guardFields[f]+` FROM tasks WHERE id = $1`, taskID).Scan(&ok); err != nil || !ok {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return http.StatusUnprocessableEntity, "transition requires fields: " + strings.Join(missing, ", ")
+	}
+	if g.MinEvalScore != nil {
+		var score sql.NullFloat64
+		db.DB.QueryRow(`SELECT score FROM evaluations WHERE task_id = $1 ORDER BY created_at DESC LIMIT 1`, taskID).Scan(&score)
+		if !score.Valid {
+			return http.StatusUnprocessableEntity, fmt.Sprintf("transition requires an evaluation score of at least %g; task has no evaluation", *g.MinEvalScore)
+		}
+		if score.Float64 < *g.MinEvalScore {
+			return http.StatusUnprocessableEntity, fmt.Sprintf("transition requires an evaluation score of at least %g; latest is %g", *g.MinEvalScore, score.Float64)
+		}
+	}
+	return 0, ""
+}
+
+// ─── HTTP handlers ───────────────────────────────────────────────────────────
+
+type WorkflowHandler struct{}
+
+const workflowCols = `id, name, COALESCE(description, ''), initial_status, statuses, transitions, is_default, created_at, updated_at`
+
+func scanWorkflow(scanner interface{ Scan(...interface{}) error }) (*Workflow, error) {
+	var wf Workflow
+	var statuses, transitions []byte
+	if err := scanner.Scan(&wf.ID, &wf.Name, &wf.Description, &wf.InitialStatus, &statuses, &transitions,
+		&wf.IsDefault, &wf.CreatedAt, &wf.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(statuses, &wf.Statuses); err != nil {
+		return nil, fmt.Errorf("workflow %s: bad statuses: %w", wf.Name, err)
+	}
+	if err := json.Unmarshal(transitions, &wf.Transitions); err != nil {
+		return nil, fmt.Errorf("workflow %s: bad transitions: %w", wf.Name, err)
+	}
+	wf.Teams = []string{}
+	return &wf, nil
+}
+
+// ListWorkflows handles GET /api/workflows
+func (h *WorkflowHandler) ListWorkflows(w http.ResponseWriter, r *http.Request) {
+	list := loadWorkflows().all()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].IsDefault != list[j].IsDefault {
+			return list[i].IsDefault
+		}
+		return list[i].Name < list[j].Name
+	})
+	respondJSON(w, http.StatusOK, list)
+}
+
+// GetWorkflow handles GET /api/workflows/{id}
+func (h *WorkflowHandler) GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	wf := loadWorkflows().byID[mux.Vars(r)["id"]]
+	if wf == nil {
+		respondError(w, http.StatusNotFound, "workflow not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, wf)
+}
+
+func decodeWorkflow(w http.ResponseWriter, r *http.Request) (*Workflow, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var wf Workflow
+	if err := json.NewDecoder(r.Body).Decode(&wf); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return nil, false
+	}
+	if wf.Transitions == nil {
+		wf.Transitions = []WorkflowTransition{}
+	}
+	if err := wf.validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return &wf, true
+}
+
+// CreateWorkflow handles POST /api/workflows
+func (h *WorkflowHandler) CreateWorkflow(w http.ResponseWriter, r *http.Request) {
+	wf, ok := decodeWorkflow(w, r)
+	if !ok {
+		return
+	}
+	statuses, _ := json.Marshal(wf.Statuses)
+	transitions, _ := json.Marshal(wf.Transitions)
+	created, err := scanWorkflow(db.DB.QueryRow(`
+		INSERT INTO workflows (name, description, initial_status, statuses, transitions)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING `+workflowCols,
+		wf.Name, wf.Description, wf.InitialStatus, statuses, transitions))
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			respondError(w, http.StatusConflict, "a workflow with that name already exists")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invalidateWorkflows()
+	go LogAudit(getAgentFromContext(r), "workflow_created", "workflow", created.ID, map[string]interface{}{"name": created.Name})
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// UpdateWorkflow handles PUT /api/workflows/{id}
+// Statuses still used by tasks on this workflow can't be removed.
+func (h *WorkflowHandler) UpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	wf, ok := decodeWorkflow(w, r)
+	if !ok {
+		return
+	}
+	invalidateWorkflows()
+	set := loadWorkflows()
+	old := set.byID[id]
+	if old == nil {
+		respondError(w, http.StatusNotFound, "workflow not found")
+		return
+	}
+	if orphaned := orphanedStatuses(set, old, wf); len(orphaned) > 0 {
+		respondError(w, http.StatusConflict, "tasks still use removed statuses: "+strings.Join(orphaned, ", "))
+		return
+	}
+
+	statuses, _ := json.Marshal(wf.Statuses)
+	transitions, _ := json.Marshal(wf.Transitions)
+	updated, err := scanWorkflow(db.DB.QueryRow(`
+		UPDATE workflows SET name = $1, description = NULLIF($2, ''), initial_status = $3,
+		       statuses = $4, transitions = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING `+workflowCols,
+		wf.Name, wf.Description, wf.InitialStatus, statuses, transitions, id))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invalidateWorkflows()
+	go LogAudit(getAgentFromContext(r), "workflow_updated", "workflow", id, map[string]interface{}{"name": updated.Name})
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// orphanedStatuses lists statuses dropped from old that tasks governed by it
+// still sit in.
+func orphanedStatuses(set *workflowSet, old, updated *Workflow) []string {
+	var removed []string
+	for _, s := range old.Statuses {
+		if updated.status(s.Name) == nil {
+			removed = append(removed, s.Name)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return strandedStatuses(`t.status = ANY($1)`, pq.Array(removed), func(templateWF, team string) *Workflow {
+		if set.workflowFor(templateWF, team).ID == old.ID {
+			return updated
+		}
+		return nil
+	})
+}
+
+// strandedStatuses lists statuses of the tasks matching where (with arg as
+// $1) that the workflow moveTo picks for them lacks. moveTo gets a task's
+// template workflow and team and returns nil for tasks that keep theirs.
+func strandedStatuses(where string, arg interface{}, moveTo func(templateWF, team string) *Workflow) []string {
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT t.status, COALESCE(tt.workflow_id::text, ''), COALESCE(t.team, '')
+		FROM tasks t LEFT JOIN task_templates tt ON tt.id = t.template_id
+		WHERE `+where, arg)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	seen := map[string]bool{}
+	var out []string
+	for rows.Next() {
+		var status, templateWF, team string
+		if rows.Scan(&status, &templateWF, &team) != nil || seen[status] {
+			continue
+		}
+		if wf := moveTo(templateWF, team); wf != nil && wf.status(status) == nil {
+			seen[status] = true
+			out = append(out, status)
+		}
+	}
+	return out
+}
+
+// DeleteWorkflow handles DELETE /api/workflows/{id}
+// Teams and templates on the workflow fall back to the default.
+func (h *WorkflowHandler) DeleteWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var isDefault bool
+	err := db.DB.QueryRow(`SELECT is_default FROM workflows WHERE id = $1`, id).Scan(&isDefault)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "workflow not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if isDefault {
+		respondError(w, http.StatusConflict, "the default workflow can't be deleted")
+		return
+	}
+	invalidateWorkflows()
+	set := loadWorkflows()
+	if orphaned := orphanedStatuses(set, set.byID[id], set.defaultWF); len(orphaned) > 0 {
+		respondError(w, http.StatusConflict, "tasks would be left in statuses the default workflow lacks: "+strings.Join(orphaned, ", "))
+		return
+	}
+	if _, err := db.DB.Exec(`DELETE FROM workflows WHERE id = $1`, id); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invalidateWorkflows()
+	go LogAudit(getAgentFromContext(r), "workflow_deleted", "workflow", id, nil)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "workflow deleted"})
+}
+
+// SetDefaultWorkflow handles POST /api/workflows/{id}/default
+func (h *WorkflowHandler) SetDefaultWorkflow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	tx, err := db.DB.Begin()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	tx.Exec(`UPDATE workflows SET is_default = false WHERE is_default AND id <> $1`, id)
+	res, err := tx.Exec(`UPDATE workflows SET is_default = true, updated_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		respondError(w, http.StatusNotFound, "workflow not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invalidateWorkflows()
+	go LogAudit(getAgentFromContext(r), "workflow_default_set", "workflow", id, nil)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "default workflow set"})
+}
+
+// SetTeamWorkflow handles PUT /api/workflows/teams/{team}
+// Body: {"workflow_id": "..."}; an empty workflow_id reverts the team to the default.
+func (h *WorkflowHandler) SetTeamWorkflow(w http.ResponseWriter, r *http.Request) {
+	team := mux.Vars(r)["team"]
+	var req struct {
+		WorkflowID string `json:"workflow_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	invalidateWorkflows()
+	set := loadWorkflows()
+	if req.WorkflowID != "" && set.byID[req.WorkflowID] == nil {
+		respondError(w, http.StatusNotFound, "workflow not found")
+		return
+	}
+	// Tasks with a template workflow keep it; the rest move to the new one
+	stranded := strandedStatuses(`t.team = $1`, team, func(templateWF, _ string) *Workflow {
+		if set.byID[templateWF] != nil {
+			return nil
+		}
+		from, to := set.workflowFor("", team), set.workflowFor(req.WorkflowID, "")
+		if from.ID == to.ID {
+			return nil
+		}
+		return to
+	})
+	if len(stranded) > 0 {
+		respondError(w, http.StatusConflict, "the team's tasks use statuses the new workflow lacks: "+strings.Join(stranded, ", "))
+		return
+	}
+	var err error
+	if req.WorkflowID == "" {
+		_, err = db.DB.Exec(`DELETE FROM team_workflows WHERE team = $1`, team)
+	} else {
+		_, err = db.DB.Exec(`
+			INSERT INTO team_workflows (team, workflow_id) VALUES ($1, $2)
+			ON CONFLICT (team) DO UPDATE SET workflow_id = EXCLUDED.workflow_id`, team, req.WorkflowID)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "foreign key") {
+			respondError(w, http.StatusNotFound, "workflow not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invalidateWorkflows()
+	go LogAudit(getAgentFromContext(r), "team_workflow_set", "team", team, map[string]interface{}{"workflow_id": req.WorkflowID})
+	respondJSON(w, http.StatusOK, map[string]string{"team": team, "workflow_id": req.WorkflowID})
+}
+
+// GetTaskWorkflow handles GET /api/tasks/{id}/workflow
+// Returns the workflow governing the task and the statuses it may move to next.
+func (h *WorkflowHandler) GetTaskWorkflow(w http.ResponseWriter, r *http.Request) {
+	status, wf, err := taskWorkflow(mux.Vars(r)["id"])
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   status,
+		"category": wf.category(status),
+		"next":     wf.next(status),
+		"workflow": wf,
+	})
+}
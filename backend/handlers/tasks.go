@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alghanim/agentboard/backend/db"
@@ -167,8 +168,17 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	team := ""
+	if task.Team != nil {
+		team = *task.Team
+	}
+	wf := loadWorkflows().workflowFor("", team)
 	if task.Status == "" {
-		task.Status = "todo"
+		task.Status = wf.InitialStatus
+	}
+	if wf.status(task.Status) == nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Status %q is not part of workflow %q", task.Status, wf.Name))
+		return
 	}
 	if task.Priority == "" {
 		task.Priority = "medium"
@@ -189,8 +199,10 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logActivity(getAgentFromContext(r), "task_created", task.ID, map[string]string{"title": task.Title})
+	actor := getAgentFromContext(r)
+	logActivity(actor, "task_created", task.ID, map[string]string{"title": task.Title})
 	h.Hub.Broadcast("task_created", task)
+	go TriggerWebhooks(EventTaskCreated, map[string]interface{}{"task": task, "actor": actor})
 
 	respondJSON(w, http.StatusCreated, task)
 }
@@ -207,13 +219,33 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	}
 	task.ID = id
 
+	currentStatus, wf, err := taskWorkflow(id)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if wf.status(task.Status) == nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Status %q is not part of workflow %q", task.Status, wf.Name))
+		return
+	}
+	// A status change goes through the workflow like POST .../transition;
+	// refuse a move the workflow lacks before touching the other fields
+	if task.Status != currentStatus && wf.transition(currentStatus, task.Status) == nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid status transition %s → %s (allowed: %s)",
+			currentStatus, task.Status, strings.Join(wf.next(currentStatus), ", ")))
+		return
+	}
+
 	result, err := db.DB.Exec(
-		`UPDATE tasks SET title=$1, description=$2, status=$3, priority=$4,
-		 assignee=$5, team=$6, due_date=$7, parent_task_id=$8, labels=$9,
-		 updated_at=NOW(),
-		 completed_at = CASE WHEN $3 = 'done' THEN COALESCE(completed_at, NOW()) ELSE completed_at END
-		 WHERE id=$10`,
-		task.Title, models.PtrToNullString(task.Description), task.Status, task.Priority,
+		`UPDATE tasks SET title=$1, description=$2, priority=$3,
+		 assignee=$4, team=$5, due_date=$6, parent_task_id=$7, labels=$8,
+		 updated_at=NOW()
+		 WHERE id=$9`,
+		task.Title, models.PtrToNullString(task.Description), task.Priority,
 		models.PtrToNullString(task.Assignee), models.PtrToNullString(task.Team),
 		models.PtrToNullTime(task.DueDate), models.PtrToNullString(task.ParentTaskID),
 		pq.Array(task.Labels), id,
@@ -227,8 +259,17 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logActivity(getAgentFromContext(r), "task_updated", id, map[string]string{"status": task.Status})
+	actor := getAgentFromContext(r)
+	if task.Status != currentStatus {
+		// Guards see the fields saved above
+		if code, err := moveTask(h.Hub, r, id, task.Status, actor, 0); err != nil {
+			respondError(w, code, err.Error())
+			return
+		}
+	}
+	logActivity(actor, "task_updated", id, map[string]string{"status": task.Status})
 	h.Hub.Broadcast("task_updated", task)
+	go TriggerWebhooks(EventTaskUpdated, map[string]interface{}{"task": task, "actor": actor})
 
 	respondJSON(w, http.StatusOK, task)
 }
@@ -237,18 +278,66 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	result, err := db.DB.Exec(`DELETE FROM tasks WHERE id = $1`, id)
+	tx, err := db.DB.Begin()
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if n, _ := result.RowsAffected(); n == 0 {
+	defer tx.Rollback()
+
+	var title string
+	var wasDone bool
+	err = tx.QueryRow(`DELETE FROM tasks WHERE id = $1 RETURNING title, status IN `+sqlStatusList(StatusDone), id).Scan(&title, &wasDone)
+	if err == sql.ErrNoRows {
 		respondError(w, http.StatusNotFound, "Task not found")
 		return
 	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Drop the deleted task, and subtasks deleted with it, from other
+	// tasks' dependencies
+	var dependents []string
+	rows, err := tx.Query(`
+		UPDATE tasks t SET depends_on = ARRAY(
+		    SELECT d.id FROM unnest(t.depends_on) WITH ORDINALITY AS d(id, n)
+		    WHERE EXISTS (SELECT 1 FROM tasks x WHERE x.id = d.id)
+		    ORDER BY d.n)
+		WHERE EXISTS (
+		    SELECT 1 FROM unnest(t.depends_on) AS d(id)
+		    WHERE NOT EXISTS (SELECT 1 FROM tasks x WHERE x.id = d.id))
+		RETURNING t.id`)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for rows.Next() {
+		var dep string
+		if rows.Scan(&dep) == nil {
+			dependents = append(dependents, dep)
+		}
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Tasks that were only waiting on this one are now free; a finished
+	// task was holding nothing up, so its dependents stay where they are
+	if !wasDone {
+		go func() {
+			for _, dep := range dependents {
+				releaseTask(h.Hub, dep, 0)
+			}
+		}()
+	}
 
-	logActivity(getAgentFromContext(r), "task_deleted", id, nil)
+	actor := getAgentFromContext(r)
+	logActivity(actor, "task_deleted", id, nil)
 	h.Hub.Broadcast("task_deleted", map[string]string{"id": id})
+	go TriggerWebhooks(EventTaskDeleted, map[string]interface{}{"task_id": id, "title": title, "actor": actor})
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Task deleted"})
 }
@@ -265,17 +354,37 @@ func (h *TaskHandler) AssignTask(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	// Agent-bound keys may only claim tasks for their own agent
+	if agent := GetBoundAgent(r); agent != "" && data.Assignee != agent {
+		respondError(w, http.StatusForbidden, "API key is bound to agent "+agent)
+		return
+	}
 
-	if _, err := db.DB.Exec(`UPDATE tasks SET assignee = $1 WHERE id = $2`, data.Assignee, id); err != nil {
+	var previous string
+	err := db.DB.QueryRow(
+		`UPDATE tasks t SET assignee = $1 FROM tasks old
+		 WHERE t.id = $2 AND old.id = t.id
+		 RETURNING COALESCE(old.assignee, '')`, data.Assignee, id).Scan(&previous)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	// Update agent's current task if they exist in DB
 	db.DB.Exec(`UPDATE agents SET current_task_id = $1::uuid WHERE id = $2`, id, data.Assignee)
+	// A manual reassignment ends another agent's queue lease
+	db.DB.Exec(`DELETE FROM task_leases WHERE task_id = $1 AND agent_id <> $2`, id, data.Assignee)
 
-	logActivity(getAgentFromContext(r), "task_assigned", id, map[string]string{"assignee": data.Assignee})
+	actor := getAgentFromContext(r)
+	logActivity(actor, "task_assigned", id, map[string]string{"assignee": data.Assignee})
 	h.Hub.Broadcast("task_assigned", map[string]string{"task_id": id, "assignee": data.Assignee})
+	go TriggerWebhooks(EventTaskAssigned, map[string]interface{}{
+		"task_id": id, "assignee": data.Assignee, "previous_assignee": previous, "actor": actor,
+	})
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Task assigned"})
 }
@@ -293,90 +402,110 @@ func (h *TaskHandler) TransitionTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	validTransitions := map[string][]string{
-		"todo":     {"progress", "backlog"},
-		"backlog":  {"todo", "next"},
-		"next":     {"progress"},
-		"progress": {"review", "blocked", "todo"},
-		"review":   {"done", "progress"},
-		"blocked":  {"todo", "progress"},
-		"done":     {},
+	if code, err := moveTask(h.Hub, r, id, data.Status, getAgentFromContext(r), 0); err != nil {
+		respondError(w, code, err.Error())
+		return
 	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Task status updated"})
+}
 
-	var currentStatus string
-	if err := db.DB.QueryRow(`SELECT status FROM tasks WHERE id = $1`, id).Scan(&currentStatus); err != nil {
-		respondError(w, http.StatusNotFound, "Task not found")
-		return
+// moveTask moves a task to status if its workflow allows it, then records
+// history and fires notifications, workflow rules and webhooks. r is nil for
+// system moves (workflow rules, the scheduler), which skip role guards.
+// ruleDepth counts how many rule-triggered moves led here, to stop loops.
+// On failure it returns the HTTP status to report.
+func moveTask(hub *websocket.Hub, r *http.Request, id, status, changedBy string, ruleDepth int) (int, error) {
+	currentStatus, wf, err := taskWorkflow(id)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, fmt.Errorf("Task not found")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
 	}
 
-	valid := false
-	for _, s := range validTransitions[currentStatus] {
-		if s == data.Status {
-			valid = true
-			break
+	if wf.status(status) == nil {
+		return http.StatusBadRequest, fmt.Errorf("Status %q is not part of workflow %q", status, wf.Name)
+	}
+	if status != currentStatus {
+		rule := wf.transition(currentStatus, status)
+		if rule == nil {
+			return http.StatusBadRequest, fmt.Errorf("Invalid status transition %s → %s (allowed: %s)",
+				currentStatus, status, strings.Join(wf.next(currentStatus), ", "))
+		}
+		if code, msg := checkGuards(r, id, rule.Guards); code != 0 {
+			return code, fmt.Errorf("%s", msg)
 		}
 	}
-	if !valid && data.Status != currentStatus {
-		respondError(w, http.StatusBadRequest, "Invalid status transition")
-		return
+	category := wf.category(status)
+	if category == StatusActive && wf.category(currentStatus) != StatusActive {
+		if code, err := checkDependenciesForStart(id); err != nil {
+			return code, err
+		}
 	}
 
 	if _, err := db.DB.Exec(
 		`UPDATE tasks SET
 		   status = $1,
 		   updated_at = NOW(),
-		   completed_at = CASE WHEN $1 = 'done' THEN COALESCE(completed_at, NOW()) ELSE completed_at END
+		   completed_at = CASE WHEN $3 THEN COALESCE(completed_at, NOW()) ELSE NULL END
 		 WHERE id = $2`,
-		data.Status, id,
+		status, id, category == StatusDone,
 	); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
-		return
+		return http.StatusInternalServerError, err
 	}
 
 	// Record status transition in task_history
-	changedBy := getAgentFromContext(r)
 	_, _ = db.DB.Exec(`
 		INSERT INTO task_history (task_id, from_status, to_status, changed_by, changed_at)
 		VALUES ($1, $2, $3, $4, NOW())`,
-		id, currentStatus, data.Status, changedBy)
+		id, currentStatus, status, changedBy)
 
 	logActivity(changedBy, "task_transitioned", id, map[string]string{
-		"from": currentStatus, "to": data.Status,
+		"from": currentStatus, "to": status,
 	})
 	go LogAudit(changedBy, "task_transitioned", "task", id, map[string]interface{}{
-		"from": currentStatus, "to": data.Status,
+		"from": currentStatus, "to": status,
 	})
-	h.Hub.Broadcast("task_transitioned", map[string]string{"task_id": id, "status": data.Status})
+	if hub != nil {
+		hub.Broadcast("task_transitioned", map[string]string{"task_id": id, "status": status})
+	}
 
 	// Notify assignee on blocked/done transitions
-	if data.Status == "blocked" || data.Status == "done" {
+	if category == StatusBlocked || category == StatusDone {
 		var assignee string
 		if err := db.DB.QueryRow(`SELECT COALESCE(assignee, '') FROM tasks WHERE id = $1`, id).Scan(&assignee); err == nil && assignee != "" {
-			go CreateNotificationInternal(assignee, "task_"+data.Status, "Task "+data.Status, fmt.Sprintf("Task %s moved to %s", id, data.Status))
+			go CreateNotificationInternal(assignee, "task_"+status, "Task "+status, fmt.Sprintf("Task %s moved to %s", id, status))
 		}
 	}
 
-	// Apply workflow rules from templates
-	go applyWorkflowRules(id, currentStatus, data.Status)
+	// Run workflow rules for this transition
+	go runWorkflowRules(hub, id, currentStatus, status, ruleDepth)
+
+	// Release tasks that were only waiting on this one; finished work
+	// needs no lease
+	if category == StatusDone {
+		db.DB.Exec(`DELETE FROM task_leases WHERE task_id = $1`, id)
+		go releaseDependents(hub, id, ruleDepth)
+	}
 
 	// Trigger webhooks for terminal task statuses
-	if data.Status == "done" {
-		go TriggerWebhooks("task_done", map[string]interface{}{
-			"task_id": id, "changed_by": changedBy,
+	if category == StatusDone {
+		go TriggerWebhooks(EventTaskDone, map[string]interface{}{
+			"task_id": id, "from_status": currentStatus, "changed_by": changedBy,
 		})
-	} else if data.Status == "blocked" {
-		go TriggerWebhooks("task_failed", map[string]interface{}{
-			"task_id": id, "changed_by": changedBy,
+	} else if category == StatusBlocked {
+		go TriggerWebhooks(EventTaskFailed, map[string]interface{}{
+			"task_id": id, "from_status": currentStatus, "changed_by": changedBy,
 		})
 	}
-
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Task status updated"})
+	return http.StatusOK, nil
 }
 
-// isStuck returns true if the task has been in-progress (status="progress")
-// for more than 2 hours without an update.
+// isStuck returns true if the task has sat in an active workflow status
+// longer than that status's stuck threshold without an update.
 func isStuck(task models.Task) bool {
-	return task.Status == "progress" && task.UpdatedAt.Before(time.Now().Add(-2*time.Hour))
+	threshold, ok := stuckThresholds()[task.Status]
+	return ok && task.UpdatedAt.Before(time.Now().Add(-threshold))
 }
 
 // GetStuckTasks handles GET /api/tasks/stuck
@@ -385,8 +514,7 @@ func (h *TaskHandler) GetStuckTasks(w http.ResponseWriter, r *http.Request) {
 		SELECT id, title, description, status, priority, assignee, team,
 		       due_date, created_at, updated_at, completed_at, parent_task_id, labels
 		FROM tasks
-		WHERE status = 'progress'
-		  AND updated_at < NOW() - INTERVAL '2 hours'
+		WHERE ` + sqlStuckCondition() + `
 		ORDER BY updated_at ASC
 	`)
 	if err != nil {
@@ -3,7 +3,10 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/alghanim/agentboard/backend/db"
@@ -20,15 +23,19 @@ type TaskTemplate struct {
 	DefaultPriority string          `json:"default_priority"`
 	Checklist       json.RawMessage `json:"checklist"`
 	WorkflowRules   json.RawMessage `json:"workflow_rules"`
+	WorkflowID      *string         `json:"workflow_id,omitempty"` // task workflow for tasks created from this template
 	CreatedAt       time.Time       `json:"created_at"`
 	UpdatedAt       time.Time       `json:"updated_at"`
 }
 
 func scanTemplate(scanner interface{ Scan(...interface{}) error }) (TaskTemplate, error) {
 	var t TaskTemplate
-	var desc, assignee sql.NullString
+	var desc, assignee, workflowID sql.NullString
 	err := scanner.Scan(&t.ID, &t.Name, &desc, &assignee, &t.DefaultPriority,
-		&t.Checklist, &t.WorkflowRules, &t.CreatedAt, &t.UpdatedAt)
+		&t.Checklist, &t.WorkflowRules, &workflowID, &t.CreatedAt, &t.UpdatedAt)
+	if workflowID.Valid {
+		t.WorkflowID = &workflowID.String
+	}
 	if desc.Valid {
 		t.Description = &desc.String
 	}
@@ -38,7 +45,7 @@ func scanTemplate(scanner interface{ Scan(...interface{}) error }) (TaskTemplate
 	return t, err
 }
 
-const templateCols = `id, name, description, default_assignee, default_priority, checklist, workflow_rules, created_at, updated_at`
+const templateCols = `id, name, description, default_assignee, default_priority, checklist, workflow_rules, workflow_id, created_at, updated_at`
 
 // ListTemplates handles GET /api/templates
 func (h *TemplateHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
@@ -86,6 +93,7 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 		DefaultPriority string          `json:"default_priority"`
 		Checklist       json.RawMessage `json:"checklist"`
 		WorkflowRules   json.RawMessage `json:"workflow_rules"`
+		WorkflowID      *string         `json:"workflow_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, 400, "invalid JSON")
@@ -104,18 +112,24 @@ func (h *TemplateHandler) CreateTemplate(w http.ResponseWriter, r *http.Request)
 	if req.WorkflowRules == nil {
 		req.WorkflowRules = json.RawMessage(`[]`)
 	}
+	if !validTemplateRules(w, req.WorkflowRules) {
+		return
+	}
 
 	var id string
 	var createdAt time.Time
 	err := db.DB.QueryRow(
-		`INSERT INTO task_templates (name, description, default_assignee, default_priority, checklist, workflow_rules)
-		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
-		req.Name, req.Description, req.DefaultAssignee, req.DefaultPriority, req.Checklist, req.WorkflowRules,
+		`INSERT INTO task_templates (name, description, default_assignee, default_priority, checklist, workflow_rules, workflow_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::uuid) RETURNING id, created_at`,
+		req.Name, req.Description, req.DefaultAssignee, req.DefaultPriority, req.Checklist, req.WorkflowRules, req.WorkflowID,
 	).Scan(&id, &createdAt)
 	if err != nil {
 		respondError(w, 500, err.Error())
 		return
 	}
+	if err := syncTemplateRules(id, req.WorkflowRules); err != nil {
+		log.Printf("[templates] syncing workflow rules for %s: %v", id, err)
+	}
 	respondJSON(w, 201, map[string]interface{}{"id": id, "name": req.Name, "created_at": createdAt})
 }
 
@@ -129,16 +143,36 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 		DefaultPriority string          `json:"default_priority"`
 		Checklist       json.RawMessage `json:"checklist"`
 		WorkflowRules   json.RawMessage `json:"workflow_rules"`
+		WorkflowID      *string         `json:"workflow_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, 400, "invalid JSON")
 		return
 	}
+	if !validTemplateRules(w, req.WorkflowRules) {
+		return
+	}
+	newWF := ""
+	if req.WorkflowID != nil {
+		newWF = *req.WorkflowID
+	}
+	set := loadWorkflows()
+	stranded := strandedStatuses(`t.template_id = $1`, id, func(templateWF, team string) *Workflow {
+		from, to := set.workflowFor(templateWF, team), set.workflowFor(newWF, team)
+		if from.ID == to.ID {
+			return nil
+		}
+		return to
+	})
+	if len(stranded) > 0 {
+		respondError(w, 409, "the template's tasks use statuses the new workflow lacks: "+strings.Join(stranded, ", "))
+		return
+	}
 
 	result, err := db.DB.Exec(
 		`UPDATE task_templates SET name=$1, description=$2, default_assignee=$3, default_priority=$4,
-		 checklist=$5, workflow_rules=$6, updated_at=NOW() WHERE id=$7`,
-		req.Name, req.Description, req.DefaultAssignee, req.DefaultPriority, req.Checklist, req.WorkflowRules, id,
+		 checklist=$5, workflow_rules=$6, workflow_id=NULLIF($8, '')::uuid, updated_at=NOW() WHERE id=$7`,
+		req.Name, req.Description, req.DefaultAssignee, req.DefaultPriority, req.Checklist, req.WorkflowRules, id, req.WorkflowID,
 	)
 	if err != nil {
 		respondError(w, 500, err.Error())
@@ -148,9 +182,34 @@ func (h *TemplateHandler) UpdateTemplate(w http.ResponseWriter, r *http.Request)
 		respondError(w, 404, "template not found")
 		return
 	}
+	if err := syncTemplateRules(id, req.WorkflowRules); err != nil {
+		log.Printf("[templates] syncing workflow rules for %s: %v", id, err)
+	}
 	respondJSON(w, 200, map[string]string{"message": "template updated"})
 }
 
+// validTemplateRules rejects workflow_rules that aren't a list of
+// from_status/to_status/action/target rules.
+func validTemplateRules(w http.ResponseWriter, raw json.RawMessage) bool {
+	if len(raw) == 0 {
+		return true
+	}
+	var rules []legacyTemplateRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		respondError(w, 400, "workflow_rules must be a list of rules: "+err.Error())
+		return false
+	}
+	for i, rule := range rules {
+		switch rule.Action {
+		case "assign", "notify", "create_subtask":
+		default:
+			respondError(w, 400, fmt.Sprintf("workflow_rules[%d]: action must be assign, notify or create_subtask", i))
+			return false
+		}
+	}
+	return true
+}
+
 // DeleteTemplate handles DELETE /api/templates/{id}
 func (h *TemplateHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
@@ -203,11 +262,7 @@ func (h *TemplateHandler) InstantiateTemplate(w http.ResponseWriter, r *http.Req
 		priority = *overrides.Priority
 	}
 
-	var taskID string
-	err = db.DB.QueryRow(
-		`INSERT INTO tasks (title, description, status, priority, assignee) VALUES ($1, $2, 'todo', $3, $4) RETURNING id`,
-		title, tmpl.Description, priority, assignee,
-	).Scan(&taskID)
+	taskID, err := instantiateTemplate(db.DB, &tmpl, title, tmpl.Description, assignee, priority)
 	if err != nil {
 		respondError(w, 500, err.Error())
 		return
@@ -215,3 +270,21 @@ func (h *TemplateHandler) InstantiateTemplate(w http.ResponseWriter, r *http.Req
 
 	respondJSON(w, 201, map[string]string{"task_id": taskID, "template_id": id})
 }
+
+// instantiateTemplate creates a task from tmpl in its workflow's initial status.
+func instantiateTemplate(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, tmpl *TaskTemplate, title string, description, assignee *string, priority string) (string, error) {
+	templateWF := ""
+	if tmpl.WorkflowID != nil {
+		templateWF = *tmpl.WorkflowID
+	}
+	wf := loadWorkflows().workflowFor(templateWF, "")
+
+	var taskID string
+	err := q.QueryRow(
+		`INSERT INTO tasks (title, description, status, priority, assignee, template_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		title, description, wf.InitialStatus, priority, assignee, tmpl.ID,
+	).Scan(&taskID)
+	return taskID, err
+}
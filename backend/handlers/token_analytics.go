@@ -1,17 +1,14 @@
 package handlers
 
 import (
-	"bufio"
 	"encoding/json"
 	"net/http"
-	"os"
-	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/alghanim/agentboard/backend/config"
+	"github.com/alghanim/agentboard/backend/db"
 )
 
 // Model pricing per 1M tokens
@@ -20,185 +17,186 @@ var modelPricing = map[string]struct{ In, Out float64 }{
 	"anthropic/claude-opus-4-6":   {15.0, 75.0},
 	"google/gemini-2.5-pro":       {1.25, 10.0},
 	"google/gemini-2.5-flash":     {0.075, 0.30},
-	"anthropic/claude-haiku-3.5":    {0.80, 4.0},
-	"anthropic/claude-sonnet-3.5":    {3.0, 15.0},
-	"openai/gpt-4o":                  {2.50, 10.0},
-	"openai/gpt-4o-mini":             {0.15, 0.60},
-	"openai/o1":                      {15.0, 60.0},
-	"openai/o1-mini":                 {3.0, 12.0},
-	"openai/o3-mini":                 {1.10, 4.40},
-	"google/gemini-2.0-flash":        {0.075, 0.30},
-	"deepseek/deepseek-chat":         {0.14, 0.28},
-	"deepseek/deepseek-reasoner":     {0.55, 2.19},
+	"anthropic/claude-haiku-3.5":  {0.80, 4.0},
+	"anthropic/claude-sonnet-3.5": {3.0, 15.0},
+	"openai/gpt-4o":               {2.50, 10.0},
+	"openai/gpt-4o-mini":          {0.15, 0.60},
+	"openai/o1":                   {15.0, 60.0},
+	"openai/o1-mini":              {3.0, 12.0},
+	"openai/o3-mini":              {1.10, 4.40},
+	"google/gemini-2.0-flash":     {0.075, 0.30},
+	"deepseek/deepseek-chat":      {0.14, 0.28},
+	"deepseek/deepseek-reasoner":  {0.55, 2.19},
 }
 
 // tokenMessage represents a single assistant message with usage data from JSONL
 type tokenMessage struct {
-	Timestamp time.Time
-	Model     string
-	AgentID   string
-	Input     int64
-	Output    int64
-	CacheRead int64
-	CacheWrite int64
-	TotalTokens int64
-	CostTotal float64
+	Timestamp    time.Time
+	Model        string
+	AgentID      string
+	Input        int64
+	Output       int64
+	CacheRead    int64
+	CacheWrite   int64
+	TotalTokens  int64
+	CostTotal    float64 // ReportedCost, or priced from modelPricing if none
+	ReportedCost float64
 }
 
-// parseAllTokenData scans all agent JSONL session files and extracts token usage
-func parseAllTokenData() []tokenMessage {
-	openClawDir := config.GetOpenClawDir()
-	agentsDir := filepath.Join(openClawDir, "agents")
+// tokenSpend is an agent's indexed token usage over some window.
+type tokenSpend struct {
+	Tokens int64
+	Cost   float64
+}
 
-	entries, err := os.ReadDir(agentsDir)
+// tokenSpendByAgent sums indexed tokens and cost per agent since since,
+// optionally for one agent only.
+func tokenSpendByAgent(since time.Time, agentID string) (map[string]tokenSpend, error) {
+	rows, err := db.DB.Query(`
+		SELECT agent_id, SUM(total_tokens), SUM(cost_usd)
+		FROM token_usage
+		WHERE ts >= $1 AND ($2 = '' OR agent_id = $2)
+		GROUP BY agent_id
+	`, since, agentID)
 	if err != nil {
-		return nil
+		return nil, err
 	}
-
-	var allMessages []tokenMessage
-
-	for _, agentEntry := range entries {
-		if !agentEntry.IsDir() {
-			continue
-		}
-		agentID := agentEntry.Name()
-		sessionsDir := filepath.Join(agentsDir, agentID, "sessions")
-
-		sessionFiles, err := os.ReadDir(sessionsDir)
-		if err != nil {
-			continue
-		}
-
-		for _, sf := range sessionFiles {
-			if !strings.HasSuffix(sf.Name(), ".jsonl") {
-				continue
-			}
-
-			msgs := parseJSONLFile(filepath.Join(sessionsDir, sf.Name()), agentID)
-			allMessages = append(allMessages, msgs...)
-		}
+	defer rows.Close()
+	out := map[string]tokenSpend{}
+	for rows.Next() {
+		var agent string
+		var s tokenSpend
+		if err := rows.Scan(&agent, &s.Tokens, &s.Cost); err != nil {
+			return nil, err
+		}
+		out[agent] = s
 	}
-
-	return allMessages
+	return out, rows.Err()
 }
 
-func parseJSONLFile(path, agentID string) []tokenMessage {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil
+// responseGapsSQL selects agent_id, ts and gap for assistant messages since
+// $1: gap is the seconds since the agent's previous message. Gaps of 10
+// minutes or more are idle time, not response time, and are left out.
+const responseGapsSQL = `
+	SELECT agent_id, ts, gap FROM (
+		SELECT agent_id, ts,
+		       EXTRACT(EPOCH FROM ts - LAG(ts) OVER (PARTITION BY agent_id ORDER BY ts))::float8 AS gap
+		FROM token_usage
+		WHERE ts >= $1::timestamptz - INTERVAL '10 minutes'
+	) g
+	WHERE ts >= $1 AND gap > 0 AND gap < 600`
+
+// parseTokenLine extracts the usage of an assistant message from a session
+// JSONL line.
+func parseTokenLine(line []byte, agentID string) (tokenMessage, bool) {
+	var msg tokenMessage
+	var entry map[string]interface{}
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return msg, false
 	}
-	defer f.Close()
 
-	var messages []tokenMessage
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // 1MB buffer
-
-	for scanner.Scan() {
-		var entry map[string]interface{}
-		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
-			continue
-		}
-
-		// Only assistant messages have usage data
-		if entry["type"] != "message" {
-			continue
-		}
-
-		// Usage is nested inside entry["message"]["usage"]
-		innerMsg, _ := entry["message"].(map[string]interface{})
-		if innerMsg == nil {
-			continue
-		}
-		// Only count assistant messages (they carry usage/cost)
-		if role, _ := innerMsg["role"].(string); role != "assistant" {
-			continue
-		}
-		usage, ok := innerMsg["usage"].(map[string]interface{})
-		if !ok {
-			continue
-		}
+	// Only assistant messages have usage data
+	if entry["type"] != "message" {
+		return msg, false
+	}
 
-		var msg tokenMessage
-		msg.AgentID = agentID
+	// Usage is nested inside entry["message"]["usage"]
+	innerMsg, _ := entry["message"].(map[string]interface{})
+	if innerMsg == nil {
+		return msg, false
+	}
+	// Only count assistant messages (they carry usage/cost)
+	if role, _ := innerMsg["role"].(string); role != "assistant" {
+		return msg, false
+	}
+	usage, ok := innerMsg["usage"].(map[string]interface{})
+	if !ok {
+		return msg, false
+	}
 
-		// Parse timestamp (may be at top level or inside message)
-		tsStr := ""
-		if ts, ok := entry["timestamp"].(string); ok {
-			tsStr = ts
-		} else if ts, ok := innerMsg["timestamp"].(string); ok {
-			tsStr = ts
-		}
-		if tsStr != "" {
-			if t, err := time.Parse(time.RFC3339Nano, tsStr); err == nil {
-				msg.Timestamp = t
-			} else if t, err := time.Parse("2006-01-02T15:04:05.000Z", tsStr); err == nil {
-				msg.Timestamp = t
-			}
-		}
-		if msg.Timestamp.IsZero() {
-			msg.Timestamp = time.Now()
-		}
+	msg.AgentID = agentID
 
-		// Parse model (inside message)
-		if m, ok := innerMsg["model"].(string); ok {
-			msg.Model = m
+	// Parse timestamp (may be at top level or inside message)
+	tsStr := ""
+	if ts, ok := entry["timestamp"].(string); ok {
+		tsStr = ts
+	} else if ts, ok := innerMsg["timestamp"].(string); ok {
+		tsStr = ts
+	}
+	if tsStr != "" {
+		if t, err := time.Parse(time.RFC3339Nano, tsStr); err == nil {
+			msg.Timestamp = t
+		} else if t, err := time.Parse("2006-01-02T15:04:05.000Z", tsStr); err == nil {
+			msg.Timestamp = t
 		}
+	}
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
 
-		// Parse usage fields
-		if v, ok := usage["input"].(float64); ok {
-			msg.Input = int64(v)
-		}
-		if v, ok := usage["output"].(float64); ok {
-			msg.Output = int64(v)
-		}
-		if v, ok := usage["cacheRead"].(float64); ok {
-			msg.CacheRead = int64(v)
-		}
-		if v, ok := usage["cacheWrite"].(float64); ok {
-			msg.CacheWrite = int64(v)
-		}
-		if v, ok := usage["totalTokens"].(float64); ok {
-			msg.TotalTokens = int64(v)
-		}
+	// Parse model (inside message)
+	if m, ok := innerMsg["model"].(string); ok {
+		msg.Model = m
+	}
 
-		// Parse cost
-		if cost, ok := usage["cost"].(map[string]interface{}); ok {
-			if v, ok := cost["total"].(float64); ok {
-				msg.CostTotal = v
-			}
-		}
+	// Parse usage fields
+	if v, ok := usage["input"].(float64); ok {
+		msg.Input = int64(v)
+	}
+	if v, ok := usage["output"].(float64); ok {
+		msg.Output = int64(v)
+	}
+	if v, ok := usage["cacheRead"].(float64); ok {
+		msg.CacheRead = int64(v)
+	}
+	if v, ok := usage["cacheWrite"].(float64); ok {
+		msg.CacheWrite = int64(v)
+	}
+	if v, ok := usage["totalTokens"].(float64); ok {
+		msg.TotalTokens = int64(v)
+	}
 
-		// If no cost from JSONL, calculate from model pricing
-		if msg.CostTotal == 0 && msg.Model != "" {
-			msg.CostTotal = calcModelCost(msg.Model, msg.Input+msg.CacheRead+msg.CacheWrite, msg.Output)
+	// Parse cost
+	if cost, ok := usage["cost"].(map[string]interface{}); ok {
+		if v, ok := cost["total"].(float64); ok {
+			msg.ReportedCost = v
 		}
-
-		messages = append(messages, msg)
 	}
+	msg.CostTotal = msg.ReportedCost
 
-	return messages
+	// If no cost from JSONL, calculate from model pricing
+	if msg.CostTotal == 0 && msg.Model != "" {
+		msg.CostTotal = calcModelCost(msg.Model, msg.Input+msg.CacheRead+msg.CacheWrite, msg.Output)
+	}
+	return msg, true
 }
 
-func calcModelCost(model string, input, output int64) float64 {
+// modelRates returns the per-1M-token pricing of model.
+func modelRates(model string) struct{ In, Out float64 } {
 	// Try exact match first
 	if p, ok := modelPricing[model]; ok {
-		return (float64(input)/1e6)*p.In + (float64(output)/1e6)*p.Out
+		return p
 	}
 	// Fuzzy match
 	for k, p := range modelPricing {
 		if strings.Contains(model, strings.Split(k, "/")[len(strings.Split(k, "/"))-1]) {
-			return (float64(input)/1e6)*p.In + (float64(output)/1e6)*p.Out
+			return p
 		}
 	}
 	// Default to sonnet pricing
-	return (float64(input)/1e6)*3.0 + (float64(output)/1e6)*15.0
+	return struct{ In, Out float64 }{3.0, 15.0}
+}
+
+func calcModelCost(model string, input, output int64) float64 {
+	p := modelRates(model)
+	return (float64(input)/1e6)*p.In + (float64(output)/1e6)*p.Out
 }
 
+// tokenDay is the UTC calendar day of a token_usage row.
+const tokenDay = `to_char(ts AT TIME ZONE 'UTC', 'YYYY-MM-DD')`
+
 // GetTokens handles GET /api/analytics/tokens — per-agent token usage
 func (h *AnalyticsHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
-	allMsgs := parseAllTokenData()
-
-	// Aggregate per agent
 	type agentUsage struct {
 		AgentID     string  `json:"agent_id"`
 		Name        string  `json:"name"`
@@ -208,37 +206,48 @@ func (h *AnalyticsHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
 		CostUSD     float64 `json:"cost_usd"`
 	}
 
-	agentMap := make(map[string]*agentUsage)
-	for _, msg := range allMsgs {
-		au, ok := agentMap[msg.AgentID]
-		if !ok {
-			au = &agentUsage{AgentID: msg.AgentID, Name: msg.AgentID}
-			agentMap[msg.AgentID] = au
-		}
-		au.TokensIn += msg.Input + msg.CacheRead + msg.CacheWrite
-		au.TokensOut += msg.Output
-		au.TotalTokens += msg.TotalTokens
-		au.CostUSD += msg.CostTotal
+	rows, err := db.DB.Query(`
+		SELECT agent_id, SUM(input_tokens + cache_read_tokens + cache_write_tokens), SUM(output_tokens),
+		       SUM(total_tokens), SUM(cost_usd)
+		FROM token_usage
+		GROUP BY agent_id
+		ORDER BY 5 DESC
+	`)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
+	defer rows.Close()
 
-	// Resolve display names from config
-	for _, ca := range config.GetAgents() {
-		if au, ok := agentMap[ca.ID]; ok {
-			au.Name = ca.Name
+	names := agentDisplayNames()
+	results := []agentUsage{}
+	for rows.Next() {
+		var au agentUsage
+		if err := rows.Scan(&au.AgentID, &au.TokensIn, &au.TokensOut, &au.TotalTokens, &au.CostUSD); err != nil {
+			continue
 		}
+		au.Name = names(au.AgentID)
+		results = append(results, au)
 	}
 
-	results := make([]agentUsage, 0, len(agentMap))
-	for _, au := range agentMap {
-		results = append(results, *au)
-	}
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].CostUSD > results[j].CostUSD
-	})
-
 	respondJSON(w, http.StatusOK, results)
 }
 
+// agentDisplayNames returns a lookup of configured agent names that falls
+// back to the agent ID.
+func agentDisplayNames() func(string) string {
+	names := map[string]string{}
+	for _, ca := range config.GetAgents() {
+		names[ca.ID] = ca.Name
+	}
+	return func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return id
+	}
+}
+
 // GetTokensTimeline handles GET /api/analytics/tokens/timeline — daily token usage
 func (h *AnalyticsHandler) GetTokensTimeline(w http.ResponseWriter, r *http.Request) {
 	daysStr := r.URL.Query().Get("days")
@@ -250,43 +259,41 @@ func (h *AnalyticsHandler) GetTokensTimeline(w http.ResponseWriter, r *http.Requ
 	}
 
 	agentFilter := r.URL.Query().Get("agent")
-
-	allMsgs := parseAllTokenData()
 	cutoff := time.Now().AddDate(0, 0, -days)
 
 	type dailyUsage struct {
-		Date     string  `json:"date"`
-		TokensIn int64   `json:"tokens_in"`
-		TokensOut int64  `json:"tokens_out"`
-		CostUSD  float64 `json:"cost_usd"`
+		Date      string  `json:"date"`
+		TokensIn  int64   `json:"tokens_in"`
+		TokensOut int64   `json:"tokens_out"`
+		CostUSD   float64 `json:"cost_usd"`
 	}
 
-	dayMap := make(map[string]*dailyUsage)
+	rows, err := db.DB.Query(`
+		SELECT `+tokenDay+`, SUM(input_tokens + cache_read_tokens + cache_write_tokens), SUM(output_tokens), SUM(cost_usd)
+		FROM token_usage
+		WHERE ts >= $1 AND ($2 = '' OR agent_id = $2)
+		GROUP BY 1
+	`, cutoff, agentFilter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
 
-	for _, msg := range allMsgs {
-		if msg.Timestamp.Before(cutoff) {
-			continue
-		}
-		if agentFilter != "" && msg.AgentID != agentFilter {
-			continue
-		}
-		dateStr := msg.Timestamp.Format("2006-01-02")
-		du, ok := dayMap[dateStr]
-		if !ok {
-			du = &dailyUsage{Date: dateStr}
-			dayMap[dateStr] = du
+	dayMap := make(map[string]dailyUsage)
+	for rows.Next() {
+		var du dailyUsage
+		if err := rows.Scan(&du.Date, &du.TokensIn, &du.TokensOut, &du.CostUSD); err == nil {
+			dayMap[du.Date] = du
 		}
-		du.TokensIn += msg.Input + msg.CacheRead + msg.CacheWrite
-		du.TokensOut += msg.Output
-		du.CostUSD += msg.CostTotal
 	}
 
 	// Fill in missing days
 	results := make([]dailyUsage, 0, days)
 	for d := 0; d < days; d++ {
-		date := time.Now().AddDate(0, 0, -days+1+d).Format("2006-01-02")
+		date := time.Now().UTC().AddDate(0, 0, -days+1+d).Format("2006-01-02")
 		if du, ok := dayMap[date]; ok {
-			results = append(results, *du)
+			results = append(results, du)
 		} else {
 			results = append(results, dailyUsage{Date: date})
 		}
@@ -297,8 +304,6 @@ func (h *AnalyticsHandler) GetTokensTimeline(w http.ResponseWriter, r *http.Requ
 
 // GetCostSummary handles GET /api/analytics/cost/summary
 func (h *AnalyticsHandler) GetCostSummary(w http.ResponseWriter, r *http.Request) {
-	allMsgs := parseAllTokenData()
-
 	now := time.Now()
 	weekStart := now.AddDate(0, 0, -int(now.Weekday()))
 	weekStart = time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day(), 0, 0, 0, 0, now.Location())
@@ -306,37 +311,28 @@ func (h *AnalyticsHandler) GetCostSummary(w http.ResponseWriter, r *http.Request
 
 	var costThisWeek, costThisMonth, costAllTime float64
 	var tokensAllTime int64
-	agentCosts := make(map[string]float64)
-
-	for _, msg := range allMsgs {
-		costAllTime += msg.CostTotal
-		tokensAllTime += msg.TotalTokens
-		agentCosts[msg.AgentID] += msg.CostTotal
-
-		if !msg.Timestamp.Before(weekStart) {
-			costThisWeek += msg.CostTotal
-		}
-		if !msg.Timestamp.Before(monthStart) {
-			costThisMonth += msg.CostTotal
-		}
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(SUM(cost_usd) FILTER (WHERE ts >= $1), 0),
+		       COALESCE(SUM(cost_usd) FILTER (WHERE ts >= $2), 0),
+		       COALESCE(SUM(cost_usd), 0),
+		       COALESCE(SUM(total_tokens), 0)
+		FROM token_usage
+	`, weekStart, monthStart).Scan(&costThisWeek, &costThisMonth, &costAllTime, &tokensAllTime)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	// Find most expensive agent
 	var mostExpensiveAgent string
 	var mostExpensiveCost float64
-	for agentID, cost := range agentCosts {
-		if cost > mostExpensiveCost {
-			mostExpensiveCost = cost
-			mostExpensiveAgent = agentID
-		}
-	}
-
-	// Resolve display name
-	for _, ca := range config.GetAgents() {
-		if ca.ID == mostExpensiveAgent {
-			mostExpensiveAgent = ca.Name
-			break
-		}
+	db.DB.QueryRow(`
+		SELECT agent_id, SUM(cost_usd) FROM token_usage
+		GROUP BY agent_id HAVING SUM(cost_usd) > 0
+		ORDER BY 2 DESC LIMIT 1
+	`).Scan(&mostExpensiveAgent, &mostExpensiveCost)
+	if mostExpensiveAgent != "" {
+		mostExpensiveAgent = agentDisplayNames()(mostExpensiveAgent)
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -358,8 +354,6 @@ func (h *AnalyticsHandler) GetTokensByAgent(w http.ResponseWriter, r *http.Reque
 			days = v
 		}
 	}
-
-	allMsgs := parseAllTokenData()
 	cutoff := time.Now().AddDate(0, 0, -days)
 
 	type agentTokens struct {
@@ -372,36 +366,30 @@ func (h *AnalyticsHandler) GetTokensByAgent(w http.ResponseWriter, r *http.Reque
 		Messages  int     `json:"message_count"`
 	}
 
-	agentMap := make(map[string]*agentTokens)
-	for _, msg := range allMsgs {
-		if msg.Timestamp.Before(cutoff) {
-			continue
-		}
-		at, ok := agentMap[msg.AgentID]
-		if !ok {
-			at = &agentTokens{AgentID: msg.AgentID, Name: msg.AgentID}
-			agentMap[msg.AgentID] = at
-		}
-		at.TokensIn += msg.Input + msg.CacheRead + msg.CacheWrite
-		at.TokensOut += msg.Output
-		at.Total += msg.TotalTokens
-		at.CostUSD += msg.CostTotal
-		at.Messages++
+	rows, err := db.DB.Query(`
+		SELECT agent_id, SUM(input_tokens + cache_read_tokens + cache_write_tokens), SUM(output_tokens),
+		       SUM(total_tokens), SUM(cost_usd), COUNT(*)
+		FROM token_usage
+		WHERE ts >= $1
+		GROUP BY agent_id
+		ORDER BY 5 DESC
+	`, cutoff)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
+	defer rows.Close()
 
-	for _, ca := range config.GetAgents() {
-		if at, ok := agentMap[ca.ID]; ok {
-			at.Name = ca.Name
+	names := agentDisplayNames()
+	results := []agentTokens{}
+	for rows.Next() {
+		var at agentTokens
+		if err := rows.Scan(&at.AgentID, &at.TokensIn, &at.TokensOut, &at.Total, &at.CostUSD, &at.Messages); err != nil {
+			continue
 		}
+		at.Name = names(at.AgentID)
+		results = append(results, at)
 	}
 
-	results := make([]agentTokens, 0, len(agentMap))
-	for _, at := range agentMap {
-		results = append(results, *at)
-	}
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].CostUSD > results[j].CostUSD
-	})
-
 	respondJSON(w, http.StatusOK, results)
 }
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/config"
+	"github.com/alghanim/agentboard/backend/db"
+)
+
+// ─── Token index ─────────────────────────────────────────────────────────────
+//
+// Session JSONL files are append-only, so rather than re-reading them for
+// every request the indexer tails them into token_usage, one row per
+// assistant message. session_files remembers each file's inode and how far
+// it has been read; a pass only reads what was appended since. A file whose
+// inode changed or that shrank was replaced, so its rows are dropped and it
+// is read again from the start. Rows of deleted files are kept.
+//
+// Only complete lines are indexed. A last line without a newline is taken
+// if it parses, since a half-written one can't.
+
+const (
+	tokenIndexInterval = 15 * time.Second
+	tokenIndexBatch    = 500 // rows per insert, and per commit of a file's offset
+)
+
+var tokenIndex struct {
+	mu sync.Mutex // held for a whole pass or rebuild
+
+	state      sync.Mutex
+	lastRun    time.Time
+	lastTook   time.Duration
+	lastRows   int64
+	lastErr    string
+	rebuilding bool
+}
+
+// StartTokenIndexer keeps token_usage up to date with the session files.
+func StartTokenIndexer() {
+	log.Println("[tokens] Indexer started")
+	ticker := time.NewTicker(tokenIndexInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := indexTokenUsage(false); err != nil {
+			log.Printf("[tokens] Index error: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// RebuildTokenIndex brings token_usage in line with the current pricing.
+// Messages without a cost of their own are repriced from modelPricing; with
+// full, every session file is also read again from the start and rows of
+// files no longer on disk are dropped.
+func RebuildTokenIndex(full bool) (repriced, indexed int64, err error) {
+	tokenIndex.state.Lock()
+	tokenIndex.rebuilding = true
+	tokenIndex.state.Unlock()
+	defer func() {
+		tokenIndex.state.Lock()
+		tokenIndex.rebuilding = false
+		tokenIndex.state.Unlock()
+	}()
+
+	if full {
+		indexed, err = indexTokenUsage(true)
+		return 0, indexed, err
+	}
+	indexed, err = indexTokenUsage(false)
+	if err != nil {
+		return 0, indexed, err
+	}
+	tokenIndex.mu.Lock()
+	defer tokenIndex.mu.Unlock()
+	repriced, err = repriceTokenUsage()
+	return repriced, indexed, err
+}
+
+// repriceTokenUsage recomputes cost_usd for messages that didn't report a
+// cost, one model at a time.
+func repriceTokenUsage() (int64, error) {
+	rows, err := db.DB.Query(`SELECT DISTINCT model FROM token_usage WHERE reported_cost = 0 AND model <> ''`)
+	if err != nil {
+		return 0, err
+	}
+	var models []string
+	for rows.Next() {
+		var m string
+		if rows.Scan(&m) == nil {
+			models = append(models, m)
+		}
+	}
+	rows.Close()
+
+	var total int64
+	for _, m := range models {
+		p := modelRates(m)
+		res, err := db.DB.Exec(`
+			UPDATE token_usage
+			SET cost_usd = (input_tokens + cache_read_tokens + cache_write_tokens) / 1e6 * $2 + output_tokens / 1e6 * $3
+			WHERE reported_cost = 0 AND model = $1
+		`, m, p.In, p.Out)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+// sessionFile is a session JSONL file found on disk.
+type sessionFile struct {
+	path, agentID string
+	inode         int64
+	size          int64
+	modTime       time.Time
+}
+
+// listSessionFiles finds every agent's session files. It fails when a
+// directory can't be read, rather than report its files as gone; an agent
+// without a sessions directory simply has none.
+func listSessionFiles() ([]sessionFile, error) {
+	agentsDir := filepath.Join(config.GetOpenClawDir(), "agents")
+	entries, err := os.ReadDir(agentsDir)
+	if err != nil {
+		return nil, err
+	}
+	var files []sessionFile
+	for _, agentEntry := range entries {
+		if !agentEntry.IsDir() {
+			continue
+		}
+		agentID := agentEntry.Name()
+		sessionsDir := filepath.Join(agentsDir, agentID, "sessions")
+		sessionFiles, err := os.ReadDir(sessionsDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, sf := range sessionFiles {
+			if !strings.HasSuffix(sf.Name(), ".jsonl") {
+				continue
+			}
+			path := filepath.Join(sessionsDir, sf.Name())
+			fi, err := os.Stat(path)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, sessionFile{path: path, agentID: agentID, inode: fileInode(fi), size: fi.Size(), modTime: fi.ModTime()})
+		}
+	}
+	return files, nil
+}
+
+// indexTokenUsage runs one pass over the session files and returns the
+// number of messages added. With reset every file is read from the start.
+func indexTokenUsage(reset bool) (int64, error) {
+	tokenIndex.mu.Lock()
+	defer tokenIndex.mu.Unlock()
+	start := time.Now()
+
+	files, err := listSessionFiles()
+	if err != nil {
+		// An unreadable (e.g. unmounted) directory must not look like
+		// deleted sessions to a rebuild
+		tokenIndex.state.Lock()
+		tokenIndex.lastRun, tokenIndex.lastErr = start, err.Error()
+		tokenIndex.state.Unlock()
+		return 0, fmt.Errorf("reading session files: %w", err)
+	}
+	known := map[string][2]int64{} // path -> inode, read_offset
+	rows, err := db.DB.Query(`SELECT path, inode, read_offset FROM session_files`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var path string
+		var inode, offset int64
+		if rows.Scan(&path, &inode, &offset) == nil {
+			known[path] = [2]int64{inode, offset}
+		}
+	}
+	rows.Close()
+
+	if reset {
+		onDisk := make([]string, len(files))
+		for i, f := range files {
+			onDisk[i] = f.path
+		}
+		onDiskJSON, _ := json.Marshal(onDisk)
+		if _, err := db.DB.Exec(`
+			DELETE FROM token_usage WHERE file_path NOT IN (SELECT jsonb_array_elements_text($1::jsonb))
+		`, string(onDiskJSON)); err != nil {
+			return 0, err
+		}
+		db.DB.Exec(`DELETE FROM session_files WHERE path NOT IN (SELECT jsonb_array_elements_text($1::jsonb))`, string(onDiskJSON))
+	}
+
+	var added int64
+	var firstErr error
+	for _, f := range files {
+		prev, seen := known[f.path]
+		offset := prev[1]
+		replaced := seen && (reset || prev[0] != f.inode || f.size < offset)
+		if replaced {
+			offset = 0
+		} else if seen && f.size == offset {
+			continue
+		}
+		n, err := indexSessionFile(f, offset, replaced)
+		added += n
+		if err != nil {
+			log.Printf("[tokens] Error indexing %s: %v", f.path, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	tokenIndex.state.Lock()
+	tokenIndex.lastRun, tokenIndex.lastTook, tokenIndex.lastRows = start, time.Since(start), added
+	tokenIndex.lastErr = ""
+	if firstErr != nil {
+		tokenIndex.lastErr = firstErr.Error()
+	}
+	tokenIndex.state.Unlock()
+	if added > 0 {
+		log.Printf("[tokens] Indexed %d message(s) in %s", added, time.Since(start).Round(time.Millisecond))
+	}
+	return added, firstErr
+}
+
+// indexedMessage is a message and the byte offset of its line.
+type indexedMessage struct {
+	offset int64
+	msg    tokenMessage
+}
+
+// indexSessionFile reads f from offset, committing rows together with the
+// new offset every tokenIndexBatch messages. drop deletes the file's rows
+// first, inside the first commit.
+func indexSessionFile(f sessionFile, offset int64, drop bool) (int64, error) {
+	fh, err := os.Open(f.path)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	if _, err := fh.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var added int64
+	var batch []indexedMessage
+	flush := func(upTo int64) error {
+		n, err := commitTokenBatch(f, batch, upTo, drop)
+		if err != nil {
+			return err
+		}
+		added += n
+		batch, drop = batch[:0], false
+		return nil
+	}
+
+	reader := bufio.NewReaderSize(fh, 256*1024)
+	pos := offset
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && (err == nil || json.Valid(bytes.TrimSpace(line))) {
+			if msg, ok := parseTokenLine(line, f.agentID); ok {
+				batch = append(batch, indexedMessage{pos, msg})
+			}
+			pos += int64(len(line))
+			if len(batch) >= tokenIndexBatch {
+				if err := flush(pos); err != nil {
+					return added, err
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return added, err
+		}
+	}
+	return added, flush(pos)
+}
+
+// commitTokenBatch inserts msgs and records upTo as f's read offset in one
+// transaction.
+func commitTokenBatch(f sessionFile, msgs []indexedMessage, upTo int64, drop bool) (int64, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if drop {
+		if _, err := tx.Exec(`DELETE FROM token_usage WHERE file_path = $1`, f.path); err != nil {
+			return 0, err
+		}
+	}
+	var added int64
+	if len(msgs) > 0 {
+		const cols = 12
+		var sb strings.Builder
+		sb.WriteString(`INSERT INTO token_usage (file_path, line_offset, agent_id, model, ts, input_tokens, output_tokens,
+			cache_read_tokens, cache_write_tokens, total_tokens, reported_cost, cost_usd) VALUES `)
+		args := make([]interface{}, 0, len(msgs)*cols)
+		for i, m := range msgs {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString("(")
+			for c := 1; c <= cols; c++ {
+				if c > 1 {
+					sb.WriteString(",")
+				}
+				fmt.Fprintf(&sb, "$%d", i*cols+c)
+			}
+			sb.WriteString(")")
+			args = append(args, f.path, m.offset, m.msg.AgentID, m.msg.Model, m.msg.Timestamp, m.msg.Input, m.msg.Output,
+				m.msg.CacheRead, m.msg.CacheWrite, m.msg.TotalTokens, m.msg.ReportedCost, m.msg.CostTotal)
+		}
+		sb.WriteString(` ON CONFLICT (file_path, line_offset) DO NOTHING`)
+		res, err := tx.Exec(sb.String(), args...)
+		if err != nil {
+			return 0, err
+		}
+		added, _ = res.RowsAffected()
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO session_files (path, agent_id, inode, size, read_offset, mod_time, indexed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (path) DO UPDATE SET
+			agent_id = EXCLUDED.agent_id, inode = EXCLUDED.inode, size = EXCLUDED.size,
+			read_offset = EXCLUDED.read_offset, mod_time = EXCLUDED.mod_time, indexed_at = NOW()
+	`, f.path, f.agentID, f.inode, f.size, upTo, f.modTime); err != nil {
+		return 0, err
+	}
+	return added, tx.Commit()
+}
+
+// GetTokenIndexStatus handles GET /api/admin/token-index
+func GetTokenIndexStatus(w http.ResponseWriter, r *http.Request) {
+	var files, behind int64
+	var pendingBytes int64
+	db.DB.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE size > read_offset), COALESCE(SUM(GREATEST(size - read_offset, 0)), 0)
+		FROM session_files
+	`).Scan(&files, &behind, &pendingBytes)
+	var messages int64
+	var oldest, newest sql.NullTime
+	db.DB.QueryRow(`SELECT COUNT(*), MIN(ts), MAX(ts) FROM token_usage`).Scan(&messages, &oldest, &newest)
+
+	tokenIndex.state.Lock()
+	status := map[string]interface{}{
+		"files":             files,
+		"files_behind":      behind,
+		"pending_bytes":     pendingBytes,
+		"messages":          messages,
+		"oldest_message":    nullTimePtr(oldest),
+		"newest_message":    nullTimePtr(newest),
+		"last_run":          nil,
+		"last_run_ms":       tokenIndex.lastTook.Milliseconds(),
+		"last_run_messages": tokenIndex.lastRows,
+		"last_error":        tokenIndex.lastErr,
+		"rebuilding":        tokenIndex.rebuilding,
+		"interval_seconds":  int(tokenIndexInterval / time.Second),
+	}
+	if !tokenIndex.lastRun.IsZero() {
+		status["last_run"] = tokenIndex.lastRun
+	}
+	tokenIndex.state.Unlock()
+	respondJSON(w, http.StatusOK, status)
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// RebuildTokenIndexHandler handles POST /api/admin/token-index/rebuild
+func RebuildTokenIndexHandler(w http.ResponseWriter, r *http.Request) {
+	full := r.URL.Query().Get("full") == "true"
+	repriced, indexed, err := RebuildTokenIndex(full)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "token_index_rebuilt", "token_usage", "", map[string]interface{}{
+		"full": full, "repriced": repriced, "indexed": indexed,
+	})
+	respondJSON(w, http.StatusOK, map[string]interface{}{"full": full, "repriced": repriced, "indexed": indexed})
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package handlers
+
+import "os"
+
+// fileInode returns 0 where inodes aren't available; a replaced session
+// file is then only detected when it shrinks.
+func fileInode(fi os.FileInfo) int64 {
+	return 0
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package handlers
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the file's inode number, so a session file replaced
+// under the same path is read again from the start.
+func fileInode(fi os.FileInfo) int64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Ino)
+	}
+	return 0
+}
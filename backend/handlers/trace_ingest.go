@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ─── Bulk trace ingestion ────────────────────────────────────────────────────
+//
+// POST /api/traces/batch takes a JSON array or NDJSON (one trace per line,
+// Content-Type application/x-ndjson), optionally gzip-compressed. Valid
+// items are written with multi-row inserts in one transaction; every item
+// gets a result so callers can see what was rejected and why.
+
+const (
+	traceBatchMaxBody    = 8 << 20  // compressed request size
+	traceBatchMaxDecoded = 64 << 20 // after gzip
+	traceBatchMaxItems   = 10000
+	traceInsertChunk     = 1000 // rows per INSERT statement, 15 parameters each
+)
+
+// TraceItemResult reports what happened to one item of a batch.
+type TraceItemResult struct {
+	Index  int    `json:"index"`
+	Line   int    `json:"line,omitempty"` // NDJSON only
+	Status string `json:"status"`         // inserted, duplicate or rejected
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// readCompressedBody reads a request body of at most maxBody bytes,
+// inflating it when Content-Encoding is gzip.
+func readCompressedBody(w http.ResponseWriter, r *http.Request, maxBody, maxDecoded int64) ([]byte, error) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxBody)
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %v", err)
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", r.Header.Get("Content-Encoding"))
+	}
+	b, err := io.ReadAll(io.LimitReader(body, maxDecoded+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > maxDecoded {
+		return nil, fmt.Errorf("request body too large")
+	}
+	return b, nil
+}
+
+// insertTraces writes items in chunks of multi-row inserts. It returns
+// each item's ID and whether it was new; a span already stored, or repeated
+// within items, keeps the ID it was first stored under.
+func insertTraces(tx *sql.Tx, items []*traceInput) ([]string, []bool, error) {
+	ids := make([]string, len(items))
+	isNew := make([]bool, len(items))
+
+	firstBySpan := map[string]int{}
+	var rows []int
+	for i, t := range items {
+		if t.SpanID != "" {
+			key := t.TraceID + "/" + t.SpanID
+			if first, ok := firstBySpan[key]; ok {
+				ids[i] = "=" + fmt.Sprint(first) // resolved below
+				continue
+			}
+			firstBySpan[key] = i
+		}
+		ids[i] = uuid.New().String()
+		rows = append(rows, i)
+	}
+
+	for len(rows) > 0 {
+		chunk := rows
+		if len(chunk) > traceInsertChunk {
+			chunk = rows[:traceInsertChunk]
+		}
+		rows = rows[len(chunk):]
+
+		var sb strings.Builder
+		sb.WriteString(`INSERT INTO agent_traces (id, task_id, agent_id, trace_type, content, duration_ms, created_at,
+			trace_id, span_id, parent_span_id, name, attributes, status_code, status_message, start_time, end_time) VALUES `)
+		args := make([]interface{}, 0, len(chunk)*15)
+		for n, i := range chunk {
+			t := items[i]
+			var attrs interface{}
+			if len(t.Attributes) > 0 {
+				attrs = []byte(t.Attributes)
+			}
+			p := n * 15
+			if n > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, `($%d::uuid, NULLIF($%d,'')::uuid, NULLIF($%d,''), $%d, $%d::jsonb, $%d::int, COALESCE($%d::timestamptz, NOW()),
+				NULLIF($%d,''), NULLIF($%d,''), NULLIF($%d,''), NULLIF($%d,''), $%d::jsonb, $%d, NULLIF($%d,''), $%d::timestamptz, $%d::timestamptz)`,
+				p+1, p+2, p+3, p+4, p+5, p+6, p+7, p+8, p+9, p+10, p+11, p+12, p+13, p+14, p+7, p+15)
+			args = append(args, ids[i], t.TaskID, t.AgentID, t.TraceType, []byte(t.Content), t.DurationMs, t.StartTime,
+				t.TraceID, t.SpanID, t.ParentSpanID, t.Name, attrs, t.Status, t.StatusMessage, t.EndTime)
+		}
+		sb.WriteString(` ON CONFLICT (trace_id, span_id) WHERE span_id IS NOT NULL DO NOTHING RETURNING id`)
+
+		res, err := tx.Query(sb.String(), args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		stored := map[string]bool{}
+		for res.Next() {
+			var id string
+			if res.Scan(&id) == nil {
+				stored[id] = true
+			}
+		}
+		res.Close()
+		if err := res.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		// Rows that hit the unique index were stored by an earlier request
+		var traceIDs, spanIDs []string
+		for _, i := range chunk {
+			if stored[ids[i]] {
+				isNew[i] = true
+			} else {
+				traceIDs, spanIDs = append(traceIDs, items[i].TraceID), append(spanIDs, items[i].SpanID)
+			}
+		}
+		if len(traceIDs) > 0 {
+			existing := map[string]string{}
+			er, err := tx.Query(`
+				SELECT t.id, t.trace_id, t.span_id FROM agent_traces t
+				JOIN unnest($1::text[], $2::text[]) AS k(trace_id, span_id) ON t.trace_id = k.trace_id AND t.span_id = k.span_id
+			`, pq.Array(traceIDs), pq.Array(spanIDs))
+			if err != nil {
+				return nil, nil, err
+			}
+			for er.Next() {
+				var id, traceID, spanID string
+				if er.Scan(&id, &traceID, &spanID) == nil {
+					existing[traceID+"/"+spanID] = id
+				}
+			}
+			er.Close()
+			for _, i := range chunk {
+				if !isNew[i] {
+					ids[i] = existing[items[i].TraceID+"/"+items[i].SpanID]
+				}
+			}
+		}
+	}
+
+	for i, t := range items {
+		if strings.HasPrefix(ids[i], "=") {
+			ids[i] = ids[firstBySpan[t.TraceID+"/"+t.SpanID]]
+		}
+	}
+	return ids, isNew, nil
+}
+
+// BatchIngestTraces handles POST /api/traces/batch
+func (h *TraceHandler) BatchIngestTraces(w http.ResponseWriter, r *http.Request) {
+	body, err := readCompressedBody(w, r, traceBatchMaxBody, traceBatchMaxDecoded)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Split the body into raw items, remembering NDJSON line numbers
+	var raw []json.RawMessage
+	var lines []int
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		sc := bufio.NewScanner(bytes.NewReader(body))
+		sc.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+		for line := 1; sc.Scan(); line++ {
+			if b := bytes.TrimSpace(sc.Bytes()); len(b) > 0 {
+				raw = append(raw, append(json.RawMessage(nil), b...))
+				lines = append(lines, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid NDJSON body: "+err.Error())
+			return
+		}
+	default:
+		if err := json.Unmarshal(body, &raw); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON array")
+			return
+		}
+	}
+	if len(raw) > traceBatchMaxItems {
+		respondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d traces per batch", traceBatchMaxItems))
+		return
+	}
+
+	bound := GetBoundAgent(r)
+	results := make([]TraceItemResult, len(raw))
+	var valid []*traceInput
+	var validIdx []int
+	for i, item := range raw {
+		results[i].Index = i
+		if lines != nil {
+			results[i].Line = lines[i]
+		}
+		t := &traceInput{}
+		if err := json.Unmarshal(item, t); err != nil {
+			results[i].Status, results[i].Error = "rejected", "invalid JSON: "+err.Error()
+			continue
+		}
+		if err := t.normalize(bound); err != nil {
+			results[i].Status, results[i].Error = "rejected", err.Error()
+			continue
+		}
+		valid = append(valid, t)
+		validIdx = append(validIdx, i)
+	}
+
+	// Unknown tasks would fail the whole insert on the foreign key
+	var taskIDs []string
+	for _, t := range valid {
+		if t.TaskID != "" {
+			taskIDs = append(taskIDs, t.TaskID)
+		}
+	}
+	if len(taskIDs) > 0 {
+		known, err := existingTasks(taskIDs)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		kept, keptIdx := valid[:0], validIdx[:0]
+		for n, t := range valid {
+			if t.TaskID != "" && !known[t.TaskID] {
+				results[validIdx[n]].Status, results[validIdx[n]].Error = "rejected", "task not found"
+				continue
+			}
+			kept, keptIdx = append(kept, t), append(keptIdx, validIdx[n])
+		}
+		valid, validIdx = kept, keptIdx
+	}
+
+	if len(valid) > 0 {
+		tx, err := db.DB.Begin()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer tx.Rollback()
+		ids, isNew, err := insertTraces(tx, valid)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for n, i := range validIdx {
+			results[i].ID, results[i].Status = ids[n], "duplicate"
+			if isNew[n] {
+				results[i].Status = "inserted"
+				if t := valid[n]; t.TraceType == "error" && t.AgentID != "" {
+					traceErrorNotices.add(t.AgentID, t.TaskID)
+				}
+			}
+		}
+	}
+
+	inserted, duplicates := 0, 0
+	ids := []string{}
+	rejected := []int{}
+	for _, res := range results {
+		switch res.Status {
+		case "inserted":
+			inserted++
+			ids = append(ids, res.ID)
+		case "duplicate":
+			duplicates++
+		default:
+			rejected = append(rejected, res.Index)
+		}
+	}
+	status := http.StatusCreated
+	if len(raw) > 0 && len(rejected) == len(raw) {
+		status = http.StatusBadRequest
+	}
+	respondJSON(w, status, map[string]interface{}{
+		"inserted":         inserted,
+		"duplicates":       duplicates,
+		"rejected":         len(rejected),
+		"rejected_indices": rejected,
+		"ids":              ids,
+		"results":          results,
+	})
+}
+
+// existingTasks returns which of ids (UUIDs) name existing tasks.
+func existingTasks(ids []string) (map[string]bool, error) {
+	known := map[string]bool{}
+	rows, err := db.DB.Query(`SELECT id::text FROM tasks WHERE id = ANY($1::uuid[])`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			known[id] = true
+		}
+	}
+	return known, rows.Err()
+}
+
+// ─── Error trace notifications ───────────────────────────────────────────────
+//
+// Error traces are collected per agent and sent as one notification per
+// agent a short while after the first, however many arrive meanwhile.
+
+const traceErrorNoticeDelay = 30 * time.Second
+
+type errorNoticeBatcher struct {
+	mu      sync.Mutex
+	pending map[string]map[string]int // agent → task ("" for none) → count
+	timer   *time.Timer
+}
+
+var traceErrorNotices = &errorNoticeBatcher{}
+
+func (b *errorNoticeBatcher) add(agentID, taskID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending == nil {
+		b.pending = map[string]map[string]int{}
+	}
+	if b.pending[agentID] == nil {
+		b.pending[agentID] = map[string]int{}
+	}
+	b.pending[agentID][taskID]++
+	if b.timer == nil {
+		b.timer = time.AfterFunc(traceErrorNoticeDelay, b.flush)
+	}
+}
+
+func (b *errorNoticeBatcher) flush() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending, b.timer = nil, nil
+	b.mu.Unlock()
+
+	for agentID, tasks := range pending {
+		total := 0
+		var taskIDs []string
+		for taskID, n := range tasks {
+			total += n
+			if taskID != "" {
+				taskIDs = append(taskIDs, taskID)
+			}
+		}
+		sort.Strings(taskIDs)
+
+		var msg string
+		switch {
+		case total == 1 && len(taskIDs) == 1:
+			msg = fmt.Sprintf("Error trace recorded for agent %s on task %s", agentID, taskIDs[0])
+		case total == 1:
+			msg = fmt.Sprintf("Error trace recorded for agent %s", agentID)
+		case len(taskIDs) == 1:
+			msg = fmt.Sprintf("%d error traces recorded for agent %s on task %s", total, agentID, taskIDs[0])
+		case len(taskIDs) > 1:
+			msg = fmt.Sprintf("%d error traces recorded for agent %s across %d tasks", total, agentID, len(taskIDs))
+		default:
+			msg = fmt.Sprintf("%d error traces recorded for agent %s", total, agentID)
+		}
+		CreateNotificationInternal(agentID, "trace_error", "Agent error trace", msg)
+	}
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/gorilla/mux"
+)
+
+// ─── Trace waterfall ─────────────────────────────────────────────────────────
+//
+// GET /api/tasks/{id}/traces/tree nests a task's spans by parent_span_id and
+// times every span:
+//
+//   - self_ms is the part of a span not covered by any of its children
+//     (overlapping children count once), child_ms the rest.
+//   - The critical path is the chain of work that decided when the task
+//     finished: walking back from the end, each span hands over to the child
+//     that finished last, then to the one that finished before that child
+//     started, and so on. critical_ms is the time each span spent on it.
+//     Gaps where no span was running are reported as idle_ms.
+//
+// Traces without start/end times are placed at created_at.
+
+// TraceNode is one span in the waterfall.
+type TraceNode struct {
+	ID             string       `json:"id"`
+	TraceID        string       `json:"trace_id,omitempty"`
+	SpanID         string       `json:"span_id,omitempty"`
+	ParentSpanID   string       `json:"parent_span_id,omitempty"`
+	Name           string       `json:"name,omitempty"`
+	TraceType      string       `json:"trace_type"`
+	AgentID        string       `json:"agent_id,omitempty"`
+	Status         string       `json:"status"`
+	StatusMessage  string       `json:"status_message,omitempty"`
+	Start          time.Time    `json:"start"`
+	End            time.Time    `json:"end"`
+	Depth          int          `json:"depth"`
+	OffsetMs       float64      `json:"offset_ms"` // from the task's first span
+	DurationMs     float64      `json:"duration_ms"`
+	SelfMs         float64      `json:"self_ms"`
+	ChildMs        float64      `json:"child_ms"`
+	CriticalMs     float64      `json:"critical_ms"`
+	OnCriticalPath bool         `json:"on_critical_path"`
+	Children       []*TraceNode `json:"children"`
+}
+
+// TraceTypeRollup totals the spans of one trace_type.
+type TraceTypeRollup struct {
+	TraceType  string  `json:"trace_type"`
+	Count      int     `json:"count"`
+	Errors     int     `json:"errors"`
+	TotalMs    float64 `json:"total_ms"`
+	SelfMs     float64 `json:"self_ms"`
+	CriticalMs float64 `json:"critical_ms"`
+	SelfPct    float64 `json:"self_pct"` // share of all self time
+}
+
+// CriticalStep is one span's share of the critical path.
+type CriticalStep struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name,omitempty"`
+	TraceType  string  `json:"trace_type"`
+	AgentID    string  `json:"agent_id,omitempty"`
+	CriticalMs float64 `json:"critical_ms"`
+}
+
+// TraceTree is the response of GetTaskTraceTree.
+type TraceTree struct {
+	TaskID       string            `json:"task_id"`
+	SpanCount    int               `json:"span_count"`
+	Start        *time.Time        `json:"start"`
+	End          *time.Time        `json:"end"`
+	TotalMs      float64           `json:"total_ms"` // wall clock, first start to last end
+	BusyMs       float64           `json:"busy_ms"`
+	IdleMs       float64           `json:"idle_ms"`
+	Errors       int               `json:"errors"`
+	CriticalPath []CriticalStep    `json:"critical_path"`
+	ByType       []TraceTypeRollup `json:"by_type"`
+	Roots        []*TraceNode      `json:"roots"`
+}
+
+func spanMs(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+}
+
+// GetTaskTraceTree handles GET /api/tasks/{id}/traces/tree
+func (h *TraceHandler) GetTaskTraceTree(w http.ResponseWriter, r *http.Request) {
+	taskID := mux.Vars(r)["id"]
+	var exists bool
+	if err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)`, taskID).Scan(&exists); err != nil || !exists {
+		respondError(w, http.StatusNotFound, "task not found")
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT `+traceCols+` FROM agent_traces WHERE task_id = $1
+		ORDER BY COALESCE(start_time, created_at) ASC, id LIMIT 10000`, taskID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	var traces []AgentTrace
+	for rows.Next() {
+		t, err := scanTrace(rows)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		traces = append(traces, t)
+	}
+
+	respondJSON(w, http.StatusOK, buildTraceTree(taskID, traces))
+}
+
+func traceNode(t AgentTrace) *TraceNode {
+	n := &TraceNode{ID: t.ID, TraceType: t.TraceType, Status: "unset", Children: []*TraceNode{}}
+	str := func(p *string) string {
+		if p == nil {
+			return ""
+		}
+		return *p
+	}
+	n.TraceID, n.SpanID, n.ParentSpanID = str(t.TraceID), str(t.SpanID), str(t.ParentSpanID)
+	n.Name, n.AgentID, n.StatusMessage = str(t.Name), str(t.AgentID), str(t.StatusMessage)
+	if s := str(t.StatusCode); s != "" {
+		n.Status = s
+	} else if t.TraceType == "error" {
+		n.Status = "error"
+	}
+
+	n.Start = t.CreatedAt
+	if t.StartTime != nil {
+		n.Start = *t.StartTime
+	}
+	n.End = n.Start.Add(time.Duration(t.DurationMs) * time.Millisecond)
+	if t.EndTime != nil && !t.EndTime.Before(n.Start) {
+		n.End = *t.EndTime
+	}
+	n.Start, n.End = n.Start.UTC(), n.End.UTC()
+	return n
+}
+
+func buildTraceTree(taskID string, traces []AgentTrace) *TraceTree {
+	tree := &TraceTree{TaskID: taskID, SpanCount: len(traces), CriticalPath: []CriticalStep{}, ByType: []TraceTypeRollup{}, Roots: []*TraceNode{}}
+	if len(traces) == 0 {
+		return tree
+	}
+
+	nodes := make([]*TraceNode, len(traces))
+	bySpan := map[string]*TraceNode{}
+	for i, t := range traces {
+		nodes[i] = traceNode(t)
+		if n := nodes[i]; n.SpanID != "" {
+			bySpan[n.TraceID+"/"+n.SpanID] = n
+		}
+	}
+	parent := map[*TraceNode]*TraceNode{}
+	for _, n := range nodes {
+		if p, ok := bySpan[n.TraceID+"/"+n.ParentSpanID]; ok && n.ParentSpanID != "" && p != n {
+			parent[n] = p
+			p.Children = append(p.Children, n)
+		}
+	}
+
+	// Roots, plus a way out of parent cycles: a span never reached from a
+	// root is cut loose from its parent and becomes one
+	visited := map[*TraceNode]bool{}
+	var visit func(n *TraceNode, depth int)
+	visit = func(n *TraceNode, depth int) {
+		visited[n] = true
+		n.Depth = depth
+		for _, c := range n.Children {
+			visit(c, depth+1)
+		}
+	}
+	for _, n := range nodes {
+		if parent[n] == nil {
+			tree.Roots = append(tree.Roots, n)
+			visit(n, 0)
+		}
+	}
+	for _, n := range nodes {
+		if visited[n] {
+			continue
+		}
+		p := parent[n]
+		for i, c := range p.Children {
+			if c == n {
+				p.Children = append(p.Children[:i], p.Children[i+1:]...)
+				break
+			}
+		}
+		delete(parent, n)
+		tree.Roots = append(tree.Roots, n)
+		visit(n, 0)
+	}
+
+	start, end := nodes[0].Start, nodes[0].End
+	for _, n := range nodes {
+		if n.Start.Before(start) {
+			start = n.Start
+		}
+		if n.End.After(end) {
+			end = n.End
+		}
+	}
+	tree.Start, tree.End = &start, &end
+	tree.TotalMs = spanMs(end.Sub(start))
+
+	for _, n := range nodes {
+		sortSpans(n.Children)
+		n.OffsetMs = spanMs(n.Start.Sub(start))
+		n.DurationMs = spanMs(n.End.Sub(n.Start))
+		n.ChildMs = spanMs(coveredBy(n.Start, n.End, n.Children))
+		n.SelfMs = math.Max(0, math.Round((n.DurationMs-n.ChildMs)*1000)/1000)
+	}
+	sortSpans(tree.Roots)
+
+	// The roots hang off a virtual task span covering [start, end]; its own
+	// time on the critical path is idle time
+	idle := time.Duration(0)
+	walkCriticalPath(&TraceNode{Start: start, End: end, Children: tree.Roots}, end, func(n *TraceNode, d time.Duration) {
+		if n.ID == "" {
+			idle += d
+			return
+		}
+		n.CriticalMs += spanMs(d)
+	})
+	tree.IdleMs = spanMs(idle)
+	tree.BusyMs = math.Round((tree.TotalMs-tree.IdleMs)*1000) / 1000
+
+	rollups := map[string]*TraceTypeRollup{}
+	var totalSelf float64
+	for _, n := range nodes {
+		r := rollups[n.TraceType]
+		if r == nil {
+			r = &TraceTypeRollup{TraceType: n.TraceType}
+			rollups[n.TraceType] = r
+		}
+		r.Count++
+		r.TotalMs += n.DurationMs
+		r.SelfMs += n.SelfMs
+		r.CriticalMs += n.CriticalMs
+		totalSelf += n.SelfMs
+		if n.Status == "error" {
+			r.Errors++
+			tree.Errors++
+		}
+	}
+	for _, r := range rollups {
+		if totalSelf > 0 {
+			r.SelfPct = math.Round(r.SelfMs/totalSelf*1000) / 10
+		}
+		r.TotalMs = math.Round(r.TotalMs*1000) / 1000
+		r.SelfMs = math.Round(r.SelfMs*1000) / 1000
+		r.CriticalMs = math.Round(r.CriticalMs*1000) / 1000
+		tree.ByType = append(tree.ByType, *r)
+	}
+	sort.Slice(tree.ByType, func(i, j int) bool {
+		if tree.ByType[i].SelfMs != tree.ByType[j].SelfMs {
+			return tree.ByType[i].SelfMs > tree.ByType[j].SelfMs
+		}
+		return tree.ByType[i].TraceType < tree.ByType[j].TraceType
+	})
+
+	// Critical path in start order; a span's ancestors are on it too
+	for _, n := range nodes {
+		if n.CriticalMs <= 0 {
+			continue
+		}
+		tree.CriticalPath = append(tree.CriticalPath, CriticalStep{ID: n.ID, Name: n.Name, TraceType: n.TraceType, AgentID: n.AgentID, CriticalMs: n.CriticalMs})
+		for p := n; p != nil; p = parent[p] {
+			p.OnCriticalPath = true
+		}
+	}
+	return tree
+}
+
+func sortSpans(spans []*TraceNode) {
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+}
+
+// coveredBy returns how much of [start, end] the spans cover, counting
+// overlaps once. spans must be sorted by start.
+func coveredBy(start, end time.Time, spans []*TraceNode) time.Duration {
+	var total time.Duration
+	cur := start
+	for _, s := range spans {
+		from, to := s.Start, s.End
+		if from.Before(cur) {
+			from = cur
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			total += to.Sub(from)
+			cur = to
+		}
+	}
+	return total
+}
+
+// walkCriticalPath attributes the critical path of n, up to cursor, to
+// spans via add.
+func walkCriticalPath(n *TraceNode, cursor time.Time, add func(*TraceNode, time.Duration)) {
+	end := n.End
+	if cursor.Before(end) {
+		end = cursor
+	}
+	children := append([]*TraceNode(nil), n.Children...)
+	sort.SliceStable(children, func(i, j int) bool { return children[i].End.After(children[j].End) })
+
+	for _, c := range children {
+		if !end.After(n.Start) {
+			break
+		}
+		if !c.Start.Before(end) {
+			continue // started after the work it would hand over to
+		}
+		childEnd := c.End
+		if end.Before(childEnd) {
+			childEnd = end
+		}
+		if d := end.Sub(childEnd); d > 0 {
+			add(n, d)
+		}
+		walkCriticalPath(c, childEnd, add)
+		end = c.Start
+		if end.Before(n.Start) {
+			end = n.Start
+		}
+	}
+	if d := end.Sub(n.Start); d > 0 {
+		add(n, d)
+	}
+}
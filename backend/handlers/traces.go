@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alghanim/agentboard/backend/db"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
@@ -21,6 +26,19 @@ type AgentTrace struct {
 	Content    json.RawMessage `json:"content"`
 	CreatedAt  time.Time       `json:"created_at"`
 	DurationMs int             `json:"duration_ms"`
+
+	// Set for spans received over OTLP
+	TraceID       *string         `json:"trace_id,omitempty"`
+	SpanID        *string         `json:"span_id,omitempty"`
+	ParentSpanID  *string         `json:"parent_span_id,omitempty"`
+	Name          *string         `json:"name,omitempty"`
+	Attributes    json.RawMessage `json:"attributes,omitempty"`
+	StatusCode    *string         `json:"status_code,omitempty"`
+	StatusMessage *string         `json:"status_message,omitempty"`
+	StartTime     *time.Time      `json:"start_time,omitempty"`
+	EndTime       *time.Time      `json:"end_time,omitempty"`
+
+	Children []*AgentTrace `json:"children,omitempty"` // ?view=tree
 }
 
 var validTraceTypes = map[string]bool{
@@ -29,12 +47,54 @@ var validTraceTypes = map[string]bool{
 	"sub_agent_spawn": true,
 	"file_change":     true,
 	"error":           true,
+	"span":            true, // any other OTLP span
+}
+
+const traceCols = `id, task_id, agent_id, trace_type, content, created_at, duration_ms,
+	trace_id, span_id, parent_span_id, name, attributes, status_code, status_message, start_time, end_time`
+
+func scanTrace(rows *sql.Rows) (AgentTrace, error) {
+	var t AgentTrace
+	var attrs []byte
+	err := rows.Scan(&t.ID, &t.TaskID, &t.AgentID, &t.TraceType, &t.Content, &t.CreatedAt, &t.DurationMs,
+		&t.TraceID, &t.SpanID, &t.ParentSpanID, &t.Name, &attrs, &t.StatusCode, &t.StatusMessage, &t.StartTime, &t.EndTime)
+	if len(attrs) > 0 {
+		t.Attributes = attrs
+	}
+	return t, err
 }
 
-// GetTaskTraces handles GET /api/tasks/{id}/traces
+// buildSpanTree nests spans under their parents. Spans whose parent isn't
+// in the list, and traces recorded without span IDs, become roots. Input
+// order (by start time) is kept among siblings.
+func buildSpanTree(traces []AgentTrace) []*AgentTrace {
+	bySpan := map[string]*AgentTrace{}
+	nodes := make([]*AgentTrace, len(traces))
+	for i := range traces {
+		nodes[i] = &traces[i]
+		if t := nodes[i]; t.TraceID != nil && t.SpanID != nil {
+			bySpan[*t.TraceID+"/"+*t.SpanID] = t
+		}
+	}
+	roots := []*AgentTrace{}
+	for _, t := range nodes {
+		if t.TraceID != nil && t.ParentSpanID != nil {
+			if parent, ok := bySpan[*t.TraceID+"/"+*t.ParentSpanID]; ok && parent != t {
+				parent.Children = append(parent.Children, t)
+				continue
+			}
+		}
+		roots = append(roots, t)
+	}
+	return roots
+}
+
+// GetTaskTraces handles GET /api/tasks/{id}/traces. With ?view=tree spans
+// are nested under their parents.
 func (h *TraceHandler) GetTaskTraces(w http.ResponseWriter, r *http.Request) {
 	taskID := mux.Vars(r)["id"]
-	query := `SELECT id, task_id, agent_id, trace_type, content, created_at, duration_ms FROM agent_traces WHERE task_id = $1`
+	tree := r.URL.Query().Get("view") == "tree"
+	query := `SELECT ` + traceCols + ` FROM agent_traces WHERE task_id = $1`
 	args := []interface{}{taskID}
 	n := 2
 
@@ -43,11 +103,15 @@ func (h *TraceHandler) GetTaskTraces(w http.ResponseWriter, r *http.Request) {
 		args = append(args, traceType)
 		n++
 	}
-	query += " ORDER BY created_at ASC"
+	query += " ORDER BY COALESCE(start_time, created_at) ASC, id"
 
-	limit := 100
+	// A tree cut off part way through loses its leaves, so allow more rows
+	limit, maxLimit := 100, 1000
+	if tree {
+		limit, maxLimit = 10000, 10000
+	}
 	if l := r.URL.Query().Get("limit"); l != "" {
-		if v, err := strconv.Atoi(l); err == nil && v > 0 && v <= 1000 {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 && v <= maxLimit {
 			limit = v
 		}
 	}
@@ -63,43 +127,153 @@ func (h *TraceHandler) GetTaskTraces(w http.ResponseWriter, r *http.Request) {
 
 	traces := []AgentTrace{}
 	for rows.Next() {
-		var t AgentTrace
-		if err := rows.Scan(&t.ID, &t.TaskID, &t.AgentID, &t.TraceType, &t.Content, &t.CreatedAt, &t.DurationMs); err != nil {
+		t, err := scanTrace(rows)
+		if err != nil {
 			respondError(w, 500, err.Error())
 			return
 		}
 		traces = append(traces, t)
 	}
+	if tree {
+		respondJSON(w, 200, buildSpanTree(traces))
+		return
+	}
 	respondJSON(w, 200, traces)
 }
 
+// traceInput is a trace posted to /api/traces or /api/traces/batch. The span
+// fields are optional; with them, traces nest into a tree.
+type traceInput struct {
+	TaskID        string          `json:"task_id"`
+	AgentID       string          `json:"agent_id"`
+	TraceType     string          `json:"trace_type"`
+	Content       json.RawMessage `json:"content"`
+	DurationMs    int             `json:"duration_ms"`
+	TraceID       string          `json:"trace_id"`
+	SpanID        string          `json:"span_id"`
+	ParentSpanID  string          `json:"parent_span_id"`
+	Name          string          `json:"name"`
+	Attributes    json.RawMessage `json:"attributes"`
+	Status        string          `json:"status"` // unset, ok or error
+	StatusMessage string          `json:"status_message"`
+	StartTime     *time.Time      `json:"start_time"`
+	EndTime       *time.Time      `json:"end_time"`
+}
+
+// newSpanID returns a random 8-byte span ID in hex, as OpenTelemetry uses.
+func newSpanID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// normalize validates t and fills in defaults. Spans without a trace_id
+// share one trace per task; a child without its own span_id gets one.
+func (t *traceInput) normalize(boundAgent string) error {
+	if boundAgent != "" {
+		t.AgentID = boundAgent
+	}
+	if !validTraceTypes[t.TraceType] {
+		return fmt.Errorf("invalid trace_type")
+	}
+	if t.TaskID != "" {
+		id, err := uuid.Parse(t.TaskID)
+		if err != nil {
+			return fmt.Errorf("task_id must be a UUID")
+		}
+		t.TaskID = id.String()
+	}
+	if t.Content == nil {
+		t.Content = json.RawMessage(`{}`)
+	}
+	if len(t.TraceID) > 64 || len(t.SpanID) > 64 || len(t.ParentSpanID) > 64 {
+		return fmt.Errorf("trace_id, span_id and parent_span_id are limited to 64 characters")
+	}
+	if t.ParentSpanID != "" && t.SpanID == "" {
+		t.SpanID = newSpanID()
+	}
+	if t.SpanID != "" && t.TraceID == "" {
+		if t.TaskID == "" {
+			return fmt.Errorf("span_id needs a trace_id or task_id")
+		}
+		t.TraceID = strings.ReplaceAll(t.TaskID, "-", "")
+	}
+
+	switch t.Status {
+	case "":
+		t.Status = "unset"
+		if t.TraceType == "error" {
+			t.Status = "error"
+		}
+	case "unset", "ok", "error":
+	default:
+		return fmt.Errorf("status must be unset, ok or error")
+	}
+
+	switch {
+	case t.StartTime != nil && t.EndTime != nil:
+		if t.EndTime.Before(*t.StartTime) {
+			return fmt.Errorf("end_time is before start_time")
+		}
+		if t.DurationMs == 0 {
+			t.DurationMs = int(t.EndTime.Sub(*t.StartTime).Milliseconds())
+		}
+	case t.StartTime != nil:
+		end := t.StartTime.Add(time.Duration(t.DurationMs) * time.Millisecond)
+		t.EndTime = &end
+	case t.EndTime != nil:
+		start := t.EndTime.Add(-time.Duration(t.DurationMs) * time.Millisecond)
+		t.StartTime = &start
+	}
+	return nil
+}
+
+// insert stores t and returns its ID. A span already stored under the same
+// trace_id and span_id is not stored again; its existing ID is returned.
+func (t *traceInput) insert(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}) (string, error) {
+	var attrs interface{}
+	if len(t.Attributes) > 0 {
+		attrs = []byte(t.Attributes)
+	}
+	var id string
+	err := q.QueryRow(`
+		INSERT INTO agent_traces (task_id, agent_id, trace_type, content, duration_ms, created_at,
+		                          trace_id, span_id, parent_span_id, name, attributes, status_code, status_message, start_time, end_time)
+		VALUES (NULLIF($1,'')::uuid, NULLIF($2,''), $3, $4, $5, COALESCE($6::timestamptz, NOW()),
+		        NULLIF($7,''), NULLIF($8,''), NULLIF($9,''), NULLIF($10,''), $11, $12, NULLIF($13,''), $6, $14)
+		ON CONFLICT (trace_id, span_id) WHERE span_id IS NOT NULL DO UPDATE SET span_id = EXCLUDED.span_id
+		RETURNING id
+	`, t.TaskID, t.AgentID, t.TraceType, t.Content, t.DurationMs, t.StartTime,
+		t.TraceID, t.SpanID, t.ParentSpanID, t.Name, attrs, t.Status, t.StatusMessage, t.EndTime).Scan(&id)
+	return id, err
+}
+
 // IngestTrace handles POST /api/traces
 func (h *TraceHandler) IngestTrace(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		TaskID     string          `json:"task_id"`
-		AgentID    string          `json:"agent_id"`
-		TraceType  string          `json:"trace_type"`
-		Content    json.RawMessage `json:"content"`
-		DurationMs int             `json:"duration_ms"`
-	}
+	var req traceInput
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, 400, "invalid JSON")
 		return
 	}
-	if !validTraceTypes[req.TraceType] {
-		respondError(w, 400, "invalid trace_type")
+	if err := req.normalize(GetBoundAgent(r)); err != nil {
+		respondError(w, 400, err.Error())
 		return
 	}
-	if req.Content == nil {
-		req.Content = json.RawMessage(`{}`)
+	if req.TaskID != "" {
+		known, err := existingTasks([]string{req.TaskID})
+		if err != nil {
+			respondError(w, 500, err.Error())
+			return
+		}
+		if !known[req.TaskID] {
+			respondError(w, 400, "task not found")
+			return
+		}
 	}
 
-	var id string
-	err := db.DB.QueryRow(
-		`INSERT INTO agent_traces (task_id, agent_id, trace_type, content, duration_ms)
-		 VALUES (NULLIF($1,'')::uuid, NULLIF($2,''), $3, $4, $5) RETURNING id`,
-		req.TaskID, req.AgentID, req.TraceType, req.Content, req.DurationMs,
-	).Scan(&id)
+	id, err := req.insert(db.DB)
 	if err != nil {
 		respondError(w, 500, err.Error())
 		return
@@ -107,50 +281,14 @@ func (h *TraceHandler) IngestTrace(w http.ResponseWriter, r *http.Request) {
 
 	// Auto-notify on error traces
 	if req.TraceType == "error" && req.AgentID != "" {
-		go CreateNotificationInternal(req.AgentID, "trace_error", "Agent error trace",
-			fmt.Sprintf("Error trace recorded for agent %s on task %s", req.AgentID, req.TaskID))
+		traceErrorNotices.add(req.AgentID, req.TaskID)
 	}
 
-	respondJSON(w, 201, map[string]string{"id": id})
-}
-
-// BatchIngestTraces handles POST /api/traces/batch
-func (h *TraceHandler) BatchIngestTraces(w http.ResponseWriter, r *http.Request) {
-	var traces []struct {
-		TaskID     string          `json:"task_id"`
-		AgentID    string          `json:"agent_id"`
-		TraceType  string          `json:"trace_type"`
-		Content    json.RawMessage `json:"content"`
-		DurationMs int             `json:"duration_ms"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&traces); err != nil {
-		respondError(w, 400, "invalid JSON array")
-		return
-	}
-
-	ids := []string{}
-	for _, t := range traces {
-		if !validTraceTypes[t.TraceType] {
-			continue
-		}
-		if t.Content == nil {
-			t.Content = json.RawMessage(`{}`)
-		}
-		var id string
-		err := db.DB.QueryRow(
-			`INSERT INTO agent_traces (task_id, agent_id, trace_type, content, duration_ms)
-			 VALUES (NULLIF($1,'')::uuid, NULLIF($2,''), $3, $4, $5) RETURNING id`,
-			t.TaskID, t.AgentID, t.TraceType, t.Content, t.DurationMs,
-		).Scan(&id)
-		if err == nil {
-			ids = append(ids, id)
-			if t.TraceType == "error" && t.AgentID != "" {
-				go CreateNotificationInternal(t.AgentID, "trace_error", "Agent error trace",
-					fmt.Sprintf("Error trace recorded for agent %s", t.AgentID))
-			}
-		}
+	resp := map[string]string{"id": id}
+	if req.SpanID != "" {
+		resp["trace_id"], resp["span_id"] = req.TraceID, req.SpanID
 	}
-	respondJSON(w, 201, map[string]interface{}{"inserted": len(ids), "ids": ids})
+	respondJSON(w, 201, resp)
 }
 
 // GetAgentTraces handles GET /api/agents/{id}/traces
@@ -164,7 +302,7 @@ func (h *TraceHandler) GetAgentTraces(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := db.DB.Query(
-		`SELECT id, task_id, agent_id, trace_type, content, created_at, duration_ms
+		`SELECT `+traceCols+`
 		 FROM agent_traces WHERE agent_id = $1 ORDER BY created_at DESC LIMIT $2`,
 		agentID, limit,
 	)
@@ -176,8 +314,8 @@ func (h *TraceHandler) GetAgentTraces(w http.ResponseWriter, r *http.Request) {
 
 	traces := []AgentTrace{}
 	for rows.Next() {
-		var t AgentTrace
-		if err := rows.Scan(&t.ID, &t.TaskID, &t.AgentID, &t.TraceType, &t.Content, &t.CreatedAt, &t.DurationMs); err != nil {
+		t, err := scanTrace(rows)
+		if err != nil {
 			respondError(w, 500, err.Error())
 			return
 		}
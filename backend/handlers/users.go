@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserHandler struct{}
+
+// User is a dashboard account. Password hashes and invite tokens never leave the backend.
+type User struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	Disabled    bool       `json:"disabled"`
+	Pending     bool       `json:"pending"` // invited or reset, no password set yet
+	SSO         bool       `json:"sso"`     // signs in through the OIDC provider
+	LastLogin   *time.Time `json:"last_login"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// AuthUser is the identity RequireAuth attaches to a request.
+type AuthUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+const userCols = `id, username, display_name, email, role, disabled,
+	password_hash IS NULL AND oidc_subject IS NULL, oidc_subject IS NOT NULL, last_login, created_at`
+
+// Invite and reset links stay valid for this long unless the caller overrides it.
+const defaultInviteTTL = 72 * time.Hour
+
+func scanUser(scanner interface{ Scan(...interface{}) error }) (User, error) {
+	var u User
+	var lastLogin sql.NullTime
+	err := scanner.Scan(&u.ID, &u.Username, &u.DisplayName, &u.Email, &u.Role,
+		&u.Disabled, &u.Pending, &u.SSO, &lastLogin, &u.CreatedAt)
+	if lastLogin.Valid {
+		u.LastLogin = &lastLogin.Time
+	}
+	return u, err
+}
+
+func validRole(role string) bool {
+	_, ok := roleLevel[role]
+	return ok
+}
+
+// newInviteToken returns a random plaintext token and the sha256 hex stored in the DB.
+// Tokens carry 256 bits of entropy, so a fast hash is enough and keeps lookups indexed.
+func newInviteToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	plaintext := hex.EncodeToString(raw)
+	return plaintext, hashInviteToken(plaintext), nil
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// EnsureBootstrapAdmin creates the first admin account when the users table is empty.
+// The password comes from AGENTBOARD_PASSWORD / AGENTBOARD_PASSWORD_HASH, so existing
+// single-password deployments keep working after upgrading.
+func EnsureBootstrapAdmin() {
+	var count int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count); err != nil {
+		log.Printf("⚠️  users: failed to count users: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	username := os.Getenv("AGENTBOARD_ADMIN_USER")
+	if username == "" {
+		username = "admin"
+	}
+	_, err := db.DB.Exec(
+		`INSERT INTO users (username, display_name, password_hash, role) VALUES ($1, $1, $2, 'admin')`,
+		username, getPasswordHash(),
+	)
+	if err != nil {
+		log.Printf("⚠️  users: failed to create bootstrap admin: %v", err)
+		return
+	}
+	log.Printf("✅ Created bootstrap admin user %q", username)
+}
+
+// loadAuthUser resolves a token subject to an active user.
+func loadAuthUser(id string) (*AuthUser, bool) {
+	var u AuthUser
+	err := db.DB.QueryRow(
+		`SELECT id, username, role FROM users WHERE id = $1 AND disabled = false`, id,
+	).Scan(&u.ID, &u.Username, &u.Role)
+	if err != nil {
+		return nil, false
+	}
+	return &u, true
+}
+
+// isLastActiveAdmin reports whether id is the only enabled admin left.
+func isLastActiveAdmin(id string) bool {
+	var others int
+	db.DB.QueryRow(
+		`SELECT COUNT(*) FROM users WHERE role = 'admin' AND disabled = false AND id != $1`, id,
+	).Scan(&others)
+	return others == 0
+}
+
+// ListUsers handles GET /api/users
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.Query(`SELECT ` + userCols + ` FROM users ORDER BY created_at ASC`)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		users = append(users, u)
+	}
+	respondJSON(w, http.StatusOK, users)
+}
+
+// InviteUser handles POST /api/users
+// Creates a pending account and returns a one-time invite token the user redeems
+// via POST /api/auth/accept-invite to set their password.
+func (h *UserHandler) InviteUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username       string `json:"username"`
+		DisplayName    string `json:"display_name"`
+		Email          string `json:"email"`
+		Role           string `json:"role"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		respondError(w, http.StatusBadRequest, "username is required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = "member"
+	}
+	if !validRole(req.Role) {
+		respondError(w, http.StatusBadRequest, "role must be admin, member, or viewer")
+		return
+	}
+	if req.DisplayName == "" {
+		req.DisplayName = req.Username
+	}
+	ttl := defaultInviteTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	token, tokenHash, err := newInviteToken()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to generate invite token")
+		return
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	u, err := scanUser(db.DB.QueryRow(
+		`INSERT INTO users (username, display_name, email, role, invite_token_hash, invite_expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (username) DO NOTHING
+		 RETURNING `+userCols,
+		req.Username, req.DisplayName, req.Email, req.Role, tokenHash, expiresAt,
+	))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusConflict, "username already exists")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	go LogAudit(getAgentFromContext(r), "user_invited", "user", u.ID, map[string]interface{}{"username": u.Username, "role": u.Role})
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"user":              u,
+		"invite_token":      token,
+		"invite_expires_at": expiresAt,
+	})
+}
+
+// UpdateUser handles PUT /api/users/{id}
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req struct {
+		DisplayName *string `json:"display_name"`
+		Email       *string `json:"email"`
+		Role        *string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.Role != nil {
+		if !validRole(*req.Role) {
+			respondError(w, http.StatusBadRequest, "role must be admin, member, or viewer")
+			return
+		}
+		if *req.Role != "admin" && isLastActiveAdmin(id) {
+			respondError(w, http.StatusConflict, "cannot demote the last active admin")
+			return
+		}
+	}
+
+	u, err := scanUser(db.DB.QueryRow(
+		`UPDATE users SET display_name = COALESCE($1, display_name),
+		                  email        = COALESCE($2, email),
+		                  role         = COALESCE($3, role)
+		 WHERE id = $4
+		 RETURNING `+userCols,
+		req.DisplayName, req.Email, req.Role, id,
+	))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	go LogAudit(getAgentFromContext(r), "user_updated", "user", u.ID, map[string]interface{}{"role": u.Role})
+	respondJSON(w, http.StatusOK, u)
+}
+
+// DisableUser handles POST /api/users/{id}/disable
+func (h *UserHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// EnableUser handles POST /api/users/{id}/enable
+func (h *UserHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *UserHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id := mux.Vars(r)["id"]
+	if disabled && isLastActiveAdmin(id) {
+		var role string
+		db.DB.QueryRow(`SELECT role FROM users WHERE id = $1`, id).Scan(&role)
+		if role == "admin" {
+			respondError(w, http.StatusConflict, "cannot disable the last active admin")
+			return
+		}
+	}
+
+	u, err := scanUser(db.DB.QueryRow(
+		`UPDATE users SET disabled = $1 WHERE id = $2 RETURNING `+userCols, disabled, id,
+	))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	action := "user_enabled"
+	if disabled {
+		action = "user_disabled"
+		revokeUserSessions(u.ID, "user_disabled")
+	}
+	go LogAudit(getAgentFromContext(r), action, "user", u.ID, map[string]interface{}{"username": u.Username})
+	respondJSON(w, http.StatusOK, u)
+}
+
+// ResetUser handles POST /api/users/{id}/reset
+// Clears the user's password and issues a fresh one-time token for accept-invite.
+func (h *UserHandler) ResetUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	token, tokenHash, err := newInviteToken()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to generate reset token")
+		return
+	}
+	expiresAt := time.Now().Add(defaultInviteTTL)
+
+	u, err := scanUser(db.DB.QueryRow(
+		`UPDATE users SET password_hash = NULL, invite_token_hash = $1, invite_expires_at = $2
+		 WHERE id = $3
+		 RETURNING `+userCols,
+		tokenHash, expiresAt, id,
+	))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	revokeUserSessions(u.ID, "user_reset")
+	go LogAudit(getAgentFromContext(r), "user_reset", "user", u.ID, map[string]interface{}{"username": u.Username})
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user":              u,
+		"invite_token":      token,
+		"invite_expires_at": expiresAt,
+	})
+}
+
+// AcceptInvite handles POST /api/auth/accept-invite
+// Redeems an invite or reset token and sets the account password.
+func (h *UserHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if req.Token == "" {
+		respondError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+	if len(req.Password) < 8 {
+		respondError(w, http.StatusBadRequest, "password must be at least 8 characters")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+
+	u, err := scanUser(db.DB.QueryRow(
+		`UPDATE users SET password_hash = $1, invite_token_hash = NULL, invite_expires_at = NULL
+		 WHERE invite_token_hash = $2 AND invite_expires_at > NOW() AND disabled = false
+		 RETURNING `+userCols,
+		string(hash), hashInviteToken(req.Token),
+	))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	go LogAudit(u.ID, "user_password_set", "user", u.ID, nil)
+	respondJSON(w, http.StatusOK, u)
+}
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alghanim/agentboard/backend/db"
+	"github.com/gorilla/mux"
+)
+
+// ─── Webhook delivery queue ──────────────────────────────────────────────────
+//
+// Deliveries move pending → delivered, or pending → retrying → … → failed once
+// max_attempts is reached, backing off exponentially between attempts. A
+// webhook whose deliveries fail outright webhookDisableAfter times in a row is
+// deactivated. Deliveries of inactive webhooks wait until it is re-activated.
+
+const (
+	webhookMaxAttempts  = 10
+	webhookBackoffBase  = 15 * time.Second
+	webhookBackoffMax   = time.Hour
+	webhookDisableAfter = 5
+	webhookTimeout      = 10 * time.Second
+	webhookWorkers      = 4
+	webhookBatch        = 20
+	webhookLease        = 2 * time.Minute // a claimed delivery is retried after this if the sender dies
+	webhookSnippetBytes = 1024
+	webhookPollInterval = 5 * time.Second
+)
+
+type WebhookDelivery struct {
+	ID              string     `json:"id"`
+	WebhookID       string     `json:"webhook_id"`
+	Event           string     `json:"event"`
+	URL             string     `json:"url"`
+	Payload         RawJSON    `json:"payload"`
+	Status          string     `json:"status"`
+	Attempts        int        `json:"attempts"`
+	MaxAttempts     int        `json:"max_attempts"`
+	LastStatusCode  *int       `json:"last_status_code"`
+	LastLatencyMs   *int       `json:"last_latency_ms"`
+	LastError       string     `json:"last_error,omitempty"`
+	ResponseSnippet string     `json:"response_snippet,omitempty"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	DeliveredAt     *time.Time `json:"delivered_at"`
+	RedeliveryOf    *string    `json:"redelivery_of,omitempty"`
+}
+
+// RawJSON embeds stored JSON text verbatim in a response.
+type RawJSON string
+
+func (j RawJSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+var webhookWake = make(chan struct{}, 1)
+
+// wakeWebhookDispatcher nudges the dispatcher to look for due deliveries now.
+func wakeWebhookDispatcher() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartWebhookDispatcher sends queued webhook deliveries until the process exits.
+func StartWebhookDispatcher() {
+	log.Println("[webhooks] Delivery dispatcher started")
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	client := &http.Client{Timeout: webhookTimeout}
+	for {
+		for dispatchDueWebhooks(client) == webhookBatch {
+			// Full batch: there may be more due right away.
+		}
+		select {
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+type queuedDelivery struct {
+	id, webhookID, event, url, body, secret string
+	attempts, maxAttempts                   int
+	redelivery                              bool
+}
+
+// dispatchDueWebhooks claims up to webhookBatch due deliveries, sends them and
+// returns how many it claimed.
+func dispatchDueWebhooks(client *http.Client) int {
+	rows, err := db.DB.Query(`
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + $1 * INTERVAL '1 second'
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT q.id FROM webhook_deliveries q JOIN webhooks qw ON qw.id = q.webhook_id
+			WHERE q.status IN ('pending', 'retrying') AND q.next_attempt_at <= NOW() AND qw.active = true
+			ORDER BY q.next_attempt_at
+			LIMIT $2
+			FOR UPDATE OF q SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event, d.url, d.body, COALESCE(w.secret, ''),
+		          d.attempts, d.max_attempts, d.redelivery_of IS NOT NULL`,
+		int(webhookLease.Seconds()), webhookBatch)
+	if err != nil {
+		log.Printf("[webhooks] claim error: %v", err)
+		return 0
+	}
+	var batch []queuedDelivery
+	for rows.Next() {
+		var d queuedDelivery
+		if err := rows.Scan(&d.id, &d.webhookID, &d.event, &d.url, &d.body, &d.secret,
+			&d.attempts, &d.maxAttempts, &d.redelivery); err == nil {
+			batch = append(batch, d)
+		}
+	}
+	rows.Close()
+
+	sem := make(chan struct{}, webhookWorkers)
+	done := make(chan struct{})
+	for _, d := range batch {
+		sem <- struct{}{}
+		go func(d queuedDelivery) {
+			defer func() { <-sem; done <- struct{}{} }()
+			attemptDelivery(client, d)
+		}(d)
+	}
+	for range batch {
+		<-done
+	}
+	return len(batch)
+}
+
+// attemptDelivery sends one delivery and records the outcome.
+func attemptDelivery(client *http.Client, d queuedDelivery) {
+	body := []byte(d.body)
+	var statusCode *int
+	var snippet, errMsg string
+
+	start := time.Now()
+	req, err := http.NewRequest("POST", d.url, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-AgentBoard-Event", d.event)
+		req.Header.Set("X-AgentBoard-Delivery", d.id)
+		req.Header.Set("User-Agent", "AgentBoard-Webhook/1.0")
+		if d.redelivery {
+			req.Header.Set("X-AgentBoard-Redelivery", "true")
+		}
+		if d.secret != "" {
+			req.Header.Set("X-Webhook-Signature", signWebhookBody(d.secret, body))
+		}
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err == nil {
+			code := resp.StatusCode
+			statusCode = &code
+			b, _ := io.ReadAll(io.LimitReader(resp.Body, webhookSnippetBytes))
+			snippet = string(bytes.ToValidUTF8(b, nil))
+			resp.Body.Close()
+			if code < 200 || code > 299 {
+				err = fmt.Errorf("receiver returned %d", code)
+			}
+		}
+	}
+	latency := int(time.Since(start).Milliseconds())
+	attempts := d.attempts + 1
+
+	if err == nil {
+		db.DB.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'delivered', attempts = $2, last_status_code = $3, last_latency_ms = $4,
+			    last_error = NULL, response_snippet = $5, delivered_at = NOW(), next_attempt_at = NULL
+			WHERE id = $1`, d.id, attempts, statusCode, latency, snippet)
+		db.DB.Exec(`UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1 AND consecutive_failures > 0`, d.webhookID)
+		return
+	}
+
+	errMsg = err.Error()
+	if attempts < d.maxAttempts {
+		backoff := webhookBackoffBase << uint(attempts-1)
+		if backoff > webhookBackoffMax || backoff <= 0 {
+			backoff = webhookBackoffMax
+		}
+		db.DB.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'retrying', attempts = $2, last_status_code = $3, last_latency_ms = $4,
+			    last_error = $5, response_snippet = $6, next_attempt_at = $7
+			WHERE id = $1`, d.id, attempts, statusCode, latency, errMsg, snippet, time.Now().Add(backoff))
+		return
+	}
+
+	log.Printf("[webhooks] delivery %s to %s failed after %d attempts: %s", d.id, d.url, attempts, errMsg)
+	db.DB.Exec(`
+		UPDATE webhook_deliveries
+		SET status = 'failed', attempts = $2, last_status_code = $3, last_latency_ms = $4,
+		    last_error = $5, response_snippet = $6, next_attempt_at = NULL
+		WHERE id = $1`, d.id, attempts, statusCode, latency, errMsg, snippet)
+	recordWebhookFailure(d.webhookID)
+}
+
+// recordWebhookFailure counts a dead delivery and disables the webhook once
+// webhookDisableAfter deliveries in a row have failed.
+func recordWebhookFailure(webhookID string) {
+	var failures int
+	var active bool
+	err := db.DB.QueryRow(`
+		UPDATE webhooks SET consecutive_failures = consecutive_failures + 1
+		WHERE id = $1 RETURNING consecutive_failures, active`, webhookID,
+	).Scan(&failures, &active)
+	if err != nil || !active || failures < webhookDisableAfter {
+		return
+	}
+	reason := fmt.Sprintf("disabled after %d consecutive failed deliveries", failures)
+	db.DB.Exec(`UPDATE webhooks SET active = false, disabled_reason = $2, updated_at = NOW() WHERE id = $1`, webhookID, reason)
+	// Park whatever is still queued; it can be replayed after the receiver is fixed.
+	db.DB.Exec(`
+		UPDATE webhook_deliveries SET status = 'failed', last_error = 'webhook disabled', next_attempt_at = NULL
+		WHERE webhook_id = $1 AND status IN ('pending', 'retrying')`, webhookID)
+	log.Printf("⚠️  [webhooks] webhook %s %s", webhookID, reason)
+	go LogAudit("system", "webhook_disabled", "webhook", webhookID, map[string]interface{}{"reason": reason})
+	go CreateNotificationInternal("", "webhook_disabled", "Webhook disabled", "Webhook "+webhookID+" was "+reason)
+}
+
+const deliveryCols = `id, webhook_id, event, url, body, status, attempts, max_attempts,
+	last_status_code, last_latency_ms, COALESCE(last_error, ''), COALESCE(response_snippet, ''),
+	next_attempt_at, created_at, delivered_at, redelivery_of`
+
+func scanDelivery(scanner interface{ Scan(...interface{}) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var code, latency sql.NullInt64
+	var next, delivered sql.NullTime
+	var redeliveryOf sql.NullString
+	err := scanner.Scan(&d.ID, &d.WebhookID, &d.Event, &d.URL, &d.Payload, &d.Status, &d.Attempts, &d.MaxAttempts,
+		&code, &latency, &d.LastError, &d.ResponseSnippet, &next, &d.CreatedAt, &delivered, &redeliveryOf)
+	if redeliveryOf.Valid {
+		d.RedeliveryOf = &redeliveryOf.String
+	}
+	if code.Valid {
+		c := int(code.Int64)
+		d.LastStatusCode = &c
+	}
+	if latency.Valid {
+		l := int(latency.Int64)
+		d.LastLatencyMs = &l
+	}
+	if next.Valid {
+		d.NextAttemptAt = &next.Time
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return d, err
+}
+
+// ListDeliveries handles GET /api/webhooks/{id}/deliveries?status=failed&limit=50
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	query := `SELECT ` + deliveryCols + ` FROM webhook_deliveries WHERE webhook_id = $1`
+	args := []interface{}{id}
+	if status := r.URL.Query().Get("status"); status != "" {
+		args = append(args, status)
+		query += ` AND status = $2`
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY created_at DESC LIMIT $%d`, len(args))
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		deliveries = append(deliveries, d)
+	}
+	respondJSON(w, http.StatusOK, deliveries)
+}
+
+// ─── Redelivery ──────────────────────────────────────────────────────────────
+//
+// A redelivery is a new queued row with the original body, so the receiver
+// gets the original payload and timestamp, signed exactly as before, plus an
+// X-AgentBoard-Redelivery: true header.
+
+// webhookIsActive reports whether the webhook exists and is active, writing the
+// error response otherwise.
+func webhookIsActive(w http.ResponseWriter, id string) bool {
+	var active bool
+	err := db.DB.QueryRow(`SELECT active FROM webhooks WHERE id = $1`, id).Scan(&active)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Webhook not found")
+		return false
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !active {
+		respondError(w, http.StatusConflict, "Webhook is inactive; re-activate it before redelivering")
+		return false
+	}
+	return true
+}
+
+// RedeliverDelivery handles POST /api/webhooks/{id}/deliveries/{delivery_id}/redeliver
+func (h *WebhookHandler) RedeliverDelivery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !webhookIsActive(w, vars["id"]) {
+		return
+	}
+	d, err := scanDelivery(db.DB.QueryRow(`
+		INSERT INTO webhook_deliveries (webhook_id, event, url, body, max_attempts, redelivery_of)
+		SELECT d.webhook_id, d.event, w.url, d.body, $3, d.id
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.id = $2 AND d.webhook_id = $1
+		RETURNING `+deliveryCols,
+		vars["id"], vars["delivery_id"], webhookMaxAttempts))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "Delivery not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wakeWebhookDispatcher()
+	go LogAudit(getAgentFromContext(r), "webhook_redelivered", "webhook", vars["id"], map[string]interface{}{"delivery_id": vars["delivery_id"]})
+	respondJSON(w, http.StatusAccepted, d)
+}
+
+// ReplayFailedDeliveries handles POST /api/webhooks/{id}/deliveries/replay
+// Body: {"since": "2024-05-01T00:00:00Z"}. Re-queues every failed delivery
+// created since then that has not already been redelivered (or whose
+// redelivery failed too).
+func (h *WebhookHandler) ReplayFailedDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req struct {
+		Since time.Time `json:"since"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Since.IsZero() {
+		respondError(w, http.StatusBadRequest, "since (RFC 3339 timestamp) is required")
+		return
+	}
+	if !webhookIsActive(w, id) {
+		return
+	}
+
+	rows, err := db.DB.Query(`
+		INSERT INTO webhook_deliveries (webhook_id, event, url, body, max_attempts, redelivery_of)
+		SELECT d.webhook_id, d.event, w.url, d.body, $3, d.id
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.webhook_id = $1 AND d.status = 'failed' AND d.created_at >= $2
+		  AND NOT EXISTS (
+			SELECT 1 FROM webhook_deliveries rd WHERE rd.redelivery_of = d.id AND rd.status <> 'failed'
+		  )
+		ORDER BY d.created_at
+		RETURNING id`,
+		id, req.Since, webhookMaxAttempts)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var newID string
+		if rows.Scan(&newID) == nil {
+			ids = append(ids, newID)
+		}
+	}
+	if len(ids) > 0 {
+		wakeWebhookDispatcher()
+	}
+	go LogAudit(getAgentFromContext(r), "webhook_replayed", "webhook", id, map[string]interface{}{
+		"since": req.Since, "count": len(ids),
+	})
+	respondJSON(w, http.StatusAccepted, map[string]interface{}{"queued": len(ids), "delivery_ids": ids})
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ─── Webhook event catalogue ─────────────────────────────────────────────────
+//
+// Every event a webhook can subscribe to is listed here with a JSON Schema of
+// its delivery body. Each body carries the common envelope (event,
+// schema_version, timestamp) next to the event's own fields. Adding fields is
+// backwards compatible; renaming or removing one means bumping Version.
+
+const (
+	EventTaskCreated         = "task_created"
+	EventTaskUpdated         = "task_updated"
+	EventTaskAssigned        = "task_assigned"
+	EventTaskDeleted         = "task_deleted"
+	EventTaskCommented       = "task_commented"
+	EventTaskDone            = "task_done"
+	EventTaskFailed          = "task_failed"
+	EventAgentStatusChanged  = "agent_status_changed"
+	EventAgentPaused         = "agent_paused"
+	EventAgentResumed        = "agent_resumed"
+	EventAgentKilled         = "agent_killed"
+	EventAgentOffline        = "agent_offline"
+	EventAgentError          = "agent_error"
+	EventAlertFired          = "alert_fired"
+	EventAlertAcknowledged   = "alert_acknowledged"
+	EventAlertResolved       = "alert_resolved"
+	EventSLABreached         = "sla_breached"
+	EventIncidentOpened      = "incident_opened"
+	EventIncidentUpdated     = "incident_updated"
+	EventIncidentResolved    = "incident_resolved"
+	EventEvaluationRecorded  = "evaluation_recorded"
+	EventSoulUpdated         = "soul_updated"
+	EventNotificationCreated = "notification.created"
+
+	// Direct events go to one specific webhook and can't be subscribed to.
+	EventAlertTriggered = "alert_triggered"
+	EventWorkflowRule   = "workflow_rule"
+	EventTest           = "test"
+)
+
+// WebhookEventType describes one event in the catalogue.
+type WebhookEventType struct {
+	Name        string                 `json:"name"`
+	Version     int                    `json:"version"`
+	Category    string                 `json:"category"`
+	Description string                 `json:"description"`
+	Direct      bool                   `json:"direct,omitempty"` // delivered to a single webhook, not by subscription
+	Schema      map[string]interface{} `json:"schema"`
+}
+
+// Schema building helpers, to keep the catalogue below readable.
+
+type schemaProps map[string]interface{}
+
+func schemaType(t, desc string) map[string]interface{} {
+	return map[string]interface{}{"type": t, "description": desc}
+}
+
+func schemaStr(desc string) map[string]interface{}  { return schemaType("string", desc) }
+func schemaNum(desc string) map[string]interface{}  { return schemaType("number", desc) }
+func schemaBool(desc string) map[string]interface{} { return schemaType("boolean", desc) }
+func schemaNullStr(desc string) map[string]interface{} {
+	return schemaType("string", desc+" (empty when not set)")
+}
+
+func schemaStrList(desc string) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": desc}
+}
+
+func schemaObject(desc string, props schemaProps, required ...string) map[string]interface{} {
+	s := map[string]interface{}{"type": "object", "properties": map[string]interface{}(props)}
+	if desc != "" {
+		s["description"] = desc
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+var taskSchema = schemaObject("The task as stored after the change", schemaProps{
+	"id":             schemaStr("Task UUID"),
+	"title":          schemaStr("Title"),
+	"description":    schemaStr("Description"),
+	"status":         schemaStr("Workflow status"),
+	"priority":       schemaStr("low, medium, high or critical"),
+	"assignee":       schemaStr("Assigned agent ID"),
+	"team":           schemaStr("Owning team"),
+	"due_date":       schemaType("string", "RFC 3339 due date"),
+	"parent_task_id": schemaStr("Parent task UUID"),
+	"labels":         schemaStrList("Labels"),
+	"created_at":     schemaStr("RFC 3339"),
+	"updated_at":     schemaStr("RFC 3339"),
+}, "id", "title", "status", "priority")
+
+// eventSchema wraps an event's own properties in the common envelope.
+func eventSchema(name string, version int, props schemaProps, required ...string) map[string]interface{} {
+	all := schemaProps{
+		"event":          map[string]interface{}{"const": name},
+		"schema_version": map[string]interface{}{"const": version},
+		"timestamp":      schemaStr("RFC 3339 time the event was raised (unchanged on retries and redeliveries)"),
+	}
+	for k, v := range props {
+		all[k] = v
+	}
+	s := schemaObject("", all, append([]string{"event", "schema_version", "timestamp"}, required...)...)
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = fmt.Sprintf("agentboard:webhook:%s:v%d", name, version)
+	return s
+}
+
+func newEventType(name, category, desc string, props schemaProps, required ...string) WebhookEventType {
+	return WebhookEventType{
+		Name: name, Version: 1, Category: category, Description: desc,
+		Schema: eventSchema(name, 1, props, required...),
+	}
+}
+
+var webhookEventCatalogue = func() map[string]WebhookEventType {
+	actor := schemaStr("User or agent that caused the event (\"system\" for background jobs)")
+	agentChange := schemaProps{
+		"agent_id":        schemaStr("Agent ID"),
+		"previous_status": schemaStr("Status before the change"),
+		"actor":           actor,
+	}
+	alert := schemaProps{
+		"alert_id": schemaStr("Alert history UUID"),
+		"rule_id":  schemaStr("Alert rule UUID"),
+		"rule":     schemaStr("Alert rule name"),
+		"agent_id": schemaNullStr("Agent the alert is about"),
+		"message":  schemaStr("Alert message"),
+	}
+	incident := schemaProps{
+		"incident_id": schemaStr("Incident UUID"),
+		"title":       schemaStr("Title"),
+		"severity":    schemaStr("low, medium, high or critical"),
+		"status":      schemaStr("open, investigating, mitigating, resolved or closed"),
+	}
+	with := func(base schemaProps, extra schemaProps) schemaProps {
+		out := schemaProps{}
+		for k, v := range base {
+			out[k] = v
+		}
+		for k, v := range extra {
+			out[k] = v
+		}
+		return out
+	}
+
+	events := []WebhookEventType{
+		newEventType(EventTaskCreated, "tasks", "A task was created.",
+			schemaProps{"task": taskSchema, "actor": actor}, "task"),
+		newEventType(EventTaskUpdated, "tasks", "A task's fields were edited.",
+			schemaProps{"task": taskSchema, "actor": actor}, "task"),
+		newEventType(EventTaskAssigned, "tasks", "A task was assigned to an agent.",
+			schemaProps{
+				"task_id":           schemaStr("Task UUID"),
+				"assignee":          schemaStr("New assignee"),
+				"previous_assignee": schemaNullStr("Previous assignee"),
+				"actor":             actor,
+			}, "task_id", "assignee"),
+		newEventType(EventTaskDeleted, "tasks", "A task was deleted.",
+			schemaProps{"task_id": schemaStr("Task UUID"), "title": schemaStr("Title at deletion"), "actor": actor}, "task_id"),
+		newEventType(EventTaskCommented, "tasks", "A comment was added to a task.",
+			schemaProps{
+				"task_id":    schemaStr("Task UUID"),
+				"comment_id": schemaStr("Comment UUID"),
+				"author":     schemaStr("Comment author"),
+				"content":    schemaStr("Comment text"),
+			}, "task_id", "comment_id"),
+		newEventType(EventTaskDone, "tasks", "A task was moved to done.",
+			schemaProps{"task_id": schemaStr("Task UUID"), "from_status": schemaStr("Previous status"), "changed_by": actor}, "task_id"),
+		newEventType(EventTaskFailed, "tasks", "A task was moved to blocked.",
+			schemaProps{"task_id": schemaStr("Task UUID"), "from_status": schemaStr("Previous status"), "changed_by": actor}, "task_id"),
+
+		newEventType(EventAgentStatusChanged, "agents", "An agent's status changed.",
+			schemaProps{
+				"agent_id": schemaStr("Agent ID"),
+				"from":     schemaStr("Previous status"),
+				"to":       schemaStr("New status"),
+				"source":   schemaStr("What noticed the change: poller, health_check or api"),
+			}, "agent_id", "from", "to", "source"),
+		newEventType(EventAgentPaused, "agents", "An agent was paused.", agentChange, "agent_id"),
+		newEventType(EventAgentResumed, "agents", "A paused or killed agent was resumed.", agentChange, "agent_id"),
+		newEventType(EventAgentKilled, "agents", "An agent was killed.", agentChange, "agent_id"),
+		newEventType(EventAgentOffline, "agents", "An agent's status was set to offline through the API.",
+			schemaProps{"agent_id": schemaStr("Agent ID"), "status": schemaStr("Always offline")}, "agent_id"),
+		newEventType(EventAgentError, "agents", "An agent logged an error or failure activity.",
+			schemaProps{
+				"agent_id": schemaStr("Agent ID"),
+				"action":   schemaStr("Activity action"),
+				"task_id":  schemaNullStr("Related task"),
+			}, "agent_id", "action"),
+
+		newEventType(EventAlertFired, "alerts", "An alert rule fired.", alert, "alert_id", "rule_id", "message"),
+		newEventType(EventAlertAcknowledged, "alerts", "A fired alert was acknowledged.",
+			with(alert, schemaProps{"acknowledged_by": actor}), "alert_id", "rule_id"),
+		newEventType(EventAlertResolved, "alerts", "A firing alert's condition cleared.", alert, "alert_id", "rule_id", "message"),
+		newEventType(EventSLABreached, "alerts", "An SLA breach reached the last escalation step of an sla_breach rule.",
+			schemaProps{
+				"task_id":   schemaStr("Task UUID"),
+				"title":     schemaStr("Task title"),
+				"priority":  schemaStr("Task priority"),
+				"team":      schemaNullStr("Task team"),
+				"assignee":  schemaNullStr("Assigned agent"),
+				"policy_id": schemaStr("SLA policy UUID"),
+				"policy":    schemaStr("SLA policy name"),
+				"target":    schemaStr("response or resolution"),
+				"due_at":    schemaStr("RFC 3339 time the target was due"),
+				"level":     schemaNum("Escalation level (3 = webhook)"),
+				"message":   schemaStr("Breach description"),
+			}, "task_id", "policy_id", "target"),
+
+		newEventType(EventIncidentOpened, "incidents", "An incident was opened, manually or automatically.",
+			with(incident, schemaProps{
+				"task_ids":  schemaStrList("Related tasks"),
+				"agent_ids": schemaStrList("Related agents"),
+				"automatic": schemaBool("Opened by error detection rather than a user"),
+			}), "incident_id", "title", "severity"),
+		newEventType(EventIncidentUpdated, "incidents", "An incident's fields changed or an automatic timeline entry was added.",
+			with(incident, schemaProps{"changed": schemaStrList("Names of the changed fields")}), "incident_id", "changed"),
+		newEventType(EventIncidentResolved, "incidents", "An incident was resolved or closed.",
+			with(incident, schemaProps{"resolved_at": schemaStr("RFC 3339")}), "incident_id", "status"),
+
+		newEventType(EventEvaluationRecorded, "quality", "A quality evaluation was recorded.",
+			schemaProps{
+				"evaluation_id": schemaStr("Evaluation UUID"),
+				"task_id":       schemaNullStr("Evaluated task"),
+				"agent_id":      schemaNullStr("Evaluated agent"),
+				"score":         schemaNum("Score from 0 to 100"),
+				"evaluator":     schemaStr("Who or what produced the score"),
+				"criteria":      schemaType("object", "Per-criterion scores"),
+			}, "evaluation_id", "score"),
+		newEventType(EventSoulUpdated, "agents", "One of an agent's workspace files (SOUL.md, MEMORY.md, HEARTBEAT.md, AGENTS.md) was edited.",
+			schemaProps{
+				"agent_id": schemaStr("Agent ID"),
+				"file":     schemaStr("memory, soul, heartbeat or agents"),
+				"filename": schemaStr("File name written"),
+				"bytes":    schemaNum("New file size"),
+				"actor":    actor,
+			}, "agent_id", "file"),
+
+		newEventType(EventNotificationCreated, "notifications", "An in-app notification was created.",
+			schemaProps{
+				"id":       schemaStr("Notification UUID"),
+				"agent_id": schemaNullStr("Recipient"),
+				"type":     schemaStr("Notification type"),
+				"title":    schemaStr("Title"),
+			}, "id", "type"),
+	}
+
+	alertTriggered := newEventType(EventAlertTriggered, "alerts", "Sent to an alert rule's own notification webhook when it fires and when it resolves.",
+		schemaProps{
+			"rule": schemaStr("Alert rule name"), "agent_id": schemaNullStr("Agent"), "message": schemaStr("Alert message"),
+			"state": schemaStr("firing, or resolved once the condition cleared"),
+		}, "rule", "message")
+	alertTriggered.Direct = true
+	test := newEventType(EventTest, "webhooks", "Sent by POST /api/webhooks/{id}/test.",
+		schemaProps{"message": schemaStr("Fixed test message"), "webhook_id": schemaStr("Webhook UUID")})
+	test.Direct = true
+	workflowRule := newEventType(EventWorkflowRule, "tasks", "Sent to the webhook named by a workflow rule's webhook action.",
+		schemaProps{
+			"rule_id": schemaStr("Workflow rule UUID"), "rule": schemaStr("Workflow rule name"),
+			"task_id": schemaStr("Task UUID"), "title": schemaStr("Task title"),
+			"from_status": schemaStr("Status the task left"), "to_status": schemaStr("Status the task entered"),
+			"message": schemaNullStr("Action text, placeholders filled in"),
+		}, "rule_id", "rule", "task_id", "to_status")
+	workflowRule.Direct = true
+	events = append(events, alertTriggered, workflowRule, test)
+
+	m := make(map[string]WebhookEventType, len(events))
+	for _, e := range events {
+		m[e.Name] = e
+	}
+	return m
+}()
+
+// webhookEventVersion returns the schema version stamped on event's body.
+func webhookEventVersion(event string) int {
+	if e, ok := webhookEventCatalogue[event]; ok {
+		return e.Version
+	}
+	return 1
+}
+
+// validateWebhookEvents checks that every name is a subscribable catalogue
+// event and returns a readable error listing the ones that aren't.
+func validateWebhookEvents(events []string) error {
+	var bad []string
+	for _, ev := range events {
+		if e, ok := webhookEventCatalogue[ev]; !ok || e.Direct {
+			bad = append(bad, ev)
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("unknown webhook event(s): %s (see GET /api/webhooks/events)", strings.Join(bad, ", "))
+	}
+	return nil
+}
+
+// ListWebhookEvents handles GET /api/webhooks/events
+func (h *WebhookHandler) ListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	out := make([]WebhookEventType, 0, len(webhookEventCatalogue))
+	for _, e := range webhookEventCatalogue {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Category != out[j].Category {
+			return out[i].Category < out[j].Category
+		}
+		return out[i].Name < out[j].Name
+	})
+	respondJSON(w, http.StatusOK, out)
+}
@@ -14,20 +14,21 @@ import (
 type WebhookHandler struct{}
 
 type Webhook struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	URL       string    `json:"url"`
-	Events    []string  `json:"events"`
-	Secret    string    `json:"secret,omitempty"`
-	Active    bool      `json:"active"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	URL            string    `json:"url"`
+	Events         []string  `json:"events"`
+	Secret         string    `json:"secret,omitempty"`
+	Active         bool      `json:"active"`
+	DisabledReason string    `json:"disabled_reason,omitempty"` // set when auto-disabled after failed deliveries
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 // ListWebhooks handles GET /api/webhooks
 func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.DB.Query(
-		`SELECT id, COALESCE(name,''), url, events, COALESCE(secret,''), active, created_at, updated_at
+		`SELECT id, COALESCE(name,''), url, events, COALESCE(secret,''), active, COALESCE(disabled_reason,''), created_at, updated_at
 		 FROM webhooks ORDER BY created_at DESC`)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
@@ -39,7 +40,7 @@ func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var wh Webhook
 		if err := rows.Scan(&wh.ID, &wh.Name, &wh.URL, pq.Array(&wh.Events),
-			&wh.Secret, &wh.Active, &wh.CreatedAt, &wh.UpdatedAt); err != nil {
+			&wh.Secret, &wh.Active, &wh.DisabledReason, &wh.CreatedAt, &wh.UpdatedAt); err != nil {
 			respondError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -69,21 +70,25 @@ func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "at least one event is required")
 		return
 	}
+	if err := validateWebhookEvents(data.Events); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	var wh Webhook
 	err := db.DB.QueryRow(
 		`INSERT INTO webhooks (name, url, events, secret)
 		 VALUES ($1, $2, $3, NULLIF($4,''))
-		 RETURNING id, COALESCE(name,''), url, events, COALESCE(secret,''), active, created_at, updated_at`,
+		 RETURNING id, COALESCE(name,''), url, events, COALESCE(secret,''), active, COALESCE(disabled_reason,''), created_at, updated_at`,
 		data.Name, data.URL, pq.Array(data.Events), data.Secret,
 	).Scan(&wh.ID, &wh.Name, &wh.URL, pq.Array(&wh.Events),
-		&wh.Secret, &wh.Active, &wh.CreatedAt, &wh.UpdatedAt)
+		&wh.Secret, &wh.Active, &wh.DisabledReason, &wh.CreatedAt, &wh.UpdatedAt)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	go LogAudit("user", "webhook_created", "webhook", wh.ID, map[string]interface{}{"name": wh.Name, "url": wh.URL})
+	go LogAudit(getAgentFromContext(r), "webhook_created", "webhook", wh.ID, map[string]interface{}{"name": wh.Name, "url": wh.URL})
 	respondJSON(w, http.StatusCreated, wh)
 }
 
@@ -102,6 +107,10 @@ func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if err := validateWebhookEvents(data.Events); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	var wh Webhook
 	err := db.DB.QueryRow(
@@ -111,12 +120,14 @@ func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
 		     events  = CASE WHEN array_length($3::text[], 1) > 0 THEN $3::text[] ELSE events END,
 		     secret  = CASE WHEN $4 <> '' THEN $4 ELSE secret END,
 		     active  = COALESCE($5, active),
+		     consecutive_failures = CASE WHEN $5 THEN 0 ELSE consecutive_failures END,
+		     disabled_reason = CASE WHEN $5 THEN NULL ELSE disabled_reason END,
 		     updated_at = NOW()
 		 WHERE id = $6
-		 RETURNING id, COALESCE(name,''), url, events, COALESCE(secret,''), active, created_at, updated_at`,
+		 RETURNING id, COALESCE(name,''), url, events, COALESCE(secret,''), active, COALESCE(disabled_reason,''), created_at, updated_at`,
 		data.Name, data.URL, pq.Array(data.Events), data.Secret, data.Active, id,
 	).Scan(&wh.ID, &wh.Name, &wh.URL, pq.Array(&wh.Events),
-		&wh.Secret, &wh.Active, &wh.CreatedAt, &wh.UpdatedAt)
+		&wh.Secret, &wh.Active, &wh.DisabledReason, &wh.CreatedAt, &wh.UpdatedAt)
 	if err == sql.ErrNoRows {
 		respondError(w, http.StatusNotFound, "Webhook not found")
 		return
@@ -141,7 +152,7 @@ func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusNotFound, "Webhook not found")
 		return
 	}
-	go LogAudit("user", "webhook_deleted", "webhook", id, nil)
+	go LogAudit(getAgentFromContext(r), "webhook_deleted", "webhook", id, nil)
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted"})
 }
 
@@ -166,11 +177,15 @@ func (h *WebhookHandler) TestWebhook(w http.ResponseWriter, r *http.Request) {
 		wh.Secret = secret.String
 	}
 
-	go TriggerWebhooksToURL(wh.URL, wh.Secret, "test", map[string]interface{}{
-		"event":      "test",
+	if !wh.Active {
+		respondError(w, http.StatusConflict, "Webhook is inactive")
+		return
+	}
+
+	go TriggerWebhooksToURL(wh.ID, EventTest, map[string]interface{}{
 		"webhook_id": wh.ID,
 		"message":    "This is a test webhook from AgentBoard",
 	})
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Test webhook dispatched"})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Test webhook queued"})
 }
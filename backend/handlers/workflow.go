@@ -1,79 +1,1124 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alghanim/agentboard/backend/db"
+	"github.com/alghanim/agentboard/backend/websocket"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
-// WorkflowRule represents a single workflow rule from a template.
+// ─── Workflow rules ──────────────────────────────────────────────────────────
+//
+// A rule fires when a task in its scope (everything, one template, one team,
+// or one label) makes a matching transition and all its conditions hold. Its
+// actions then run in order; a failing action stops the chain only when the
+// rule says so. Every firing is written to workflow_rule_runs.
+//
+// Templates keep their simple from/to/action/target rules in workflow_rules;
+// they are mirrored here as template-scoped rules with source 'template'.
+
+// Rule scopes.
+const (
+	RuleScopeGlobal   = "global"
+	RuleScopeTemplate = "template"
+	RuleScopeTeam     = "team"
+	RuleScopeLabel    = "label"
+)
+
+// maxRuleDepth bounds chains of rules transitioning other tasks, which could
+// otherwise ping-pong forever.
+const maxRuleDepth = 3
+
+// RuleCondition compares one task field against Value.
+type RuleCondition struct {
+	Field string      `json:"field"` // priority, labels, assignee, team, age_minutes, time_in_status_minutes
+	Op    string      `json:"op"`    // eq, neq, in, not_in, contains, not_contains, empty, not_empty, gt, gte, lt, lte
+	Value interface{} `json:"value,omitempty"`
+}
+
+// RuleAction is one step of a rule. Which fields matter depends on Type.
+// Text fields accept placeholders: {{task.id}}, {{task.title}},
+// {{task.assignee}}, {{task.priority}}, {{task.team}}, {{from}}, {{to}}, {{rule}}.
+type RuleAction struct {
+	Type      string `json:"type"`
+	Field     string `json:"field,omitempty"`      // set_field
+	Value     string `json:"value,omitempty"`      // set_field, add_label, assign, create_subtask
+	Text      string `json:"text,omitempty"`       // comment, message_agent, notify, create_incident (title)
+	AgentID   string `json:"agent_id,omitempty"`   // message_agent, notify; "assignee" means the task's assignee
+	WebhookID string `json:"webhook_id,omitempty"` // webhook
+	Status    string `json:"status,omitempty"`     // transition_dependents
+	Severity  string `json:"severity,omitempty"`   // create_incident
+}
+
+// WorkflowRule is a scoped, conditional chain of actions run on transitions.
 type WorkflowRule struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Enabled     bool            `json:"enabled"`
+	ScopeType   string          `json:"scope_type"`
+	ScopeValue  string          `json:"scope_value"`
+	FromStatus  string          `json:"from_status"` // "" or "*" matches any
+	ToStatus    string          `json:"to_status"`   // "" or "*" matches any
+	Conditions  []RuleCondition `json:"conditions"`
+	Actions     []RuleAction    `json:"actions"`
+	StopOnError bool            `json:"stop_on_error"`
+	Position    int             `json:"position"`
+	Source      string          `json:"source"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// legacyTemplateRule is the rule format stored on task templates.
+type legacyTemplateRule struct {
 	FromStatus string `json:"from_status"`
 	ToStatus   string `json:"to_status"`
 	Action     string `json:"action"`
 	Target     string `json:"target"`
 }
 
-// applyWorkflowRules checks all templates for matching workflow rules and executes actions.
-func applyWorkflowRules(taskID, fromStatus, toStatus string) {
-	rows, err := db.DB.Query(`SELECT workflow_rules FROM task_templates WHERE workflow_rules != '[]'::jsonb`)
+var ruleConditionOps = map[string]bool{
+	"eq": true, "neq": true, "in": true, "not_in": true, "contains": true, "not_contains": true,
+	"empty": true, "not_empty": true, "gt": true, "gte": true, "lt": true, "lte": true,
+}
+
+// orderingOps compare values; only numeric fields and priority have an order.
+var orderingOps = map[string]bool{"gt": true, "gte": true, "lt": true, "lte": true}
+
+// priorityRank orders priorities for gt/gte/lt/lte conditions.
+var priorityRank = map[string]int{"low": 1, "medium": 2, "high": 3, "urgent": 4, "critical": 5}
+
+var ruleConditionFields = map[string]bool{
+	"priority": true, "labels": true, "assignee": true, "team": true,
+	"age_minutes": true, "time_in_status_minutes": true,
+}
+
+// ruleSetFields maps fields set_field may change to their column.
+var ruleSetFields = map[string]string{
+	"priority":    "priority",
+	"assignee":    "assignee",
+	"team":        "team",
+	"title":       "title",
+	"description": "description",
+	"due_date":    "due_date",
+}
+
+var ruleActionTypes = map[string]bool{
+	"set_field": true, "add_label": true, "comment": true, "webhook": true, "message_agent": true,
+	"transition_dependents": true, "create_incident": true, "assign": true, "notify": true, "create_subtask": true,
+}
+
+func (rule *WorkflowRule) validate() error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch rule.ScopeType {
+	case "":
+		rule.ScopeType = RuleScopeGlobal
+	case RuleScopeGlobal:
+	case RuleScopeTemplate, RuleScopeTeam, RuleScopeLabel:
+		if rule.ScopeValue == "" {
+			return fmt.Errorf("scope_value is required for scope_type %q", rule.ScopeType)
+		}
+	default:
+		return fmt.Errorf("scope_type must be one of global, template, team, label")
+	}
+	for i, c := range rule.Conditions {
+		if !ruleConditionFields[c.Field] {
+			return fmt.Errorf("conditions[%d]: unknown field %q", i, c.Field)
+		}
+		if !ruleConditionOps[c.Op] {
+			return fmt.Errorf("conditions[%d]: unknown op %q", i, c.Op)
+		}
+		switch {
+		case c.Field == "age_minutes" || c.Field == "time_in_status_minutes":
+			if !orderingOps[c.Op] && c.Op != "eq" && c.Op != "neq" {
+				return fmt.Errorf("conditions[%d]: %s takes eq, neq, gt, gte, lt or lte", i, c.Field)
+			}
+		case orderingOps[c.Op] && c.Field != "priority":
+			return fmt.Errorf("conditions[%d]: %s has no order to compare with %s", i, c.Field, c.Op)
+		case orderingOps[c.Op]:
+			if v, _ := c.Value.(string); priorityRank[v] == 0 {
+				return fmt.Errorf("conditions[%d]: compare priority with one of low, medium, high, urgent, critical", i)
+			}
+		}
+	}
+	if len(rule.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	for i, a := range rule.Actions {
+		if !ruleActionTypes[a.Type] {
+			return fmt.Errorf("actions[%d]: unknown type %q", i, a.Type)
+		}
+		switch a.Type {
+		case "set_field":
+			if _, ok := ruleSetFields[a.Field]; !ok {
+				return fmt.Errorf("actions[%d]: set_field cannot change %q", i, a.Field)
+			}
+		case "add_label", "assign":
+			if a.Value == "" {
+				return fmt.Errorf("actions[%d]: %s needs a value", i, a.Type)
+			}
+		case "comment", "message_agent":
+			if a.Text == "" {
+				return fmt.Errorf("actions[%d]: %s needs text", i, a.Type)
+			}
+		case "webhook":
+			if a.WebhookID == "" {
+				return fmt.Errorf("actions[%d]: webhook needs a webhook_id", i)
+			}
+		case "transition_dependents":
+			if !statusNamePattern.MatchString(a.Status) {
+				return fmt.Errorf("actions[%d]: transition_dependents needs a valid status", i)
+			}
+		}
+	}
+	return nil
+}
+
+// ─── Task snapshot and matching ──────────────────────────────────────────────
+
+// ruleTask is the view of a task that rules are evaluated against.
+type ruleTask struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Status      string    `json:"status"`
+	Priority    string    `json:"priority"`
+	Assignee    string    `json:"assignee"`
+	Team        string    `json:"team"`
+	Labels      []string  `json:"labels"`
+	TemplateID  string    `json:"template_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	StatusSince time.Time `json:"status_since"`
+}
+
+func loadRuleTask(taskID string) (*ruleTask, error) {
+	var t ruleTask
+	var statusSince sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT t.id, t.title, t.status, COALESCE(t.priority, ''), COALESCE(t.assignee, ''), COALESCE(t.team, ''),
+		       COALESCE(t.labels, '{}'), COALESCE(t.template_id::text, ''), t.created_at,
+		       (SELECT MAX(h.changed_at) FROM task_history h WHERE h.task_id = t.id AND h.to_status = t.status)
+		FROM tasks t WHERE t.id = $1`, taskID,
+	).Scan(&t.ID, &t.Title, &t.Status, &t.Priority, &t.Assignee, &t.Team,
+		pq.Array(&t.Labels), &t.TemplateID, &t.CreatedAt, &statusSince)
 	if err != nil {
-		log.Printf("[workflow] Error querying templates: %v", err)
+		return nil, err
+	}
+	t.StatusSince = t.CreatedAt
+	if statusSince.Valid {
+		t.StatusSince = statusSince.Time
+	}
+	return &t, nil
+}
+
+func (rule *WorkflowRule) inScope(t *ruleTask) bool {
+	switch rule.ScopeType {
+	case RuleScopeTemplate:
+		return t.TemplateID == rule.ScopeValue
+	case RuleScopeTeam:
+		return t.Team == rule.ScopeValue
+	case RuleScopeLabel:
+		return containsString(t.Labels, rule.ScopeValue)
+	}
+	return true
+}
+
+func (rule *WorkflowRule) matchesTransition(from, to string) bool {
+	return (rule.FromStatus == "" || rule.FromStatus == "*" || rule.FromStatus == from) &&
+		(rule.ToStatus == "" || rule.ToStatus == "*" || rule.ToStatus == to)
+}
+
+// conditionResult reports how one condition evaluated, for dry runs and the log.
+type conditionResult struct {
+	RuleCondition
+	Actual interface{} `json:"actual"`
+	Passed bool        `json:"passed"`
+}
+
+func (c RuleCondition) eval(t *ruleTask, now time.Time) conditionResult {
+	res := conditionResult{RuleCondition: c}
+	switch c.Field {
+	case "labels":
+		res.Actual = t.Labels
+		res.Passed = evalListCondition(c, t.Labels)
+		return res
+	case "age_minutes", "time_in_status_minutes":
+		since := t.CreatedAt
+		if c.Field == "time_in_status_minutes" {
+			since = t.StatusSince
+		}
+		mins := now.Sub(since).Minutes()
+		res.Actual = int(mins)
+		res.Passed = evalNumberCondition(c, mins)
+		return res
+	}
+
+	if c.Field == "priority" && orderingOps[c.Op] {
+		res.Actual = t.Priority
+		res.Passed = evalPriorityCondition(c, t.Priority)
+		return res
+	}
+
+	var actual string
+	switch c.Field {
+	case "priority":
+		actual = t.Priority
+	case "assignee":
+		actual = t.Assignee
+	case "team":
+		actual = t.Team
+	}
+	res.Actual = actual
+	res.Passed = evalStringCondition(c, actual)
+	return res
+}
+
+// conditionStrings reads a condition value as a list of strings.
+func conditionStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{val}
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, x := range val {
+			out = append(out, fmt.Sprint(x))
+		}
+		return out
+	case []string:
+		return val
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+func evalStringCondition(c RuleCondition, actual string) bool {
+	want := conditionStrings(c.Value)
+	first := ""
+	if len(want) > 0 {
+		first = want[0]
+	}
+	switch c.Op {
+	case "eq":
+		return actual == first
+	case "neq":
+		return actual != first
+	case "in":
+		return containsString(want, actual)
+	case "not_in":
+		return !containsString(want, actual)
+	case "contains":
+		return strings.Contains(actual, first)
+	case "not_contains":
+		return !strings.Contains(actual, first)
+	case "empty":
+		return actual == ""
+	case "not_empty":
+		return actual != ""
+	}
+	return false
+}
+
+// evalPriorityCondition compares priorities by priorityRank; a task without
+// a ranked priority matches no comparison.
+func evalPriorityCondition(c RuleCondition, actual string) bool {
+	have := priorityRank[actual]
+	want := 0
+	if v, ok := c.Value.(string); ok {
+		want = priorityRank[v]
+	}
+	if have == 0 || want == 0 {
+		return false
+	}
+	switch c.Op {
+	case "gt":
+		return have > want
+	case "gte":
+		return have >= want
+	case "lt":
+		return have < want
+	case "lte":
+		return have <= want
+	}
+	return false
+}
+
+func evalListCondition(c RuleCondition, actual []string) bool {
+	want := conditionStrings(c.Value)
+	anyOf := func() bool {
+		for _, w := range want {
+			if containsString(actual, w) {
+				return true
+			}
+		}
+		return false
+	}
+	switch c.Op {
+	case "contains", "in", "eq":
+		return anyOf()
+	case "not_contains", "not_in", "neq":
+		return !anyOf()
+	case "empty":
+		return len(actual) == 0
+	case "not_empty":
+		return len(actual) > 0
+	}
+	return false
+}
+
+func evalNumberCondition(c RuleCondition, actual float64) bool {
+	var want float64
+	switch v := c.Value.(type) {
+	case float64:
+		want = v
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		want = f
+	default:
+		return false
+	}
+	switch c.Op {
+	case "eq":
+		return actual == want
+	case "neq":
+		return actual != want
+	case "gt":
+		return actual > want
+	case "gte":
+		return actual >= want
+	case "lt":
+		return actual < want
+	case "lte":
+		return actual <= want
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleContext carries what an action's placeholders and side effects need.
+type ruleContext struct {
+	hub   *websocket.Hub
+	rule  *WorkflowRule
+	task  *ruleTask
+	from  string
+	to    string
+	depth int
+}
+
+func (rc *ruleContext) render(s string) string {
+	return strings.NewReplacer(
+		"{{task.id}}", rc.task.ID,
+		"{{task.title}}", rc.task.Title,
+		"{{task.assignee}}", rc.task.Assignee,
+		"{{task.priority}}", rc.task.Priority,
+		"{{task.team}}", rc.task.Team,
+		"{{from}}", rc.from,
+		"{{to}}", rc.to,
+		"{{rule}}", rc.rule.Name,
+	).Replace(s)
+}
+
+func (rc *ruleContext) actor() string {
+	return "workflow:" + rc.rule.Name
+}
+
+// agentTarget resolves an action's agent_id, where "assignee" or empty means
+// the task's assignee.
+func (rc *ruleContext) agentTarget(agentID string) string {
+	if agentID == "" || agentID == "assignee" {
+		return rc.task.Assignee
+	}
+	return agentID
+}
+
+// rendered returns a with its placeholders filled in, as it would run.
+func (rc *ruleContext) rendered(a RuleAction) RuleAction {
+	a.Value = rc.render(a.Value)
+	a.Text = rc.render(a.Text)
+	if a.Type == "message_agent" || a.Type == "notify" {
+		a.AgentID = rc.agentTarget(a.AgentID)
+	}
+	return a
+}
+
+// ─── Execution ───────────────────────────────────────────────────────────────
+
+// actionResult is one action's outcome in the execution log.
+type actionResult struct {
+	Type   string `json:"type"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// runWorkflowRules runs every enabled rule matching a task's transition.
+// depth is how many rule-triggered transitions led here.
+func runWorkflowRules(hub *websocket.Hub, taskID, fromStatus, toStatus string, depth int) {
+	if depth > maxRuleDepth {
+		log.Printf("[workflow] rule depth limit reached at task %s (%s → %s)", taskID, fromStatus, toStatus)
+		return
+	}
+	rules, err := listWorkflowRules(true)
+	if err != nil {
+		log.Printf("[workflow] Error loading rules: %v", err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+	task, err := loadRuleTask(taskID)
+	if err != nil {
+		log.Printf("[workflow] Error loading task %s: %v", taskID, err)
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var rulesJSON json.RawMessage
-		if err := rows.Scan(&rulesJSON); err != nil {
+	now := time.Now()
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.matchesTransition(fromStatus, toStatus) || !rule.inScope(task) {
 			continue
 		}
-		var rules []WorkflowRule
-		if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+		if _, ok := evalConditions(rule.Conditions, task, now); !ok {
 			continue
 		}
-		for _, rule := range rules {
-			if rule.FromStatus == fromStatus && rule.ToStatus == toStatus {
-				executeWorkflowAction(taskID, rule)
-			}
+		rc := &ruleContext{hub: hub, rule: rule, task: task, from: fromStatus, to: toStatus, depth: depth}
+		start := time.Now()
+		results := rc.execute()
+		recordRuleRun(rule, taskID, fromStatus, toStatus, results, time.Since(start))
+
+		// Later rules see the effects of earlier ones
+		if t, err := loadRuleTask(taskID); err == nil {
+			task = t
 		}
 	}
 }
 
-func executeWorkflowAction(taskID string, rule WorkflowRule) {
-	switch rule.Action {
-	case "assign":
-		_, err := db.DB.Exec(`UPDATE tasks SET assignee = $1, updated_at = NOW() WHERE id = $2`, rule.Target, taskID)
+func evalConditions(conds []RuleCondition, t *ruleTask, now time.Time) ([]conditionResult, bool) {
+	results := make([]conditionResult, 0, len(conds))
+	ok := true
+	for _, c := range conds {
+		res := c.eval(t, now)
+		results = append(results, res)
+		ok = ok && res.Passed
+	}
+	return results, ok
+}
+
+func (rc *ruleContext) execute() []actionResult {
+	results := make([]actionResult, 0, len(rc.rule.Actions))
+	for _, a := range rc.rule.Actions {
+		detail, err := rc.runAction(rc.rendered(a))
+		res := actionResult{Type: a.Type, OK: err == nil, Detail: detail}
 		if err != nil {
-			log.Printf("[workflow] assign action failed for task %s: %v", taskID, err)
-		} else {
-			log.Printf("[workflow] Assigned task %s to %s", taskID, rule.Target)
+			res.Error = err.Error()
+			log.Printf("[workflow] rule %q action %s failed for task %s: %v", rc.rule.Name, a.Type, rc.task.ID, err)
+		}
+		results = append(results, res)
+		if err != nil && rc.rule.StopOnError {
+			break
+		}
+	}
+	return results
+}
+
+func (rc *ruleContext) runAction(a RuleAction) (string, error) {
+	t := rc.task
+	switch a.Type {
+	case "set_field":
+		col := ruleSetFields[a.Field]
+		val := `NULLIF($1, '')`
+		if col == "due_date" {
+			val += `::timestamp`
+		}
+		if _, err := db.DB.Exec(`UPDATE tasks SET `+col+` = `+val+`, updated_at = NOW() WHERE id = $2`, a.Value, t.ID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %q", a.Field, a.Value), nil
+
+	case "assign":
+		if _, err := db.DB.Exec(`UPDATE tasks SET assignee = $1, updated_at = NOW() WHERE id = $2`, a.Value, t.ID); err != nil {
+			return "", err
+		}
+		go TriggerWebhooks(EventTaskAssigned, map[string]interface{}{
+			"task_id": t.ID, "assignee": a.Value, "previous_assignee": t.Assignee, "actor": rc.actor(),
+		})
+		return "assigned to " + a.Value, nil
+
+	case "add_label":
+		if _, err := db.DB.Exec(`
+			UPDATE tasks SET labels = array_append(COALESCE(labels, '{}'), $1), updated_at = NOW()
+			WHERE id = $2 AND NOT ($1 = ANY(COALESCE(labels, '{}')))`, a.Value, t.ID); err != nil {
+			return "", err
 		}
+		return "label " + a.Value, nil
+
+	case "comment":
+		if _, err := db.DB.Exec(`INSERT INTO comments (task_id, author, content) VALUES ($1, $2, $3)`, t.ID, rc.actor(), a.Text); err != nil {
+			return "", err
+		}
+		go TriggerWebhooks(EventTaskCommented, map[string]interface{}{
+			"task_id": t.ID, "author": rc.actor(), "content": a.Text,
+		})
+		return "commented", nil
 
 	case "notify":
-		agentID := rule.Target
-		if agentID == "" {
-			// Get assignee from task
-			db.DB.QueryRow(`SELECT COALESCE(assignee, '') FROM tasks WHERE id = $1`, taskID).Scan(&agentID)
+		if a.AgentID == "" {
+			return "", fmt.Errorf("task has no assignee to notify")
+		}
+		text := a.Text
+		if text == "" {
+			text = fmt.Sprintf("Task %s moved %s → %s", t.Title, rc.from, rc.to)
+		}
+		CreateNotificationInternal(a.AgentID, "workflow", "Workflow: "+rc.rule.Name, text)
+		return "notified " + a.AgentID, nil
+
+	case "message_agent":
+		if a.AgentID == "" {
+			return "", fmt.Errorf("task has no assignee to message")
 		}
-		if agentID != "" {
-			CreateNotificationInternal(agentID, "workflow", "Workflow trigger", "Task "+taskID+" transitioned, triggering workflow rule")
+		resp, err := sendAgentMessage(a.AgentID, a.Text)
+		if err != nil {
+			return "", err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return "", fmt.Errorf("agent %s answered HTTP %d", a.AgentID, resp.StatusCode)
+		}
+		logActivity(a.AgentID, "workflow_message", t.ID, map[string]string{"rule": rc.rule.Name, "message": a.Text})
+		return "messaged " + a.AgentID, nil
+
+	case "webhook":
+		var active bool
+		if err := db.DB.QueryRow(`SELECT active FROM webhooks WHERE id = $1`, a.WebhookID).Scan(&active); err != nil || !active {
+			return "", fmt.Errorf("webhook %s not found or inactive", a.WebhookID)
 		}
+		TriggerWebhooksToURL(a.WebhookID, EventWorkflowRule, map[string]interface{}{
+			"rule_id": rc.rule.ID, "rule": rc.rule.Name, "task_id": t.ID, "title": t.Title,
+			"from_status": rc.from, "to_status": rc.to, "message": a.Text,
+		})
+		return "queued for webhook " + a.WebhookID, nil
 
 	case "create_subtask":
-		title := rule.Target
+		title := a.Value
 		if title == "" {
 			title = "Auto-created subtask"
 		}
-		_, err := db.DB.Exec(
-			`INSERT INTO tasks (title, status, priority, parent_task_id) VALUES ($1, 'todo', 'medium', $2)`,
-			title, taskID,
-		)
+		_, wf, err := taskWorkflow(t.ID)
+		if err != nil {
+			return "", err
+		}
+		var id string
+		if err := db.DB.QueryRow(
+			`INSERT INTO tasks (title, status, priority, team, parent_task_id) VALUES ($1, $2, 'medium', NULLIF($3, ''), $4) RETURNING id`,
+			title, wf.InitialStatus, t.Team, t.ID,
+		).Scan(&id); err != nil {
+			return "", err
+		}
+		return "created subtask " + id, nil
+
+	case "transition_dependents":
+		return rc.transitionDependents(a.Status)
+
+	case "create_incident":
+		title := a.Text
+		if title == "" {
+			title = fmt.Sprintf("%s: %s", rc.rule.Name, t.Title)
+		}
+		severity := a.Severity
+		if severity == "" {
+			severity = "medium"
+		}
+		taskIDs, _ := json.Marshal([]string{t.ID})
+		agentIDs := json.RawMessage(`[]`)
+		if t.Assignee != "" {
+			agentIDs, _ = json.Marshal([]string{t.Assignee})
+		}
+		var id string
+		if err := db.DB.QueryRow(
+			`INSERT INTO incidents (title, severity, task_ids, agent_ids) VALUES ($1, $2, $3, $4) RETURNING id`,
+			title, severity, taskIDs, agentIDs,
+		).Scan(&id); err != nil {
+			return "", err
+		}
+		go TriggerWebhooks(EventIncidentOpened, map[string]interface{}{
+			"incident_id": id, "title": title, "severity": severity, "status": "open",
+			"task_ids": taskIDs, "agent_ids": agentIDs, "automatic": true,
+		})
+		return "opened incident " + id, nil
+	}
+	return "", fmt.Errorf("unknown action %q", a.Type)
+}
+
+// transitionDependents moves tasks depending on this one to status, once all
+// of their dependencies are done.
+func (rc *ruleContext) transitionDependents(status string) (string, error) {
+	rows, err := db.DB.Query(`
+		SELECT d.id FROM tasks d
+		WHERE $1 = ANY(d.depends_on) AND d.status <> $2
+		  AND NOT EXISTS (
+		      SELECT 1 FROM tasks dep
+		      WHERE dep.id = ANY(d.depends_on) AND dep.status NOT IN `+sqlStatusList(StatusDone)+`)`,
+		rc.task.ID, status)
+	if err != nil {
+		return "", err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	var moved, failed []string
+	for _, id := range ids {
+		if _, err := moveTask(rc.hub, nil, id, status, rc.actor(), rc.depth+1); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", id, err))
+			continue
+		}
+		moved = append(moved, id)
+	}
+	detail := fmt.Sprintf("moved %d dependent task(s) to %s", len(moved), status)
+	if len(failed) > 0 {
+		return detail, fmt.Errorf("could not move %s", strings.Join(failed, ", "))
+	}
+	return detail, nil
+}
+
+func recordRuleRun(rule *WorkflowRule, taskID, from, to string, results []actionResult, took time.Duration) {
+	status := "success"
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	if failed == len(results) && failed > 0 {
+		status = "failed"
+	} else if failed > 0 || len(results) < len(rule.Actions) {
+		status = "partial"
+	}
+	body, _ := json.Marshal(results)
+	if _, err := db.DB.Exec(`
+		INSERT INTO workflow_rule_runs (rule_id, rule_name, task_id, from_status, to_status, status, results, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		rule.ID, rule.Name, taskID, from, to, status, body, took.Milliseconds()); err != nil {
+		log.Printf("[workflow] Error recording run of rule %q: %v", rule.Name, err)
+	}
+}
+
+// ─── Storage ─────────────────────────────────────────────────────────────────
+
+const workflowRuleCols = `id, name, COALESCE(description, ''), enabled, scope_type, COALESCE(scope_value, ''),
+	COALESCE(from_status, ''), COALESCE(to_status, ''), conditions, actions, stop_on_error, position, source,
+	created_at, updated_at`
+
+func scanWorkflowRule(scanner interface{ Scan(...interface{}) error }) (*WorkflowRule, error) {
+	var rule WorkflowRule
+	var conditions, actions []byte
+	if err := scanner.Scan(&rule.ID, &rule.Name, &rule.Description, &rule.Enabled, &rule.ScopeType, &rule.ScopeValue,
+		&rule.FromStatus, &rule.ToStatus, &conditions, &actions, &rule.StopOnError, &rule.Position, &rule.Source,
+		&rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(conditions, &rule.Conditions); err != nil {
+		return nil, fmt.Errorf("rule %s: bad conditions: %w", rule.Name, err)
+	}
+	if err := json.Unmarshal(actions, &rule.Actions); err != nil {
+		return nil, fmt.Errorf("rule %s: bad actions: %w", rule.Name, err)
+	}
+	return &rule, nil
+}
+
+func listWorkflowRules(enabledOnly bool) ([]WorkflowRule, error) {
+	q := `SELECT ` + workflowRuleCols + ` FROM workflow_rules`
+	if enabledOnly {
+		q += ` WHERE enabled`
+	}
+	rows, err := db.DB.Query(q + ` ORDER BY position, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rules := []WorkflowRule{}
+	for rows.Next() {
+		rule, err := scanWorkflowRule(rows)
 		if err != nil {
-			log.Printf("[workflow] create_subtask failed for task %s: %v", taskID, err)
-		} else {
-			log.Printf("[workflow] Created subtask '%s' for task %s", title, taskID)
+			log.Printf("[workflow] skipping rule: %v", err)
+			continue
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+// legacyRuleAction converts a template rule's action/target pair.
+func legacyRuleAction(lr legacyTemplateRule) RuleAction {
+	switch lr.Action {
+	case "notify":
+		return RuleAction{Type: "notify", AgentID: lr.Target}
+	case "create_subtask":
+		return RuleAction{Type: "create_subtask", Value: lr.Target}
+	}
+	return RuleAction{Type: lr.Action, Value: lr.Target}
+}
+
+// syncTemplateRules replaces a template's mirrored rules with its current
+// workflow_rules JSON.
+func syncTemplateRules(templateID string, raw json.RawMessage) error {
+	var legacy []legacyTemplateRule
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &legacy); err != nil {
+			return fmt.Errorf("workflow_rules: %w", err)
+		}
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM workflow_rules WHERE source = 'template' AND scope_type = 'template' AND scope_value = $1`, templateID); err != nil {
+		return err
+	}
+	for i, lr := range legacy {
+		if lr.Action == "" {
+			continue
+		}
+		actions, _ := json.Marshal([]RuleAction{legacyRuleAction(lr)})
+		if _, err := tx.Exec(`
+			INSERT INTO workflow_rules (name, scope_type, scope_value, from_status, to_status, actions, position, source)
+			VALUES ($1, 'template', $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, 'template')`,
+			fmt.Sprintf("template rule %d: %s", i+1, lr.Action), templateID, lr.FromStatus, lr.ToStatus, actions, i); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ─── HTTP handlers ───────────────────────────────────────────────────────────
+
+type WorkflowRuleHandler struct {
+	Hub *websocket.Hub
+}
+
+// ListWorkflowRules handles GET /api/workflow-rules
+func (h *WorkflowRuleHandler) ListWorkflowRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := listWorkflowRules(false)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, rules)
+}
+
+// GetWorkflowRule handles GET /api/workflow-rules/{id}
+func (h *WorkflowRuleHandler) GetWorkflowRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := scanWorkflowRule(db.DB.QueryRow(`SELECT `+workflowRuleCols+` FROM workflow_rules WHERE id = $1`, mux.Vars(r)["id"]))
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "rule not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, rule)
+}
+
+func decodeWorkflowRule(w http.ResponseWriter, r *http.Request) (*WorkflowRule, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	rule := WorkflowRule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return nil, false
+	}
+	if rule.Conditions == nil {
+		rule.Conditions = []RuleCondition{}
+	}
+	if err := rule.validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return &rule, true
+}
+
+// CreateWorkflowRule handles POST /api/workflow-rules
+func (h *WorkflowRuleHandler) CreateWorkflowRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := decodeWorkflowRule(w, r)
+	if !ok {
+		return
+	}
+	conditions, _ := json.Marshal(rule.Conditions)
+	actions, _ := json.Marshal(rule.Actions)
+	created, err := scanWorkflowRule(db.DB.QueryRow(`
+		INSERT INTO workflow_rules (name, description, enabled, scope_type, scope_value, from_status, to_status,
+		                            conditions, actions, stop_on_error, position)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10, $11)
+		RETURNING `+workflowRuleCols,
+		rule.Name, rule.Description, rule.Enabled, rule.ScopeType, rule.ScopeValue, rule.FromStatus, rule.ToStatus,
+		conditions, actions, rule.StopOnError, rule.Position))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "workflow_rule_created", "workflow_rule", created.ID, map[string]interface{}{"name": created.Name})
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// UpdateWorkflowRule handles PUT /api/workflow-rules/{id}
+// Rules mirrored from a template are edited through the template instead.
+func (h *WorkflowRuleHandler) UpdateWorkflowRule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	rule, ok := decodeWorkflowRule(w, r)
+	if !ok {
+		return
+	}
+	var source string
+	err := db.DB.QueryRow(`SELECT source FROM workflow_rules WHERE id = $1`, id).Scan(&source)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "rule not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if source == "template" {
+		respondError(w, http.StatusConflict, "this rule belongs to a template; edit the template's workflow_rules instead")
+		return
+	}
+
+	conditions, _ := json.Marshal(rule.Conditions)
+	actions, _ := json.Marshal(rule.Actions)
+	updated, err := scanWorkflowRule(db.DB.QueryRow(`
+		UPDATE workflow_rules SET name = $1, description = NULLIF($2, ''), enabled = $3, scope_type = $4,
+		       scope_value = NULLIF($5, ''), from_status = NULLIF($6, ''), to_status = NULLIF($7, ''),
+		       conditions = $8, actions = $9, stop_on_error = $10, position = $11, updated_at = NOW()
+		WHERE id = $12
+		RETURNING `+workflowRuleCols,
+		rule.Name, rule.Description, rule.Enabled, rule.ScopeType, rule.ScopeValue, rule.FromStatus, rule.ToStatus,
+		conditions, actions, rule.StopOnError, rule.Position, id))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "workflow_rule_updated", "workflow_rule", id, map[string]interface{}{"name": updated.Name})
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// DeleteWorkflowRule handles DELETE /api/workflow-rules/{id}
+func (h *WorkflowRuleHandler) DeleteWorkflowRule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var name string
+	err := db.DB.QueryRow(`DELETE FROM workflow_rules WHERE id = $1 AND source <> 'template' RETURNING name`, id).Scan(&name)
+	if err == sql.ErrNoRows {
+		respondError(w, http.StatusNotFound, "rule not found (template rules are removed through their template)")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	go LogAudit(getAgentFromContext(r), "workflow_rule_deleted", "workflow_rule", id, map[string]interface{}{"name": name})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "rule deleted"})
+}
+
+// DryRunWorkflowRules handles POST /api/workflow-rules/dry-run
+// Reports which rules a hypothetical transition would fire, and with which
+// actions, without running anything. The task is an existing one (task_id),
+// optionally overridden field by field, or entirely described in "task".
+func (h *WorkflowRuleHandler) DryRunWorkflowRules(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var req struct {
+		TaskID     string `json:"task_id"`
+		FromStatus string `json:"from_status"`
+		ToStatus   string `json:"to_status"`
+		Task       struct {
+			Title               *string   `json:"title"`
+			Priority            *string   `json:"priority"`
+			Assignee            *string   `json:"assignee"`
+			Team                *string   `json:"team"`
+			Labels              *[]string `json:"labels"`
+			TemplateID          *string   `json:"template_id"`
+			AgeMinutes          *float64  `json:"age_minutes"`
+			TimeInStatusMinutes *float64  `json:"time_in_status_minutes"`
+		} `json:"task"`
+		RuleID string `json:"rule_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.ToStatus == "" {
+		respondError(w, http.StatusBadRequest, "to_status is required")
+		return
+	}
+
+	now := time.Now()
+	task := &ruleTask{ID: "00000000-0000-0000-0000-000000000000", Title: "(hypothetical task)", CreatedAt: now, StatusSince: now}
+	if req.TaskID != "" {
+		t, err := loadRuleTask(req.TaskID)
+		if err == sql.ErrNoRows {
+			respondError(w, http.StatusNotFound, "task not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		task = t
+	}
+	o := req.Task
+	if o.Title != nil {
+		task.Title = *o.Title
+	}
+	if o.Priority != nil {
+		task.Priority = *o.Priority
+	}
+	if o.Assignee != nil {
+		task.Assignee = *o.Assignee
+	}
+	if o.Team != nil {
+		task.Team = *o.Team
+	}
+	if o.Labels != nil {
+		task.Labels = *o.Labels
+	}
+	if o.TemplateID != nil {
+		task.TemplateID = *o.TemplateID
+	}
+	if o.AgeMinutes != nil {
+		task.CreatedAt = now.Add(-time.Duration(*o.AgeMinutes * float64(time.Minute)))
+	}
+	if o.TimeInStatusMinutes != nil {
+		task.StatusSince = now.Add(-time.Duration(*o.TimeInStatusMinutes * float64(time.Minute)))
+	}
+	from := req.FromStatus
+	if from == "" {
+		from = task.Status
+	}
+
+	rules, err := listWorkflowRules(false)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type ruleOutcome struct {
+		RuleID          string            `json:"rule_id"`
+		Name            string            `json:"name"`
+		Enabled         bool              `json:"enabled"`
+		InScope         bool              `json:"in_scope"`
+		TransitionMatch bool              `json:"transition_match"`
+		Conditions      []conditionResult `json:"conditions"`
+		WouldFire       bool              `json:"would_fire"`
+		Actions         []RuleAction      `json:"actions,omitempty"`
+	}
+	outcomes := []ruleOutcome{}
+	fired := 0
+	for i := range rules {
+		rule := &rules[i]
+		if req.RuleID != "" && rule.ID != req.RuleID {
+			continue
+		}
+		out := ruleOutcome{
+			RuleID: rule.ID, Name: rule.Name, Enabled: rule.Enabled,
+			InScope:         rule.inScope(task),
+			TransitionMatch: rule.matchesTransition(from, req.ToStatus),
+		}
+		var condsOK bool
+		out.Conditions, condsOK = evalConditions(rule.Conditions, task, now)
+		out.WouldFire = rule.Enabled && out.InScope && out.TransitionMatch && condsOK
+		if out.WouldFire {
+			fired++
+			rc := &ruleContext{rule: rule, task: task, from: from, to: req.ToStatus}
+			for _, a := range rule.Actions {
+				out.Actions = append(out.Actions, rc.rendered(a))
+			}
+		}
+		outcomes = append(outcomes, out)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"task":        task,
+		"from_status": from,
+		"to_status":   req.ToStatus,
+		"would_fire":  fired,
+		"rules":       outcomes,
+	})
+}
+
+// ListWorkflowRuleRuns handles GET /api/workflow-rules/runs?rule_id=&task_id=&status=&limit=
+func (h *WorkflowRuleHandler) ListWorkflowRuleRuns(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if n, err := strconv.Atoi(q.Get("limit")); err == nil && n > 0 && n <= 500 {
+		limit = n
+	}
+
+	query := `SELECT id, rule_id, rule_name, task_id, COALESCE(from_status, ''), to_status, status, results, duration_ms, created_at
+		FROM workflow_rule_runs WHERE 1=1`
+	args := []interface{}{}
+	for _, f := range []string{"rule_id", "task_id", "status"} {
+		if v := q.Get(f); v != "" {
+			args = append(args, v)
+			query += fmt.Sprintf(" AND %s = $%d", f, len(args))
+		}
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d", len(args))
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	type ruleRun struct {
+		ID         string          `json:"id"`
+		RuleID     *string         `json:"rule_id"`
+		RuleName   string          `json:"rule_name"`
+		TaskID     string          `json:"task_id"`
+		FromStatus string          `json:"from_status"`
+		ToStatus   string          `json:"to_status"`
+		Status     string          `json:"status"`
+		Results    json.RawMessage `json:"results"`
+		DurationMS int64           `json:"duration_ms"`
+		CreatedAt  time.Time       `json:"created_at"`
+	}
+	runs := []ruleRun{}
+	for rows.Next() {
+		var run ruleRun
+		if err := rows.Scan(&run.ID, &run.RuleID, &run.RuleName, &run.TaskID, &run.FromStatus, &run.ToStatus,
+			&run.Status, &run.Results, &run.DurationMS, &run.CreatedAt); err != nil {
+			continue
 		}
+		runs = append(runs, run)
 	}
+	respondJSON(w, http.StatusOK, runs)
 }
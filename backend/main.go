@@ -43,6 +43,26 @@ func main() {
 	}
 	defer db.Close()
 
+	// `agentboard reindex-tokens [--full]` reprices the token index after a
+	// pricing change (--full re-reads every session file) and exits
+	if len(os.Args) > 1 && os.Args[1] == "reindex-tokens" {
+		full := len(os.Args) > 2 && os.Args[2] == "--full"
+		repriced, indexed, err := handlers.RebuildTokenIndex(full)
+		if err != nil {
+			log.Fatalf("Token reindex failed: %v", err)
+		}
+		log.Printf("Token reindex done: %d message(s) indexed, %d repriced", indexed, repriced)
+		return
+	}
+
+	// Create the first admin account on a fresh install
+	handlers.EnsureBootstrapAdmin()
+
+	// Seed the built-in task workflow, or bring an older seed up to date
+	if err := handlers.EnsureDefaultWorkflow(); err != nil {
+		log.Printf("⚠️  Failed to seed the default workflow: %v", err)
+	}
+
 	// Seed agents from config into DB (upsert — preserves existing status)
 	if err := db.UpsertAgentsFromConfig(config.GetAgents()); err != nil {
 		log.Printf("⚠️  Failed to seed agents from config: %v", err)
@@ -73,7 +93,13 @@ func main() {
 	controlHandler := &handlers.AgentControlHandler{}
 	authHandler := &handlers.AuthHandler{}
 	keyHandler := &handlers.APIKeyHandler{}
+	userHandler := &handlers.UserHandler{}
+	sessionHandler := &handlers.SessionHandler{}
 	templateHandler := &handlers.TemplateHandler{}
+	workflowHandler := &handlers.WorkflowHandler{}
+	workflowRuleHandler := &handlers.WorkflowRuleHandler{Hub: hub}
+	schedulerHandler := &handlers.SchedulerHandler{Hub: hub}
+	queueHandler := &handlers.QueueHandler{Hub: hub}
 	notificationHandler := &handlers.NotificationHandler{}
 	traceHandler := &handlers.TraceHandler{}
 	dashboardsHandler := &handlers.DashboardsHandler{}
@@ -107,15 +133,41 @@ func main() {
 	// Health checker
 	go handlers.StartHealthChecker()
 
+	// Webhook delivery queue
+	go handlers.StartWebhookDispatcher()
+
+	// Dependency scheduler (releases unblocked tasks, auto-assigns ready ones)
+	go handlers.StartTaskScheduler(hub)
+
+	// Work queue lease expiry
+	go handlers.StartLeaseReaper(hub)
+
+	// Recurring tasks from template schedules
+	go handlers.StartRecurringTasks(hub)
+
+	// Retention pruning (rolls old rows into daily_rollups)
+	go handlers.StartRetentionPruner()
+
+	// Token usage index (tails session JSONL files into token_usage)
+	go handlers.StartTokenIndexer()
+
 	// Router
 	router := mux.NewRouter()
 	api := router.PathPrefix("/api").Subrouter()
 	api.Use(handlers.RequireAuth)
 
-	// Auth routes (public — no auth middleware needed, but RequireAuth allows GETs and login skips check anyway)
+	// Route access: RequireAuth admits callers per AGENTBOARD_AUTH_MODE and keeps
+	// viewers read-only; sensitive reads below are raised to member or admin with
+	// handlers.RoleHandler.
+
+	// Auth routes (public — RequireAuth always lets /api/auth/* through)
 	api.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
 	api.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
 	api.HandleFunc("/auth/me", authHandler.Me).Methods("GET")
+	api.HandleFunc("/auth/accept-invite", userHandler.AcceptInvite).Methods("POST")
+	api.HandleFunc("/auth/refresh", authHandler.Refresh).Methods("POST")
+	api.HandleFunc("/auth/oidc/login", authHandler.OIDCLogin).Methods("GET")
+	api.HandleFunc("/auth/oidc/callback", authHandler.OIDCCallback).Methods("GET")
 
 	// Task routes  — static route MUST come before parameterised {id} route
 	api.HandleFunc("/tasks", taskHandler.GetTasks).Methods("GET")
@@ -123,12 +175,14 @@ func main() {
 	api.HandleFunc("/tasks/mine", taskHandler.GetMyTasks).Methods("GET")
 	api.HandleFunc("/tasks/stuck", taskHandler.GetStuckTasks).Methods("GET")
 	api.HandleFunc("/tasks/graph", handlers.GetTaskDAG).Methods("GET")
+	api.HandleFunc("/tasks/graph/validate", handlers.ValidateTaskGraph).Methods("GET")
 	api.HandleFunc("/tasks/{id}", taskHandler.GetTask).Methods("GET")
 	api.HandleFunc("/tasks/{id}", taskHandler.UpdateTask).Methods("PUT")
 	api.HandleFunc("/tasks/{id}", taskHandler.DeleteTask).Methods("DELETE")
 	api.HandleFunc("/tasks/{id}/assign", taskHandler.AssignTask).Methods("POST")
 	api.HandleFunc("/tasks/{id}/transition", taskHandler.TransitionTask).Methods("POST")
 	api.HandleFunc("/tasks/{id}/history", taskHandler.GetTaskHistory).Methods("GET")
+	api.HandleFunc("/tasks/{id}/workflow", workflowHandler.GetTaskWorkflow).Methods("GET")
 
 	// Comment routes
 	api.HandleFunc("/tasks/{task_id}/comments", commentHandler.GetComments).Methods("GET")
@@ -161,28 +215,32 @@ func main() {
 
 	// Environments
 	api.HandleFunc("/environments", environmentHandler.GetEnvironments).Methods("GET")
-	api.HandleFunc("/environments", environmentHandler.AddEnvironment).Methods("POST")
-	api.HandleFunc("/environments", environmentHandler.DeleteEnvironment).Methods("DELETE")
-	api.HandleFunc("/environments/switch", environmentHandler.SwitchEnvironment).Methods("POST")
+	api.Handle("/environments", handlers.RoleHandler("admin", environmentHandler.AddEnvironment)).Methods("POST")
+	api.Handle("/environments", handlers.RoleHandler("admin", environmentHandler.DeleteEnvironment)).Methods("DELETE")
+	api.Handle("/environments/switch", handlers.RoleHandler("admin", environmentHandler.SwitchEnvironment)).Methods("POST")
 
 	// Webhooks
-	api.HandleFunc("/webhooks", webhookHandler.ListWebhooks).Methods("GET")
-	api.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST")
-	api.HandleFunc("/webhooks/{id}", webhookHandler.UpdateWebhook).Methods("PUT")
-	api.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
-	api.HandleFunc("/webhooks/{id}/test", webhookHandler.TestWebhook).Methods("POST")
+	api.Handle("/webhooks", handlers.RoleHandler("admin", webhookHandler.ListWebhooks)).Methods("GET")
+	api.HandleFunc("/webhooks/events", webhookHandler.ListWebhookEvents).Methods("GET")
+	api.Handle("/webhooks", handlers.RoleHandler("admin", webhookHandler.CreateWebhook)).Methods("POST")
+	api.Handle("/webhooks/{id}", handlers.RoleHandler("admin", webhookHandler.UpdateWebhook)).Methods("PUT")
+	api.Handle("/webhooks/{id}", handlers.RoleHandler("admin", webhookHandler.DeleteWebhook)).Methods("DELETE")
+	api.Handle("/webhooks/{id}/test", handlers.RoleHandler("admin", webhookHandler.TestWebhook)).Methods("POST")
+	api.Handle("/webhooks/{id}/deliveries", handlers.RoleHandler("admin", webhookHandler.ListDeliveries)).Methods("GET")
+	api.Handle("/webhooks/{id}/deliveries/replay", handlers.RoleHandler("admin", webhookHandler.ReplayFailedDeliveries)).Methods("POST")
+	api.Handle("/webhooks/{id}/deliveries/{delivery_id}/redeliver", handlers.RoleHandler("admin", webhookHandler.RedeliverDelivery)).Methods("POST")
 
 	// Soul endpoint — reads live workspace files
-	api.HandleFunc("/agents/{id}/soul", openclawHandler.GetAgentSoul).Methods("GET")
-	api.HandleFunc("/agents/{id}/soul", openclawHandler.UpdateAgentSoul).Methods("PUT")
+	api.Handle("/agents/{id}/soul", handlers.RoleHandler("admin", openclawHandler.GetAgentSoul)).Methods("GET")
+	api.Handle("/agents/{id}/soul", handlers.RoleHandler("admin", openclawHandler.UpdateAgentSoul)).Methods("PUT")
 
 	// Snapshots
-	api.HandleFunc("/agents/{id}/snapshots", handlers.GetSnapshots).Methods("GET")
-	api.HandleFunc("/agents/{id}/snapshots", handlers.CreateSnapshot).Methods("POST")
-	api.HandleFunc("/agents/{id}/snapshots/{snapshot_id}/restore", handlers.RestoreSnapshot).Methods("POST")
+	api.Handle("/agents/{id}/snapshots", handlers.RoleHandler("admin", handlers.GetSnapshots)).Methods("GET")
+	api.Handle("/agents/{id}/snapshots", handlers.RoleHandler("admin", handlers.CreateSnapshot)).Methods("POST")
+	api.Handle("/agents/{id}/snapshots/{snapshot_id}/restore", handlers.RoleHandler("admin", handlers.RestoreSnapshot)).Methods("POST")
 
 	// Timeline endpoint — agent's action history
-	api.HandleFunc("/agents/{id}/timeline", openclawHandler.GetAgentTimeline).Methods("GET")
+	api.Handle("/agents/{id}/timeline", handlers.RoleHandler("member", openclawHandler.GetAgentTimeline)).Methods("GET")
 
 	// Skills endpoint — reads global + agent-specific skills
 	api.HandleFunc("/agents/{id}/skills", openclawHandler.GetAgentSkills).Methods("GET")
@@ -218,17 +276,17 @@ func main() {
 	api.HandleFunc("/analytics/export/csv", analyticsHandler.ExportCSV).Methods("GET")
 	api.HandleFunc("/analytics/tokens", analyticsHandler.GetTokens).Methods("GET")
 	api.HandleFunc("/analytics/tokens/timeline", analyticsHandler.GetTokensTimeline).Methods("GET")
-	api.HandleFunc("/analytics/cost/summary", analyticsHandler.GetCostSummary).Methods("GET")
+	api.Handle("/analytics/cost/summary", handlers.RoleHandler("member", analyticsHandler.GetCostSummary)).Methods("GET")
 	api.HandleFunc("/analytics/tokens/by-agent", analyticsHandler.GetTokensByAgent).Methods("GET")
 	api.HandleFunc("/analytics/performance", performanceHandler.GetPerformance).Methods("GET")
 
 	// Cost tracking
 	api.HandleFunc("/costs", costsHandler.IngestCost).Methods("POST")
-	api.HandleFunc("/costs/summary", costsHandler.GetCostSummary).Methods("GET")
-	api.HandleFunc("/costs/breakdown", costsHandler.GetCostBreakdown).Methods("GET")
-	api.HandleFunc("/costs/burn-rate", costsHandler.GetBurnRate).Methods("GET")
-	api.HandleFunc("/costs/per-task", costsHandler.GetCostPerTask).Methods("GET")
-	api.HandleFunc("/costs/by-model", costsHandler.GetCostByModel).Methods("GET")
+	api.Handle("/costs/summary", handlers.RoleHandler("member", costsHandler.GetCostSummary)).Methods("GET")
+	api.Handle("/costs/breakdown", handlers.RoleHandler("member", costsHandler.GetCostBreakdown)).Methods("GET")
+	api.Handle("/costs/burn-rate", handlers.RoleHandler("member", costsHandler.GetBurnRate)).Methods("GET")
+	api.Handle("/costs/per-task", handlers.RoleHandler("member", costsHandler.GetCostPerTask)).Methods("GET")
+	api.Handle("/costs/by-model", handlers.RoleHandler("member", costsHandler.GetCostByModel)).Methods("GET")
 
 	// Agent scorecards
 	api.HandleFunc("/agents/{id}/scorecard", scorecardHandler.GetScorecard).Methods("GET")
@@ -249,12 +307,12 @@ func main() {
 
 	// Metrics
 	api.HandleFunc("/metrics/latency", metricsHandler.GetLatencyMetrics).Methods("GET")
-	api.HandleFunc("/metrics/cost-forecast", metricsHandler.GetCostForecast).Methods("GET")
+	api.Handle("/metrics/cost-forecast", handlers.RoleHandler("member", metricsHandler.GetCostForecast)).Methods("GET")
 	api.HandleFunc("/metrics/efficiency", metricsHandler.GetEfficiencyScores).Methods("GET")
 
 	// Documents
-	api.HandleFunc("/documents", documentsHandler.ListDocuments).Methods("GET")
-	api.HandleFunc("/documents/content", documentsHandler.GetDocumentContent).Methods("GET")
+	api.Handle("/documents", handlers.RoleHandler("member", documentsHandler.ListDocuments)).Methods("GET")
+	api.Handle("/documents/content", handlers.RoleHandler("member", documentsHandler.GetDocumentContent)).Methods("GET")
 
 	// Agent control (pause/resume/kill)
 	api.HandleFunc("/agents/{id}/kill", controlHandler.Kill).Methods("POST")
@@ -265,9 +323,28 @@ func main() {
 	keys := api.PathPrefix("/keys").Subrouter()
 	keys.Use(handlers.RequireRole("admin"))
 	keys.HandleFunc("", keyHandler.ListKeys).Methods("GET")
+	keys.HandleFunc("/scopes", keyHandler.ListAPIKeyScopes).Methods("GET")
 	keys.HandleFunc("", keyHandler.CreateKey).Methods("POST")
 	keys.HandleFunc("/{id}", keyHandler.DeleteKey).Methods("DELETE")
 
+	// Users (admin only)
+	users := api.PathPrefix("/users").Subrouter()
+	users.Use(handlers.RequireRole("admin"))
+	users.HandleFunc("", userHandler.ListUsers).Methods("GET")
+	users.HandleFunc("", userHandler.InviteUser).Methods("POST")
+	users.HandleFunc("/{id}", userHandler.UpdateUser).Methods("PUT")
+	users.HandleFunc("/{id}/disable", userHandler.DisableUser).Methods("POST")
+	users.HandleFunc("/{id}/enable", userHandler.EnableUser).Methods("POST")
+	users.HandleFunc("/{id}/reset", userHandler.ResetUser).Methods("POST")
+	users.HandleFunc("/{id}/sessions", sessionHandler.RevokeUserSessions).Methods("DELETE")
+
+	// Login sessions & token signing keys (admin only)
+	sessions := api.PathPrefix("/sessions").Subrouter()
+	sessions.Use(handlers.RequireRole("admin"))
+	sessions.HandleFunc("", sessionHandler.ListSessions).Methods("GET")
+	sessions.HandleFunc("/signing-key/rotate", sessionHandler.RotateSigningKey).Methods("POST")
+	sessions.HandleFunc("/{id}", sessionHandler.RevokeSession).Methods("DELETE")
+
 	// Templates
 	api.HandleFunc("/templates", templateHandler.ListTemplates).Methods("GET")
 	api.HandleFunc("/templates", templateHandler.CreateTemplate).Methods("POST")
@@ -275,6 +352,29 @@ func main() {
 	api.HandleFunc("/templates/{id}", templateHandler.UpdateTemplate).Methods("PUT")
 	api.HandleFunc("/templates/{id}", templateHandler.DeleteTemplate).Methods("DELETE")
 	api.HandleFunc("/templates/{id}/instantiate", templateHandler.InstantiateTemplate).Methods("POST")
+	api.HandleFunc("/templates/{id}/schedules", templateHandler.ListTemplateSchedules).Methods("GET")
+	api.HandleFunc("/templates/{id}/schedules", templateHandler.CreateTemplateSchedule).Methods("POST")
+	api.HandleFunc("/templates/{id}/schedules/history", templateHandler.GetTemplateScheduleHistory).Methods("GET")
+	api.HandleFunc("/templates/{id}/schedules/{schedule_id}", templateHandler.UpdateTemplateSchedule).Methods("PUT")
+	api.HandleFunc("/templates/{id}/schedules/{schedule_id}", templateHandler.DeleteTemplateSchedule).Methods("DELETE")
+
+	// Task workflows (status sets and transitions)
+	api.HandleFunc("/workflows", workflowHandler.ListWorkflows).Methods("GET")
+	api.Handle("/workflows", handlers.RoleHandler("admin", workflowHandler.CreateWorkflow)).Methods("POST")
+	api.Handle("/workflows/teams/{team}", handlers.RoleHandler("admin", workflowHandler.SetTeamWorkflow)).Methods("PUT")
+	api.HandleFunc("/workflows/{id}", workflowHandler.GetWorkflow).Methods("GET")
+	api.Handle("/workflows/{id}", handlers.RoleHandler("admin", workflowHandler.UpdateWorkflow)).Methods("PUT")
+	api.Handle("/workflows/{id}", handlers.RoleHandler("admin", workflowHandler.DeleteWorkflow)).Methods("DELETE")
+	api.Handle("/workflows/{id}/default", handlers.RoleHandler("admin", workflowHandler.SetDefaultWorkflow)).Methods("POST")
+
+	// Workflow rules (conditional actions on transitions)
+	api.HandleFunc("/workflow-rules", workflowRuleHandler.ListWorkflowRules).Methods("GET")
+	api.Handle("/workflow-rules", handlers.RoleHandler("admin", workflowRuleHandler.CreateWorkflowRule)).Methods("POST")
+	api.HandleFunc("/workflow-rules/dry-run", workflowRuleHandler.DryRunWorkflowRules).Methods("POST")
+	api.HandleFunc("/workflow-rules/runs", workflowRuleHandler.ListWorkflowRuleRuns).Methods("GET")
+	api.HandleFunc("/workflow-rules/{id}", workflowRuleHandler.GetWorkflowRule).Methods("GET")
+	api.Handle("/workflow-rules/{id}", handlers.RoleHandler("admin", workflowRuleHandler.UpdateWorkflowRule)).Methods("PUT")
+	api.Handle("/workflow-rules/{id}", handlers.RoleHandler("admin", workflowRuleHandler.DeleteWorkflowRule)).Methods("DELETE")
 
 	// Notifications
 	api.HandleFunc("/notifications", notificationHandler.ListNotifications).Methods("GET")
@@ -287,8 +387,10 @@ func main() {
 	// Agent Traces
 	api.HandleFunc("/traces", traceHandler.IngestTrace).Methods("POST")
 	api.HandleFunc("/traces/batch", traceHandler.BatchIngestTraces).Methods("POST")
+	api.HandleFunc("/otlp/v1/traces", traceHandler.IngestOTLPTraces).Methods("POST")
 	api.HandleFunc("/traces/{id}", traceHandler.DeleteTrace).Methods("DELETE")
 	api.HandleFunc("/tasks/{id}/traces", traceHandler.GetTaskTraces).Methods("GET")
+	api.HandleFunc("/tasks/{id}/traces/tree", traceHandler.GetTaskTraceTree).Methods("GET")
 	api.HandleFunc("/agents/{id}/traces", traceHandler.GetAgentTraces).Methods("GET")
 
 	// API Docs
@@ -302,9 +404,9 @@ func main() {
 	api.HandleFunc("/errors/summary", errorsHandler.GetErrorsSummary).Methods("GET")
 
 	// Logs viewer
-	api.HandleFunc("/logs/files", logsHandler.GetLogFiles).Methods("GET")
-	api.HandleFunc("/logs/search", logsHandler.SearchLogs).Methods("GET")
-	api.HandleFunc("/logs", logsHandler.GetLogs).Methods("GET")
+	api.Handle("/logs/files", handlers.RoleHandler("admin", logsHandler.GetLogFiles)).Methods("GET")
+	api.Handle("/logs/search", handlers.RoleHandler("admin", logsHandler.SearchLogs)).Methods("GET")
+	api.Handle("/logs", handlers.RoleHandler("admin", logsHandler.GetLogs)).Methods("GET")
 
 	// Structure (hierarchy from config)
 	api.HandleFunc("/structure", openclawHandler.GetStructure).Methods("GET")
@@ -312,14 +414,33 @@ func main() {
 	// Alert Rules Engine
 	api.HandleFunc("/alerts/rules", handlers.GetAlertRules).Methods("GET")
 	api.HandleFunc("/alerts/rules", handlers.CreateAlertRule).Methods("POST")
+	api.HandleFunc("/alerts/rules/preview", handlers.PreviewAlertExpression).Methods("POST")
 	api.HandleFunc("/alerts/rules/{id}", handlers.UpdateAlertRule).Methods("PUT")
 	api.HandleFunc("/alerts/rules/{id}", handlers.DeleteAlertRule).Methods("DELETE")
 	api.HandleFunc("/alerts/history", handlers.GetAlertHistory).Methods("GET")
 	api.HandleFunc("/alerts/history/{id}/acknowledge", handlers.AcknowledgeAlert).Methods("POST")
+	api.HandleFunc("/alerts/history/{id}/silence", handlers.SilenceAlert).Methods("POST")
+	api.HandleFunc("/alerts/history/{id}/silence", handlers.UnsilenceAlert).Methods("DELETE")
 	api.HandleFunc("/alerts/unacknowledged-count", handlers.GetAlertUnacknowledgedCount).Methods("GET")
 
+	// SLA policies
+	api.HandleFunc("/sla/policies", handlers.ListSLAPolicies).Methods("GET")
+	api.HandleFunc("/sla/policies", handlers.CreateSLAPolicy).Methods("POST")
+	api.HandleFunc("/sla/policies/{id}", handlers.UpdateSLAPolicy).Methods("PUT")
+	api.HandleFunc("/sla/policies/{id}", handlers.DeleteSLAPolicy).Methods("DELETE")
+
 	// Audit Log
-	api.HandleFunc("/audit", handlers.GetAuditLog).Methods("GET")
+	api.Handle("/audit", handlers.RoleHandler("admin", handlers.GetAuditLog)).Methods("GET")
+
+	// Retention
+	api.Handle("/admin/retention", handlers.RoleHandler("admin", handlers.GetRetention)).Methods("GET")
+	api.Handle("/admin/retention/run", handlers.RoleHandler("admin", handlers.RunRetention)).Methods("POST")
+	api.Handle("/admin/retention/rollups", handlers.RoleHandler("admin", handlers.GetRetentionRollups)).Methods("GET")
+	api.Handle("/admin/retention/{table}", handlers.RoleHandler("admin", handlers.UpdateRetention)).Methods("PUT")
+
+	// Token index
+	api.Handle("/admin/token-index", handlers.RoleHandler("admin", handlers.GetTokenIndexStatus)).Methods("GET")
+	api.Handle("/admin/token-index/rebuild", handlers.RoleHandler("admin", handlers.RebuildTokenIndexHandler)).Methods("POST")
 
 	// Dependency Graph
 	api.HandleFunc("/graph/dependencies", handlers.GetDependencyGraph).Methods("GET")
@@ -333,7 +454,17 @@ func main() {
 
 	// Phase 2: Task Dependencies (DAGs)
 	api.HandleFunc("/tasks/{id}/dependencies", handlers.GetTaskDependencies).Methods("GET")
-	api.HandleFunc("/tasks/{id}/dependencies", handlers.UpdateTaskDependencies).Methods("PUT")
+	api.HandleFunc("/tasks/{id}/dependencies", taskHandler.UpdateTaskDependencies).Methods("PUT")
+	api.HandleFunc("/tasks/{id}/readiness", schedulerHandler.GetTaskReadiness).Methods("GET")
+	api.HandleFunc("/tasks/{id}/sla", handlers.GetTaskSLA).Methods("GET")
+	api.HandleFunc("/scheduler/teams", schedulerHandler.ListTeamScheduling).Methods("GET")
+	api.Handle("/scheduler/teams/{team}", handlers.RoleHandler("admin", schedulerHandler.SetTeamScheduling)).Methods("PUT")
+
+	// Work queue (claim/lease task pickup)
+	api.HandleFunc("/queue/claim", queueHandler.ClaimTask).Methods("POST")
+	api.HandleFunc("/queue/leases", queueHandler.ListLeases).Methods("GET")
+	api.HandleFunc("/queue/leases/{task_id}/heartbeat", queueHandler.HeartbeatLease).Methods("POST")
+	api.HandleFunc("/queue/leases/{task_id}/release", queueHandler.ReleaseLease).Methods("POST")
 
 	// Phase 2: Incidents
 	api.HandleFunc("/incidents", handlers.GetIncidents).Methods("GET")
@@ -362,6 +493,10 @@ func main() {
 
 	// WebSocket
 	router.HandleFunc("/ws/stream", func(w http.ResponseWriter, r *http.Request) {
+		if !handlers.AuthorizeWebSocket(r) {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Printf("WebSocket upgrade error: %v", err)
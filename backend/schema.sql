@@ -154,7 +154,8 @@ CREATE TABLE IF NOT EXISTS alert_rules (
     notify_webhook_id UUID,
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    CONSTRAINT valid_condition_type CHECK (condition_type IN ('no_heartbeat', 'error_rate', 'task_stuck'))
+    CONSTRAINT valid_condition_type CHECK (condition_type IN ('no_heartbeat', 'error_rate', 'task_stuck', 'login_bruteforce', 'sla_breach',
+                                                              'cost_threshold_exceeded', 'agent_idle', 'expression'))
 );
 
 -- Alert History table
@@ -281,7 +282,8 @@ CREATE INDEX IF NOT EXISTS idx_agent_traces_created ON agent_traces(created_at);
 DO $$ BEGIN
   ALTER TABLE alert_rules DROP CONSTRAINT IF EXISTS valid_condition_type;
   ALTER TABLE alert_rules ADD CONSTRAINT valid_condition_type
-    CHECK (condition_type IN ('no_heartbeat', 'error_rate', 'task_stuck', 'cost_threshold_exceeded', 'sla_breach', 'agent_idle'));
+    CHECK (condition_type IN ('no_heartbeat', 'error_rate', 'task_stuck', 'login_bruteforce', 'sla_breach',
+                              'cost_threshold_exceeded', 'agent_idle', 'expression'));
 END $$;
 -- Trigger to auto-update updated_at on tasks
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -364,3 +366,409 @@ CREATE TABLE IF NOT EXISTS incidents (
 
 CREATE INDEX IF NOT EXISTS idx_incidents_status ON incidents(status);
 CREATE INDEX IF NOT EXISTS idx_incidents_severity ON incidents(severity);
+
+-- Users table (per-user dashboard accounts)
+CREATE TABLE IF NOT EXISTS users (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    username VARCHAR(100) NOT NULL UNIQUE,
+    display_name VARCHAR(255) NOT NULL DEFAULT '',
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    password_hash VARCHAR(255),
+    role VARCHAR(20) NOT NULL DEFAULT 'member',
+    disabled BOOLEAN NOT NULL DEFAULT false,
+    invite_token_hash VARCHAR(64),
+    invite_expires_at TIMESTAMP,
+    last_login TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_user_role CHECK (role IN ('admin', 'member', 'viewer'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_invite_token ON users(invite_token_hash);
+
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
+CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- API key prefixes: the visible nc_live_<id> part of a key, used to find its row
+-- without bcrypt-comparing every key. Legacy nb_ keys have no prefix.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(32);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys(key_prefix);
+
+-- Scoped keys: empty scopes = unrestricted (role only); agent_id binds a key to one agent
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS agent_id VARCHAR(100) REFERENCES agents(id) ON DELETE CASCADE;
+
+-- SSO users: linked to an OpenID Connect identity (issuer + subject) instead of a password
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_issuer VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc ON users(oidc_issuer, oidc_subject);
+
+-- Login sessions: one per login, holding the sha256 of the current refresh token.
+-- previous_token_hash detects replay of a rotated-out refresh token.
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash VARCHAR(64) NOT NULL UNIQUE,
+    previous_token_hash VARCHAR(64),
+    method VARCHAR(20) NOT NULL DEFAULT 'password',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    revoked_reason VARCHAR(50)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_previous ON user_sessions(previous_token_hash);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_revoked ON user_sessions(revoked_at) WHERE revoked_at IS NOT NULL;
+
+-- HMAC keys for access tokens. The newest unretired key signs; retired keys
+-- verify until their tokens expire. Unused when JWT_SECRET is set.
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    id VARCHAR(32) PRIMARY KEY,
+    secret VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    retired_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action_time ON audit_logs(action, timestamp);
+
+-- Outbound webhook deliveries. body is the exact JSON sent (and signed), so
+-- retries are byte-identical.
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS consecutive_failures INT NOT NULL DEFAULT 0;
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS disabled_reason TEXT;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event VARCHAR(100) NOT NULL,
+    url TEXT NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 10,
+    next_attempt_at TIMESTAMP DEFAULT NOW(),
+    last_status_code INT,
+    last_latency_ms INT,
+    last_error TEXT,
+    response_snippet TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP,
+    CONSTRAINT valid_delivery_status CHECK (status IN ('pending', 'retrying', 'delivered', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at)
+    WHERE status IN ('pending', 'retrying');
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+
+-- Redeliveries are new rows carrying the original body; redelivery_of points at the source
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS redelivery_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_redelivery_of ON webhook_deliveries(redelivery_of);
+
+-- Task workflows: named status sets and guarded transitions, chosen per team or template
+CREATE TABLE IF NOT EXISTS workflows (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    initial_status VARCHAR(50) NOT NULL,
+    statuses JSONB NOT NULL DEFAULT '[]',
+    transitions JSONB NOT NULL DEFAULT '[]',
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflows_single_default ON workflows(is_default) WHERE is_default;
+
+CREATE TABLE IF NOT EXISTS team_workflows (
+    team VARCHAR(100) PRIMARY KEY,
+    workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE
+);
+
+ALTER TABLE task_templates ADD COLUMN IF NOT EXISTS workflow_id UUID REFERENCES workflows(id) ON DELETE SET NULL;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS template_id UUID REFERENCES task_templates(id) ON DELETE SET NULL;
+
+-- Statuses now come from workflows; only their shape is enforced here
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS valid_status;
+ALTER TABLE tasks ADD CONSTRAINT valid_status CHECK (status ~ '^[a-z][a-z0-9_-]{0,49}$');
+
+-- Workflow rules: scoped, conditional action chains run on task transitions
+CREATE TABLE IF NOT EXISTS workflow_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(150) NOT NULL,
+    description TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    scope_type VARCHAR(20) NOT NULL DEFAULT 'global',
+    scope_value VARCHAR(255),
+    from_status VARCHAR(50),
+    to_status VARCHAR(50),
+    conditions JSONB NOT NULL DEFAULT '[]',
+    actions JSONB NOT NULL DEFAULT '[]',
+    stop_on_error BOOLEAN NOT NULL DEFAULT false,
+    position INTEGER NOT NULL DEFAULT 0,
+    source VARCHAR(20) NOT NULL DEFAULT 'api',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_rule_scope CHECK (scope_type IN ('global', 'template', 'team', 'label')),
+    CONSTRAINT valid_rule_source CHECK (source IN ('api', 'template'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_rules_scope ON workflow_rules(scope_type, scope_value);
+
+-- Mirror rules already stored on templates, once per template
+INSERT INTO workflow_rules (name, scope_type, scope_value, from_status, to_status, actions, position, source)
+SELECT 'template rule ' || e.n || ': ' || (e.r->>'action'),
+       'template', t.id::text,
+       NULLIF(e.r->>'from_status', ''), NULLIF(e.r->>'to_status', ''),
+       jsonb_build_array(CASE e.r->>'action'
+           WHEN 'notify' THEN jsonb_build_object('type', 'notify', 'agent_id', COALESCE(e.r->>'target', ''))
+           ELSE jsonb_build_object('type', e.r->>'action', 'value', COALESCE(e.r->>'target', ''))
+       END),
+       e.n - 1, 'template'
+FROM task_templates t
+CROSS JOIN LATERAL jsonb_array_elements(
+    CASE WHEN jsonb_typeof(t.workflow_rules) = 'array' THEN t.workflow_rules ELSE '[]'::jsonb END
+) WITH ORDINALITY AS e(r, n)
+WHERE COALESCE(e.r->>'action', '') IN ('assign', 'notify', 'create_subtask')
+  AND NOT EXISTS (
+      SELECT 1 FROM workflow_rules wr
+      WHERE wr.source = 'template' AND wr.scope_type = 'template' AND wr.scope_value = t.id::text
+  );
+
+CREATE TABLE IF NOT EXISTS workflow_rule_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    rule_id UUID REFERENCES workflow_rules(id) ON DELETE SET NULL,
+    rule_name VARCHAR(150) NOT NULL,
+    task_id UUID NOT NULL,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    results JSONB NOT NULL DEFAULT '[]',
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_rule_run_status CHECK (status IN ('success', 'partial', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_rule_runs_rule ON workflow_rule_runs(rule_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_workflow_rule_runs_task ON workflow_rule_runs(task_id, created_at DESC);
+
+-- Scheduler: unblocked tasks move to their ready status; teams opt in to auto-assignment
+CREATE TABLE IF NOT EXISTS team_scheduling (
+    team VARCHAR(100) PRIMARY KEY,
+    auto_assign BOOLEAN NOT NULL DEFAULT false,
+    roles TEXT[] NOT NULL DEFAULT '{}',
+    max_active_per_agent INTEGER NOT NULL DEFAULT 1 CHECK (max_active_per_agent > 0),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Work queue leases: one live claim per task, renewed by heartbeat
+CREATE TABLE IF NOT EXISTS task_leases (
+    task_id UUID PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+    agent_id VARCHAR(100) NOT NULL,
+    token UUID NOT NULL,
+    claimed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    heartbeat_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_leases_expires ON task_leases(expires_at);
+CREATE INDEX IF NOT EXISTS idx_task_leases_agent ON task_leases(agent_id);
+
+-- Recurring tasks: cron schedules on templates and their run history
+CREATE TABLE IF NOT EXISTS template_schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    template_id UUID NOT NULL REFERENCES task_templates(id) ON DELETE CASCADE,
+    cron VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    title_pattern TEXT NOT NULL DEFAULT '{{template}} {{date}}',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    catch_up VARCHAR(10) NOT NULL DEFAULT 'latest',
+    max_catch_up INTEGER NOT NULL DEFAULT 10 CHECK (max_catch_up > 0),
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT valid_catch_up CHECK (catch_up IN ('skip', 'latest', 'all'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_template_schedules_template ON template_schedules(template_id);
+CREATE INDEX IF NOT EXISTS idx_template_schedules_due ON template_schedules(next_run_at) WHERE enabled;
+
+CREATE TABLE IF NOT EXISTS template_schedule_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    schedule_id UUID REFERENCES template_schedules(id) ON DELETE SET NULL,
+    template_id UUID NOT NULL REFERENCES task_templates(id) ON DELETE CASCADE,
+    scheduled_for TIMESTAMPTZ NOT NULL,
+    ran_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    task_id UUID REFERENCES tasks(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL,
+    catch_up BOOLEAN NOT NULL DEFAULT false,
+    note TEXT,
+    CONSTRAINT valid_schedule_run_status CHECK (status IN ('created', 'skipped', 'failed')),
+    UNIQUE (schedule_id, scheduled_for)
+);
+
+CREATE INDEX IF NOT EXISTS idx_template_schedule_runs_template ON template_schedule_runs(template_id, scheduled_for DESC);
+
+-- SLA policies by priority/team; sla_breach rules escalate breaches step by step
+CREATE TABLE IF NOT EXISTS sla_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    priority VARCHAR(20),  -- NULL = any priority
+    team VARCHAR(100),     -- NULL = any team
+    response_minutes INTEGER CHECK (response_minutes > 0),
+    resolution_minutes INTEGER CHECK (resolution_minutes > 0),
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT sla_policy_has_target CHECK (response_minutes IS NOT NULL OR resolution_minutes IS NOT NULL)
+);
+
+CREATE TABLE IF NOT EXISTS sla_escalations (
+    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    target VARCHAR(20) NOT NULL CHECK (target IN ('response', 'resolution')),
+    policy_id UUID REFERENCES sla_policies(id) ON DELETE SET NULL,
+    level INTEGER NOT NULL,
+    breached_at TIMESTAMPTZ NOT NULL,
+    last_escalated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (task_id, target)
+);
+
+-- Cost rules sum spend over an hour, day or month, per agent or for the fleet
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS time_window VARCHAR(10) NOT NULL DEFAULT 'day';
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS scope VARCHAR(10) NOT NULL DEFAULT 'agent';
+ALTER TABLE alert_rules DROP CONSTRAINT IF EXISTS valid_alert_window;
+ALTER TABLE alert_rules ADD CONSTRAINT valid_alert_window CHECK (time_window IN ('hour', 'day', 'month'));
+ALTER TABLE alert_rules DROP CONSTRAINT IF EXISTS valid_alert_scope;
+ALTER TABLE alert_rules ADD CONSTRAINT valid_alert_scope CHECK (scope IN ('agent', 'fleet'));
+
+-- Alert state: one alert_history row per alert, repeated occurrences folded in.
+-- Rows from before this change are closed; new alerts default to firing.
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS state VARCHAR(10) NOT NULL DEFAULT 'resolved';
+ALTER TABLE alert_history ALTER COLUMN state SET DEFAULT 'firing';
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(255);
+UPDATE alert_history SET fingerprint = COALESCE(agent_id, '') WHERE fingerprint IS NULL;
+ALTER TABLE alert_history ALTER COLUMN fingerprint SET DEFAULT '';
+ALTER TABLE alert_history ALTER COLUMN fingerprint SET NOT NULL;
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
+UPDATE alert_history SET last_seen_at = triggered_at WHERE last_seen_at IS NULL;
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS occurrences INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS last_notified_at TIMESTAMP;
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP;
+ALTER TABLE alert_history ADD COLUMN IF NOT EXISTS silenced_until TIMESTAMP;
+ALTER TABLE alert_history DROP CONSTRAINT IF EXISTS valid_alert_state;
+ALTER TABLE alert_history ADD CONSTRAINT valid_alert_state CHECK (state IN ('firing', 'resolved', 'silenced'));
+
+CREATE INDEX IF NOT EXISTS idx_alert_history_fingerprint ON alert_history(rule_id, fingerprint, triggered_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alert_history_open ON alert_history(rule_id, fingerprint) WHERE state <> 'resolved';
+
+-- Per-rule notification policy: quiet reopen window and re-notify interval (0 = never)
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS cooldown_minutes INTEGER NOT NULL DEFAULT 5 CHECK (cooldown_minutes >= 0);
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS renotify_minutes INTEGER NOT NULL DEFAULT 0 CHECK (renotify_minutes >= 0);
+
+-- Expression rules: a metric query such as "p95(response_time[1h]) by agent > 30 for 10m"
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS expression TEXT;
+
+-- Groups whose expression matches but haven't held for the rule's "for" duration yet
+CREATE TABLE IF NOT EXISTS alert_pending (
+    rule_id UUID NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    fingerprint VARCHAR(255) NOT NULL,
+    since TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (rule_id, fingerprint)
+);
+
+-- OpenTelemetry spans received over OTLP
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS trace_id VARCHAR(32);
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS span_id VARCHAR(16);
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS parent_span_id VARCHAR(16);
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS name TEXT;
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS attributes JSONB;
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS status_code VARCHAR(10);
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS status_message TEXT;
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS start_time TIMESTAMPTZ;
+ALTER TABLE agent_traces ADD COLUMN IF NOT EXISTS end_time TIMESTAMPTZ;
+ALTER TABLE agent_traces DROP CONSTRAINT IF EXISTS valid_trace_type;
+ALTER TABLE agent_traces ADD CONSTRAINT valid_trace_type
+    CHECK (trace_type IN ('tool_call', 'llm_invoke', 'sub_agent_spawn', 'file_change', 'error', 'span'));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_agent_traces_span ON agent_traces(trace_id, span_id) WHERE span_id IS NOT NULL;
+
+-- Span IDs posted to /api/traces needn't be OpenTelemetry-sized
+ALTER TABLE agent_traces ALTER COLUMN trace_id TYPE VARCHAR(64);
+ALTER TABLE agent_traces ALTER COLUMN span_id TYPE VARCHAR(64);
+ALTER TABLE agent_traces ALTER COLUMN parent_span_id TYPE VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_agent_traces_trace ON agent_traces(trace_id);
+
+-- Retention: raw rows older than raw_days are rolled into daily_rollups and
+-- deleted; rollups older than summary_days are dropped. 0 keeps forever.
+-- Policies are opt-in: nothing is pruned until an admin enables one.
+CREATE TABLE IF NOT EXISTS retention_policies (
+    table_name VARCHAR(50) PRIMARY KEY,
+    raw_days INTEGER NOT NULL DEFAULT 0 CHECK (raw_days >= 0),
+    summary_days INTEGER NOT NULL DEFAULT 0 CHECK (summary_days >= 0),
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    last_pruned_at TIMESTAMPTZ,
+    last_pruned_rows BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Suggested periods; audit_logs keeps everything until one is chosen
+INSERT INTO retention_policies (table_name, raw_days, summary_days, enabled) VALUES
+    ('agent_traces', 14, 365, false),
+    ('activity_log', 90, 365, false),
+    ('audit_logs', 0, 0, false),
+    ('alert_history', 90, 365, false),
+    ('notifications', 30, 365, false)
+ON CONFLICT (table_name) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS daily_rollups (
+    table_name VARCHAR(50) NOT NULL,
+    day DATE NOT NULL,
+    agent_id VARCHAR(100) NOT NULL DEFAULT '',
+    kind VARCHAR(100) NOT NULL DEFAULT '',
+    count BIGINT NOT NULL DEFAULT 0,
+    error_count BIGINT NOT NULL DEFAULT 0,
+    total_ms BIGINT NOT NULL DEFAULT 0,
+    max_ms BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (table_name, day, agent_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS idx_daily_rollups_day ON daily_rollups(table_name, day);
+
+-- Token usage indexed from session JSONL files, one row per assistant message.
+-- session_files tracks how far each file has been read.
+CREATE TABLE IF NOT EXISTS session_files (
+    path TEXT PRIMARY KEY,
+    agent_id VARCHAR(100) NOT NULL,
+    inode BIGINT NOT NULL DEFAULT 0,
+    size BIGINT NOT NULL DEFAULT 0,
+    read_offset BIGINT NOT NULL DEFAULT 0,
+    mod_time TIMESTAMPTZ,
+    indexed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS token_usage (
+    id BIGSERIAL PRIMARY KEY,
+    file_path TEXT NOT NULL,
+    line_offset BIGINT NOT NULL,
+    agent_id VARCHAR(100) NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    ts TIMESTAMPTZ NOT NULL,
+    input_tokens BIGINT NOT NULL DEFAULT 0,
+    output_tokens BIGINT NOT NULL DEFAULT 0,
+    cache_read_tokens BIGINT NOT NULL DEFAULT 0,
+    cache_write_tokens BIGINT NOT NULL DEFAULT 0,
+    total_tokens BIGINT NOT NULL DEFAULT 0,
+    reported_cost DOUBLE PRECISION NOT NULL DEFAULT 0, -- usage.cost.total from the session, 0 if absent
+    cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,      -- reported_cost, or priced from the model
+    UNIQUE (file_path, line_offset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_usage_ts ON token_usage(ts);
+CREATE INDEX IF NOT EXISTS idx_token_usage_agent_ts ON token_usage(agent_id, ts);
+
+-- Which built-in workflow upgrades a seeded workflow has received; see
+-- builtinUpgrades. Workflows that predate it start at 0 and get them once.
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS seed_version INTEGER NOT NULL DEFAULT 0;
@@ -3,9 +3,8 @@
 const API_BASE = window.AGENTBOARD_API || '';
 
 window.apiFetch = async function apiFetch(path, options = {}) {
-  // Inject auth token for write requests
-  const isWrite = options.method && options.method !== 'GET';
-  if (isWrite && window.Auth) {
+  // Inject auth token (reads may need it too when the server runs in private mode)
+  if (window.Auth) {
     const token = Auth.getToken();
     if (token) {
       options.headers = Object.assign({}, options.headers, {
@@ -16,8 +15,11 @@ window.apiFetch = async function apiFetch(path, options = {}) {
 
   const res = await fetch(API_BASE + path, options);
 
-  // On 401 for write requests, show login modal then retry
-  if (res.status === 401 && isWrite && window.Auth) {
+  // On 401, try to refresh the session once, else show login modal then retry
+  if (res.status === 401 && window.Auth) {
+    if (!options._refreshed && await Auth.refresh()) {
+      return apiFetch(path, Object.assign({}, options, { _refreshed: true }));
+    }
     return Auth.handle401(() => apiFetch(path, options));
   }
 
@@ -54,6 +56,17 @@ window.API = {
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify({ status })
   }),
+  getWorkflows: () => apiFetch('/api/workflows'),
+  getWorkflowRules: () => apiFetch('/api/workflow-rules'),
+  dryRunWorkflowRules: (data) => apiFetch('/api/workflow-rules/dry-run', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(data)
+  }),
+  getWorkflowRuleRuns: (params = {}) => {
+    const qs = new URLSearchParams(params).toString();
+    return apiFetch('/api/workflow-rules/runs' + (qs ? '?' + qs : ''));
+  },
   getActivity: (params = {}) => {
     const qs = new URLSearchParams(params).toString();
     return apiFetch('/api/activity' + (qs ? '?' + qs : ''));
@@ -114,6 +127,7 @@ window.API = {
 
   // Webhooks
   getWebhooks: () => apiFetch('/api/webhooks'),
+  getWebhookEvents: () => apiFetch('/api/webhooks/events'),
   createWebhook: (data) => apiFetch('/api/webhooks', {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
@@ -168,12 +182,25 @@ window.API = {
     body: JSON.stringify(data)
   }),
   deleteAlertRule: (id) => apiFetch(`/api/alerts/rules/${id}`, { method: 'DELETE' }),
+  previewAlertExpression: (data) => apiFetch('/api/alerts/rules/preview', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(data)
+  }),
   getAlertHistory: (params = {}) => {
     const qs = new URLSearchParams(params).toString();
     return apiFetch('/api/alerts/history' + (qs ? '?' + qs : ''));
   },
   acknowledgeAlert: (id) => apiFetch(`/api/alerts/history/${id}/acknowledge`, { method: 'POST' }),
   getAlertUnacknowledgedCount: () => apiFetch('/api/alerts/unacknowledged-count'),
+  getSLAPolicies: () => apiFetch('/api/sla/policies'),
+  createSLAPolicy: (data) => apiFetch('/api/sla/policies', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(data)
+  }),
+  deleteSLAPolicy: (id) => apiFetch(`/api/sla/policies/${id}`, { method: 'DELETE' }),
+  getTaskSLA: (id) => apiFetch(`/api/tasks/${id}/sla`),
 
   // Dependency Graph
   getGraphDependencies: () => apiFetch('/api/graph/dependencies'),
@@ -193,10 +220,10 @@ window.API = {
     apiFetch(`/api/agents/${encodeURIComponent(agentId)}/commits?limit=${limit}`),
 
   // Auth
-  authLogin: (password) => apiFetch('/api/auth/login', {
+  authLogin: (username, password) => apiFetch('/api/auth/login', {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
-    body: JSON.stringify({ password })
+    body: JSON.stringify({ username, password })
   }),
   authMe: () => apiFetch('/api/auth/me'),
 
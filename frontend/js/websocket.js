@@ -16,7 +16,8 @@
     if (ws && (ws.readyState === WebSocket.OPEN || ws.readyState === WebSocket.CONNECTING)) return;
 
     try {
-      ws = new WebSocket(WS_URL);
+      const token = window.Auth && Auth.getToken();
+      ws = new WebSocket(token ? WS_URL + '?token=' + encodeURIComponent(token) : WS_URL);
     } catch (e) {
       scheduleReconnect();
       return;
@@ -41,8 +42,14 @@
     };
 
     ws.onclose = () => {
+      const wasConnected = connected;
       connected = false;
       emit('_disconnected', {});
+      // A rejected handshake may mean the access token expired; refresh it first
+      if (!wasConnected && window.Auth && Auth.getToken()) {
+        Auth.refresh().finally(scheduleReconnect);
+        return;
+      }
       scheduleReconnect();
     };
 
@@ -1160,8 +1160,8 @@ Pages.agents = {
 
     try {
       const [scRes, tlRes] = await Promise.allSettled([
-        fetch(`/api/agents/${encodeURIComponent(agentId)}/scorecard`).then(r => r.ok ? r.json() : null),
-        fetch(`/api/agents/${encodeURIComponent(agentId)}/performance/timeline`).then(r => r.ok ? r.json() : [])
+        fetch(`/api/agents/${encodeURIComponent(agentId)}/scorecard`, { headers: Auth.authHeaders() }).then(r => r.ok ? r.json() : null),
+        fetch(`/api/agents/${encodeURIComponent(agentId)}/performance/timeline`, { headers: Auth.authHeaders() }).then(r => r.ok ? r.json() : [])
       ]);
       scorecard = scRes.status === 'fulfilled' ? scRes.value : null;
       timeline = (tlRes.status === 'fulfilled' && Array.isArray(tlRes.value)) ? tlRes.value : [];
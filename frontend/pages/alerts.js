@@ -70,14 +70,42 @@ Pages.alerts = {
                   <option value="cost_threshold_exceeded">Cost Threshold Exceeded</option>
                   <option value="sla_breach">SLA Breach</option>
                   <option value="agent_idle">Agent Idle</option>
+                  <option value="login_bruteforce">Login Brute-force</option>
+                  <option value="expression">Expression</option>
                 </select>
               </div>
 
-              <div>
+              <div id="alertFormThresholdWrap">
                 <label style="font-size:12px;color:var(--text-secondary);display:block;margin-bottom:4px" id="alertFormThresholdLabel">Threshold (minutes)</label>
                 <input class="input" id="alertFormThreshold" type="number" min="1" value="30" style="width:100%;box-sizing:border-box">
               </div>
 
+              <div class="alert-cost-opt" style="display:none">
+                <label style="font-size:12px;color:var(--text-secondary);display:block;margin-bottom:4px">Window (UTC)</label>
+                <select class="select" id="alertFormWindow" style="width:100%;box-sizing:border-box">
+                  <option value="day">Current day</option>
+                  <option value="hour">Current hour</option>
+                  <option value="month">Current month</option>
+                </select>
+              </div>
+
+              <div class="alert-cost-opt" style="display:none">
+                <label style="font-size:12px;color:var(--text-secondary);display:block;margin-bottom:4px">Scope</label>
+                <select class="select" id="alertFormScope" style="width:100%;box-sizing:border-box">
+                  <option value="agent">Each agent</option>
+                  <option value="fleet">Fleet total</option>
+                </select>
+              </div>
+
+              <div class="alert-expr-opt" style="display:none;grid-column:1/-1">
+                <label style="font-size:12px;color:var(--text-secondary);display:block;margin-bottom:4px">Expression</label>
+                <div style="display:flex;gap:8px">
+                  <input class="input" id="alertFormExpression" type="text" placeholder='p95(response_time[1h]) by agent > 30 for 10m' style="flex:1;font-family:monospace">
+                  <button class="btn-secondary" onclick="Pages.alerts._previewExpression()">Preview</button>
+                </div>
+                <div id="alertFormExprPreview" style="font-size:12px;color:var(--text-secondary);margin-top:6px"></div>
+              </div>
+
               <div style="grid-column:1/-1">
                 <label style="font-size:12px;color:var(--text-secondary);display:block;margin-bottom:4px">Notify via Webhook</label>
                 <select class="select" id="alertFormWebhook" style="width:100%;box-sizing:border-box">
@@ -320,14 +348,17 @@ Pages.alerts = {
       cost_threshold_exceeded: 'Cost Threshold',
       sla_breach: 'SLA Breach',
       agent_idle: 'Agent Idle',
+      login_bruteforce: 'Login Brute-force',
+      expression: 'Expression',
     };
     const condUnits = {
       no_heartbeat: 'min',
       task_stuck: 'min',
       error_rate: 'errors/hr',
-      cost_threshold_exceeded: 'USD',
+      cost_threshold_exceeded: 'USD/' + (r.window || 'day') + (r.scope === 'fleet' ? ' (fleet)' : ''),
       sla_breach: 'min',
       agent_idle: 'min',
+      login_bruteforce: 'failures/15m',
     };
     const statusColor = r.enabled ? 'var(--green,#22c55e)' : 'var(--text-tertiary)';
     const statusText = r.enabled ? '● Active' : '○ Disabled';
@@ -343,7 +374,9 @@ Pages.alerts = {
       <td style="font-weight:500">${Utils.esc(r.name)}</td>
       <td><span class="badge badge--neutral">${Utils.esc(condLabels[r.condition_type] || r.condition_type)}</span></td>
       <td style="color:var(--text-secondary)">${r.agent_id ? Utils.esc(r.agent_id) : '<span style="color:var(--text-tertiary)">All</span>'}</td>
-      <td>${r.threshold} <span style="color:var(--text-tertiary);font-size:12px">${condUnits[r.condition_type] || ''}</span></td>
+      <td>${r.condition_type === 'expression'
+        ? `<code style="font-size:12px">${Utils.esc(r.expression || '')}</code>`
+        : `${r.threshold} <span style="color:var(--text-tertiary);font-size:12px">${condUnits[r.condition_type] || ''}</span>`}</td>
       <td style="font-size:12px;color:var(--text-secondary)">${webhookName}</td>
       <td style="color:${statusColor};font-size:12px;font-weight:600">${statusText}</td>
       <td>
@@ -393,12 +426,13 @@ Pages.alerts = {
       <table class="table" style="width:100%">
         <thead>
           <tr>
-            <th>Time</th>
+            <th>Last Seen</th>
             <th>Rule</th>
             <th>Agent</th>
             <th>Message</th>
+            <th>Count</th>
             <th>Status</th>
-            <th style="width:60px"></th>
+            <th style="width:110px"></th>
           </tr>
         </thead>
         <tbody>
@@ -408,19 +442,30 @@ Pages.alerts = {
   },
 
   _histRow(h) {
-    const ts = new Date(h.triggered_at);
-    const timeStr = ts.toLocaleDateString() + ' ' + ts.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
-    const statusColor = h.acknowledged ? 'var(--text-tertiary)' : 'var(--yellow,#f59e0b)';
-    const statusText = h.acknowledged ? '✓ Acked' : '⚠ Active';
+    const fmt = (t) => {
+      const ts = new Date(t);
+      return ts.toLocaleDateString() + ' ' + ts.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+    };
+    const timeStr = fmt(h.last_seen_at || h.triggered_at);
+    const states = {
+      firing: ['var(--red,#ef4444)', '● Firing'],
+      silenced: ['var(--text-tertiary)', '◌ Silenced'],
+      resolved: ['var(--green,#22c55e)', '✓ Resolved'],
+    };
+    let [statusColor, statusText] = states[h.state] || ['var(--yellow,#f59e0b)', '⚠ Active'];
+    if (h.acknowledged) statusText += ' · Acked';
 
     return `<tr style="${h.acknowledged ? 'opacity:0.65' : ''}">
       <td style="font-family:var(--font-display);font-size:11px;color:var(--text-secondary);white-space:nowrap">${Utils.esc(timeStr)}</td>
       <td style="font-weight:500;font-size:12px">${Utils.esc(h.rule_name || '—')}</td>
       <td style="font-size:12px;color:var(--text-secondary)">${h.agent_id ? Utils.esc(h.agent_id) : '—'}</td>
       <td style="font-size:12px;color:var(--text-secondary);max-width:320px;white-space:nowrap;overflow:hidden;text-overflow:ellipsis" title="${Utils.esc(h.message)}">${Utils.esc(h.message || '—')}</td>
+      <td style="font-size:12px;color:var(--text-secondary);white-space:nowrap" title="First seen ${Utils.esc(fmt(h.triggered_at))}">×${h.count || 1}</td>
       <td style="color:${statusColor};font-size:11px;font-weight:600;white-space:nowrap">${statusText}</td>
-      <td>
+      <td style="white-space:nowrap">
         ${!h.acknowledged ? `<button class="btn-secondary" style="font-size:11px;padding:2px 8px" onclick="Pages.alerts._ackAlert('${Utils.esc(h.id)}')">Ack</button>` : ''}
+        ${h.state === 'firing' ? `<button class="btn-secondary" style="font-size:11px;padding:2px 8px" onclick="Pages.alerts._silenceAlert('${Utils.esc(h.id)}', true)">Silence 1h</button>` : ''}
+        ${h.state === 'silenced' ? `<button class="btn-secondary" style="font-size:11px;padding:2px 8px" onclick="Pages.alerts._silenceAlert('${Utils.esc(h.id)}', false)">Unsilence</button>` : ''}
       </td>
     </tr>`;
   },
@@ -441,7 +486,7 @@ Pages.alerts = {
     const wrap = document.getElementById('alertsFormWrap');
     if (wrap) wrap.style.display = 'none';
     // Reset form fields
-    const fields = ['alertFormName', 'alertFormAgent', 'alertFormCondition', 'alertFormThreshold', 'alertFormWebhook'];
+    const fields = ['alertFormName', 'alertFormAgent', 'alertFormCondition', 'alertFormThreshold', 'alertFormWindow', 'alertFormScope', 'alertFormExpression', 'alertFormWebhook'];
     fields.forEach(id => {
       const el = document.getElementById(id);
       if (!el) return;
@@ -449,6 +494,9 @@ Pages.alerts = {
       else if (el.type === 'number') el.value = '30';
       else el.value = '';
     });
+    const preview = document.getElementById('alertFormExprPreview');
+    if (preview) preview.innerHTML = '';
+    this._onConditionChange();
   },
 
   _onConditionChange() {
@@ -457,6 +505,15 @@ Pages.alerts = {
     const input = document.getElementById('alertFormThreshold');
     if (!cond || !label || !input) return;
 
+    document.querySelectorAll('.alert-cost-opt').forEach(el => {
+      el.style.display = cond.value === 'cost_threshold_exceeded' ? '' : 'none';
+    });
+    document.querySelectorAll('.alert-expr-opt').forEach(el => {
+      el.style.display = cond.value === 'expression' ? '' : 'none';
+    });
+    const thresholdWrap = document.getElementById('alertFormThresholdWrap');
+    if (thresholdWrap) thresholdWrap.style.display = cond.value === 'expression' ? 'none' : '';
+
     switch (cond.value) {
       case 'no_heartbeat':
         label.textContent = 'Threshold (minutes without heartbeat)';
@@ -473,13 +530,18 @@ Pages.alerts = {
         input.value = input.value || '5';
         input.min = '1';
         break;
+      case 'login_bruteforce':
+        label.textContent = 'Threshold (failed sign-ins per IP or account in 15 min)';
+        input.value = input.value || '10';
+        input.min = '1';
+        break;
       case 'cost_threshold_exceeded':
-        label.textContent = 'Threshold (USD amount)';
+        label.textContent = 'Threshold (USD spent in window)';
         input.value = input.value || '100';
         input.min = '1';
         break;
       case 'sla_breach':
-        label.textContent = 'Threshold (minutes past SLA)';
+        label.textContent = 'Threshold (minutes between escalation steps)';
         input.value = input.value || '30';
         input.min = '1';
         break;
@@ -505,7 +567,12 @@ Pages.alerts = {
       if (errEl) { errEl.textContent = 'Name and Condition are required.'; errEl.style.display = ''; }
       return;
     }
-    if (isNaN(threshold) || threshold < 1) {
+    const expression = (document.getElementById('alertFormExpression')?.value || '').trim();
+    if (condType === 'expression' && !expression) {
+      if (errEl) { errEl.textContent = 'Expression is required.'; errEl.style.display = ''; }
+      return;
+    }
+    if (condType !== 'expression' && (isNaN(threshold) || threshold < 1)) {
       if (errEl) { errEl.textContent = 'Threshold must be a positive number.'; errEl.style.display = ''; }
       return;
     }
@@ -522,6 +589,11 @@ Pages.alerts = {
       };
       if (agentId) body.agent_id = agentId;
       if (webhookId) body.notify_webhook_id = webhookId;
+      if (condType === 'cost_threshold_exceeded') {
+        body.window = document.getElementById('alertFormWindow')?.value || 'day';
+        body.scope = document.getElementById('alertFormScope')?.value || 'agent';
+      }
+      if (condType === 'expression') body.expression = expression;
 
       await apiFetch('/api/alerts/rules', {
         method: 'POST',
@@ -541,6 +613,26 @@ Pages.alerts = {
     }
   },
 
+  async _previewExpression() {
+    const out = document.getElementById('alertFormExprPreview');
+    const expression = (document.getElementById('alertFormExpression')?.value || '').trim();
+    if (!out || !expression) return;
+    const agentId = document.getElementById('alertFormAgent')?.value || '';
+    out.textContent = 'Evaluating…';
+    try {
+      const res = await API.previewAlertExpression({ expression, agent_id: agentId });
+      const rows = res.results || [];
+      if (!rows.length) {
+        out.textContent = 'No data in window — the rule would not fire.';
+        return;
+      }
+      out.innerHTML = rows.map(g => `<span style="margin-right:12px;color:${g.matches ? 'var(--red,#ef4444)' : 'inherit'}">`
+        + `${Utils.esc(g.agent_id || 'fleet')}: ${g.value}${g.matches ? ' ●' : ''}</span>`).join('');
+    } catch (e) {
+      out.textContent = e.message;
+    }
+  },
+
   // ── Actions ──────────────────────────────────────────────────
 
   async _toggleRule(id, enable) {
@@ -578,4 +670,15 @@ Pages.alerts = {
       alert('Failed to acknowledge alert: ' + e.message);
     }
   },
+
+  async _silenceAlert(id, silence) {
+    try {
+      await apiFetch(`/api/alerts/history/${id}/silence`, silence
+        ? { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ minutes: 60 }) }
+        : { method: 'DELETE' });
+      await this._refreshHistory();
+    } catch (e) {
+      alert('Failed to update alert: ' + e.message);
+    }
+  },
 };
@@ -79,7 +79,7 @@ window.Pages.documents = (function () {
     listEl.innerHTML = '<div class="loading-state"><div class="spinner"></div></div>';
 
     try {
-      const resp = await fetch('/api/documents');
+      const resp = await fetch('/api/documents', { headers: Auth.authHeaders() });
       fileList = await resp.json();
       renderFileList();
     } catch (e) {
@@ -134,7 +134,7 @@ window.Pages.documents = (function () {
     viewer.innerHTML = '<div class="loading-state"><div class="spinner"></div></div>';
 
     try {
-      const resp = await fetch('/api/documents/content?path=' + encodeURIComponent(path));
+      const resp = await fetch('/api/documents/content?path=' + encodeURIComponent(path), { headers: Auth.authHeaders() });
       const data = await resp.json();
       if (data.error) throw new Error(data.error);
 
@@ -24,7 +24,24 @@ Pages.kanban = {
     { id: 'done',     label: 'Done' },
   ],
 
+  // Columns follow the workflows: the default workflow's statuses first, then
+  // any extra statuses other workflows add. Falls back to COLUMNS as defined.
+  async _loadColumns() {
+    try {
+      const workflows = await API.getWorkflows();
+      const cols = [];
+      const seen = new Set();
+      (workflows || []).forEach(wf => (wf.statuses || []).forEach(s => {
+        if (seen.has(s.name)) return;
+        seen.add(s.name);
+        cols.push({ id: s.name, label: s.label || s.name });
+      }));
+      if (cols.length) this.COLUMNS = cols;
+    } catch (_) {}
+  },
+
   async render(container) {
+    await this._loadColumns();
     container.innerHTML = `
       <div class="kanban-filters">
         <div class="search-wrapper">
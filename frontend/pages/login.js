@@ -2,6 +2,7 @@
 
 window.Auth = (function () {
   const TOKEN_KEY = 'agentboard_token';
+  const REFRESH_KEY = 'agentboard_refresh_token';
 
   function getToken() {
     return localStorage.getItem(TOKEN_KEY);
@@ -13,6 +14,38 @@ window.Auth = (function () {
 
   function clearToken() {
     localStorage.removeItem(TOKEN_KEY);
+    localStorage.removeItem(REFRESH_KEY);
+  }
+
+  function setTokens(data) {
+    setToken(data.token);
+    if (data.refresh_token) localStorage.setItem(REFRESH_KEY, data.refresh_token);
+  }
+
+  // Exchange the refresh token for a new access token. Concurrent callers share
+  // one request, since each refresh token can only be used once.
+  let refreshing = null;
+  function refresh() {
+    const rt = localStorage.getItem(REFRESH_KEY);
+    if (!rt) return Promise.resolve(false);
+    if (!refreshing) {
+      refreshing = fetch('/api/auth/refresh', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: rt })
+      })
+        .then(async res => {
+          if (!res.ok) {
+            clearToken();
+            return false;
+          }
+          setTokens(await res.json());
+          return true;
+        })
+        .catch(() => false)
+        .finally(() => { refreshing = null; });
+    }
+    return refreshing;
   }
 
   async function checkAuth() {
@@ -27,24 +60,35 @@ window.Auth = (function () {
     }
   }
 
-  async function login(password) {
+  async function login(username, password) {
     const res = await fetch('/api/auth/login', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ password })
+      body: JSON.stringify({ username, password })
     });
     if (!res.ok) {
       const err = await res.json().catch(() => ({}));
       throw new Error(err.error || 'Login failed');
     }
-    const data = await res.json();
-    setToken(data.token);
+    setTokens(await res.json());
+  }
+
+  // SSO callback lands on /#sso_token=... or /#sso_error=...
+  function consumeSSORedirect() {
+    const params = new URLSearchParams(location.hash.slice(1));
+    const token = params.get('sso_token');
+    const error = params.get('sso_error');
+    if (!token && !error) return null;
+    if (token) setTokens({ token, refresh_token: params.get('sso_refresh') });
+    history.replaceState(null, '', location.pathname + location.search);
+    return error;
   }
 
   async function logout() {
     await fetch('/api/auth/logout', {
       method: 'POST',
-      headers: getToken() ? { Authorization: 'Bearer ' + getToken() } : {}
+      headers: Object.assign({ 'Content-Type': 'application/json' }, authHeaders()),
+      body: JSON.stringify({ refresh_token: localStorage.getItem(REFRESH_KEY) || '' })
     }).catch(() => {});
     clearToken();
     // Reload to show login modal
@@ -73,8 +117,18 @@ window.Auth = (function () {
           </svg>
         </div>
         <h2 class="auth-modal__title">AgentBoard</h2>
-        <p class="auth-modal__sub">Enter your admin password to continue</p>
+        <p class="auth-modal__sub">Sign in to continue</p>
         <form id="authForm" class="auth-modal__form" onsubmit="Auth._submit(event)">
+          <div class="auth-modal__field">
+            <input
+              type="text"
+              id="authUsername"
+              class="auth-modal__input"
+              placeholder="Username"
+              autocomplete="username"
+              autofocus
+            />
+          </div>
           <div class="auth-modal__field">
             <input
               type="password"
@@ -82,10 +136,10 @@ window.Auth = (function () {
               class="auth-modal__input"
               placeholder="Password"
               autocomplete="current-password"
-              autofocus
             />
           </div>
           <button type="submit" class="auth-modal__btn" id="authSubmitBtn">Sign In</button>
+          <a href="/api/auth/oidc/login" class="auth-modal__btn auth-modal__btn--sso" id="authSSOBtn" style="display:none">Sign in with SSO</a>
           <div id="authError" class="auth-modal__error" style="display:none"></div>
         </form>
       </div>`;
@@ -96,15 +150,34 @@ window.Auth = (function () {
     // Store callback
     overlay._onSuccess = onSuccess;
 
-    // Focus password field
+    // Offer SSO when the server has it configured
+    fetch('/api/auth/me')
+      .then(res => res.json())
+      .then(data => {
+        const sso = document.getElementById('authSSOBtn');
+        if (sso && data.sso) sso.style.display = '';
+      })
+      .catch(() => {});
+
+    if (ssoError) {
+      const errEl = document.getElementById('authError');
+      if (errEl) {
+        errEl.textContent = ssoError;
+        errEl.style.display = '';
+      }
+      ssoError = null;
+    }
+
+    // Focus username field
     setTimeout(() => {
-      const inp = document.getElementById('authPassword');
+      const inp = document.getElementById('authUsername');
       if (inp) inp.focus();
     }, 50);
   }
 
   async function _submit(e) {
     e.preventDefault();
+    const username = document.getElementById('authUsername')?.value.trim() || '';
     const pwd = document.getElementById('authPassword')?.value || '';
     const btn = document.getElementById('authSubmitBtn');
     const errEl = document.getElementById('authError');
@@ -115,14 +188,14 @@ window.Auth = (function () {
     if (errEl) errEl.style.display = 'none';
 
     try {
-      await login(pwd);
+      await login(username, pwd);
       const overlay = document.getElementById('authOverlay');
       if (overlay) overlay.style.display = 'none';
       if (overlay?._onSuccess) overlay._onSuccess();
       _renderLogoutBtn();
     } catch (err) {
       if (errEl) {
-        errEl.textContent = err.message || 'Invalid password';
+        errEl.textContent = err.message || 'Invalid username or password';
         errEl.style.display = '';
       }
     } finally {
@@ -166,13 +239,13 @@ window.Auth = (function () {
 
   // ─── Interceptor helper ────────────────────────────────────────────────────
 
-  // Returns auth headers for write requests
+  // Returns auth headers for API requests
   function authHeaders() {
     const t = getToken();
     return t ? { Authorization: 'Bearer ' + t } : {};
   }
 
-  // Handle 401 from any write call: show login modal, retry original call
+  // Handle 401 from any API call: show login modal, retry original call
   async function handle401(retryFn) {
     return new Promise((resolve, reject) => {
       renderLoginModal(async () => {
@@ -186,11 +259,15 @@ window.Auth = (function () {
     });
   }
 
+  let ssoError = consumeSSORedirect();
+  if (ssoError) document.addEventListener('DOMContentLoaded', () => renderLoginModal());
+
   // ─── Public API ────────────────────────────────────────────────────────────
 
   return {
     getToken,
     login,
+    refresh,
     logout,
     checkAuth,
     renderLoginModal,
@@ -76,11 +76,14 @@ Pages.settings = {
                 margin: 0;
                 line-height: 1.5;
               ">{
-  "event": "task.updated",
+  "event": "task_updated",
+  "schema_version": 1,
+  "timestamp": "2026-02-22T15:00:00Z",
+  "actor": "pixel",
   "task": {
     "id": "abc-123",
     "title": "Fix login bug",
-    "status": "in-progress",
+    "status": "progress",
     "assignee": "pixel",
     "priority": "high",
     "updated_at": "2026-02-22T15:00:00Z"
@@ -324,7 +327,9 @@ Pages.settings = {
     const el = document.getElementById('settingsWebhooks');
     if (!el) return;
     try {
-      this._webhooks = await API.getWebhooks();
+      const [webhooks, events] = await Promise.all([API.getWebhooks(), API.getWebhookEvents()]);
+      this._webhooks = webhooks;
+      this._webhookEvents = (events || []).filter(ev => !ev.direct);
       this._renderWebhookList();
     } catch (e) {
       el.innerHTML = `<div style="color:var(--danger,#ef4444);font-size:13px;padding:8px 0">${Utils.esc(e.message)}</div>`;
@@ -335,8 +340,6 @@ Pages.settings = {
     const el = document.getElementById('settingsWebhooks');
     if (!el) return;
 
-    const ALL_EVENTS = ['agent_down', 'task_done', 'task_failed', 'agent_error', 'agent_paused', 'agent_killed'];
-
     if (!this._webhooks || this._webhooks.length === 0) {
       el.innerHTML = `<div style="color:var(--text-tertiary);font-size:13px;padding:8px 0">No webhooks configured. Add one to get notified of events.</div>`;
       return;
@@ -371,7 +374,7 @@ Pages.settings = {
     if (!formEl) return;
 
     const existing = editId ? this._webhooks.find(w => w.id === editId) : null;
-    const ALL_EVENTS = ['agent_down', 'task_done', 'task_failed', 'agent_error', 'agent_paused', 'agent_killed'];
+    const ALL_EVENTS = this._webhookEvents || [];
 
     formEl.style.display = 'block';
     formEl.innerHTML = `
@@ -390,9 +393,9 @@ Pages.settings = {
             <label style="font-size:12px;color:var(--text-secondary);display:block;margin-bottom:6px">Events <span style="color:var(--danger,#ef4444)">*</span></label>
             <div style="display:flex;flex-wrap:wrap;gap:8px">
               ${ALL_EVENTS.map(ev => `
-                <label style="display:flex;align-items:center;gap:4px;font-size:12px;cursor:pointer;color:var(--text-secondary)">
-                  <input type="checkbox" name="whEvents" value="${Utils.esc(ev)}" ${existing && existing.events && existing.events.includes(ev) ? 'checked' : ''}>
-                  ${Utils.esc(ev)}
+                <label style="display:flex;align-items:center;gap:4px;font-size:12px;cursor:pointer;color:var(--text-secondary)" title="${Utils.esc(ev.description)} (v${ev.version})">
+                  <input type="checkbox" name="whEvents" value="${Utils.esc(ev.name)}" ${existing && existing.events && existing.events.includes(ev.name) ? 'checked' : ''}>
+                  ${Utils.esc(ev.name)}
                 </label>`).join('')}
             </div>
           </div>
@@ -9,8 +9,9 @@ Pages.traces = {
   _refreshTimer: null,
   _selectedTask: '',
   _selectedAgent: '',
-  _filters: { tool_call:true, llm_invoke:true, sub_agent_spawn:true, file_change:true, error:true },
+  _filters: { tool_call:true, llm_invoke:true, sub_agent_spawn:true, file_change:true, error:true, span:true },
   _expanded: {},
+  _waterfall: false,
 
   async render(container) {
     container.innerHTML = '<div class="traces-page">' +
@@ -21,6 +22,7 @@ Pages.traces = {
           '<select class="select" id="traceAgentSel" onchange="Pages.traces._onAgentChange(this.value)" style="min-width:140px"><option value="">All agents</option></select></div>' +
         '<div style="display:flex;gap:6px;align-items:flex-end;flex-wrap:wrap" id="traceTypeFilters"></div>' +
         '<div style="margin-left:auto;display:flex;gap:8px;align-items:flex-end">' +
+          '<button class="btn-secondary" id="traceWaterfallBtn" onclick="Pages.traces._toggleWaterfall()" style="font-size:12px;display:none">▤ Waterfall</button>' +
           '<button class="btn-secondary" onclick="Pages.traces._load()" style="font-size:12px">↻ Refresh</button>' +
           '<label style="font-size:12px;color:var(--text-secondary);display:flex;align-items:center;gap:4px;cursor:pointer">' +
             '<input type="checkbox" id="traceAutoRefresh" onchange="Pages.traces._toggleAutoRefresh(this.checked)"> Auto (5s)</label>' +
@@ -75,7 +77,8 @@ Pages.traces = {
       { key:'llm_invoke', icon:'🧠', label:'LLM' },
       { key:'sub_agent_spawn', icon:'🔀', label:'Sub-agent' },
       { key:'file_change', icon:'📁', label:'File' },
-      { key:'error', icon:'❌', label:'Error' }
+      { key:'error', icon:'❌', label:'Error' },
+      { key:'span', icon:'📡', label:'Span' }
     ];
     var self = this;
     el.innerHTML = types.map(function(t) {
@@ -85,7 +88,20 @@ Pages.traces = {
     }).join('');
   },
 
-  _onTaskChange(val) { this._selectedTask = val; this._selectedAgent = ''; document.getElementById('traceAgentSel').value = ''; this._load(); },
+  _onTaskChange(val) {
+    this._selectedTask = val; this._selectedAgent = ''; document.getElementById('traceAgentSel').value = '';
+    if (!val) this._waterfall = false;
+    var btn = document.getElementById('traceWaterfallBtn');
+    if (btn) btn.style.display = val ? '' : 'none';
+    this._load();
+  },
+
+  _toggleWaterfall() {
+    this._waterfall = !this._waterfall;
+    var btn = document.getElementById('traceWaterfallBtn');
+    if (btn) btn.textContent = this._waterfall ? '☰ Timeline' : '▤ Waterfall';
+    this._load();
+  },
   _onAgentChange(val) { this._selectedAgent = val; this._selectedTask = ''; document.getElementById('traceTaskSel').value = ''; this._load(); },
 
   _toggleAutoRefresh(on) {
@@ -99,17 +115,18 @@ Pages.traces = {
       var el = document.getElementById('traceTimeline');
       if (el) el.innerHTML = '<div class="loading-state"><div class="spinner"></div><span>Loading...</span></div>';
     }
+    if (this._waterfall && this._selectedTask) return this._loadWaterfall();
     try {
       var activeTypes = Object.keys(this._filters).filter(function(k){ return Pages.traces._filters[k]; });
       var url;
       if (this._selectedTask) {
         url = '/api/tasks/' + this._selectedTask + '/traces?limit=200';
-        if (activeTypes.length < 5) url += '&type=' + activeTypes.join(',');
+        if (activeTypes.length < Object.keys(this._filters).length) url += '&type=' + activeTypes.join(',');
       } else if (this._selectedAgent) {
         url = '/api/agents/' + this._selectedAgent + '/traces?limit=200';
       } else {
         url = '/api/tasks/traces?limit=200';
-        if (activeTypes.length < 5) url += '&type=' + activeTypes.join(',');
+        if (activeTypes.length < Object.keys(this._filters).length) url += '&type=' + activeTypes.join(',');
       }
       this._traces = await apiFetch(url) || [];
       // client-side filter by type
@@ -142,19 +159,19 @@ Pages.traces = {
       el.innerHTML = '<div class="empty-state"><div class="empty-state-title">No traces found</div><div class="empty-state-desc">Select a task or agent, or adjust filters.</div></div>';
       return;
     }
-    var icons = { tool_call:'🔧', llm_invoke:'🧠', sub_agent_spawn:'🔀', file_change:'📁', error:'❌' };
+    var icons = { tool_call:'🔧', llm_invoke:'🧠', sub_agent_spawn:'🔀', file_change:'📁', error:'❌', span:'📡' };
     var self = this;
     el.innerHTML = '<div style="position:relative;padding-left:28px">' +
       '<div style="position:absolute;left:12px;top:0;bottom:0;width:2px;background:var(--border)"></div>' +
       this._traces.map(function(t, i) {
         var icon = icons[t.trace_type] || '📌';
-        var ts = new Date(t.timestamp || t.created_at);
+        var ts = new Date(t.start_time || t.timestamp || t.created_at);
         var timeStr = ts.toLocaleTimeString([], {hour:'2-digit',minute:'2-digit',second:'2-digit'});
         var dateStr = ts.toLocaleDateString();
         var expanded = self._expanded[i];
         var contentJson = '';
         if (t.content || t.data || t.metadata) {
-          try { contentJson = JSON.stringify(t.content || t.data || t.metadata, null, 2); } catch(_) { contentJson = String(t.content || t.data || ''); }
+          try { contentJson = JSON.stringify(t.attributes ? { attributes: t.attributes, content: t.content } : (t.content || t.data || t.metadata), null, 2); } catch(_) { contentJson = String(t.content || t.data || ''); }
         }
         return '<div style="position:relative;margin-bottom:12px">' +
           '<div style="position:absolute;left:-22px;top:6px;width:12px;height:12px;border-radius:50%;background:var(--bg-secondary);border:2px solid var(--border);display:flex;align-items:center;justify-content:center;font-size:8px">' + icon + '</div>' +
@@ -162,6 +179,7 @@ Pages.traces = {
             '<div style="display:flex;align-items:center;gap:8px;flex-wrap:wrap">' +
               '<span style="font-size:16px">' + icon + '</span>' +
               '<span style="font-weight:600;font-size:13px;color:var(--text-primary)">' + Utils.esc(t.trace_type) + '</span>' +
+              (t.name ? '<span style="font-size:12px;color:var(--text-secondary);font-family:monospace">' + Utils.esc(t.name) + '</span>' : '') +
               (t.agent_name || t.agent_id ? '<span style="font-size:11px;padding:2px 8px;border-radius:9px;background:var(--accent-muted,rgba(99,102,241,0.12));color:var(--accent,#6366f1)">' + Utils.esc(t.agent_name || t.agent_id) + '</span>' : '') +
               (t.duration_ms ? '<span style="font-size:11px;padding:2px 6px;border-radius:9px;background:var(--bg-elevated,#1a1a2e);color:var(--text-secondary)">' + t.duration_ms + 'ms</span>' : '') +
               '<span style="margin-left:auto;font-size:11px;color:var(--text-tertiary)">' + Utils.esc(dateStr + ' ' + timeStr) + '</span>' +
@@ -172,6 +190,63 @@ Pages.traces = {
     '</div>';
   },
 
+  async _loadWaterfall() {
+    var el = document.getElementById('traceTimeline');
+    try {
+      var tree = await apiFetch('/api/tasks/' + this._selectedTask + '/traces/tree');
+      this._renderWaterfall(tree);
+    } catch(e) {
+      if (el) el.innerHTML = '<div class="empty-state"><div class="empty-state-title">Failed to load waterfall</div><div class="empty-state-desc">'+Utils.esc(e.message)+'</div></div>';
+    }
+  },
+
+  _renderWaterfall(tree) {
+    var stats = document.getElementById('traceStats');
+    var el = document.getElementById('traceTimeline');
+    if (!el) return;
+    var box = function(label, value, color) {
+      return '<div style="background:var(--bg-secondary);border:1px solid var(--border);border-radius:8px;padding:10px 16px;font-size:13px"><span style="color:var(--text-tertiary)">' + label + '</span><div style="font-size:20px;font-weight:700;color:' + (color || 'var(--text-primary)') + '">' + value + '</div></div>';
+    };
+    if (stats) stats.innerHTML = box('Spans', tree.span_count) + box('Wall Clock', Math.round(tree.total_ms) + 'ms') +
+      box('Busy', Math.round(tree.busy_ms) + 'ms') + box('Idle', Math.round(tree.idle_ms) + 'ms') +
+      box('Errors', tree.errors, tree.errors ? 'var(--red,#ef4444)' : '');
+    if (!tree.span_count) {
+      el.innerHTML = '<div class="empty-state"><div class="empty-state-title">No traces for this task</div></div>';
+      return;
+    }
+
+    var icons = { tool_call:'🔧', llm_invoke:'🧠', sub_agent_spawn:'🔀', file_change:'📁', error:'❌', span:'📡' };
+    var total = tree.total_ms || 1;
+    var rows = [];
+    var walk = function(nodes) {
+      nodes.forEach(function(n) {
+        var left = (n.offset_ms / total * 100).toFixed(2);
+        var width = Math.max(n.duration_ms / total * 100, 0.3).toFixed(2);
+        var color = n.status === 'error' ? 'var(--red,#ef4444)' : (n.on_critical_path ? 'var(--accent,#6366f1)' : 'var(--text-tertiary)');
+        rows.push('<div style="display:flex;align-items:center;gap:8px;font-size:12px;padding:2px 0" title="self ' + n.self_ms + 'ms · children ' + n.child_ms + 'ms · critical ' + n.critical_ms + 'ms">' +
+          '<div style="width:38%;white-space:nowrap;overflow:hidden;text-overflow:ellipsis;padding-left:' + (n.depth * 14) + 'px;color:var(--text-primary)">' +
+            (icons[n.trace_type] || '📌') + ' ' + Utils.esc(n.name || n.trace_type) +
+            (n.agent_id ? ' <span style="color:var(--text-tertiary)">' + Utils.esc(n.agent_id) + '</span>' : '') + '</div>' +
+          '<div style="flex:1;position:relative;height:14px;background:var(--bg-primary);border-radius:3px">' +
+            '<div style="position:absolute;left:' + left + '%;width:' + width + '%;top:2px;bottom:2px;border-radius:2px;background:' + color + ';opacity:' + (n.on_critical_path ? 1 : 0.5) + '"></div></div>' +
+          '<div style="width:90px;text-align:right;color:var(--text-secondary)">' + n.duration_ms + 'ms</div>' +
+        '</div>');
+        walk(n.children || []);
+      });
+    };
+    walk(tree.roots || []);
+
+    var rollup = '<table class="table" style="margin-top:16px;font-size:12px"><thead><tr><th>Type</th><th>Count</th><th>Errors</th><th>Total</th><th>Self</th><th>Critical</th><th>Self %</th></tr></thead><tbody>' +
+      (tree.by_type || []).map(function(r) {
+        return '<tr><td>' + (icons[r.trace_type] || '📌') + ' ' + Utils.esc(r.trace_type) + '</td><td>' + r.count + '</td><td>' + r.errors + '</td><td>' +
+          Math.round(r.total_ms) + 'ms</td><td>' + Math.round(r.self_ms) + 'ms</td><td>' + Math.round(r.critical_ms) + 'ms</td><td>' + r.self_pct + '%</td></tr>';
+      }).join('') + '</tbody></table>';
+
+    el.innerHTML = '<div style="background:var(--bg-secondary);border:1px solid var(--border);border-radius:8px;padding:12px">' +
+      '<div style="font-size:11px;color:var(--text-tertiary);margin-bottom:8px">Highlighted spans are on the critical path. Hover a span for self / child time.</div>' +
+      rows.join('') + '</div>' + rollup;
+  },
+
   _toggle(i) {
     this._expanded[i] = !this._expanded[i];
     this._renderTimeline();